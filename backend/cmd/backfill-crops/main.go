@@ -0,0 +1,39 @@
+// backfill-crops 一次性将已有识别结果、候选与标注的作物名归一化到作物目录代码
+package main
+
+import (
+	"agri-scan/internal/config"
+	"agri-scan/internal/repository"
+	"agri-scan/internal/service"
+	"flag"
+	"fmt"
+	"log"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "只统计不写入")
+	flag.Parse()
+
+	cfg := config.Load()
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		cfg.Database.Host,
+		cfg.Database.User,
+		cfg.Database.Password,
+		cfg.Database.DBName,
+		cfg.Database.Port,
+		cfg.Database.SSLMode,
+	)
+	repo, err := repository.NewRepository(dsn)
+	if err != nil {
+		log.Fatalf("Failed to connect database: %v", err)
+	}
+
+	svc := service.NewService(repo, nil, nil)
+	stats, err := svc.BackfillCropNormalization(*dryRun)
+	if err != nil {
+		log.Fatalf("Backfill failed: %v", err)
+	}
+	log.Printf("results=%d changed=%d labels=%d changed=%d unknown=%d dry_run=%v",
+		stats.Results, stats.ResultsChanged, stats.Labels, stats.LabelsChanged, stats.Unknown, *dryRun)
+}
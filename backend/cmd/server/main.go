@@ -10,6 +10,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -90,20 +93,74 @@ func main() {
 
 	// 注册 OpenAI 兼容 Provider
 	if cfg.LLM.APIKey != "" {
-		llm.RegisterProvider("openai", llm.NewOpenAIProvider(cfg.LLM.APIKey, cfg.LLM.Endpoint, cfg.LLM.Model, cfg.LLM.ImageInput))
+		llm.RegisterProvider("openai", llm.NewOpenAIProvider(cfg.LLM.APIKey, cfg.LLM.Endpoint, cfg.LLM.Model, cfg.LLM.ImageInput, cfg.LLM.Structured))
 		log.Println("OpenAI provider registered")
 	}
 
-	// 获取配置的提供商
-	provider, err := llm.GetProvider(cfg.LLM.Provider)
+	// 注册通义千问（DashScope）Provider
+	if cfg.LLM.Qwen.APIKey != "" {
+		llm.RegisterProvider("qwen", llm.NewQwenProvider(cfg.LLM.Qwen.APIKey, cfg.LLM.Qwen.Endpoint, cfg.LLM.Qwen.Model, cfg.LLM.Qwen.ImageInput, cfg.LLM.Qwen.Workspace))
+		log.Println("Qwen provider registered")
+	}
+
+	// 注册百度植物识别 Provider
+	if cfg.LLM.Baidu.APIKey != "" && cfg.LLM.Baidu.SecretKey != "" {
+		llm.RegisterProvider("baidu", llm.NewBaiduProvider(cfg.LLM.Baidu.APIKey, cfg.LLM.Baidu.SecretKey, cfg.LLM.Baidu.Endpoint))
+		log.Println("Baidu provider registered")
+	}
+
+	// 组装路由提供商：主提供商 + 回退链，未注册的提供商直接报错，不再静默退回 mock
+	chain := []string{cfg.LLM.Provider}
+	for _, name := range strings.Split(cfg.LLM.Fallback, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != cfg.LLM.Provider {
+			chain = append(chain, name)
+		}
+	}
+	timeouts, err := llm.ParseTimeouts(cfg.LLM.Timeouts)
+	if err != nil {
+		log.Fatalf("Invalid LLM_PROVIDER_TIMEOUTS: %v", err)
+	}
+	defaultTimeout, err := time.ParseDuration(cfg.LLM.Timeout)
+	if err != nil {
+		log.Fatalf("Invalid LLM_TIMEOUT: %v", err)
+	}
+	rules, err := llm.ParseRouteRules(cfg.LLM.Routes)
+	if err != nil {
+		log.Fatalf("Invalid LLM_ROUTES: %v", err)
+	}
+	breakerCfg, err := parseBreakerConfig(cfg.LLM.Breaker)
 	if err != nil {
-		log.Printf("Warning: Provider %s not found, using mock", cfg.LLM.Provider)
-		provider = llm.NewMockProvider()
+		log.Fatalf("Invalid LLM breaker config: %v", err)
 	}
+	llm.ConfigureBreakers(breakerCfg)
+	provider, err := llm.NewRouterProvider(llm.RouterConfig{
+		Chain:          chain,
+		Timeouts:       timeouts,
+		DefaultTimeout: defaultTimeout,
+		Rules:          rules,
+	})
+	if err != nil {
+		log.Fatalf("Failed to init LLM provider chain %v: %v", chain, err)
+	}
+	log.Printf("LLM provider chain: %s", strings.Join(provider.Chain(), " -> "))
 
 	// 初始化服务
 	svc := service.NewService(repo, provider, stor)
 	svc.StartRetentionWorker(context.Background())
+	svc.StartJobWorkers(context.Background())
+	svc.StartBackfillRunner(context.Background())
+	svc.StartIdempotencyJanitor(context.Background())
+	svc.StartQuotaReaper(context.Background())
+	svc.StartWebhookDispatcher(context.Background())
+	probeInterval, err := time.ParseDuration(cfg.LLM.Breaker.ProbeInterval)
+	if err != nil {
+		log.Fatalf("Invalid LLM_HEALTH_PROBE_INTERVAL: %v", err)
+	}
+	probeTimeout, err := time.ParseDuration(cfg.LLM.Breaker.ProbeTimeout)
+	if err != nil {
+		log.Fatalf("Invalid LLM_HEALTH_PROBE_TIMEOUT: %v", err)
+	}
+	llm.StartHealthProber(context.Background(), probeInterval, probeTimeout)
 
 	// 初始化处理器
 	h := handler.NewHandler(svc)
@@ -120,8 +177,8 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", "X-Auth-Token", "X-Device-ID"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", "X-Auth-Token", "X-Device-ID", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
@@ -134,3 +191,22 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// parseBreakerConfig 解析熔断配置
+func parseBreakerConfig(c config.BreakerConfig) (llm.BreakerConfig, error) {
+	out := llm.DefaultBreakerConfig
+	var err error
+	if out.ErrorRate, err = strconv.ParseFloat(c.ErrorRate, 64); err != nil || out.ErrorRate <= 0 || out.ErrorRate > 1 {
+		return out, fmt.Errorf("LLM_BREAKER_ERROR_RATE must be in (0,1]: %q", c.ErrorRate)
+	}
+	if out.MinRequests, err = strconv.Atoi(c.MinRequests); err != nil || out.MinRequests < 1 {
+		return out, fmt.Errorf("LLM_BREAKER_MIN_REQUESTS must be positive: %q", c.MinRequests)
+	}
+	if out.Window, err = time.ParseDuration(c.Window); err != nil || out.Window <= 0 {
+		return out, fmt.Errorf("LLM_BREAKER_WINDOW must be a positive duration: %q", c.Window)
+	}
+	if out.OpenDuration, err = time.ParseDuration(c.Cooldown); err != nil || out.OpenDuration <= 0 {
+		return out, fmt.Errorf("LLM_BREAKER_COOLDOWN must be a positive duration: %q", c.Cooldown)
+	}
+	return out, nil
+}
@@ -58,6 +58,40 @@ type LLMConfig struct {
 	Endpoint   string
 	Model      string
 	ImageInput string // url, base64, auto
+	Structured bool   // OpenAI 兼容端点使用 json_schema 结构化输出
+	Fallback   string // 逗号分隔的回退链，如 openai,qwen
+	Timeouts   string // 单个提供商超时，如 openai=30s,qwen=20s
+	Timeout    string // 默认单次调用超时
+	Routes     string // JSON 路由规则，按套餐/来源/图片大小选择提供商
+	Breaker    BreakerConfig
+	Qwen       QwenConfig
+	Baidu      BaiduConfig
+}
+
+// BreakerConfig 提供商熔断与健康探测配置
+type BreakerConfig struct {
+	ErrorRate     string // 窗口内错误率达到该值时打开熔断
+	MinRequests   string // 窗口内最少请求数，不足时不判断
+	Window        string // 错误率统计窗口
+	Cooldown      string // 打开后多久进入半开
+	ProbeInterval string // 健康探测间隔，0 关闭
+	ProbeTimeout  string
+}
+
+// QwenConfig 阿里云百炼 DashScope 配置
+type QwenConfig struct {
+	APIKey     string
+	Endpoint   string
+	Model      string
+	ImageInput string
+	Workspace  string
+}
+
+// BaiduConfig 百度智能云图像识别配置
+type BaiduConfig struct {
+	APIKey    string
+	SecretKey string
+	Endpoint  string
 }
 
 func Load() *Config {
@@ -102,6 +136,31 @@ func Load() *Config {
 			Endpoint:   getEnv("LLM_ENDPOINT", "https://api.openai.com/v1"),
 			Model:      getEnv("LLM_MODEL", "gpt-4o"),
 			ImageInput: getEnv("LLM_IMAGE_INPUT", "auto"),
+			Structured: getEnv("LLM_STRUCTURED_OUTPUT", "true") == "true",
+			Fallback:   getEnv("LLM_FALLBACK", ""),
+			Timeouts:   getEnv("LLM_PROVIDER_TIMEOUTS", ""),
+			Timeout:    getEnv("LLM_TIMEOUT", "45s"),
+			Routes:     getEnv("LLM_ROUTES", ""),
+			Breaker: BreakerConfig{
+				ErrorRate:     getEnv("LLM_BREAKER_ERROR_RATE", "0.5"),
+				MinRequests:   getEnv("LLM_BREAKER_MIN_REQUESTS", "10"),
+				Window:        getEnv("LLM_BREAKER_WINDOW", "60s"),
+				Cooldown:      getEnv("LLM_BREAKER_COOLDOWN", "30s"),
+				ProbeInterval: getEnv("LLM_HEALTH_PROBE_INTERVAL", "60s"),
+				ProbeTimeout:  getEnv("LLM_HEALTH_PROBE_TIMEOUT", "10s"),
+			},
+			Qwen: QwenConfig{
+				APIKey:     getEnv("DASHSCOPE_API_KEY", ""),
+				Endpoint:   getEnv("DASHSCOPE_ENDPOINT", "https://dashscope.aliyuncs.com"),
+				Model:      getEnv("DASHSCOPE_MODEL", "qwen-vl-max"),
+				ImageInput: getEnv("DASHSCOPE_IMAGE_INPUT", "auto"),
+				Workspace:  getEnv("DASHSCOPE_WORKSPACE", ""),
+			},
+			Baidu: BaiduConfig{
+				APIKey:    getEnv("BAIDU_API_KEY", ""),
+				SecretKey: getEnv("BAIDU_SECRET_KEY", ""),
+				Endpoint:  getEnv("BAIDU_ENDPOINT", "https://aip.baidubce.com"),
+			},
 		},
 	}
 }
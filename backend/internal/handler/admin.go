@@ -3,6 +3,8 @@ package handler
 import (
 	"agri-scan/internal/service"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -161,6 +163,164 @@ func (h *Handler) AdminUpdateSetting(c *gin.Context) {
 	c.JSON(http.StatusOK, item)
 }
 
+// GET /api/v1/admin/prompts
+func (h *Handler) AdminPromptTemplates(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListPromptTemplates(c.Query("name"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// POST /api/v1/admin/prompts
+func (h *Handler) AdminCreatePromptTemplate(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req service.PromptTemplateCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	item, err := h.svc.CreatePromptTemplate(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("create_prompt", "prompt", item.ID, fmt.Sprintf("%s v%d", item.Name, item.Version), c.ClientIP())
+	c.JSON(http.StatusOK, item)
+}
+
+// POST /api/v1/admin/prompts/:id/activate
+func (h *Handler) AdminActivatePromptTemplate(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	item, err := h.svc.ActivatePromptTemplate(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "prompt not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("activate_prompt", "prompt", item.ID, fmt.Sprintf("%s v%d", item.Name, item.Version), c.ClientIP())
+	c.JSON(http.StatusOK, item)
+}
+
+// GET /api/v1/admin/crops/unknown
+func (h *Handler) AdminUnknownCrops(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListUnknownCrops(c.DefaultQuery("status", "pending"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// POST /api/v1/admin/crops/unknown/:id/resolve
+func (h *Handler) AdminResolveUnknownCrop(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Code     string `json:"code"`
+		AddAlias bool   `json:"add_alias"`
+		Reviewer string `json:"reviewer"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	affected, err := h.svc.ResolveUnknownCrop(uint(id), req.Code, req.AddAlias, req.Reviewer)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown crop not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	detail := "ignored"
+	if strings.TrimSpace(req.Code) != "" {
+		detail = fmt.Sprintf("mapped to %s, %d rows", strings.TrimSpace(req.Code), affected)
+	}
+	h.svc.RecordAdminAudit("resolve_unknown_crop", "unknown_crop", uint(id), detail, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"ok": true, "affected": affected})
+}
+
+// POST /api/v1/admin/calibration/refit
+func (h *Handler) AdminRefitCalibration(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req service.CalibrationRefitRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	out, err := h.svc.RefitCalibration(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCalibrationMethod) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("refit_calibration", "calibration", 0, fmt.Sprintf("%d samples, %d maps, %d reapplied", out.Samples, len(out.Maps), out.Reapplied), c.ClientIP())
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/v1/admin/calibration/maps
+func (h *Handler) AdminCalibrationMaps(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	items, err := h.svc.ListCalibrationMaps(c.Query("provider"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items})
+}
+
+// GET /api/v1/admin/calibration/reliability
+func (h *Handler) AdminCalibrationReliability(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "90"))
+	report, err := h.svc.GetReliabilityReport(c.Query("provider"), c.Query("crop_type"), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 // GET /api/v1/admin/plan-settings
 func (h *Handler) AdminPlanSettings(c *gin.Context) {
 	if !h.requireAdmin(c) {
@@ -919,7 +1079,12 @@ func (h *Handler) AdminSearchResults(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration range"})
 		return
 	}
-	items, err := h.svc.SearchResults(limit, offset, provider, cropType, source, minConf, maxConf, minDuration, maxDuration, startDate, endDate)
+	filter, err := resultFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	items, err := h.svc.SearchResults(limit, offset, provider, cropType, source, minConf, maxConf, minDuration, maxDuration, startDate, endDate, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1070,9 +1235,10 @@ func (h *Handler) AdminRunEvalSet(c *gin.Context) {
 	}
 	var req struct {
 		BaselineID *uint `json:"baseline_id"`
+		BackfillID *uint `json:"backfill_id"`
 	}
 	_ = c.ShouldBindJSON(&req)
-	run, err := h.svc.RunEvalSet(uint(id), req.BaselineID)
+	run, err := h.svc.RunEvalSet(uint(id), req.BaselineID, req.BackfillID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1286,3 +1452,114 @@ func (h *Handler) AdminExportFailures(c *gin.Context) {
 		c.Status(http.StatusInternalServerError)
 	}
 }
+
+// GET /api/v1/admin/usage/summary
+func (h *Handler) AdminUsageSummary(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	group := strings.TrimSpace(c.DefaultQuery("group", "provider"))
+	items, err := h.svc.SummarizeUsage(group, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "group": group})
+}
+
+// GET /api/v1/admin/providers/health
+func (h *Handler) AdminProviderHealth(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	probe := c.DefaultQuery("probe", "false") == "true"
+	items := h.svc.ProviderHealth(c.Request.Context(), probe)
+	c.JSON(http.StatusOK, gin.H{"results": items})
+}
+
+// GET /api/v1/admin/shadow/report
+func (h *Handler) AdminShadowReport(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	items, err := h.svc.GetShadowReport(startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items})
+}
+
+// GET /api/v1/admin/shadow/results
+func (h *Handler) AdminShadowResults(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var agreed *bool
+	if raw := strings.TrimSpace(c.Query("agreed")); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agreed"})
+			return
+		}
+		agreed = &v
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListShadowResults(startDate, endDate, c.Query("provider"), agreed, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/admin/export/usage
+func (h *Handler) AdminExportUsage(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "csv")))
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var userID uint
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID = uint(v)
+	}
+	if format == "json" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename=usage.json")
+		if err := h.svc.ExportUsageJSON(c.Writer, userID, startDate, endDate); err != nil {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=usage.csv")
+	if err := h.svc.ExportUsageCSV(c.Writer, userID, startDate, endDate); err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -245,10 +245,12 @@ func mapEntitlementError(c *gin.Context, err error) {
 	}
 }
 
-func (h *Handler) consumeRecognition(c *gin.Context, actor *Actor) bool {
-	if err := h.svc.ConsumeRecognition(actor.User, actor.DeviceID); err != nil {
+// reserveRecognition 调用提供商前预占一次识别，失败时写出响应
+func (h *Handler) reserveRecognition(c *gin.Context, actor *Actor, source string) (*model.QuotaReservation, bool) {
+	reservation, err := h.svc.ReserveRecognition(actor.User, actor.DeviceID, source)
+	if err != nil {
 		mapEntitlementError(c, err)
-		return false
+		return nil, false
 	}
-	return true
+	return reservation, true
 }
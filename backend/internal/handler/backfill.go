@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"agri-scan/internal/service"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUserID 通过登录令牌进入后台时返回管理员用户 ID，使用 X-Admin-Token 时为 0
+func (h *Handler) adminUserID(c *gin.Context) uint {
+	user, err := h.svc.GetUserByToken(strings.TrimSpace(c.GetHeader("X-Auth-Token")))
+	if err != nil || user == nil {
+		return 0
+	}
+	return user.ID
+}
+
+// POST /api/v1/admin/backfills
+func (h *Handler) AdminCreateBackfill(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req struct {
+		Provider      string `json:"provider"`
+		PromptVersion int    `json:"prompt_version"`
+		Mode          string `json:"mode"`
+		Promote       bool   `json:"promote"`
+		RatePerMinute int    `json:"rate_per_minute"`
+		Filters       struct {
+			StartDate string `json:"start_date"`
+			EndDate   string `json:"end_date"`
+			CropType  string `json:"crop_type"`
+			Provider  string `json:"provider"`
+			Source    string `json:"source"`
+			EvalSetID *uint  `json:"eval_set_id"`
+		} `json:"filters"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	startDate, endDate, err := parseDateRange(strings.TrimSpace(req.Filters.StartDate), strings.TrimSpace(req.Filters.EndDate))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	view, err := h.svc.CreateBackfill(h.adminUserID(c), service.BackfillCreate{
+		Provider:      req.Provider,
+		PromptVersion: req.PromptVersion,
+		Mode:          req.Mode,
+		Promote:       req.Promote,
+		RatePerMinute: req.RatePerMinute,
+		Filter: service.BackfillFilter{
+			StartDate: startDate,
+			EndDate:   endDate,
+			CropType:  req.Filters.CropType,
+			Provider:  req.Filters.Provider,
+			Source:    req.Filters.Source,
+			EvalSetID: req.Filters.EvalSetID,
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("create_backfill", "backfill", view.ID, view.Provider, c.ClientIP())
+	c.JSON(http.StatusOK, view)
+}
+
+// GET /api/v1/admin/backfills
+func (h *Handler) AdminListBackfills(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListBackfills(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/admin/backfills/:id
+func (h *Handler) AdminGetBackfill(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	view, err := h.svc.GetBackfill(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backfill not found"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// POST /api/v1/admin/backfills/:id/start|pause|resume|cancel
+func (h *Handler) AdminBackfillAction(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	actions := map[string]func(uint) (service.BackfillView, error){
+		"start":  h.svc.StartBackfill,
+		"pause":  h.svc.PauseBackfill,
+		"resume": h.svc.ResumeBackfill,
+		"cancel": h.svc.CancelBackfill,
+	}
+	action := path.Base(c.FullPath())
+	fn, ok := actions[action]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown action"})
+		return
+	}
+	view, err := fn(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrBackfillState) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit(action+"_backfill", "backfill", view.ID, view.Status, c.ClientIP())
+	c.JSON(http.StatusOK, view)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"agri-scan/internal/model"
+	"agri-scan/internal/service"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/v1/admin/experiments
+func (h *Handler) AdminCreateExperiment(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Unit        string `json:"unit"`
+		Arms        []struct {
+			Name          string `json:"name"`
+			Provider      string `json:"provider"`
+			Model         string `json:"model"`
+			PromptVersion int    `json:"prompt_version"`
+			Weight        int    `json:"weight"`
+		} `json:"arms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	input := service.ExperimentCreate{
+		Name:        req.Name,
+		Description: req.Description,
+		Unit:        req.Unit,
+	}
+	for _, arm := range req.Arms {
+		input.Arms = append(input.Arms, service.ExperimentArmInput{
+			Name:          arm.Name,
+			Provider:      arm.Provider,
+			Model:         arm.Model,
+			PromptVersion: arm.PromptVersion,
+			Weight:        arm.Weight,
+		})
+	}
+	exp, err := h.svc.CreateExperiment(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("create_experiment", "experiment", exp.ID, exp.Name, c.ClientIP())
+	c.JSON(http.StatusOK, exp)
+}
+
+// GET /api/v1/admin/experiments
+func (h *Handler) AdminListExperiments(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListExperiments(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/admin/experiments/:id
+func (h *Handler) AdminGetExperiment(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	exp, err := h.svc.GetExperiment(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "experiment not found"})
+		return
+	}
+	c.JSON(http.StatusOK, exp)
+}
+
+// POST /api/v1/admin/experiments/:id/start|stop
+func (h *Handler) AdminExperimentAction(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	actions := map[string]func(uint) (*model.Experiment, error){
+		"start": h.svc.StartExperiment,
+		"stop":  h.svc.StopExperiment,
+	}
+	action := path.Base(c.FullPath())
+	fn, ok := actions[action]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown action"})
+		return
+	}
+	exp, err := fn(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrExperimentState) || errors.Is(err, service.ErrExperimentRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit(action+"_experiment", "experiment", exp.ID, exp.Status, c.ClientIP())
+	c.JSON(http.StatusOK, exp)
+}
+
+// GET /api/v1/admin/experiments/:id/report
+func (h *Handler) AdminExperimentReport(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := h.svc.GetExperimentReport(uint(id), startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "experiment not found"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -4,6 +4,7 @@ import (
 	"agri-scan/internal/llm"
 	"agri-scan/internal/model"
 	"agri-scan/internal/service"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -30,6 +31,7 @@ type UploadResponse struct {
 	ImageID       uint   `json:"image_id"`
 	OriginalURL   string `json:"original_url"`
 	CompressedURL string `json:"compressed_url"`
+	ThumbnailURL  string `json:"thumbnail_url"`
 }
 
 // RecognizeResponse 识别响应
@@ -37,60 +39,186 @@ type RecognizeResponse struct {
 	RawText        string   `json:"raw_text"`
 	ResultID       uint     `json:"result_id"`
 	ImageID        uint     `json:"image_id"`
+	Version        int      `json:"version"`
+	IsCurrent      bool     `json:"is_current"`
 	CropType       string   `json:"crop_type"`
+	CropTypeRaw    string   `json:"crop_type_raw,omitempty"`
 	Confidence     float64  `json:"confidence"`
+	CalibratedConfidence *float64 `json:"calibrated_confidence"`
 	ConfidenceLow  float64  `json:"confidence_low"`
 	ConfidenceHigh float64  `json:"confidence_high"`
 	Description    string   `json:"description"`
 	GrowthStage    *string  `json:"growth_stage"`
+	GrowthStageCode *string `json:"growth_stage_code"`
 	PossibleIssue  *string  `json:"possible_issue"`
 	Provider       string   `json:"provider"`
 	ImageURL       string   `json:"image_url,omitempty"`
+	ThumbnailURL   string   `json:"thumbnail_url,omitempty"`
 	Latitude       *float64 `json:"latitude,omitempty"`
 	Longitude      *float64 `json:"longitude,omitempty"`
 	RiskLevel      string   `json:"risk_level"`
 	RiskNote       string   `json:"risk_note"`
 	FeedbackCorrect *bool    `json:"feedback_correct,omitempty"`
 	Source         string   `json:"source,omitempty"`
+	CacheHit       bool     `json:"cache_hit"`
 	DurationMs     int      `json:"duration_ms,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	PromptVersion  int      `json:"prompt_version,omitempty"`
+	Mode           string   `json:"mode,omitempty"`
+	Findings       []FindingView `json:"findings"`
+	Candidates     []CandidateView `json:"candidates,omitempty"`
+	Votes          []VoteView      `json:"votes,omitempty"` // 多提供商投票时每个提供商的作答
+}
+
+// VoteView 多提供商投票中单个提供商的作答
+type VoteView struct {
+	Provider   string  `json:"provider"`
+	Weight     float64 `json:"weight"`
+	CropType   string  `json:"crop_type"`
+	Confidence float64 `json:"confidence"`
+	Agreed     bool    `json:"agreed"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs int     `json:"duration_ms"`
+}
+
+// CandidateView 候选作物，rank 从 1 开始
+type CandidateView struct {
+	Rank       int     `json:"rank"`
+	CropType   string  `json:"crop_type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// FindingView 病害/虫害/杂草结论
+type FindingView struct {
+	Category   string  `json:"category"`
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
 }
 
 type RecognizeURLRequest struct {
 	ImageURL string `json:"image_url" binding:"required"`
 	Source   string `json:"source"`
+	Mode     string `json:"mode"`
+}
+
+func toFindingViews(items []model.RecognitionFinding) []FindingView {
+	out := make([]FindingView, 0, len(items))
+	for _, item := range items {
+		out = append(out, FindingView{Category: item.Category, Name: item.Name, Confidence: item.Confidence})
+	}
+	return out
+}
+
+func toVoteViews(items []model.EnsembleVote) []VoteView {
+	out := make([]VoteView, 0, len(items))
+	for _, item := range items {
+		out = append(out, VoteView{
+			Provider:   item.Provider,
+			Weight:     item.Weight,
+			CropType:   item.CropType,
+			Confidence: item.Confidence,
+			Agreed:     item.Agreed,
+			Error:      item.Error,
+			DurationMs: item.DurationMs,
+		})
+	}
+	return out
+}
+
+func toCandidateViews(items []model.RecognitionCandidate) []CandidateView {
+	out := make([]CandidateView, 0, len(items))
+	for _, item := range items {
+		out = append(out, CandidateView{Rank: item.Rank, CropType: item.CropType, Confidence: item.Confidence})
+	}
+	return out
+}
+
+// resultFilterFromQuery 解析 mode/finding_category/finding/growth_stage/min_stage/max_stage 过滤参数
+func resultFilterFromQuery(c *gin.Context) (service.ResultFilter, error) {
+	return service.NormalizeResultFilter(service.ResultFilter{
+		Mode:            c.Query("mode"),
+		FindingCategory: c.Query("finding_category"),
+		FindingName:     c.Query("finding"),
+		GrowthStage:     c.Query("growth_stage"),
+		MinStage:        c.Query("min_stage"),
+		MaxStage:        c.Query("max_stage"),
+	})
 }
 
 const recognizeRetryMax = 2
-const recognizeRetryDelay = 300 * time.Millisecond
 
+// 重试退避：基准间隔按次数翻倍并加随机抖动，上游 Retry-After 超过上限时不再重试
+const recognizeRetryBase = 300 * time.Millisecond
+const recognizeRetryMaxDelay = 5 * time.Second
+
+// shouldRetryRecognize 由 llm 返回的错误类型判断是否可重试，熔断与调用方错误直接失败
 func shouldRetryRecognize(err error) bool {
-	if err == nil {
+	if err == nil || llm.IsCircuitOpen(err) {
 		return false
 	}
-	msg := strings.ToLower(err.Error())
-	if strings.Contains(msg, "invalid_request") ||
-		strings.Contains(msg, "invalid_parameter") ||
-		strings.Contains(msg, "invalid") ||
-		strings.Contains(msg, "unauthorized") ||
-		strings.Contains(msg, "forbidden") ||
-		strings.Contains(msg, "not found") {
-		return false
+	return llm.Retryable(err)
+}
+
+// recognizeRetryDelay 第 attempt 次失败后的等待时间，ok 为 false 表示上游要求等待过久
+func recognizeRetryDelay(attempt int, err error) (time.Duration, bool) {
+	if after := llm.RetryAfter(err); after > 0 {
+		return after, after <= recognizeRetryMaxDelay
+	}
+	return llm.Backoff(attempt, recognizeRetryBase, recognizeRetryMaxDelay), true
+}
+
+// recognizeWithRetry 调用识别并对可重试错误重试，ctx 取消或超时后立即返回
+func (h *Handler) recognizeWithRetry(ctx context.Context, actor *Actor, img *model.Image, opts service.RecognizeOptions) (*llm.RecognitionResult, error) {
+	var lastErr error
+	for attempt := 1; attempt <= recognizeRetryMax; attempt++ {
+		result, err := h.svc.Recognize(ctx, actor.User, img, opts)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		h.svc.RecordFailure(actor.UserID, &img.ID, "", "recognize", err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if attempt < recognizeRetryMax && shouldRetryRecognize(err) {
+			delay, ok := recognizeRetryDelay(attempt, err)
+			if !ok {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(delay):
+			}
+			continue
+		}
+		break
+	}
+	return nil, lastErr
+}
+
+// requestLocale 取 Accept-Language 的首选语言，用于提示词模板
+func requestLocale(c *gin.Context) string {
+	lang := strings.TrimSpace(c.GetHeader("Accept-Language"))
+	if i := strings.IndexAny(lang, ",;"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "*" {
+		return "zh-CN"
+	}
+	return lang
+}
+
+// recognizeErrorStatus 识别失败的状态码：客户端断开 499，整体超时 504
+func recognizeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 499
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
 	}
-	if strings.Contains(msg, "timeout") ||
-		strings.Contains(msg, "timed out") ||
-		strings.Contains(msg, "temporary") ||
-		strings.Contains(msg, "temporarily") ||
-		strings.Contains(msg, "rate limit") ||
-		strings.Contains(msg, "429") ||
-		strings.Contains(msg, "overload") ||
-		strings.Contains(msg, "server error") ||
-		strings.Contains(msg, "status 5") ||
-		strings.Contains(msg, "connection reset") ||
-		strings.Contains(msg, "connection refused") ||
-		strings.Contains(msg, "dial tcp") {
-		return true
-	}
-	return false
 }
 
 // RecognizeByURL 使用外部图片 URL 识别
@@ -102,74 +230,59 @@ func (h *Handler) RecognizeByURL(c *gin.Context) {
 		return
 	}
 
+	mode, err := service.NormalizeMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	actor, ok := h.requireActor(c)
 	if !ok {
 		return
 	}
 
-	if !h.consumeRecognition(c, actor) {
+	ctx, cancel := h.svc.RecognizeContext(c.Request.Context())
+	defer cancel()
+
+	source := strings.TrimSpace(req.Source)
+	if source == "" {
+		source = "url"
+	}
+
+	reservation, ok := h.reserveRecognition(c, actor, source)
+	if !ok {
 		return
 	}
 
-	img, err := h.svc.CreateImageFromURL(actor.UserID, req.ImageURL)
+	img, err := h.svc.CreateImageFromURL(ctx, actor.UserID, req.ImageURL)
 	if err != nil {
+		h.svc.ReleaseRecognition(reservation, "create_image_failed")
 		h.svc.RecordFailure(actor.UserID, nil, "", "create_image_url", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(recognizeErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	started := time.Now()
-	var result *llm.RecognitionResult
-	var err error
-	for attempt := 1; attempt <= recognizeRetryMax; attempt++ {
-		result, err = h.svc.Recognize(img.OriginalURL)
-		if err == nil {
-			break
-		}
-		h.svc.RecordFailure(actor.UserID, &img.ID, "", "recognize", err)
-		if attempt < recognizeRetryMax && shouldRetryRecognize(err) {
-			time.Sleep(recognizeRetryDelay)
-			continue
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	result, err := h.recognizeWithRetry(ctx, actor, img, service.RecognizeOptions{Source: source, Locale: requestLocale(c), Mode: mode, DeviceID: actor.DeviceID})
+	if err != nil {
+		h.svc.ReleaseRecognition(reservation, service.QuotaReasonFailed)
+		c.JSON(recognizeErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	durationMs := int(time.Since(started).Milliseconds())
 
-	source := strings.TrimSpace(req.Source)
-	if source == "" {
-		source = "url"
-	}
-	savedResult, err := h.svc.SaveResult(img.ID, result, source, durationMs)
+	savedResult, err := h.svc.SaveResult(ctx, img.ID, result, source, durationMs)
 	if err != nil {
+		h.svc.ReleaseRecognition(reservation, "save_failed")
 		h.svc.RecordFailure(actor.UserID, &img.ID, "", "save_result", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 命中缓存未调用提供商，不计入识别次数
+	h.svc.SettleRecognition(reservation, savedResult)
 
 	_, _ = h.svc.CreateNote(actor.UserID, img.ID, &savedResult.ID, "", "crop", nil)
-	low, high, riskLevel, riskNote := explainConfidence(savedResult.Confidence)
-
-	c.JSON(http.StatusOK, RecognizeResponse{
-		RawText:        savedResult.RawText,
-		ResultID:       savedResult.ID,
-		ImageID:        savedResult.ImageID,
-		CropType:       savedResult.CropType,
-		Confidence:     savedResult.Confidence,
-		ConfidenceLow:  low,
-		ConfidenceHigh: high,
-		Description:    savedResult.Description,
-		GrowthStage:    savedResult.GrowthStage,
-		PossibleIssue:  savedResult.PossibleIssue,
-		Provider:       savedResult.Provider,
-		ImageURL:       img.OriginalURL,
-		Latitude:       img.Latitude,
-		Longitude:      img.Longitude,
-		RiskLevel:      riskLevel,
-		RiskNote:       riskNote,
-		Source:         savedResult.Source,
-		DurationMs:     savedResult.DurationMs,
-	})
+	c.JSON(http.StatusOK, h.recognizeResponse(savedResult, img))
 }
 
 // UploadImage 上传图片
@@ -200,7 +313,7 @@ func (h *Handler) UploadImage(c *gin.Context) {
 
 	if imageType == "base64" && imageData != "" {
 		// Base64 上传（Web 端）
-		img, err := h.svc.UploadImageBase64(actor.UserID, imageData, lat, lng)
+		img, err := h.svc.UploadImageBase64(c.Request.Context(), actor.UserID, imageData, lat, lng)
 		if err != nil {
 			log.Printf("UploadImageBase64 failed: %v", err)
 			h.svc.RecordFailure(actor.UserID, nil, "", "upload_base64", err)
@@ -211,6 +324,7 @@ func (h *Handler) UploadImage(c *gin.Context) {
 			ImageID:       img.ID,
 			OriginalURL:   img.OriginalURL,
 			CompressedURL: img.CompressedURL,
+			ThumbnailURL:  img.ThumbnailURL,
 		})
 		return
 	}
@@ -223,7 +337,7 @@ func (h *Handler) UploadImage(c *gin.Context) {
 	}
 
 	// 上传到对象存储
-	img, err := h.svc.UploadImage(actor.UserID, file, lat, lng)
+	img, err := h.svc.UploadImage(c.Request.Context(), actor.UserID, file, lat, lng)
 	if err != nil {
 		h.svc.RecordFailure(actor.UserID, nil, "", "upload_file", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -234,6 +348,7 @@ func (h *Handler) UploadImage(c *gin.Context) {
 		ImageID:       img.ID,
 		OriginalURL:   img.OriginalURL,
 		CompressedURL: img.CompressedURL,
+		ThumbnailURL:  img.ThumbnailURL,
 	})
 }
 
@@ -243,84 +358,118 @@ func (h *Handler) Recognize(c *gin.Context) {
 	var req struct {
 		ImageID uint   `json:"image_id" binding:"required"`
 		Source  string `json:"source"`
+		Mode    string `json:"mode"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	mode, err := service.NormalizeMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	actor, ok := h.requireActor(c)
 	if !ok {
 		return
 	}
 
+	ctx, cancel := h.svc.RecognizeContext(c.Request.Context())
+	defer cancel()
+
 	// 获取图片信息
-	img, err := h.svc.GetImage(req.ImageID)
+	img, err := h.svc.GetImage(ctx, req.ImageID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
 		return
 	}
 
-	if !h.consumeRecognition(c, actor) {
+	source := strings.TrimSpace(req.Source)
+	if source == "" {
+		source = "unknown"
+	}
+
+	// 调用提供商前预占次数
+	reservation, ok := h.reserveRecognition(c, actor, source)
+	if !ok {
 		return
 	}
 
-	// 调用大模型识别
+	// 调用大模型识别，失败/取消/超时退回次数
 	started := time.Now()
-	var result *llm.RecognitionResult
-	var err error
-	for attempt := 1; attempt <= recognizeRetryMax; attempt++ {
-		result, err = h.svc.Recognize(img.OriginalURL)
-		if err == nil {
-			break
-		}
-		h.svc.RecordFailure(actor.UserID, &img.ID, "", "recognize", err)
-		if attempt < recognizeRetryMax && shouldRetryRecognize(err) {
-			time.Sleep(recognizeRetryDelay)
-			continue
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	result, err := h.recognizeWithRetry(ctx, actor, img, service.RecognizeOptions{Source: source, Locale: requestLocale(c), Mode: mode, DeviceID: actor.DeviceID})
+	if err != nil {
+		h.svc.ReleaseRecognition(reservation, service.QuotaReasonFailed)
+		c.JSON(recognizeErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	durationMs := int(time.Since(started).Milliseconds())
 
 	// 保存识别结果
-	source := strings.TrimSpace(req.Source)
-	if source == "" {
-		source = "unknown"
-	}
-	savedResult, err := h.svc.SaveResult(req.ImageID, result, source, durationMs)
+	savedResult, err := h.svc.SaveResult(ctx, req.ImageID, result, source, durationMs)
 	if err != nil {
+		h.svc.ReleaseRecognition(reservation, "save_failed")
 		h.svc.RecordFailure(actor.UserID, &img.ID, "", "save_result", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 命中缓存未调用提供商，不计入识别次数
+	h.svc.SettleRecognition(reservation, savedResult)
 
 	// 自动创建手记
 	_, _ = h.svc.CreateNote(actor.UserID, req.ImageID, &savedResult.ID, "", "crop", nil)
-	low, high, riskLevel, riskNote := explainConfidence(savedResult.Confidence)
+	c.JSON(http.StatusOK, h.recognizeResponse(savedResult, img))
+}
 
-	c.JSON(http.StatusOK, RecognizeResponse{
-		RawText:        savedResult.RawText,
-		ResultID:       savedResult.ID,
-		ImageID:        savedResult.ImageID,
-		CropType:       savedResult.CropType,
-		Confidence:     savedResult.Confidence,
-		ConfidenceLow:  low,
-		ConfidenceHigh: high,
-		Description:    savedResult.Description,
-		GrowthStage:    savedResult.GrowthStage,
-		PossibleIssue:  savedResult.PossibleIssue,
-		Provider:       savedResult.Provider,
-		ImageURL:       img.OriginalURL,
-		Latitude:       img.Latitude,
-		Longitude:      img.Longitude,
-		RiskLevel:      riskLevel,
-		RiskNote:       riskNote,
-		Source:         savedResult.Source,
-		DurationMs:     savedResult.DurationMs,
-	})
+// displayImageURL 列表展示用的图片地址，优先使用压缩后的展示图
+func displayImageURL(img *model.Image) string {
+	if img.CompressedURL != "" {
+		return img.CompressedURL
+	}
+	return img.OriginalURL
+}
+
+// recognizeResponse 组装识别接口的响应
+func (h *Handler) recognizeResponse(savedResult *model.RecognitionResult, img *model.Image) RecognizeResponse {
+	findingsMap, _ := h.svc.GetFindingsMap([]uint{savedResult.ID})
+	candidatesMap, _ := h.svc.GetCandidatesMap([]uint{savedResult.ID})
+	votesMap, _ := h.svc.GetEnsembleVotesMap([]uint{savedResult.ID})
+	low, high, riskLevel, riskNote := h.svc.ExplainConfidence(savedResult)
+	return RecognizeResponse{
+		RawText:              savedResult.RawText,
+		ResultID:             savedResult.ID,
+		ImageID:              savedResult.ImageID,
+		Version:              savedResult.Version,
+		IsCurrent:            savedResult.IsCurrent,
+		CropType:             savedResult.CropType,
+		CropTypeRaw:          savedResult.CropTypeRaw,
+		Confidence:           savedResult.Confidence,
+		CalibratedConfidence: savedResult.CalibratedConfidence,
+		ConfidenceLow:        low,
+		ConfidenceHigh:       high,
+		Description:          savedResult.Description,
+		GrowthStage:          savedResult.GrowthStage,
+		GrowthStageCode:      savedResult.GrowthStageCode,
+		PossibleIssue:        savedResult.PossibleIssue,
+		Provider:             savedResult.Provider,
+		Model:                savedResult.Model,
+		PromptVersion:        savedResult.PromptVersion,
+		Mode:                 savedResult.Mode,
+		Findings:             toFindingViews(findingsMap[savedResult.ID]),
+		Candidates:           toCandidateViews(candidatesMap[savedResult.ID]),
+		Votes:                toVoteViews(votesMap[savedResult.ID]),
+		ImageURL:             img.OriginalURL,
+		ThumbnailURL:         img.ThumbnailURL,
+		Latitude:             img.Latitude,
+		Longitude:            img.Longitude,
+		RiskLevel:            riskLevel,
+		RiskNote:             riskNote,
+		Source:               savedResult.Source,
+		CacheHit:             savedResult.CacheHit,
+		DurationMs:           savedResult.DurationMs,
+	}
 }
 
 // GetResult 获取识别结果
@@ -343,17 +492,34 @@ func (h *Handler) GetResult(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	findingsMap, err := h.svc.GetFindingsMap([]uint{result.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	candidatesMap, err := h.svc.GetCandidatesMap([]uint{result.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	votesMap, err := h.svc.GetEnsembleVotesMap([]uint{result.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	imageURL := ""
+	thumbnailURL := ""
 	var lat *float64
 	var lng *float64
-	if img, err := h.svc.GetImage(result.ImageID); err == nil {
+	if img, err := h.svc.GetImage(c.Request.Context(), result.ImageID); err == nil {
 		imageURL = img.OriginalURL
+		thumbnailURL = img.ThumbnailURL
 		lat = img.Latitude
 		lng = img.Longitude
 	}
 
-	low, high, riskLevel, riskNote := explainConfidence(result.Confidence)
+	low, high, riskLevel, riskNote := h.svc.ExplainConfidence(result)
 	var feedbackCorrect *bool
 	if fb, ok := feedbackMap[result.ID]; ok {
 		v := fb.IsCorrect
@@ -363,25 +529,81 @@ func (h *Handler) GetResult(c *gin.Context) {
 		RawText:        result.RawText,
 		ResultID:       result.ID,
 		ImageID:        result.ImageID,
+		Version:        result.Version,
+		IsCurrent:      result.IsCurrent,
 		CropType:       result.CropType,
+		CropTypeRaw:    result.CropTypeRaw,
 		Confidence:     result.Confidence,
+		CalibratedConfidence: result.CalibratedConfidence,
 		ConfidenceLow:  low,
 		ConfidenceHigh: high,
 		Description:    result.Description,
 		GrowthStage:    result.GrowthStage,
+		GrowthStageCode: result.GrowthStageCode,
 		PossibleIssue:  result.PossibleIssue,
 		Provider:       result.Provider,
+		Model:          result.Model,
+		PromptVersion:  result.PromptVersion,
+		Mode:           result.Mode,
+		Findings:       toFindingViews(findingsMap[result.ID]),
+		Candidates:     toCandidateViews(candidatesMap[result.ID]),
+		Votes:          toVoteViews(votesMap[result.ID]),
 		ImageURL:       imageURL,
+		ThumbnailURL:   thumbnailURL,
 		Latitude:       lat,
 		Longitude:      lng,
 		RiskLevel:      riskLevel,
 		RiskNote:       riskNote,
 		FeedbackCorrect: feedbackCorrect,
 		Source:         result.Source,
+		CacheHit:       result.CacheHit,
 		DurationMs:     result.DurationMs,
 	})
 }
 
+// GetImageResults 图片的识别结果历史，每次重新识别保留为新版本，is_current 标记当前结果
+// GET /api/v1/images/:id/results
+func (h *Handler) GetImageResults(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	img, err := h.svc.GetImage(c.Request.Context(), uint(id))
+	if err != nil || (img.UserID > 0 && img.UserID != actor.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+	results, err := h.svc.ListResultVersions(img.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resultIDs := make([]uint, 0, len(results))
+	for _, r := range results {
+		resultIDs = append(resultIDs, r.ID)
+	}
+	feedbackMap, err := h.svc.GetFeedbackMap(resultIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := make([]RecognizeResponse, 0, len(results))
+	for i := range results {
+		resp := h.recognizeResponse(&results[i], img)
+		if fb, ok := feedbackMap[results[i].ID]; ok {
+			v := fb.IsCorrect
+			resp.FeedbackCorrect = &v
+		}
+		response = append(response, resp)
+	}
+	c.JSON(http.StatusOK, gin.H{"image_id": img.ID, "results": response})
+}
+
 // GetHistory 获取历史记录
 // GET /api/v1/history
 func (h *Handler) GetHistory(c *gin.Context) {
@@ -503,7 +725,12 @@ func (h *Handler) GetHistory(c *gin.Context) {
 			startDate = &cutoff
 		}
 	}
-	results, err := h.svc.GetHistory(actor.UserID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, source)
+	filter, err := resultFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results, err := h.svc.GetHistory(actor.UserID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, source, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -517,10 +744,15 @@ func (h *Handler) GetHistory(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	findingsMap, err := h.svc.GetFindingsMap(resultIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	response := make([]RecognizeResponse, 0, len(results))
 	for _, r := range results {
-		low, high, riskLevel, riskNote := explainConfidence(r.Confidence)
+		low, high, riskLevel, riskNote := h.svc.ExplainConfidence(&r)
 		var feedbackCorrect *bool
 		if fb, ok := feedbackMap[r.ID]; ok {
 			v := fb.IsCorrect
@@ -530,21 +762,32 @@ func (h *Handler) GetHistory(c *gin.Context) {
 			RawText:        r.RawText,
 			ResultID:       r.ID,
 			ImageID:        r.ImageID,
+			Version:        r.Version,
+			IsCurrent:      r.IsCurrent,
 			CropType:       r.CropType,
+			CropTypeRaw:    r.CropTypeRaw,
 			Confidence:     r.Confidence,
+			CalibratedConfidence: r.CalibratedConfidence,
 			ConfidenceLow:  low,
 			ConfidenceHigh: high,
 			Description:    r.Description,
 			GrowthStage:    r.GrowthStage,
+			GrowthStageCode: r.GrowthStageCode,
 			PossibleIssue:  r.PossibleIssue,
 			Provider:       r.Provider,
-			ImageURL:       r.Image.OriginalURL,
+			Model:          r.Model,
+			PromptVersion:  r.PromptVersion,
+			Mode:           r.Mode,
+			Findings:       toFindingViews(findingsMap[r.ID]),
+			ImageURL:       displayImageURL(&r.Image),
+			ThumbnailURL:   r.Image.ThumbnailURL,
 			Latitude:       r.Image.Latitude,
 			Longitude:      r.Image.Longitude,
 			RiskLevel:      riskLevel,
 			RiskNote:       riskNote,
 			FeedbackCorrect: feedbackCorrect,
 			Source:         r.Source,
+			CacheHit:       r.CacheHit,
 			DurationMs:     r.DurationMs,
 		}
 		response = append(response, resp)
@@ -673,18 +916,23 @@ func (h *Handler) ExportHistory(c *gin.Context) {
 			startDate = &cutoff
 		}
 	}
+	filter, err := resultFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if format == "json" {
 		c.Header("Content-Type", "application/json; charset=utf-8")
 		c.Header("Content-Disposition", "attachment; filename=history.json")
-		if err := h.svc.ExportHistoryJSON(c.Writer, actor.UserID, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng); err != nil {
+		if err := h.svc.ExportHistoryJSON(c.Writer, actor.UserID, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, filter); err != nil {
 			c.Status(http.StatusInternalServerError)
 		}
 		return
 	}
 	c.Header("Content-Type", "text/csv; charset=utf-8")
 	c.Header("Content-Disposition", "attachment; filename=history.csv")
-	if err := h.svc.ExportHistoryCSV(c.Writer, actor.UserID, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng); err != nil {
+	if err := h.svc.ExportHistoryCSV(c.Writer, actor.UserID, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, filter); err != nil {
 		c.Status(http.StatusInternalServerError)
 	}
 }
@@ -901,7 +1149,7 @@ func (h *Handler) ExportNotes(c *gin.Context) {
 	if feedbackOnly {
 		fields = strings.TrimSpace(fields)
 		if fields == "" {
-			fields = "id,created_at,image_id,result_id,image_url,category,crop_type,confidence,description,growth_stage,possible_issue,provider,note,raw_text,is_correct,corrected_type,feedback_note,feedback_category,feedback_tags"
+			fields = "id,created_at,image_id,result_id,image_url,category,crop_type,confidence,description,growth_stage,growth_stage_code,possible_issue,provider,note,raw_text,is_correct,corrected_type,feedback_note,feedback_category,feedback_tags"
 		}
 	}
 
@@ -938,6 +1186,14 @@ func (h *Handler) SetupRoutes(r *gin.Engine) {
 		v1.GET("/admin/failures/top", h.AdminFailureTop)
 		v1.GET("/admin/settings", h.AdminSettings)
 		v1.PUT("/admin/settings/:key", h.AdminUpdateSetting)
+		v1.GET("/admin/prompts", h.AdminPromptTemplates)
+		v1.POST("/admin/prompts", h.AdminCreatePromptTemplate)
+		v1.POST("/admin/prompts/:id/activate", h.AdminActivatePromptTemplate)
+		v1.GET("/admin/crops/unknown", h.AdminUnknownCrops)
+		v1.POST("/admin/crops/unknown/:id/resolve", h.AdminResolveUnknownCrop)
+		v1.POST("/admin/calibration/refit", h.AdminRefitCalibration)
+		v1.GET("/admin/calibration/maps", h.AdminCalibrationMaps)
+		v1.GET("/admin/calibration/reliability", h.AdminCalibrationReliability)
 		v1.GET("/admin/plan-settings", h.AdminPlanSettings)
 		v1.PUT("/admin/plan-settings/:code", h.AdminUpdatePlanSetting)
 		v1.PUT("/admin/users/:id", h.AdminUpdateUser)
@@ -980,6 +1236,35 @@ func (h *Handler) SetupRoutes(r *gin.Engine) {
 		v1.GET("/admin/export/feedback", h.AdminExportFeedback)
 		v1.GET("/admin/export/results", h.AdminExportResults)
 		v1.GET("/admin/export/failures", h.AdminExportFailures)
+		v1.GET("/admin/export/usage", h.AdminExportUsage)
+		v1.GET("/admin/usage/summary", h.AdminUsageSummary)
+		v1.GET("/admin/providers/health", h.AdminProviderHealth)
+		v1.GET("/admin/shadow/report", h.AdminShadowReport)
+		v1.GET("/admin/shadow/results", h.AdminShadowResults)
+		v1.GET("/admin/jobs", h.AdminJobs)
+		v1.POST("/admin/backfills", h.AdminCreateBackfill)
+		v1.GET("/admin/backfills", h.AdminListBackfills)
+		v1.GET("/admin/backfills/:id", h.AdminGetBackfill)
+		v1.POST("/admin/backfills/:id/start", h.AdminBackfillAction)
+		v1.POST("/admin/backfills/:id/pause", h.AdminBackfillAction)
+		v1.POST("/admin/backfills/:id/resume", h.AdminBackfillAction)
+		v1.POST("/admin/backfills/:id/cancel", h.AdminBackfillAction)
+		v1.POST("/admin/experiments", h.AdminCreateExperiment)
+		v1.GET("/admin/experiments", h.AdminListExperiments)
+		v1.GET("/admin/experiments/:id", h.AdminGetExperiment)
+		v1.GET("/admin/experiments/:id/report", h.AdminExperimentReport)
+		v1.POST("/admin/experiments/:id/start", h.AdminExperimentAction)
+		v1.POST("/admin/experiments/:id/stop", h.AdminExperimentAction)
+		v1.GET("/admin/quota/reservations", h.AdminListQuotaReservations)
+		v1.POST("/admin/webhooks", h.AdminCreateWebhook)
+		v1.GET("/admin/webhooks", h.AdminListWebhooks)
+		v1.GET("/admin/webhooks/:id", h.AdminGetWebhook)
+		v1.PUT("/admin/webhooks/:id", h.AdminUpdateWebhook)
+		v1.DELETE("/admin/webhooks/:id", h.AdminDeleteWebhook)
+		v1.GET("/admin/webhook-deliveries", h.AdminListWebhookDeliveries)
+		v1.GET("/admin/webhook-deliveries/:id", h.AdminGetWebhookDelivery)
+		v1.POST("/admin/webhook-deliveries/:id/replay", h.AdminReplayWebhookDelivery)
+		v1.POST("/admin/images/variants/backfill", h.AdminBackfillImageVariants)
 		v1.POST("/auth/anonymous", h.AuthAnonymous)
 		v1.POST("/auth/send-otp", h.SendOTP)
 		v1.POST("/auth/verify-otp", h.VerifyOTP)
@@ -987,18 +1272,28 @@ func (h *Handler) SetupRoutes(r *gin.Engine) {
 		v1.GET("/entitlements", h.GetEntitlements)
 		v1.POST("/usage/reward", h.RewardAd)
 		v1.POST("/membership/request", h.MembershipRequest)
-		v1.POST("/payment/checkout", h.PaymentCheckout)
+		v1.POST("/payment/checkout", h.Idempotency(), h.PaymentCheckout)
 		v1.POST("/payment/webhook", h.PaymentWebhook)
-		v1.POST("/upload", h.UploadImage)
-		v1.POST("/recognize", h.Recognize)
-		v1.POST("/recognize-url", h.RecognizeByURL)
+		v1.POST("/upload", h.Idempotency(), h.UploadImage)
+		v1.POST("/recognize", h.Idempotency(), h.Recognize)
+		v1.POST("/recognize-url", h.Idempotency(), h.RecognizeByURL)
+		v1.POST("/recognize/async", h.RecognizeAsync)
+		v1.POST("/recognize/batch", h.RecognizeBatch)
+		v1.GET("/batches/:id", h.GetBatch)
+		v1.POST("/batches/:id/resume", h.ResumeBatch)
+		v1.POST("/batches/:id/cancel", h.CancelBatch)
+		v1.GET("/jobs", h.ListJobs)
+		v1.GET("/jobs/:id", h.GetJob)
+		v1.POST("/jobs/:id/cancel", h.CancelJob)
 		v1.GET("/result/:id", h.GetResult)
+		v1.GET("/images/:id/results", h.GetImageResults)
 		v1.GET("/history", h.GetHistory)
 		v1.GET("/history/export", h.ExportHistory)
-		v1.POST("/feedback", h.SubmitFeedback)
+		v1.POST("/feedback", h.Idempotency(), h.SubmitFeedback)
 		v1.GET("/providers", h.GetLLMProviders)
 		v1.GET("/plans", h.GetPlans)
 		v1.GET("/crops", h.GetCrops)
+		v1.GET("/crop-stages", h.GetCropStages)
 		v1.POST("/notes", h.CreateNote)
 		v1.PUT("/notes/:id", h.UpdateNote)
 		v1.GET("/notes", h.GetNotes)
@@ -1075,6 +1370,7 @@ func normalizeNoteTags(notes []model.FieldNote) []gin.H {
 			"confidence":        n.Confidence,
 			"description":       n.Description,
 			"growth_stage":      n.GrowthStage,
+			"growth_stage_code": n.GrowthStageCode,
 			"possible_issue":    n.PossibleIssue,
 			"provider":          n.Provider,
 			"tags":              tags,
@@ -1181,9 +1477,9 @@ func (h *Handler) GetCrops(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"results": items})
 }
 
-// GET /api/v1/plans
-func (h *Handler) GetPlans(c *gin.Context) {
-	items, err := h.svc.GetPlanSettings()
+// GET /api/v1/crop-stages
+func (h *Handler) GetCropStages(c *gin.Context) {
+	items, err := h.svc.GetCropStages(c.Query("crop"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -1191,39 +1487,12 @@ func (h *Handler) GetPlans(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"results": items})
 }
 
-func explainConfidence(conf float64) (float64, float64, string, string) {
-	c := conf
-	if c < 0 {
-		c = 0
-	}
-	if c > 1 {
-		c = 1
+// GET /api/v1/plans
+func (h *Handler) GetPlans(c *gin.Context) {
+	items, err := h.svc.GetPlanSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	delta := 0.1
-	switch {
-	case c >= 0.9:
-		delta = 0.05
-	case c >= 0.75:
-		delta = 0.08
-	default:
-		delta = 0.12
-	}
-	low := c - delta
-	high := c + delta
-	if low < 0 {
-		low = 0
-	}
-	if high > 1 {
-		high = 1
-	}
-	riskLevel := "high"
-	riskNote := "不确定性较高，建议补拍清晰照片或手动标注。"
-	if c >= 0.85 {
-		riskLevel = "low"
-		riskNote = "可信度较高，可直接参考结果。"
-	} else if c >= 0.6 {
-		riskLevel = "medium"
-		riskNote = "存在一定不确定性，建议结合肉眼判断。"
-	}
-	return low, high, riskLevel, riskNote
+	c.JSON(http.StatusOK, gin.H{"results": items})
 }
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"agri-scan/internal/service"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyKeyMaxLen = 128
+
+// 带幂等键的请求需整体读入内存计算指纹，请求体上限与 gin 默认的 multipart 内存上限一致
+const idempotencyMaxBodyBytes = 32 << 20
+
+// idempotencyWriter 同时写出并留存响应体
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 处理 Idempotency-Key 请求头：同一请求方首次请求成功后保存响应，有效期内用同一键重放直接返回保存的响应，
+// 不再上传、扣次数或落库；失败响应不保存，客户端可用同一键重试
+func (h *Handler) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyKeyMaxLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "idempotency key too long"})
+			return
+		}
+		actor, err := h.resolveActor(c)
+		if err != nil {
+			// 由接口自身返回未登录
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotencyMaxBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		begin, err := h.svc.BeginIdempotent(fmt.Sprintf("user:%d", actor.UserID), key, c.FullPath(), requestFingerprint(c, body))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrIdempotencyMismatch):
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrIdempotencyInProgress):
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		if begin.Replay != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(begin.Replay.ResponseStatus, begin.Replay.ResponseType, []byte(begin.Replay.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		saved := false
+		defer func() {
+			// 失败或 panic 时释放，避免同一键一直处于处理中
+			if !saved {
+				h.svc.ReleaseIdempotent(begin.ID)
+			}
+		}()
+		c.Next()
+		if status := writer.Status(); status < http.StatusBadRequest {
+			h.svc.CompleteIdempotent(begin.ID, status, writer.Header().Get("Content-Type"), writer.body.Bytes())
+			saved = true
+		}
+	}
+}
+
+// requestFingerprint 查询参数与请求体的摘要；multipart 请求去掉随机分隔符，客户端重新组装的相同表单视为同一请求
+func requestFingerprint(c *gin.Context, body []byte) string {
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+	sum := sha256.New()
+	sum.Write([]byte(c.Request.URL.RawQuery))
+	sum.Write([]byte{0})
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
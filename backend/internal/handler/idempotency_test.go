@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRouter 挂载幂等中间件的测试路由，status 决定每次调用的响应码
+func idempotentRouter(h *Handler, calls *atomic.Int64, status func(n int64) int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/items", h.Idempotency(), func(c *gin.Context) {
+		n := calls.Add(1)
+		c.JSON(status(n), gin.H{"call": n})
+	})
+	return r
+}
+
+func postItem(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", "42")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysSavedResponse(t *testing.T) {
+	h := newTestHandler(t)
+	var calls atomic.Int64
+	r := idempotentRouter(h, &calls, func(int64) int { return http.StatusCreated })
+
+	first := postItem(r, "k1", `{"a":1}`)
+	second := postItem(r, "k1", `{"a":1}`)
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("replay header first=%q second=%q", first.Header().Get("Idempotent-Replayed"), second.Header().Get("Idempotent-Replayed"))
+	}
+	if !strings.HasPrefix(second.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("replayed content type = %q", second.Header().Get("Content-Type"))
+	}
+
+	if w := postItem(r, "k1", `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key, other body = %d, want 422", w.Code)
+	}
+	postItem(r, "", `{"a":1}`)
+	postItem(r, "", `{"a":1}`)
+	if calls.Load() != 3 {
+		t.Errorf("requests without a key should always run, handler ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyReleasesFailedRequests(t *testing.T) {
+	h := newTestHandler(t)
+	var calls atomic.Int64
+	r := idempotentRouter(h, &calls, func(n int64) int {
+		if n == 1 {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+
+	if w := postItem(r, "k1", `{}`); w.Code != http.StatusBadGateway {
+		t.Fatalf("first = %d", w.Code)
+	}
+	if w := postItem(r, "k1", `{}`); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after failure = %d replayed=%q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyRejectsConcurrentDuplicate(t *testing.T) {
+	h := newTestHandler(t)
+	gin.SetMode(gin.TestMode)
+	entered, release := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.POST("/items", h.Idempotency(), func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postItem(r, "k1", `{}`) }()
+	<-entered
+	if w := postItem(r, "k1", `{}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate while in progress = %d, want 409", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("first request = %d", w.Code)
+	}
+	if w := postItem(r, "k1", `{}`); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("request after completion was not replayed: %d", w.Code)
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/items", (&Handler{}).Idempotency(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	if w := postItem(r, strings.Repeat("k", idempotencyKeyMaxLen+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("oversized key = %d, want 400", w.Code)
+	}
+}
+
+func multipartBody(t *testing.T, boundary string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteField("mode", "crop")
+	mw.Close()
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fingerprint := func(target, contentType string, body []byte) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", contentType)
+		return requestFingerprint(c, body)
+	}
+
+	typeA, bodyA := multipartBody(t, "boundary-aaaa")
+	typeB, bodyB := multipartBody(t, "boundary-bbbb")
+	if fingerprint("/r", typeA, bodyA) != fingerprint("/r", typeB, bodyB) {
+		t.Error("the same form with a new boundary should match")
+	}
+	if fingerprint("/r?mode=crop", "application/json", []byte(`{}`)) == fingerprint("/r?mode=disease", "application/json", []byte(`{}`)) {
+		t.Error("query parameters should be part of the fingerprint")
+	}
+	if fingerprint("/r", "application/json", []byte(`{"a":1}`)) == fingerprint("/r", "application/json", []byte(`{"a":2}`)) {
+		t.Error("body should be part of the fingerprint")
+	}
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	// 请求体超限时在访问数据库之前拒绝
+	var calls atomic.Int64
+	r := idempotentRouter(&Handler{}, &calls, func(int64) int { return http.StatusOK })
+	w := postItem(r, "big-body", strings.Repeat("x", idempotencyMaxBodyBytes+1))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("handler ran %d times for an oversized body", calls.Load())
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminBackfillImageVariants 为已有图片补生成展示图与缩略图，每次处理一批，按返回的 next_after_id 继续
+// POST /api/v1/admin/images/variants/backfill
+func (h *Handler) AdminBackfillImageVariants(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req struct {
+		AfterID uint `json:"after_id"`
+		Limit   int  `json:"limit"`
+		DryRun  bool `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	stats, err := h.svc.BackfillImageVariants(c.Request.Context(), req.AfterID, req.Limit, req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.DryRun {
+		h.svc.RecordAdminAudit("backfill_image_variants", "image", stats.NextAfterID, fmt.Sprintf("updated=%d failed=%d", stats.Updated, stats.Failed), c.ClientIP())
+	}
+	c.JSON(http.StatusOK, stats)
+}
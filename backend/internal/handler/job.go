@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"agri-scan/internal/model"
+	"agri-scan/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobResponse 异步识别任务状态，成功后附带识别结果
+type JobResponse struct {
+	JobID        uint               `json:"job_id"`
+	Status       string             `json:"status"`
+	ImageID      uint               `json:"image_id"`
+	Mode         string             `json:"mode"`
+	Attempts     int                `json:"attempts"`
+	MaxAttempts  int                `json:"max_attempts"`
+	ResultID     *uint              `json:"result_id"`
+	ErrorCode    string             `json:"error_code,omitempty"`
+	ErrorMessage string             `json:"error_message,omitempty"`
+	CreatedAt    string             `json:"created_at"`
+	StartedAt    string             `json:"started_at,omitempty"`
+	FinishedAt   string             `json:"finished_at,omitempty"`
+	Result       *RecognizeResponse `json:"result,omitempty"`
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func toJobResponse(job *model.RecognitionJob) JobResponse {
+	return JobResponse{
+		JobID:        job.ID,
+		Status:       job.Status,
+		ImageID:      job.ImageID,
+		Mode:         job.Mode,
+		Attempts:     job.Attempts,
+		MaxAttempts:  job.MaxAttempts,
+		ResultID:     job.ResultID,
+		ErrorCode:    job.ErrorCode,
+		ErrorMessage: job.ErrorMessage,
+		CreatedAt:    job.CreatedAt.Format("2006-01-02 15:04:05"),
+		StartedAt:    formatTimePtr(job.StartedAt),
+		FinishedAt:   formatTimePtr(job.FinishedAt),
+	}
+}
+
+func ownsJob(actor *Actor, job *model.RecognitionJob) bool {
+	if job.UserID > 0 {
+		return job.UserID == actor.UserID
+	}
+	return job.DeviceID != "" && job.DeviceID == actor.DeviceID
+}
+
+// loadActorJob 读取当前用户的任务，不存在或不属于当前用户时返回 404
+func (h *Handler) loadActorJob(c *gin.Context, actor *Actor) (*model.RecognitionJob, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+	job, err := h.svc.GetRecognitionJob(uint(id))
+	if err != nil || !ownsJob(actor, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return nil, false
+	}
+	return job, true
+}
+
+// RecognizeAsync 提交异步识别，立即返回任务 ID
+// POST /api/v1/recognize/async
+func (h *Handler) RecognizeAsync(c *gin.Context) {
+	var req struct {
+		ImageID  uint   `json:"image_id"`
+		ImageURL string `json:"image_url"`
+		Source   string `json:"source"`
+		Mode     string `json:"mode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.ImageID == 0 && strings.TrimSpace(req.ImageURL) == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	mode, err := service.NormalizeMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var img *model.Image
+	if req.ImageID > 0 {
+		img, err = h.svc.GetImage(ctx, req.ImageID)
+		// 他人的图片与不存在的图片一样报不存在，不暴露图片是否存在
+		if err != nil || img.UserID != actor.UserID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+	}
+
+	source := strings.TrimSpace(req.Source)
+	if source == "" && img == nil {
+		source = "url"
+	}
+	if source == "" {
+		source = "unknown"
+	}
+
+	reservation, ok := h.reserveRecognition(c, actor, source)
+	if !ok {
+		return
+	}
+
+	if img == nil {
+		img, err = h.svc.CreateImageFromURL(ctx, actor.UserID, strings.TrimSpace(req.ImageURL))
+		if err != nil {
+			h.svc.ReleaseRecognition(reservation, "create_image_failed")
+			h.svc.RecordFailure(actor.UserID, nil, "", "create_image_url", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	job, err := h.svc.SubmitRecognitionJob(ctx, actor.UserID, actor.DeviceID, img.ID, reservation, service.RecognizeOptions{Source: source, Locale: requestLocale(c), Mode: mode})
+	if err != nil {
+		h.svc.ReleaseRecognition(reservation, "create_job_failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, toJobResponse(job))
+}
+
+// GetJob 查询异步识别任务，wait 为长轮询秒数（最长 30）
+// GET /api/v1/jobs/:id
+func (h *Handler) GetJob(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	job, ok := h.loadActorJob(c, actor)
+	if !ok {
+		return
+	}
+	if wait, _ := strconv.Atoi(c.DefaultQuery("wait", "0")); wait > 0 {
+		updated, err := h.svc.WaitRecognitionJob(c.Request.Context(), job.ID, time.Duration(wait)*time.Second)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		job = updated
+	}
+	resp := toJobResponse(job)
+	if job.Status == model.JobSucceeded && job.ResultID != nil {
+		if result, err := h.svc.GetResultByID(*job.ResultID); err == nil {
+			if img, err := h.svc.GetImage(c.Request.Context(), job.ImageID); err == nil {
+				view := h.recognizeResponse(result, img)
+				resp.Result = &view
+			}
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelJob 取消尚未开始的任务
+// POST /api/v1/jobs/:id/cancel
+func (h *Handler) CancelJob(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	job, ok := h.loadActorJob(c, actor)
+	if !ok {
+		return
+	}
+	if err := h.svc.CancelRecognitionJob(job); err != nil {
+		if errors.Is(err, service.ErrJobNotCancelable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job_id": job.ID, "status": model.JobCanceled})
+}
+
+// ListJobs 当前用户的异步识别任务
+// GET /api/v1/jobs
+func (h *Handler) ListJobs(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	if actor.UserID == 0 {
+		c.JSON(http.StatusOK, gin.H{"results": []JobResponse{}, "limit": 0, "offset": 0})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListRecognitionJobs(actor.UserID, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]JobResponse, 0, len(items))
+	for i := range items {
+		out = append(out, toJobResponse(&items[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"results": out, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/admin/jobs
+func (h *Handler) AdminJobs(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var userID uint
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID = uint(v)
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListRecognitionJobs(userID, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := h.svc.CountRecognitionJobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "counts": counts, "limit": limit, "offset": offset})
+}
+
+// loadActorBatch 读取当前用户的批次，不存在或不属于当前用户时返回 404
+func (h *Handler) loadActorBatch(c *gin.Context, actor *Actor) (*model.RecognitionBatch, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+	batch, err := h.svc.GetRecognitionBatch(uint(id))
+	if err != nil || batch.UserID == 0 || batch.UserID != actor.UserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "batch not found"})
+		return nil, false
+	}
+	return batch, true
+}
+
+// RecognizeBatch 批量识别，整批校验次数后异步执行
+// POST /api/v1/recognize/batch
+func (h *Handler) RecognizeBatch(c *gin.Context) {
+	var req struct {
+		ImageIDs    []uint   `json:"image_ids"`
+		ImageURLs   []string `json:"image_urls"`
+		Source      string   `json:"source"`
+		Mode        string   `json:"mode"`
+		Concurrency int      `json:"concurrency"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	mode, err := service.NormalizeMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	batch, err := h.svc.SubmitRecognitionBatch(c.Request.Context(), actor.User, service.BatchSubmit{
+		ImageIDs:    req.ImageIDs,
+		ImageURLs:   req.ImageURLs,
+		Source:      req.Source,
+		Locale:      requestLocale(c),
+		Mode:        mode,
+		Concurrency: req.Concurrency,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBatchEmpty), errors.Is(err, service.ErrBatchTooLarge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrBatchNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			mapEntitlementError(c, err)
+		}
+		return
+	}
+	view, err := h.svc.GetBatchView(batch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, view)
+}
+
+// GetBatch 批次进度与逐项结果
+// GET /api/v1/batches/:id
+func (h *Handler) GetBatch(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	batch, ok := h.loadActorBatch(c, actor)
+	if !ok {
+		return
+	}
+	view, err := h.svc.GetBatchView(batch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// ResumeBatch 失败或已取消的项重新排队
+// POST /api/v1/batches/:id/resume
+func (h *Handler) ResumeBatch(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	batch, ok := h.loadActorBatch(c, actor)
+	if !ok {
+		return
+	}
+	requeued, err := h.svc.ResumeRecognitionBatch(actor.User, batch)
+	if err != nil {
+		mapEntitlementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"batch_id": batch.ID, "requeued": requeued})
+}
+
+// CancelBatch 取消尚未开始的项
+// POST /api/v1/batches/:id/cancel
+func (h *Handler) CancelBatch(c *gin.Context) {
+	actor, ok := h.requireActor(c)
+	if !ok {
+		return
+	}
+	batch, ok := h.loadActorBatch(c, actor)
+	if !ok {
+		return
+	}
+	canceled, err := h.svc.CancelRecognitionBatch(actor.User, batch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"batch_id": batch.ID, "canceled": canceled})
+}
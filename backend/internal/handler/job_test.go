@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/repository"
+	"agri-scan/internal/service"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newTestHandler 连接 TEST_DATABASE_DSN（key=value 形式）指定的 Postgres，在独立 schema 中迁移后创建处理器；未设置时跳过
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("test_handler_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	repo, err := repository.NewRepository(dsn + " search_path=" + schema)
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := repo.DB().DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewHandler(service.NewService(repo, llm.NewMockProvider(), nil))
+}
+
+func TestRecognizeAsyncRejectsOtherUsersImage(t *testing.T) {
+	h := newTestHandler(t)
+	owner, err := h.svc.EnsureDeviceUser("device-owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intruder, err := h.svc.EnsureDeviceUser("device-intruder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := h.svc.CreateImageFromURL(context.Background(), owner.ID, "https://img.example.com/owner.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/recognize/async", h.RecognizeAsync)
+	req := httptest.NewRequest(http.MethodPost, "/recognize/async", strings.NewReader(fmt.Sprintf(`{"image_id":%d}`, img.ID)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-ID", "device-intruder")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// 与批量识别一致：他人的图片按不存在处理
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "image not found") {
+		t.Fatalf("status = %d body %s, want 404 image not found", w.Code, w.Body.String())
+	}
+	jobs, err := h.svc.ListRecognitionJobs(intruder.ID, "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("jobs = %+v, want none queued for another user's image", jobs)
+	}
+}
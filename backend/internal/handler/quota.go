@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"agri-scan/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminListQuotaReservations 次数预占与结算记录，用于核对扣减与退回
+// GET /api/v1/admin/quota/reservations
+func (h *Handler) AdminListQuotaReservations(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	startDate, endDate, err := parseDateRange(c.DefaultQuery("start_date", ""), c.DefaultQuery("end_date", ""))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := service.QuotaReservationFilter{
+		DeviceID: c.Query("device_id"),
+		Status:   c.Query("status"),
+		Start:    startDate,
+		End:      endDate,
+	}
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		filter.UserID = uint(v)
+	}
+	items, err := h.svc.ListQuotaReservations(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
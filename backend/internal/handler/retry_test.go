@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"agri-scan/internal/llm"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRecognizeRetryDelay(t *testing.T) {
+	upstream := &llm.ProviderError{Provider: "qwen", Code: llm.CodeServerError, Retryable: true}
+	cases := []struct {
+		name     string
+		attempt  int
+		err      error
+		min, max time.Duration
+		ok       bool
+	}{
+		{"first attempt", 1, upstream, 150 * time.Millisecond, 300 * time.Millisecond, true},
+		{"second attempt doubles", 2, upstream, 300 * time.Millisecond, 600 * time.Millisecond, true},
+		{"capped at max delay", 10, upstream, recognizeRetryMaxDelay / 2, recognizeRetryMaxDelay, true},
+		{"honors Retry-After", 1, &llm.ProviderError{Code: llm.CodeRateLimited, Retryable: true, RetryAfter: 2 * time.Second}, 2 * time.Second, 2 * time.Second, true},
+		{"Retry-After too long", 1, &llm.ProviderError{Code: llm.CodeRateLimited, Retryable: true, RetryAfter: time.Minute}, time.Minute, time.Minute, false},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 20; i++ {
+			d, ok := recognizeRetryDelay(tc.attempt, tc.err)
+			if ok != tc.ok || d < tc.min || d > tc.max {
+				t.Fatalf("%s: got %s, %v; want [%s, %s], %v", tc.name, d, ok, tc.min, tc.max, tc.ok)
+			}
+		}
+	}
+}
+
+func TestShouldRetryRecognize(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"retryable provider error", fmt.Errorf("qwen: %w", &llm.ProviderError{Code: llm.CodeServerError, Retryable: true}), true},
+		{"client error", &llm.ProviderError{Code: llm.CodeUnauthorized}, false},
+		{"wrapped deadline", fmt.Errorf("recognize: %w", context.DeadlineExceeded), true},
+		{"caller canceled", context.Canceled, false},
+		{"circuit open", fmt.Errorf("openai: %w", llm.ErrCircuitOpen), false},
+		{"whole chain open", errors.Join(llm.ErrCircuitOpen, llm.ErrCircuitOpen), false},
+	}
+	for _, tc := range cases {
+		if got := shouldRetryRecognize(tc.err); got != tc.want {
+			t.Errorf("%s: shouldRetryRecognize = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"agri-scan/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type webhookRequest struct {
+	Name    *string  `json:"name"`
+	URL     *string  `json:"url"`
+	Events  []string `json:"events"`
+	Secret  *string  `json:"secret"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func (r webhookRequest) input() service.WebhookSubscriptionInput {
+	return service.WebhookSubscriptionInput{
+		Name:    r.Name,
+		URL:     r.URL,
+		Events:  r.Events,
+		Secret:  r.Secret,
+		Enabled: r.Enabled,
+	}
+}
+
+// POST /api/v1/admin/webhooks
+func (h *Handler) AdminCreateWebhook(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	sub, secret, err := h.svc.CreateWebhookSubscription(req.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("create_webhook", "webhook", sub.ID, sub.URL, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"subscription": sub, "secret": secret})
+}
+
+// GET /api/v1/admin/webhooks
+func (h *Handler) AdminListWebhooks(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	items, err := h.svc.ListWebhookSubscriptions(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset, "event_types": service.WebhookEventTypes})
+}
+
+// GET /api/v1/admin/webhooks/:id
+func (h *Handler) AdminGetWebhook(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	sub, err := h.svc.GetWebhookSubscription(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// PUT /api/v1/admin/webhooks/:id
+func (h *Handler) AdminUpdateWebhook(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	sub, err := h.svc.UpdateWebhookSubscription(uint(id), req.input())
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	h.svc.RecordAdminAudit("update_webhook", "webhook", sub.ID, sub.URL, c.ClientIP())
+	c.JSON(http.StatusOK, sub)
+}
+
+// DELETE /api/v1/admin/webhooks/:id
+func (h *Handler) AdminDeleteWebhook(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.svc.DeleteWebhookSubscription(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.svc.RecordAdminAudit("delete_webhook", "webhook", uint(id), "", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// GET /api/v1/admin/webhook-deliveries
+func (h *Handler) AdminListWebhookDeliveries(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	filter := service.WebhookDeliveryFilter{
+		Status:    c.Query("status"),
+		EventType: c.Query("event_type"),
+		EventID:   c.Query("event_id"),
+	}
+	if raw := strings.TrimSpace(c.Query("subscription_id")); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription_id"})
+			return
+		}
+		filter.SubscriptionID = uint(v)
+	}
+	items, err := h.svc.ListWebhookDeliveries(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": items, "limit": limit, "offset": offset})
+}
+
+// GET /api/v1/admin/webhook-deliveries/:id
+func (h *Handler) AdminGetWebhookDelivery(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	item, err := h.svc.GetWebhookDelivery(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// POST /api/v1/admin/webhook-deliveries/:id/replay
+func (h *Handler) AdminReplayWebhookDelivery(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	item, err := h.svc.ReplayWebhookDelivery(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotReplayable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+		return
+	}
+	h.svc.RecordAdminAudit("replay_webhook_delivery", "webhook_delivery", item.ID, item.EventID, c.ClientIP())
+	c.JSON(http.StatusOK, item)
+}
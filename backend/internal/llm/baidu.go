@@ -0,0 +1,257 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BaiduProvider 百度智能云植物识别 Provider
+type BaiduProvider struct {
+	BaseProvider
+	HTTPClient *http.Client
+	SecretKey  string
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewBaiduProvider 创建百度 Provider，apiKey/secretKey 为应用的 API Key 与 Secret Key
+func NewBaiduProvider(apiKey, secretKey, endpoint string) *BaiduProvider {
+	if endpoint == "" {
+		endpoint = "https://aip.baidubce.com"
+	}
+	return &BaiduProvider{
+		BaseProvider: BaseProvider{
+			NameVal:  "baidu",
+			APIKey:   apiKey,
+			Endpoint: strings.TrimRight(endpoint, "/"),
+		},
+		HTTPClient: &http.Client{},
+		SecretKey:  secretKey,
+	}
+}
+
+type baiduTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type baiduPlantResponse struct {
+	LogID     int64  `json:"log_id"`
+	ErrorCode int    `json:"error_code"`
+	ErrorMsg  string `json:"error_msg"`
+	Result    []struct {
+		Name      string  `json:"name"`
+		Score     float64 `json:"score"`
+		BaikeInfo struct {
+			BaikeURL    string `json:"baike_url"`
+			Description string `json:"description"`
+		} `json:"baike_info"`
+	} `json:"result"`
+}
+
+// Baidu 错误码：token 失效需要重新换取
+const (
+	baiduErrTokenInvalid = 110
+	baiduErrTokenExpired = 111
+)
+
+// Recognize 调用百度植物识别接口
+func (p *BaiduProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	form, err := p.buildForm(ctx, req.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result, body, err := p.callPlant(ctx, form)
+	if err == nil && (result.ErrorCode == baiduErrTokenInvalid || result.ErrorCode == baiduErrTokenExpired) {
+		// token 被提前吊销时清空缓存并重试一次
+		p.resetToken()
+		result, body, err = p.callPlant(ctx, form)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.ErrorCode != 0 {
+		return nil, baiduError(result.ErrorCode, result.ErrorMsg, result.LogID)
+	}
+	if len(result.Result) == 0 {
+		return nil, badResponse(p.NameVal, "no result in response", nil)
+	}
+
+	top := result.Result[0]
+	out := &RecognitionResult{
+		RawText:     string(body),
+		CropType:    top.Name,
+		Confidence:  top.Score,
+		Description: top.BaikeInfo.Description,
+		Model:       "plant",
+	}
+	if top.Name == "非植物" {
+		out.CropType = "unknown"
+	}
+	for _, item := range result.Result {
+		name := item.Name
+		if name == "非植物" {
+			name = "unknown"
+		}
+		out.Candidates = append(out.Candidates, Candidate{CropType: name, Confidence: item.Score})
+	}
+	return out, nil
+}
+
+// buildForm 百度接口优先使用 url 参数，私网或非 https 地址下载后以 base64 提交
+func (p *BaiduProvider) buildForm(ctx context.Context, imageURL string) (url.Values, error) {
+	form := url.Values{}
+	form.Set("baike_num", "1")
+
+	if strings.HasPrefix(imageURL, "data:") {
+		if comma := strings.Index(imageURL, ","); comma >= 0 {
+			form.Set("image", imageURL[comma+1:])
+			return form, nil
+		}
+		return nil, &ProviderError{Provider: p.NameVal, Code: CodeInvalidRequest, Message: "malformed data url"}
+	}
+
+	u, err := url.Parse(imageURL)
+	if err == nil && u.Scheme == "https" && u.Hostname() != "" && !isPrivateHost(u.Hostname()) {
+		form.Set("url", imageURL)
+		return form, nil
+	}
+
+	_, data, err := fetchImage(ctx, p.HTTPClient, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	form.Set("image", base64.StdEncoding.EncodeToString(data))
+	return form, nil
+}
+
+func (p *BaiduProvider) callPlant(ctx context.Context, form url.Values) (*baiduPlantResponse, []byte, error) {
+	token, err := p.token(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoint := p.Endpoint + "/rest/2.0/image-classify/v1/plant?access_token=" + url.QueryEscape(token)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, transportError(p.NameVal, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, transportError(p.NameVal, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, statusError(p.NameVal, resp.StatusCode, "", string(body), resp.Header)
+	}
+
+	var result baiduPlantResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil, badResponse(p.NameVal, "failed to decode response", err)
+	}
+	// 按次计费，token 记为 0
+	recordUsage(ctx, p.NameVal, "plant", 0, 0)
+	return &result, body, nil
+}
+
+// Probe 探测鉴权接口可达性，不刷新缓存的 token
+func (p *BaiduProvider) Probe(ctx context.Context) error {
+	return probeHTTP(ctx, p.HTTPClient, p.Endpoint+"/oauth/2.0/token", "")
+}
+
+// token 获取缓存的 access_token，过期前 5 分钟刷新
+func (p *BaiduProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.expiresAt) {
+		return p.accessToken, nil
+	}
+
+	query := url.Values{}
+	query.Set("grant_type", "client_credentials")
+	query.Set("client_id", p.APIKey)
+	query.Set("client_secret", p.SecretKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", p.Endpoint+"/oauth/2.0/token?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", transportError(p.NameVal, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", transportError(p.NameVal, err)
+	}
+
+	var tok baiduTokenResponse
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", statusError(p.NameVal, resp.StatusCode, "", "failed to decode token response", resp.Header)
+	}
+	if tok.Error != "" || tok.AccessToken == "" {
+		return "", &ProviderError{Provider: p.NameVal, Code: CodeUnauthorized, Status: resp.StatusCode, ProviderCode: tok.Error, Message: tok.ErrorDescription}
+	}
+
+	ttl := time.Duration(tok.ExpiresIn) * time.Second
+	if ttl > 10*time.Minute {
+		ttl -= 5 * time.Minute
+	}
+	p.accessToken = tok.AccessToken
+	p.expiresAt = time.Now().Add(ttl)
+	return p.accessToken, nil
+}
+
+func (p *BaiduProvider) resetToken() {
+	p.mu.Lock()
+	p.accessToken = ""
+	p.mu.Unlock()
+}
+
+// baiduError 将百度错误码映射为统一错误码，百度以 HTTP 200 返回业务错误
+func baiduError(code int, message string, logID int64) error {
+	e := &ProviderError{
+		Provider:     "baidu",
+		Code:         CodeServerError,
+		ProviderCode: strconv.Itoa(code),
+		Message:      fmt.Sprintf("%s (log_id=%d)", message, logID),
+		Retryable:    true,
+	}
+	switch code {
+	case 4, 17, 18, 19:
+		e.Code = CodeRateLimited
+		// 日配额（17）与总量（19）用尽时重试无意义
+		e.Retryable = code == 4 || code == 18
+	case 6, 14:
+		e.Code, e.Retryable = CodeForbidden, false
+	case baiduErrTokenInvalid, baiduErrTokenExpired:
+		e.Code, e.Retryable = CodeUnauthorized, false
+	case 216100, 216101, 216102, 216103, 216110, 216200, 216201, 216202, 282004:
+		e.Code, e.Retryable = CodeInvalidRequest, false
+	}
+	return e
+}
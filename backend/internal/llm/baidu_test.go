@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const testImageDataURL = "data:image/jpeg;base64,/9j/AAAA"
+
+// baiduStub 本地模拟百度鉴权与植物识别接口
+type baiduStub struct {
+	tokenCalls atomic.Int32
+	plantCalls atomic.Int32
+	tokens     []string // 依次发放的 token
+	plant      func(w http.ResponseWriter, r *http.Request, call int32)
+}
+
+func (s *baiduStub) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("grant_type") != "client_credentials" || q.Get("client_id") != "ak" || q.Get("client_secret") != "sk" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"unknown client id"}`))
+			return
+		}
+		n := s.tokenCalls.Add(1)
+		token := s.tokens[min(int(n), len(s.tokens))-1]
+		w.Write([]byte(`{"access_token":"` + token + `","expires_in":2592000}`))
+	})
+	mux.HandleFunc("/rest/2.0/image-classify/v1/plant", func(w http.ResponseWriter, r *http.Request) {
+		s.plant(w, r, s.plantCalls.Add(1))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBaiduRecognizeCachesToken(t *testing.T) {
+	stub := &baiduStub{tokens: []string{"tok-1"}}
+	stub.plant = func(w http.ResponseWriter, r *http.Request, call int32) {
+		if got := r.URL.Query().Get("access_token"); got != "tok-1" {
+			t.Errorf("access_token = %q, want tok-1", got)
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("image") != "/9j/AAAA" {
+			t.Errorf("image form = %q, err %v", r.PostForm.Get("image"), err)
+		}
+		w.Write([]byte(`{"log_id":1,"result":[{"name":"小麦","score":0.91,"baike_info":{"description":"禾本科"}},{"name":"非植物","score":0.05}]}`))
+	}
+	srv := stub.server(t)
+	p := NewBaiduProvider("ak", "sk", srv.URL)
+
+	rec := &UsageRecorder{}
+	ctx := WithUsageRecorder(context.Background(), rec)
+	for i := 0; i < 2; i++ {
+		result, err := p.Recognize(ctx, Request{ImageURL: testImageDataURL})
+		if err != nil {
+			t.Fatalf("Recognize: %v", err)
+		}
+		if result.CropType != "小麦" || result.Confidence != 0.91 || result.Description != "禾本科" {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+		if len(result.Candidates) != 2 || result.Candidates[1].CropType != "unknown" {
+			t.Fatalf("candidates = %+v", result.Candidates)
+		}
+	}
+	if n := stub.tokenCalls.Load(); n != 1 {
+		t.Errorf("token requested %d times, want 1", n)
+	}
+	if items := rec.Items(); len(items) != 1 || items[0].Calls != 2 || items[0].Provider != "baidu" {
+		t.Errorf("usage = %+v", items)
+	}
+}
+
+func TestBaiduRecognizeRefreshesRevokedToken(t *testing.T) {
+	stub := &baiduStub{tokens: []string{"old", "new"}}
+	stub.plant = func(w http.ResponseWriter, r *http.Request, call int32) {
+		if r.URL.Query().Get("access_token") == "old" {
+			w.Write([]byte(`{"error_code":111,"error_msg":"Access token expired"}`))
+			return
+		}
+		w.Write([]byte(`{"result":[{"name":"玉米","score":0.8}]}`))
+	}
+	srv := stub.server(t)
+	p := NewBaiduProvider("ak", "sk", srv.URL)
+
+	result, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.CropType != "玉米" {
+		t.Errorf("crop = %q", result.CropType)
+	}
+	if stub.tokenCalls.Load() != 2 || stub.plantCalls.Load() != 2 {
+		t.Errorf("token calls %d, plant calls %d, want 2 and 2", stub.tokenCalls.Load(), stub.plantCalls.Load())
+	}
+}
+
+func TestBaiduTokenRejected(t *testing.T) {
+	srv := (&baiduStub{tokens: []string{"x"}}).server(t)
+	p := NewBaiduProvider("ak", "wrong", srv.URL)
+
+	_, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want ProviderError", err)
+	}
+	if pe.Code != CodeUnauthorized || pe.ProviderCode != "invalid_client" || pe.Retryable {
+		t.Errorf("err = %+v", pe)
+	}
+}
+
+func TestBaiduErrorMapping(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    int
+		body      string
+		code      string
+		retryable bool
+	}{
+		{"qps limit", 200, `{"error_code":18,"error_msg":"Open api qps request limit reached"}`, CodeRateLimited, true},
+		{"daily quota", 200, `{"error_code":17,"error_msg":"Open api daily request limit reached"}`, CodeRateLimited, false},
+		{"no permission", 200, `{"error_code":6,"error_msg":"No permission to access data"}`, CodeForbidden, false},
+		{"bad image", 200, `{"error_code":216201,"error_msg":"image format error"}`, CodeInvalidRequest, false},
+		{"unknown business error", 200, `{"error_code":282000,"error_msg":"internal error"}`, CodeServerError, true},
+		{"http 503", 503, `busy`, CodeServerError, true},
+		{"http 400", 400, `bad`, CodeInvalidRequest, false},
+		{"empty result", 200, `{"result":[]}`, CodeBadResponse, false},
+		{"not json", 200, `<html>`, CodeBadResponse, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &baiduStub{tokens: []string{"tok"}}
+			stub.plant = func(w http.ResponseWriter, r *http.Request, call int32) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}
+			srv := stub.server(t)
+			_, err := NewBaiduProvider("ak", "sk", srv.URL).Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+			var pe *ProviderError
+			if !errors.As(err, &pe) {
+				t.Fatalf("err = %v, want ProviderError", err)
+			}
+			if pe.Code != tc.code || pe.Retryable != tc.retryable {
+				t.Errorf("code %q retryable %v, want %q %v", pe.Code, pe.Retryable, tc.code, tc.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen 提供商熔断中，直接失败不再调用
+var ErrCircuitOpen = errors.New("circuit_open")
+
+// BreakerConfig 熔断配置：窗口内请求数达到 MinRequests 且错误率达到 ErrorRate 时打开，
+// 打开 OpenDuration 后进入半开，放行一个探测请求，成功则关闭，失败重新打开
+type BreakerConfig struct {
+	Window       time.Duration
+	MinRequests  int
+	ErrorRate    float64
+	OpenDuration time.Duration
+}
+
+// DefaultBreakerConfig 默认熔断配置
+var DefaultBreakerConfig = BreakerConfig{
+	Window:       time.Minute,
+	MinRequests:  10,
+	ErrorRate:    0.5,
+	OpenDuration: 30 * time.Second,
+}
+
+type outcome struct {
+	at time.Time
+	ok bool
+}
+
+// Breaker 单个提供商的熔断器
+type Breaker struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	state    string
+	openedAt time.Time
+	probing  bool // 半开状态下已放行的探测请求
+	outcomes []outcome
+
+	lastError   string
+	lastErrorAt time.Time
+	probe       ProbeResult
+}
+
+// ProbeResult 最近一次健康探测
+type ProbeResult struct {
+	At        time.Time `json:"at"`
+	OK        bool      `json:"ok"`
+	LatencyMs int       `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// BreakerSnapshot 熔断器状态快照
+type BreakerSnapshot struct {
+	Provider    string       `json:"provider"`
+	State       string       `json:"state"`
+	Requests    int          `json:"requests"`
+	Failures    int          `json:"failures"`
+	ErrorRate   float64      `json:"error_rate"`
+	OpenedAt    *time.Time   `json:"opened_at,omitempty"`
+	LastError   string       `json:"last_error,omitempty"`
+	LastErrorAt *time.Time   `json:"last_error_at,omitempty"`
+	LastProbe   *ProbeResult `json:"last_probe,omitempty"`
+}
+
+func newBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{cfg: cfg, state: BreakerClosed}
+}
+
+// Allow 判断是否放行本次调用
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.OpenDuration {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = false
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record 记录调用结果；调用方主动取消、请求参数错误与图片下载失败不计入
+func (b *Breaker) Record(err error) {
+	if code := ErrorCode(err); errors.Is(err, context.Canceled) || code == CodeInvalidRequest || code == CodeDownloadFailed {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+		b.lastErrorAt = now
+	}
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if err != nil {
+			b.trip(now)
+			return
+		}
+		b.state = BreakerClosed
+		b.outcomes = nil
+	}
+	b.outcomes = append(b.prune(now), outcome{at: now, ok: err == nil})
+	if b.state == BreakerClosed {
+		total, failures := b.counts()
+		if total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.ErrorRate {
+			b.trip(now)
+		}
+	}
+}
+
+func (b *Breaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.outcomes = nil
+}
+
+// prune 丢弃窗口外的记录
+func (b *Breaker) prune(now time.Time) []outcome {
+	cutoff := now.Add(-b.cfg.Window)
+	i := 0
+	for i < len(b.outcomes) && b.outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	return b.outcomes[i:]
+}
+
+func (b *Breaker) counts() (int, int) {
+	failures := 0
+	for _, o := range b.outcomes {
+		if !o.ok {
+			failures++
+		}
+	}
+	return len(b.outcomes), failures
+}
+
+// recordProbe 记录健康探测；熔断打开时探测成功则提前进入半开
+func (b *Breaker) recordProbe(result ProbeResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probe = result
+	if result.OK && b.state == BreakerOpen {
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+}
+
+func (b *Breaker) snapshot(name string) BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.outcomes = b.prune(time.Now())
+	total, failures := b.counts()
+	out := BreakerSnapshot{Provider: name, State: b.state, Requests: total, Failures: failures, LastError: b.lastError}
+	if total > 0 {
+		out.ErrorRate = float64(failures) / float64(total)
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		out.OpenedAt = &openedAt
+	}
+	if !b.lastErrorAt.IsZero() {
+		at := b.lastErrorAt
+		out.LastErrorAt = &at
+	}
+	if !b.probe.At.IsZero() {
+		probe := b.probe
+		out.LastProbe = &probe
+	}
+	return out
+}
+
+var (
+	breakerMu     sync.Mutex
+	breakerConfig = DefaultBreakerConfig
+	breakers      = map[string]*Breaker{}
+)
+
+// ConfigureBreakers 设置熔断配置，已创建的熔断器一并重置
+func ConfigureBreakers(cfg BreakerConfig) {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	breakerConfig = cfg
+	breakers = map[string]*Breaker{}
+}
+
+func breakerFor(name string) *Breaker {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = newBreaker(breakerConfig)
+		breakers[name] = b
+	}
+	return b
+}
+
+// callWithBreaker 经熔断器调用提供商
+func callWithBreaker(ctx context.Context, provider Provider, name string, req Request) (*RecognitionResult, error) {
+	b := breakerFor(name)
+	if err := b.Allow(); err != nil {
+		return nil, err
+	}
+	result, err := provider.Recognize(ctx, req)
+	b.Record(err)
+	return result, err
+}
+
+// BreakerSnapshots 全部已注册提供商的熔断状态
+func BreakerSnapshots() []BreakerSnapshot {
+	names := ListProviders()
+	sort.Strings(names)
+	out := make([]BreakerSnapshot, 0, len(names))
+	for _, name := range names {
+		out = append(out, breakerFor(name).snapshot(name))
+	}
+	return out
+}
+
+// Prober 支持低成本健康探测的提供商
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// probeHTTP 以 GET 请求探测上游可达性，5xx 与 429 视为不健康，鉴权类 4xx 由识别请求计入熔断
+func probeHTTP(ctx context.Context, client *http.Client, url, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("probe status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// IsCircuitOpen 错误是否全部来自熔断，此时重试没有意义
+func IsCircuitOpen(err error) bool {
+	if err == nil {
+		return false
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		if len(errs) == 0 {
+			return false
+		}
+		for _, e := range errs {
+			if !IsCircuitOpen(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return errors.Is(err, ErrCircuitOpen)
+}
+
+// ProbeProviders 探测全部实现了 Prober 的提供商
+func ProbeProviders(ctx context.Context, timeout time.Duration) {
+	for _, name := range ListProviders() {
+		provider, err := GetProvider(name)
+		if err != nil {
+			continue
+		}
+		prober, ok := provider.(Prober)
+		if !ok {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		started := time.Now()
+		err = prober.Probe(probeCtx)
+		cancel()
+		result := ProbeResult{At: time.Now(), OK: err == nil, LatencyMs: int(time.Since(started).Milliseconds())}
+		if err != nil {
+			result.Error = err.Error()
+			log.Printf("health probe %s failed: %v", name, err)
+		}
+		breakerFor(name).recordProbe(result)
+	}
+}
+
+// StartHealthProber 按间隔在后台探测提供商，interval 不大于 0 时不启动
+func StartHealthProber(ctx context.Context, interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ProbeProviders(ctx, timeout)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
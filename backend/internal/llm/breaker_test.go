@@ -0,0 +1,214 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errUpstream = &ProviderError{Provider: "test", Code: CodeServerError, Status: 503, Retryable: true}
+
+func testBreaker() *Breaker {
+	return newBreaker(BreakerConfig{Window: time.Minute, MinRequests: 4, ErrorRate: 0.5, OpenDuration: 30 * time.Second})
+}
+
+func TestBreakerStaysClosedBelowMinRequests(t *testing.T) {
+	b := testBreaker()
+	for i := 0; i < 3; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		b.Record(errUpstream)
+	}
+	if b.state != BreakerClosed {
+		t.Fatalf("state = %s after 3 failures, want closed", b.state)
+	}
+}
+
+func TestBreakerTripsOnErrorRate(t *testing.T) {
+	b := testBreaker()
+	b.Record(nil)
+	b.Record(nil)
+	b.Record(errUpstream)
+	if b.state != BreakerClosed {
+		t.Fatalf("state = %s at 1/3 failures", b.state)
+	}
+	b.Record(errUpstream) // 2/4 = 0.5
+	if b.state != BreakerOpen {
+		t.Fatalf("state = %s at 2/4 failures, want open", b.state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow while open = %v", err)
+	}
+	snap := b.snapshot("test")
+	if snap.State != BreakerOpen || snap.OpenedAt == nil || snap.LastError == "" {
+		t.Errorf("snapshot = %+v", snap)
+	}
+}
+
+// openBreaker 返回已打开且冷却期已过的熔断器
+func openBreaker() *Breaker {
+	b := testBreaker()
+	b.trip(time.Now().Add(-time.Minute))
+	return b
+}
+
+func TestBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	b := openBreaker()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first call after cooldown: %v", err)
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second concurrent probe = %v, want circuit open", err)
+	}
+}
+
+func TestBreakerHalfOpenSuccessCloses(t *testing.T) {
+	b := openBreaker()
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(nil)
+	if b.state != BreakerClosed {
+		t.Fatalf("state = %s, want closed", b.state)
+	}
+	if total, failures := b.counts(); total != 1 || failures != 0 {
+		t.Errorf("window after close = %d/%d, want fresh window", failures, total)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow after close: %v", err)
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := openBreaker()
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(errUpstream)
+	if b.state != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.state)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow right after reopening = %v", err)
+	}
+}
+
+func TestBreakerIgnoresCallerErrors(t *testing.T) {
+	ignored := []error{
+		context.Canceled,
+		&ProviderError{Code: CodeInvalidRequest, Status: 400},
+		&ProviderError{Code: CodeDownloadFailed},
+	}
+	b := testBreaker()
+	for i := 0; i < 10; i++ {
+		b.Record(ignored[i%len(ignored)])
+	}
+	if total, _ := b.counts(); total != 0 || b.state != BreakerClosed {
+		t.Fatalf("caller errors counted: total=%d state=%s", total, b.state)
+	}
+
+	// 半开探测遇到调用方错误时释放探测名额，不改变状态
+	b = openBreaker()
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(context.Canceled)
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.state)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("probe slot not released: %v", err)
+	}
+}
+
+func TestBreakerPrunesOutsideWindow(t *testing.T) {
+	b := testBreaker()
+	old := time.Now().Add(-2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		b.outcomes = append(b.outcomes, outcome{at: old, ok: false})
+	}
+	b.Record(errUpstream)
+	if b.state != BreakerClosed {
+		t.Fatalf("expired failures should not trip the breaker")
+	}
+	if total, failures := b.counts(); total != 1 || failures != 1 {
+		t.Errorf("window = %d/%d, want 1/1", failures, total)
+	}
+}
+
+func TestBreakerSuccessfulProbeMovesToHalfOpen(t *testing.T) {
+	b := testBreaker()
+	b.trip(time.Now())
+	b.recordProbe(ProbeResult{At: time.Now(), OK: false})
+	if b.state != BreakerOpen {
+		t.Fatalf("failed probe changed state to %s", b.state)
+	}
+	b.recordProbe(ProbeResult{At: time.Now(), OK: true})
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.state)
+	}
+	if snap := b.snapshot("test"); snap.LastProbe == nil || !snap.LastProbe.OK {
+		t.Errorf("snapshot probe = %+v", snap.LastProbe)
+	}
+}
+
+// countingProvider 按预设错误返回并计数的提供商
+type countingProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *countingProvider) Name() string { return p.name }
+
+func (p *countingProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &RecognitionResult{CropType: "wheat", Confidence: 0.9}, nil
+}
+
+func TestRouterShortCircuitsOpenBreaker(t *testing.T) {
+	ConfigureBreakers(BreakerConfig{Window: time.Minute, MinRequests: 2, ErrorRate: 0.5, OpenDuration: time.Hour})
+	t.Cleanup(func() { ConfigureBreakers(DefaultBreakerConfig) })
+	name := fmt.Sprintf("breaker-test-%d", time.Now().UnixNano())
+	p := &countingProvider{name: name, err: errUpstream}
+	RegisterProvider(name, p)
+	t.Cleanup(func() { delete(providers, name) })
+	router, err := NewRouterProvider(RouterConfig{Chain: []string{name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := router.Recognize(context.Background(), Request{ImageURL: "https://example.com/a.jpg"}); !errors.Is(err, errUpstream) {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	_, err = router.Recognize(context.Background(), Request{ImageURL: "https://example.com/a.jpg"})
+	if !IsCircuitOpen(err) || ErrorCode(err) != CodeCircuitOpen {
+		t.Fatalf("err = %v, want circuit open", err)
+	}
+	if p.calls != 2 {
+		t.Errorf("provider called %d times, want 2", p.calls)
+	}
+}
+
+func TestIsCircuitOpenJoined(t *testing.T) {
+	if !IsCircuitOpen(errors.Join(ErrCircuitOpen, fmt.Errorf("qwen: %w", ErrCircuitOpen))) {
+		t.Error("all legs open should report circuit open")
+	}
+	if IsCircuitOpen(errors.Join(ErrCircuitOpen, errUpstream)) {
+		t.Error("mixed failures should not report circuit open")
+	}
+	if IsCircuitOpen(nil) {
+		t.Error("nil is not circuit open")
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnsembleMember 参与投票的提供商及权重
+type EnsembleMember struct {
+	Provider string  `json:"provider"`
+	Weight   float64 `json:"weight"`
+}
+
+// Vote 单个提供商的作答，失败时 Result 为空、Error 记录原因
+type Vote struct {
+	Provider   string             `json:"provider"`
+	Weight     float64            `json:"weight"`
+	Result     *RecognitionResult `json:"result,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	DurationMs int                `json:"duration_ms"`
+}
+
+// ensembleRecognizer 支持按提供商超时配置并行调用
+type ensembleRecognizer interface {
+	RecognizeEnsemble(ctx context.Context, req Request, members []EnsembleMember) []Vote
+}
+
+// RecognizeEnsemble 使用路由的单提供商超时并行调用全部成员
+func (p *RouterProvider) RecognizeEnsemble(ctx context.Context, req Request, members []EnsembleMember) []Vote {
+	return fanOut(ctx, req, members, p.timeoutFor)
+}
+
+// Ensemble 并行调用成员提供商并收集全部作答；provider 为路由提供商时沿用其超时配置
+func Ensemble(ctx context.Context, provider Provider, req Request, members []EnsembleMember) []Vote {
+	if router, ok := provider.(ensembleRecognizer); ok {
+		return router.RecognizeEnsemble(ctx, req, members)
+	}
+	return fanOut(ctx, req, members, nil)
+}
+
+func fanOut(ctx context.Context, req Request, members []EnsembleMember, timeoutFor func(string) time.Duration) []Vote {
+	votes := make([]Vote, len(members))
+	var wg sync.WaitGroup
+	for i, member := range members {
+		votes[i] = Vote{Provider: member.Provider, Weight: member.Weight}
+		provider, err := GetProvider(member.Provider)
+		if err != nil {
+			votes[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			callCtx := ctx
+			if timeoutFor != nil {
+				if timeout := timeoutFor(votes[i].Provider); timeout > 0 {
+					var cancel context.CancelFunc
+					callCtx, cancel = context.WithTimeout(ctx, timeout)
+					defer cancel()
+				}
+			}
+			started := time.Now()
+			result, err := callWithBreaker(callCtx, provider, votes[i].Provider, req)
+			votes[i].DurationMs = int(time.Since(started).Milliseconds())
+			if err != nil {
+				votes[i].Error = err.Error()
+				return
+			}
+			out := *result
+			out.Provider = votes[i].Provider
+			votes[i].Result = &out
+		}(i, provider)
+	}
+	wg.Wait()
+	return votes
+}
+
+// ParseEnsembleMembers 解析 name=weight 逗号分隔的成员配置，如 qwen=1,openai=0.8；省略权重时为 1
+func ParseEnsembleMembers(raw string) ([]EnsembleMember, error) {
+	var out []EnsembleMember
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weightRaw, hasWeight := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		weight := 1.0
+		if hasWeight {
+			v, err := strconv.ParseFloat(strings.TrimSpace(weightRaw), 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("invalid ensemble weight %q", part)
+			}
+			weight = v
+		}
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("invalid ensemble member %q", part)
+		}
+		seen[name] = true
+		out = append(out, EnsembleMember{Provider: name, Weight: weight})
+	}
+	return out, nil
+}
+
+// FormatEnsembleMembers 按 ParseEnsembleMembers 的格式输出
+func FormatEnsembleMembers(members []EnsembleMember) string {
+	parts := make([]string, 0, len(members))
+	for _, m := range members {
+		parts = append(parts, m.Provider+"="+strconv.FormatFloat(m.Weight, 'f', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,261 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 上游错误码，RecordFailure 直接使用作为 error_code
+const (
+	CodeTimeout        = "timeout"
+	CodeCanceled       = "canceled"
+	CodeNetwork        = "network_error"
+	CodeRateLimited    = "rate_limited"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeInvalidRequest = "invalid_request"
+	CodeNotFound       = "not_found"
+	CodeServerError    = "server_error"
+	CodeBadResponse    = "bad_response"
+	CodeDownloadFailed = "download_failed"
+	CodeCircuitOpen    = "circuit_open"
+)
+
+// ProviderError 上游调用失败，携带 HTTP 状态、提供商错误码、是否可重试与 Retry-After 提示
+type ProviderError struct {
+	Provider     string
+	Code         string
+	Status       int    // HTTP 状态码，百度等以 200 返回错误时为 0
+	ProviderCode string // 提供商自身的错误码
+	Message      string
+	Retryable    bool
+	RetryAfter   time.Duration
+	Err          error
+}
+
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	if e.Provider != "" {
+		b.WriteString(e.Provider)
+		b.WriteString(" ")
+	}
+	b.WriteString(e.Code)
+	if e.Status > 0 {
+		fmt.Fprintf(&b, ": status %d", e.Status)
+	}
+	if e.ProviderCode != "" {
+		fmt.Fprintf(&b, ": code %s", e.ProviderCode)
+	}
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// statusError 按 HTTP 状态码构造错误，408/429/5xx 可重试
+func statusError(provider string, status int, providerCode, message string, header http.Header) *ProviderError {
+	e := &ProviderError{
+		Provider:     provider,
+		Code:         codeForStatus(status),
+		Status:       status,
+		ProviderCode: providerCode,
+		Message:      truncate(strings.TrimSpace(message), 300),
+	}
+	e.Retryable = status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+	if header != nil {
+		e.RetryAfter = parseRetryAfter(header.Get("Retry-After"))
+	}
+	return e
+}
+
+func codeForStatus(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CodeUnauthorized
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return CodeTimeout
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status >= 500:
+		return CodeServerError
+	case status >= 400:
+		return CodeInvalidRequest
+	}
+	return CodeBadResponse
+}
+
+// transportError 请求未拿到响应：超时与网络错误可重试，调用方取消不重试
+func transportError(provider string, err error) *ProviderError {
+	e := &ProviderError{Provider: provider, Code: CodeNetwork, Retryable: true, Err: err}
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Code = CodeCanceled
+		e.Retryable = false
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Code = CodeTimeout
+	default:
+		var timeout interface{ Timeout() bool }
+		if errors.As(err, &timeout) && timeout.Timeout() {
+			e.Code = CodeTimeout
+		}
+	}
+	return e
+}
+
+// badResponse 响应无法解析或缺少内容
+func badResponse(provider, message string, err error) *ProviderError {
+	return &ProviderError{Provider: provider, Code: CodeBadResponse, Message: message, Err: err}
+}
+
+// openAIErrorDetail 解析 OpenAI 兼容错误体中的 code 与 message
+func openAIErrorDetail(body string) (string, string) {
+	var payload struct {
+		Error struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &payload); err != nil || payload.Error.Message == "" {
+		return "", body
+	}
+	code := payload.Error.Type
+	if payload.Error.Code != nil {
+		code = fmt.Sprint(payload.Error.Code)
+	}
+	return code, payload.Error.Message
+}
+
+// parseRetryAfter 支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Backoff 第 attempt 次失败后的退避时间：base 按次数翻倍，不超过 max，取后一半区间内的随机值
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := base
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// leafErrors 展开回退链合并的错误
+func leafErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var out []error
+		for _, e := range joined.Unwrap() {
+			out = append(out, leafErrors(e)...)
+		}
+		return out
+	}
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+// Retryable 回退链中任一提供商的失败可重试即重试；熔断、输出不合规与调用方错误不重试
+func Retryable(err error) bool {
+	for _, e := range leafErrors(err) {
+		var pe *ProviderError
+		if errors.As(e, &pe) {
+			if pe.Retryable {
+				return true
+			}
+			continue
+		}
+		if errors.Is(e, context.DeadlineExceeded) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter 上游要求的最长等待时间，没有提示时为 0
+func RetryAfter(err error) time.Duration {
+	var out time.Duration
+	for _, e := range leafErrors(err) {
+		var pe *ProviderError
+		if errors.As(e, &pe) && pe.RetryAfter > out {
+			out = pe.RetryAfter
+		}
+	}
+	return out
+}
+
+// ErrorCode 取首个非熔断错误的错误码，全部熔断时为 circuit_open，无法识别时返回空串
+func ErrorCode(err error) string {
+	code := ""
+	for _, e := range leafErrors(err) {
+		var pe *ProviderError
+		var outErr *OutputError
+		switch {
+		case errors.As(e, &pe):
+			return pe.Code
+		case errors.As(e, &outErr):
+			return outErr.Code
+		case errors.Is(e, ErrCircuitOpen):
+			code = CodeCircuitOpen
+		case errors.Is(e, context.Canceled):
+			return CodeCanceled
+		case errors.Is(e, context.DeadlineExceeded):
+			return CodeTimeout
+		}
+	}
+	return code
+}
+
+// ErrorProvider 取错误所属的提供商
+func ErrorProvider(err error) string {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Provider
+	}
+	return ""
+}
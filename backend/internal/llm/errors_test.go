@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		code       string
+		retryable  bool
+		wait       time.Duration
+	}{
+		{"429 with Retry-After seconds", 429, "7", CodeRateLimited, true, 7 * time.Second},
+		{"429 without Retry-After", 429, "", CodeRateLimited, true, 0},
+		{"500", 500, "", CodeServerError, true, 0},
+		{"503 with Retry-After", 503, "2", CodeServerError, true, 2 * time.Second},
+		{"504", 504, "", CodeTimeout, true, 0},
+		{"408", 408, "", CodeTimeout, true, 0},
+		{"400", 400, "", CodeInvalidRequest, false, 0},
+		{"401", 401, "", CodeUnauthorized, false, 0},
+		{"403", 403, "", CodeForbidden, false, 0},
+		{"404", 404, "", CodeNotFound, false, 0},
+		{"422", 422, "", CodeInvalidRequest, false, 0},
+		{"invalid Retry-After", 429, "soon", CodeRateLimited, true, 0},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		if tc.retryAfter != "" {
+			header.Set("Retry-After", tc.retryAfter)
+		}
+		err := statusError("openai", tc.status, "", "upstream says no", header)
+		if err.Code != tc.code || err.Retryable != tc.retryable || err.RetryAfter != tc.wait {
+			t.Errorf("%s: got code %s retryable %v wait %s", tc.name, err.Code, err.Retryable, err.RetryAfter)
+		}
+		if Retryable(err) != tc.retryable || RetryAfter(err) != tc.wait || ErrorCode(err) != tc.code {
+			t.Errorf("%s: helpers disagree with the error fields", tc.name)
+		}
+	}
+}
+
+func TestParseRetryAfterHTTPDate(t *testing.T) {
+	at := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(at); d < 25*time.Second || d > 30*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s", at, d)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(past); d != 0 {
+		t.Errorf("past date = %s, want 0", d)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		code      string
+		retryable bool
+	}{
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, CodeNetwork, true},
+		{"client timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, CodeTimeout, true},
+		{"deadline exceeded", fmt.Errorf("post: %w", context.DeadlineExceeded), CodeTimeout, true},
+		{"caller canceled", fmt.Errorf("post: %w", context.Canceled), CodeCanceled, false},
+	}
+	for _, tc := range cases {
+		err := transportError("qwen", tc.err)
+		if err.Code != tc.code || err.Retryable != tc.retryable || !errors.Is(err, tc.err) {
+			t.Errorf("%s: got code %s retryable %v", tc.name, err.Code, err.Retryable)
+		}
+		if Retryable(err) != tc.retryable || ErrorCode(err) != tc.code {
+			t.Errorf("%s: Retryable %v ErrorCode %s", tc.name, Retryable(err), ErrorCode(err))
+		}
+	}
+}
+
+func TestRetryableAndErrorCode(t *testing.T) {
+	rateLimited := &ProviderError{Provider: "qwen", Code: CodeRateLimited, Retryable: true, RetryAfter: 3 * time.Second}
+	unauthorized := &ProviderError{Provider: "openai", Code: CodeUnauthorized}
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+		code      string
+		wait      time.Duration
+	}{
+		{"nil", nil, false, "", 0},
+		{"plain error", errors.New("boom"), false, "", 0},
+		{"wrapped deadline", fmt.Errorf("recognize: %w", context.DeadlineExceeded), true, CodeTimeout, 0},
+		{"wrapped cancel", fmt.Errorf("recognize: %w", context.Canceled), false, CodeCanceled, 0},
+		{"wrapped provider error", fmt.Errorf("qwen: %w", rateLimited), true, CodeRateLimited, 3 * time.Second},
+		{"output error", &OutputError{Code: OutputSchemaInvalid}, false, OutputSchemaInvalid, 0},
+		{"circuit open", fmt.Errorf("openai: %w", ErrCircuitOpen), false, CodeCircuitOpen, 0},
+		// 回退链合并的错误：任一可重试即重试，错误码取首个非熔断错误
+		{"chain with retryable member", errors.Join(fmt.Errorf("openai: %w", unauthorized), fmt.Errorf("qwen: %w", rateLimited)), true, CodeUnauthorized, 3 * time.Second},
+		{"chain skips open circuit for code", errors.Join(fmt.Errorf("openai: %w", ErrCircuitOpen), unauthorized), false, CodeUnauthorized, 0},
+		{"chain all open", errors.Join(ErrCircuitOpen, ErrCircuitOpen), false, CodeCircuitOpen, 0},
+	}
+	for _, tc := range cases {
+		if got := Retryable(tc.err); got != tc.retryable {
+			t.Errorf("%s: Retryable = %v, want %v", tc.name, got, tc.retryable)
+		}
+		if got := ErrorCode(tc.err); got != tc.code {
+			t.Errorf("%s: ErrorCode = %q, want %q", tc.name, got, tc.code)
+		}
+		if got := RetryAfter(tc.err); got != tc.wait {
+			t.Errorf("%s: RetryAfter = %s, want %s", tc.name, got, tc.wait)
+		}
+	}
+}
+
+func TestProviderErrorMessage(t *testing.T) {
+	err := &ProviderError{Provider: "baidu", Code: CodeRateLimited, Status: 200, ProviderCode: "18", Message: "qps limit", Err: errors.New("inner")}
+	want := "baidu rate_limited: status 200: code 18: qps limit: inner"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if ErrorProvider(fmt.Errorf("wrapped: %w", err)) != "baidu" {
+		t.Error("ErrorProvider should unwrap")
+	}
+	long := statusError("openai", 500, "", strings.Repeat("x", 500), nil)
+	if len(long.Message) != 300 {
+		t.Errorf("message length = %d, want truncated to 300", len(long.Message))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	cases := []struct {
+		name    string
+		attempt int
+		backoff time.Duration
+	}{
+		{"attempt zero counts as first", 0, 100 * time.Millisecond},
+		{"first attempt", 1, 100 * time.Millisecond},
+		{"second attempt doubles", 2, 200 * time.Millisecond},
+		{"third attempt doubles again", 3, 400 * time.Millisecond},
+		{"capped at max", 5, time.Second},
+		{"far past the cap", 50, time.Second},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 50; i++ {
+			if d := Backoff(tc.attempt, base, max); d < tc.backoff/2 || d > tc.backoff {
+				t.Fatalf("%s: Backoff = %s, want within [%s, %s]", tc.name, d, tc.backoff/2, tc.backoff)
+			}
+		}
+	}
+}
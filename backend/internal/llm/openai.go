@@ -2,8 +2,10 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,19 +13,29 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// cropPrompt 内置作物识别提示词，未配置提示词模板时使用
+const cropPrompt = "请识别这是什么作物植物，仅返回JSON：{\"crop_type\":\"作物类型英文名\",\"confidence\":0.0-1.0,\"description\":\"简短描述\",\"growth_stage\":\"生育期名称，无法判断填null\",\"growth_stage_code\":\"BBCH两位代码，无法判断填null\",\"possible_issue\":\"可能的病虫草害，没有填null\",\"candidates\":[{\"crop_type\":\"候选作物英文名\",\"confidence\":0.0-1.0}]}，candidates 按置信度降序最多3个"
+
+// repairPrompt 输出不合规时的修复提示词
+const repairPrompt = "上一条回复不符合要求（%s）。请只返回一个JSON对象，必须包含 crop_type(字符串)、confidence(0到1的数字)、description(字符串)、growth_stage(字符串或null)、growth_stage_code(BBCH两位代码字符串或null)、possible_issue(字符串或null)、candidates(数组，元素含 crop_type/confidence)、findings(数组，元素含 category/name/confidence)，不要附加任何其他文字。"
+
 // OpenAIProvider OpenAI 兼容 Provider
 type OpenAIProvider struct {
 	BaseProvider
-	HTTPClient *http.Client
-	Model      string
-	ImageInput string
+	HTTPClient       *http.Client
+	Model            string
+	ImageInput       string
+	StructuredOutput bool // 使用 response_format json_schema 约束输出
+
+	schemaUnsupported atomic.Bool
 }
 
 // NewOpenAIProvider 创建 OpenAI Provider
-func NewOpenAIProvider(apiKey, endpoint, model, imageInput string) *OpenAIProvider {
+func NewOpenAIProvider(apiKey, endpoint, model, imageInput string, structuredOutput bool) *OpenAIProvider {
 	if model == "" {
 		model = "gpt-4o"
 	}
@@ -33,50 +45,105 @@ func NewOpenAIProvider(apiKey, endpoint, model, imageInput string) *OpenAIProvid
 			APIKey:   apiKey,
 			Endpoint: endpoint,
 		},
-		HTTPClient: &http.Client{Timeout: 60 * time.Second},
-		Model:      model,
-		ImageInput: imageInput,
+		// 超时由调用方 context 控制，客户端断开时请求随之取消
+		HTTPClient:       &http.Client{},
+		Model:            model,
+		ImageInput:       imageInput,
+		StructuredOutput: structuredOutput,
 	}
 }
 
-// Recognize 调用 OpenAI API 进行图像识别
-func (p *OpenAIProvider) Recognize(imageURL string) (*RecognitionResult, error) {
-	resolvedURL, err := p.resolveImageURL(imageURL)
+// Recognize 调用 OpenAI API 进行图像识别，输出不合规时追加一次修复重试
+func (p *OpenAIProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	resolvedURL, err := p.resolveImageURL(ctx, req.ImageURL)
 	if err != nil {
 		return nil, err
 	}
 
-	// 构建请求
-	reqBody := map[string]interface{}{
-		"model": p.Model,
-		"messages": []map[string]interface{}{
-			{
-				"role": "user",
-				"content": []map[string]interface{}{
-					{
-						"type": "text",
-						"text": "请识别这是什么作物植物，提供JSON格式回复：{\"crop_type\":\"作物类型英文名\",\"confidence\":0.0-1.0,\"description\":\"简短描述\"}",
-					},
-					{
-						"type": "image_url",
-						"image_url": map[string]string{
-							"url": resolvedURL,
-						},
+	messages := []map[string]interface{}{
+		{
+			"role": "user",
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": req.promptOr(cropPrompt),
+				},
+				{
+					"type": "image_url",
+					"image_url": map[string]string{
+						"url": resolvedURL,
 					},
 				},
 			},
 		},
+	}
+
+	model := req.modelOr(p.Model)
+	content, err := p.complete(ctx, model, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseCropResponse(content)
+	if err == nil {
+		result.Model = model
+		return result, nil
+	}
+	var outErr *OutputError
+	if !errors.As(err, &outErr) || !outErr.Repairable() {
+		return nil, err
+	}
+
+	// 修复重试：带上原回复与校验错误，要求模型重新输出
+	messages = append(messages,
+		map[string]interface{}{"role": "assistant", "content": content},
+		map[string]interface{}{"role": "user", "content": fmt.Sprintf(repairPrompt, outErr.Detail)},
+	)
+	repaired, err := p.complete(ctx, model, messages)
+	if err != nil {
+		return nil, err
+	}
+	result, err = parseCropResponse(repaired)
+	if err != nil {
+		if errors.As(err, &outErr) {
+			outErr.Repaired = true
+		}
+		return nil, err
+	}
+	result.Model = model
+	return result, nil
+}
+
+// complete 调用 /chat/completions 返回消息文本，端点不支持 json_schema 时自动降级
+func (p *OpenAIProvider) complete(ctx context.Context, model string, messages []map[string]interface{}) (string, error) {
+	useSchema := p.StructuredOutput && !p.schemaUnsupported.Load()
+	content, err := p.post(ctx, model, messages, useSchema)
+	var pe *ProviderError
+	if useSchema && errors.As(err, &pe) && pe.Status == http.StatusBadRequest && strings.Contains(strings.ToLower(pe.Message), "response_format") {
+		p.schemaUnsupported.Store(true)
+		content, err = p.post(ctx, model, messages, false)
+	}
+	return content, err
+}
+
+func (p *OpenAIProvider) post(ctx context.Context, model string, messages []map[string]interface{}, useSchema bool) (string, error) {
+	reqBody := map[string]interface{}{
+		"model":      model,
+		"messages":   messages,
 		"max_tokens": 500,
 	}
+	if useSchema {
+		reqBody["response_format"] = recognitionResponseFormat()
+	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", p.Endpoint+"/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.Endpoint+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -84,46 +151,68 @@ func (p *OpenAIProvider) Recognize(imageURL string) (*RecognitionResult, error)
 
 	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call API: %w", err)
+		return "", transportError(p.NameVal, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return "", transportError(p.NameVal, err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		code, message := openAIErrorDetail(string(body))
+		return "", statusError(p.NameVal, resp.StatusCode, code, message, resp.Header)
 	}
 
-	var result map[string]interface{}
+	var result struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Content *string `json:"content"`
+				Refusal *string `json:"refusal"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
 	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return "", badResponse(p.NameVal, "failed to decode response", err)
 	}
+	// 输出不合规时同样已计费，先记录用量
+	recordUsage(ctx, p.NameVal, model, result.Usage.PromptTokens, result.Usage.CompletionTokens)
 
 	// 解析响应
-	choices, ok := result["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return nil, fmt.Errorf("no choices in response")
+	if len(result.Choices) == 0 {
+		return "", badResponse(p.NameVal, "no choices in response", nil)
 	}
-
-	message, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("no message in choice")
+	choice := result.Choices[0]
+	if choice.Message.Refusal != nil && *choice.Message.Refusal != "" {
+		return "", &OutputError{Code: OutputRefused, Detail: *choice.Message.Refusal}
 	}
-
-	content, ok := message["content"].(string)
-	if !ok {
-		return nil, fmt.Errorf("no content in message")
+	if choice.FinishReason == "length" {
+		return "", &OutputError{Code: OutputTruncated, Detail: "finish_reason=length"}
 	}
+	if choice.Message.Content == nil {
+		return "", &OutputError{Code: OutputEmpty, Detail: "no content in message"}
+	}
+	return *choice.Message.Content, nil
+}
 
-	// 解析 JSON 内容
-	return parseCropResponse(content)
+// Probe 请求模型列表探测接口可用性
+func (p *OpenAIProvider) Probe(ctx context.Context) error {
+	return probeHTTP(ctx, p.HTTPClient, p.Endpoint+"/models", p.APIKey)
 }
 
-func (p *OpenAIProvider) resolveImageURL(imageURL string) (string, error) {
-	mode := strings.ToLower(strings.TrimSpace(p.ImageInput))
+func (p *OpenAIProvider) resolveImageURL(ctx context.Context, imageURL string) (string, error) {
+	return resolveImageInput(ctx, p.HTTPClient, p.ImageInput, imageURL)
+}
+
+// resolveImageInput 按 url/base64/auto 模式决定直接传 URL 还是内联为 data URL
+func resolveImageInput(ctx context.Context, client *http.Client, imageInput, imageURL string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(imageInput))
 	if mode == "" {
 		mode = "auto"
 	}
@@ -165,7 +254,7 @@ func (p *OpenAIProvider) resolveImageURL(imageURL string) (string, error) {
 		return imageURL, nil
 	}
 
-	dataURL, err := p.fetchAsDataURL(imageURL)
+	dataURL, err := fetchAsDataURL(ctx, client, imageURL)
 	if err != nil {
 		return "", err
 	}
@@ -183,24 +272,62 @@ func isPrivateHost(host string) bool {
 	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
 }
 
-func (p *OpenAIProvider) fetchAsDataURL(imageURL string) (string, error) {
-	req, err := http.NewRequest("GET", imageURL, nil)
+func fetchAsDataURL(ctx context.Context, client *http.Client, imageURL string) (string, error) {
+	contentType, data, err := fetchImage(ctx, client, imageURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to create image request: %w", err)
+		return "", err
 	}
-	resp, err := p.HTTPClient.Do(req)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return fmt.Sprintf("data:%s;base64,%s", contentType, encoded), nil
+}
+
+// 下载图片的大小上限与独立调用时的超时
+const (
+	maxImageBytes     = 20 << 20
+	imageFetchTimeout = 30 * time.Second
+)
+
+var imageFetchClient = &http.Client{Timeout: imageFetchTimeout}
+
+// FetchImage 下载图片，返回 Content-Type 与原始字节；超过 20MB 或 30 秒未完成视为下载失败
+func FetchImage(ctx context.Context, imageURL string) (string, []byte, error) {
+	return fetchImage(ctx, imageFetchClient, imageURL)
+}
+
+// fetchImage 下载图片，返回 Content-Type 与原始字节
+func fetchImage(ctx context.Context, client *http.Client, imageURL string) (string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create image request: %w", err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download image: %w", err)
+		e := transportError("", err)
+		if e.Code == CodeNetwork {
+			e.Code = CodeDownloadFailed
+		}
+		e.Message = "failed to download image"
+		return "", nil, e
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+		e := statusError("", resp.StatusCode, "", "failed to download image", resp.Header)
+		e.Code = CodeDownloadFailed
+		return "", nil, e
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
 	if err != nil {
-		return "", fmt.Errorf("failed to read image: %w", err)
+		e := transportError("", err)
+		if e.Code == CodeNetwork {
+			e.Code = CodeDownloadFailed
+		}
+		e.Message = "failed to read image"
+		return "", nil, e
+	}
+	if len(data) > maxImageBytes {
+		return "", nil, &ProviderError{Code: CodeDownloadFailed, Message: "image too large"}
 	}
 
 	contentType := resp.Header.Get("Content-Type")
@@ -210,9 +337,7 @@ func (p *OpenAIProvider) fetchAsDataURL(imageURL string) (string, error) {
 	if contentType == "" {
 		contentType = "image/jpeg"
 	}
-
-	encoded := base64.StdEncoding.EncodeToString(data)
-	return fmt.Sprintf("data:%s;base64,%s", contentType, encoded), nil
+	return contentType, data, nil
 }
 
 func contentTypeFromExt(imageURL string) string {
@@ -230,26 +355,3 @@ func contentTypeFromExt(imageURL string) string {
 		return ""
 	}
 }
-
-// parseCropResponse 解析作物识别的 JSON 响应
-func parseCropResponse(content string) (*RecognitionResult, error) {
-	// 先尝试直接解析
-	var result RecognitionResult
-	if err := json.Unmarshal([]byte(content), &result); err == nil {
-		result.RawText = content
-		return &result, nil
-	}
-
-	// 尝试从内容中提取 JSON
-	start := strings.Index(content, "{")
-	end := strings.LastIndex(content, "}")
-	if start >= 0 && end > start {
-		trimmed := strings.TrimSpace(content[start : end+1])
-		if err := json.Unmarshal([]byte(trimmed), &result); err == nil {
-			result.RawText = content
-			return &result, nil
-		}
-	}
-
-	return nil, fmt.Errorf("failed to parse response")
-}
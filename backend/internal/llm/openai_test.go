@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// openAIServer 依次返回 replies 中的消息内容，记录收到的请求体
+func openAIServer(t *testing.T, replies ...string) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, body)
+		n := len(requests)
+		mu.Unlock()
+		if n > len(replies) {
+			t.Errorf("unexpected request %d", n)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"finish_reason": "stop", "message": map[string]interface{}{"role": "assistant", "content": replies[n-1]}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestOpenAIRepairsInvalidOutputOnce(t *testing.T) {
+	srv, requests := openAIServer(t, "这是一株小麦", validCropJSON)
+	p := NewOpenAIProvider("sk-test", srv.URL, "gpt-4o", "url", false)
+
+	result, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.CropType != "wheat" {
+		t.Errorf("result = %+v", result)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(*requests))
+	}
+	// 修复请求带上原回复与校验错误
+	messages := (*requests)[1]["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("repair messages = %d, want 3", len(messages))
+	}
+	assistant := messages[1].(map[string]interface{})
+	repair := messages[2].(map[string]interface{})
+	if assistant["role"] != "assistant" || assistant["content"] != "这是一株小麦" {
+		t.Errorf("assistant message = %v", assistant)
+	}
+	if content, _ := repair["content"].(string); !strings.Contains(content, "no json object") {
+		t.Errorf("repair prompt = %q", content)
+	}
+}
+
+func TestOpenAIRepairFailureIsFinal(t *testing.T) {
+	srv, requests := openAIServer(t,
+		`{"crop_type":"wheat"}`,
+		`{"crop_type":"wheat","confidence":2,"description":"","growth_stage":null,"possible_issue":null}`,
+		validCropJSON,
+	)
+	p := NewOpenAIProvider("sk-test", srv.URL, "gpt-4o", "url", false)
+
+	_, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	var outErr *OutputError
+	if !errors.As(err, &outErr) {
+		t.Fatalf("err = %v, want OutputError", err)
+	}
+	if outErr.Code != OutputSchemaInvalid || !outErr.Repaired || outErr.Repairable() {
+		t.Errorf("err = %+v", outErr)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("requests = %d, want exactly one repair attempt", len(*requests))
+	}
+}
+
+func TestOpenAIValidOutputSkipsRepair(t *testing.T) {
+	srv, requests := openAIServer(t, validCropJSON)
+	p := NewOpenAIProvider("sk-test", srv.URL, "gpt-4o", "url", true)
+
+	if _, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL}); err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(*requests))
+	}
+	format, _ := (*requests)[0]["response_format"].(map[string]interface{})
+	if format["type"] != "json_schema" {
+		t.Errorf("response_format = %v", (*requests)[0]["response_format"])
+	}
+}
+
+func TestOpenAIUsesRequestPrompt(t *testing.T) {
+	srv, requests := openAIServer(t, validCropJSON, validCropJSON)
+	p := NewOpenAIProvider("sk-test", srv.URL, "gpt-4o", "url", false)
+
+	if _, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL, Prompt: "识别作物"}); err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if _, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL}); err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	for i, want := range []string{"识别作物", cropPrompt} {
+		messages := (*requests)[i]["messages"].([]interface{})
+		content := messages[0].(map[string]interface{})["content"].([]interface{})
+		if text := content[0].(map[string]interface{})["text"]; text != want {
+			t.Errorf("request %d prompt = %v, want %q", i, text, want)
+		}
+	}
+}
+
+func TestOpenAIUsesRequestModel(t *testing.T) {
+	srv, requests := openAIServer(t, validCropJSON, validCropJSON)
+	p := NewOpenAIProvider("sk-test", srv.URL, "gpt-4o", "url", false)
+
+	result, err := p.Recognize(context.Background(), Request{ImageURL: testImageDataURL, Model: "gpt-4o-mini"})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.Model != "gpt-4o-mini" || (*requests)[0]["model"] != "gpt-4o-mini" {
+		t.Errorf("model = %s / %v, want gpt-4o-mini", result.Model, (*requests)[0]["model"])
+	}
+	result, err = p.Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.Model != "gpt-4o" || (*requests)[1]["model"] != "gpt-4o" {
+		t.Errorf("default model = %s / %v, want gpt-4o", result.Model, (*requests)[1]["model"])
+	}
+}
+
+func TestFetchImageRejectsOversizedImage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		size := maxImageBytes
+		if r.URL.Path == "/big.jpg" {
+			size++
+		}
+		w.Write(make([]byte, size))
+	}))
+	defer srv.Close()
+
+	contentType, data, err := FetchImage(context.Background(), srv.URL+"/ok.jpg")
+	if err != nil || contentType != "image/jpeg" || len(data) != maxImageBytes {
+		t.Fatalf("at limit: %s %d bytes, err %v", contentType, len(data), err)
+	}
+	_, _, err = FetchImage(context.Background(), srv.URL+"/big.jpg")
+	if ErrorCode(err) != CodeDownloadFailed || !strings.Contains(err.Error(), "image too large") {
+		t.Errorf("err = %v, want image too large", err)
+	}
+}
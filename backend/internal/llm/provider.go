@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -12,13 +13,61 @@ type RecognitionResult struct {
 	Confidence   float64 `json:"confidence"`
 	Description  string  `json:"description"`
 	GrowthStage  *string `json:"growth_stage"`
+	GrowthStageCode *string `json:"growth_stage_code"` // BBCH 两位代码
 	PossibleIssue *string `json:"possible_issue"`
+	Provider     string  `json:"provider,omitempty"` // 实际返回结果的提供商
+	Model        string  `json:"model,omitempty"`
+	PromptVersion int    `json:"prompt_version,omitempty"`
+	Mode         string  `json:"mode,omitempty"`
+	Locale       string  `json:"locale,omitempty"` // 渲染提示词使用的语言
+	Findings     []Finding `json:"findings,omitempty"`
+	Candidates   []Candidate `json:"candidates,omitempty"` // 按置信度降序的候选作物
+	Votes        []Vote      `json:"votes,omitempty"` // 多提供商投票时每个成员的作答
+	CachedFrom   uint        `json:"-"`                 // 命中缓存时的来源结果 ID
+	ExperimentID uint        `json:"-"`                 // 参与的 A/B 实验及分组
+	ArmID        uint        `json:"-"`
+}
+
+// Candidate 候选作物
+type Candidate struct {
+	CropType   string  `json:"crop_type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Finding 病害/虫害/杂草识别结论
+type Finding struct {
+	Category   string  `json:"category"` // disease/pest/weed
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Request 单次识别请求
+type Request struct {
+	ImageURL string
+	Prompt   string // 本次使用的提示词，为空时使用提供商内置的默认提示词
+	Model    string // 本次指定的模型，覆盖提供商配置的默认模型；不支持切换模型的提供商忽略
+}
+
+// promptOr 返回请求指定的提示词，未设置时使用 fallback
+func (r Request) promptOr(fallback string) string {
+	if r.Prompt != "" {
+		return r.Prompt
+	}
+	return fallback
+}
+
+// modelOr 返回请求指定的模型，未设置时使用 fallback
+func (r Request) modelOr(fallback string) string {
+	if r.Model != "" {
+		return r.Model
+	}
+	return fallback
 }
 
 // Provider 大模型提供商接口
 type Provider interface {
 	Name() string
-	Recognize(imageURL string) (*RecognitionResult, error)
+	Recognize(ctx context.Context, req Request) (*RecognitionResult, error)
 }
 
 // BaseProvider 基础提供商
@@ -58,6 +107,25 @@ func ListProviders() []string {
 	return names
 }
 
+// ProviderModel 返回已注册提供商当前配置的模型名，未知时为空
+func ProviderModel(name string) string {
+	p, ok := providers[name]
+	if !ok {
+		return ""
+	}
+	switch v := p.(type) {
+	case *OpenAIProvider:
+		return v.Model
+	case *QwenProvider:
+		return v.Model
+	case *BaiduProvider:
+		return "plant"
+	case *MockProvider:
+		return "mock"
+	}
+	return ""
+}
+
 // MockProvider 用于测试的 Mock 提供商
 type MockProvider struct {
 	BaseProvider
@@ -69,6 +137,10 @@ func NewMockProvider() *MockProvider {
 		CropType:    "wheat",
 		Confidence:  0.92,
 		Description: "小麦（Triticum aestivum）是一种重要的谷类作物",
+		Candidates: []Candidate{
+			{CropType: "wheat", Confidence: 0.92},
+			{CropType: "barley", Confidence: 0.05},
+		},
 	}
 	return &MockProvider{
 		BaseProvider: BaseProvider{NameVal: "mock"},
@@ -76,10 +148,21 @@ func NewMockProvider() *MockProvider {
 	}
 }
 
-func (p *MockProvider) Recognize(imageURL string) (*RecognitionResult, error) {
+func (p *MockProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
 	// 模拟延迟
 	// time.Sleep(500 * time.Millisecond)
-	return p.Result, nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	recordUsage(ctx, p.NameVal, "mock", 0, 0)
+	result := *p.Result
+	result.Model = "mock"
+	return &result, nil
+}
+
+// Probe Mock 始终健康
+func (p *MockProvider) Probe(ctx context.Context) error {
+	return ctx.Err()
 }
 
 // ParseResult 解析 JSON 结果
@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// QwenProvider 阿里云百炼 DashScope 通义千问视觉 Provider
+type QwenProvider struct {
+	BaseProvider
+	HTTPClient *http.Client
+	Model      string
+	ImageInput string
+	Workspace  string
+}
+
+// NewQwenProvider 创建 DashScope Provider
+func NewQwenProvider(apiKey, endpoint, model, imageInput, workspace string) *QwenProvider {
+	if endpoint == "" {
+		endpoint = "https://dashscope.aliyuncs.com"
+	}
+	if model == "" {
+		model = "qwen-vl-max"
+	}
+	return &QwenProvider{
+		BaseProvider: BaseProvider{
+			NameVal:  "qwen",
+			APIKey:   apiKey,
+			Endpoint: strings.TrimRight(endpoint, "/"),
+		},
+		HTTPClient: &http.Client{},
+		Model:      model,
+		ImageInput: imageInput,
+		Workspace:  workspace,
+	}
+}
+
+type dashScopeResponse struct {
+	RequestID string `json:"request_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Output    struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Role    string `json:"role"`
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// Probe 请求兼容模式的模型列表探测接口可用性
+func (p *QwenProvider) Probe(ctx context.Context) error {
+	return probeHTTP(ctx, p.HTTPClient, p.Endpoint+"/compatible-mode/v1/models", p.APIKey)
+}
+
+// Recognize 调用 DashScope 多模态生成接口识别
+func (p *QwenProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	resolvedURL, err := resolveImageInput(ctx, p.HTTPClient, p.ImageInput, req.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	model := req.modelOr(p.Model)
+	reqBody := map[string]interface{}{
+		"model": model,
+		"input": map[string]interface{}{
+			"messages": []map[string]interface{}{
+				{
+					"role": "user",
+					"content": []map[string]string{
+						{"image": resolvedURL},
+						{"text": req.promptOr(cropPrompt)},
+					},
+				},
+			},
+		},
+		"parameters": map[string]interface{}{
+			"max_tokens": 500,
+		},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := p.Endpoint + "/api/v1/services/aigc/multimodal-generation/generation"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if p.Workspace != "" {
+		httpReq.Header.Set("X-DashScope-WorkSpace", p.Workspace)
+	}
+
+	resp, err := p.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, transportError(p.NameVal, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(p.NameVal, err)
+	}
+
+	var result dashScopeResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError(p.NameVal, resp.StatusCode, "", string(body), resp.Header)
+		}
+		return nil, badResponse(p.NameVal, "failed to decode response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || result.Code != "" {
+		return nil, dashScopeError(resp.StatusCode, result.Code, result.Message, result.RequestID, resp.Header)
+	}
+	recordUsage(ctx, p.NameVal, model, result.Usage.InputTokens, result.Usage.OutputTokens)
+
+	if len(result.Output.Choices) == 0 {
+		return nil, badResponse(p.NameVal, "no choices in response", nil)
+	}
+
+	var content strings.Builder
+	for _, part := range result.Output.Choices[0].Message.Content {
+		content.WriteString(part.Text)
+	}
+	if content.Len() == 0 {
+		return nil, &OutputError{Code: OutputEmpty, Detail: "no content in message"}
+	}
+
+	parsed, err := parseCropResponse(content.String())
+	if err != nil {
+		return nil, err
+	}
+	parsed.Model = model
+	return parsed, nil
+}
+
+// dashScopeError 将 DashScope 错误码映射为统一错误码，状态码为 200 但带错误码时按错误码判断
+func dashScopeError(status int, code, message, requestID string, header http.Header) error {
+	e := statusError("qwen", status, code, fmt.Sprintf("%s (request_id=%s)", message, requestID), header)
+	switch {
+	case code == "InvalidApiKey":
+		e.Code, e.Retryable = CodeUnauthorized, false
+	case code == "AccessDenied" || strings.HasPrefix(code, "Arrearage"):
+		e.Code, e.Retryable = CodeForbidden, false
+	case strings.HasPrefix(code, "Throttling"):
+		e.Code, e.Retryable = CodeRateLimited, true
+	case code == "InvalidParameter" || code == "DataInspectionFailed" || code == "InvalidURL":
+		e.Code, e.Retryable = CodeInvalidRequest, false
+	case status == http.StatusOK:
+		e.Code, e.Retryable = CodeServerError, true
+	}
+	return e
+}
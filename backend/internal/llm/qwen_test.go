@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const qwenContent = `{"crop_type":"rice","confidence":0.88,"description":"水稻","growth_stage":null,"growth_stage_code":null,"possible_issue":null,"candidates":[{"crop_type":"rice","confidence":0.88}],"findings":[]}`
+
+func qwenServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func qwenReply(content string) []byte {
+	resp := map[string]interface{}{
+		"request_id": "req-1",
+		"output": map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"role": "assistant", "content": []map[string]string{{"text": content}}}},
+			},
+		},
+		"usage": map[string]int{"input_tokens": 120, "output_tokens": 30},
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+func TestQwenRecognizeSendsAuthHeaders(t *testing.T) {
+	srv := qwenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/services/aigc/multimodal-generation/generation" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("X-DashScope-WorkSpace"); got != "ws-1" {
+			t.Errorf("workspace = %q", got)
+		}
+		var body struct {
+			Model string `json:"model"`
+			Input struct {
+				Messages []struct {
+					Content []map[string]string `json:"content"`
+				} `json:"messages"`
+			} `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if body.Model != "qwen-vl-plus" {
+			t.Errorf("model = %q", body.Model)
+		}
+		if len(body.Input.Messages) != 1 || body.Input.Messages[0].Content[0]["image"] != testImageDataURL {
+			t.Errorf("messages = %+v", body.Input.Messages)
+		}
+		w.Write(qwenReply("```json\n" + qwenContent + "\n```"))
+	})
+	p := NewQwenProvider("sk-test", srv.URL, "qwen-vl-plus", "auto", "ws-1")
+
+	rec := &UsageRecorder{}
+	result, err := p.Recognize(WithUsageRecorder(context.Background(), rec), Request{ImageURL: testImageDataURL})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.CropType != "rice" || result.Confidence != 0.88 || result.Model != "qwen-vl-plus" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	items := rec.Items()
+	if len(items) != 1 || items[0].PromptTokens != 120 || items[0].CompletionTokens != 30 {
+		t.Errorf("usage = %+v", items)
+	}
+}
+
+func TestQwenRecognizeOmitsWorkspaceWhenUnset(t *testing.T) {
+	srv := qwenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["X-Dashscope-Workspace"]; ok {
+			t.Error("workspace header should not be sent")
+		}
+		w.Write(qwenReply(qwenContent))
+	})
+	if _, err := NewQwenProvider("sk-test", srv.URL, "", "", "").Recognize(context.Background(), Request{ImageURL: testImageDataURL}); err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+}
+
+func TestQwenErrorMapping(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		header     string
+		body       string
+		code       string
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{"invalid key", 401, "", `{"code":"InvalidApiKey","message":"Invalid API-key provided.","request_id":"r"}`, CodeUnauthorized, false, 0},
+		{"arrearage", 400, "", `{"code":"Arrearage","message":"overdue","request_id":"r"}`, CodeForbidden, false, 0},
+		{"throttled", 429, "7", `{"code":"Throttling.RateQuota","message":"slow down","request_id":"r"}`, CodeRateLimited, true, 7 * time.Second},
+		{"inspection", 400, "", `{"code":"DataInspectionFailed","message":"blocked","request_id":"r"}`, CodeInvalidRequest, false, 0},
+		{"error code with 200", 200, "", `{"code":"InternalError","message":"oops","request_id":"r"}`, CodeServerError, true, 0},
+		{"gateway html", 502, "", `<html>bad gateway</html>`, CodeServerError, true, 0},
+		{"no choices", 200, "", `{"request_id":"r","output":{"choices":[]}}`, CodeBadResponse, false, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := qwenServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if tc.header != "" {
+					w.Header().Set("Retry-After", tc.header)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			})
+			_, err := NewQwenProvider("sk", srv.URL, "", "", "").Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+			var pe *ProviderError
+			if !errors.As(err, &pe) {
+				t.Fatalf("err = %v, want ProviderError", err)
+			}
+			if pe.Code != tc.code || pe.Retryable != tc.retryable || pe.RetryAfter != tc.retryAfter {
+				t.Errorf("got code %q retryable %v retry-after %v, want %q %v %v", pe.Code, pe.Retryable, pe.RetryAfter, tc.code, tc.retryable, tc.retryAfter)
+			}
+		})
+	}
+}
+
+func TestQwenInvalidOutput(t *testing.T) {
+	srv := qwenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(qwenReply("抱歉，我无法识别这张图片"))
+	})
+	_, err := NewQwenProvider("sk", srv.URL, "", "", "").Recognize(context.Background(), Request{ImageURL: testImageDataURL})
+	var oe *OutputError
+	if !errors.As(err, &oe) || oe.Code != OutputNotJSON {
+		t.Fatalf("err = %v, want %s", err, OutputNotJSON)
+	}
+}
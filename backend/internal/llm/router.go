@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RouteInfo 路由选择所需的请求信息
+type RouteInfo struct {
+	Plan      string
+	Source    string
+	ImageSize int64
+}
+
+// RouteRule 路由规则，命中后使用 Providers 作为回退链
+type RouteRule struct {
+	Plan         string   `json:"plan"`
+	Source       string   `json:"source"`
+	MinImageSize int64    `json:"min_image_size"`
+	MaxImageSize int64    `json:"max_image_size"`
+	Providers    []string `json:"providers"`
+}
+
+// Match 判断规则是否命中
+func (r RouteRule) Match(info RouteInfo) bool {
+	if r.Plan != "" && !strings.EqualFold(r.Plan, info.Plan) {
+		return false
+	}
+	if r.Source != "" && !strings.EqualFold(r.Source, info.Source) {
+		return false
+	}
+	if r.MinImageSize > 0 && info.ImageSize < r.MinImageSize {
+		return false
+	}
+	if r.MaxImageSize > 0 && info.ImageSize > r.MaxImageSize {
+		return false
+	}
+	return true
+}
+
+// RouterConfig 路由提供商配置
+type RouterConfig struct {
+	Chain          []string
+	Timeouts       map[string]time.Duration
+	DefaultTimeout time.Duration
+	Rules          []RouteRule
+}
+
+// RouterProvider 按规则选择提供商，失败时按顺序回退
+type RouterProvider struct {
+	BaseProvider
+	chain          []string
+	timeouts       map[string]time.Duration
+	defaultTimeout time.Duration
+	rules          []RouteRule
+}
+
+// ErrNoProvider 回退链中没有可用提供商
+var ErrNoProvider = errors.New("no_provider_available")
+
+// NewRouterProvider 创建路由提供商，回退链中的提供商必须已注册
+func NewRouterProvider(cfg RouterConfig) (*RouterProvider, error) {
+	chain := make([]string, 0, len(cfg.Chain))
+	for _, name := range cfg.Chain {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := GetProvider(name); err != nil {
+			return nil, err
+		}
+		chain = append(chain, name)
+	}
+	if len(chain) == 0 {
+		return nil, ErrNoProvider
+	}
+	for _, rule := range cfg.Rules {
+		for _, name := range rule.Providers {
+			if _, err := GetProvider(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	timeouts := cfg.Timeouts
+	if timeouts == nil {
+		timeouts = map[string]time.Duration{}
+	}
+	return &RouterProvider{
+		BaseProvider:   BaseProvider{NameVal: chain[0]},
+		chain:          chain,
+		timeouts:       timeouts,
+		defaultTimeout: cfg.DefaultTimeout,
+		rules:          cfg.Rules,
+	}, nil
+}
+
+// Chain 返回默认回退链
+func (p *RouterProvider) Chain() []string {
+	return append([]string(nil), p.chain...)
+}
+
+// Pin 返回只含指定提供商的路由，沿用当前路由的超时配置与熔断保护，不再应用路由规则
+func (p *RouterProvider) Pin(name string) (*RouterProvider, error) {
+	name = strings.TrimSpace(name)
+	if _, err := GetProvider(name); err != nil {
+		return nil, err
+	}
+	return &RouterProvider{
+		BaseProvider:   BaseProvider{NameVal: name},
+		chain:          []string{name},
+		timeouts:       p.timeouts,
+		defaultTimeout: p.defaultTimeout,
+	}, nil
+}
+
+// Recognize 使用默认回退链识别
+func (p *RouterProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	return p.RecognizeRoute(ctx, req, RouteInfo{})
+}
+
+// RecognizeRoute 按路由规则选择回退链并依次尝试，熔断中的提供商直接跳过，请求被取消或超时后不再回退
+func (p *RouterProvider) RecognizeRoute(ctx context.Context, req Request, info RouteInfo) (*RecognitionResult, error) {
+	chain := p.resolveChain(info)
+	var errs []error
+	for _, name := range chain {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		provider, err := GetProvider(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result, err := p.call(ctx, provider, name, req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		out := *result
+		out.Provider = name
+		return &out, nil
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoProvider
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ResolveChain 返回请求命中的回退链
+func (p *RouterProvider) ResolveChain(info RouteInfo) []string {
+	return append([]string(nil), p.resolveChain(info)...)
+}
+
+func (p *RouterProvider) resolveChain(info RouteInfo) []string {
+	for _, rule := range p.rules {
+		if len(rule.Providers) > 0 && rule.Match(info) {
+			return rule.Providers
+		}
+	}
+	return p.chain
+}
+
+func (p *RouterProvider) timeoutFor(name string) time.Duration {
+	if d, ok := p.timeouts[name]; ok && d > 0 {
+		return d
+	}
+	return p.defaultTimeout
+}
+
+func (p *RouterProvider) call(ctx context.Context, provider Provider, name string, req Request) (*RecognitionResult, error) {
+	if timeout := p.timeoutFor(name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return callWithBreaker(ctx, provider, name, req)
+}
+
+// ParseRouteRules 解析 JSON 格式的路由规则
+func ParseRouteRules(raw string) ([]RouteRule, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []RouteRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid route rules: %w", err)
+	}
+	return rules, nil
+}
+
+// ParseTimeouts 解析 name=duration 逗号分隔的超时配置，如 openai=30s,mock=2s
+func ParseTimeouts(raw string) (map[string]time.Duration, error) {
+	out := map[string]time.Duration{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid timeout %q", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %w", part, err)
+		}
+		out[strings.TrimSpace(kv[0])] = d
+	}
+	return out, nil
+}
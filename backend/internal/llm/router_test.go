@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeProvider 返回固定结果或错误，记录调用次数
+type fakeProvider struct {
+	BaseProvider
+	result *RecognitionResult
+	err    error
+	delay  time.Duration
+	calls  int
+}
+
+func (p *fakeProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	p.calls++
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.result, nil
+}
+
+// registerFake 以唯一名称注册假提供商，测试结束后注销
+func registerFake(t *testing.T, p *fakeProvider) string {
+	t.Helper()
+	name := fmt.Sprintf("fake-%s-%d", t.Name(), time.Now().UnixNano())
+	p.NameVal = name
+	RegisterProvider(name, p)
+	t.Cleanup(func() { delete(providers, name) })
+	return name
+}
+
+func TestRouterFallsBackToNextProvider(t *testing.T) {
+	errUpstream := errors.New("upstream unavailable")
+	first := &fakeProvider{err: errUpstream}
+	second := &fakeProvider{result: &RecognitionResult{CropType: "wheat", Confidence: 0.9}}
+	firstName, secondName := registerFake(t, first), registerFake(t, second)
+
+	router, err := NewRouterProvider(RouterConfig{Chain: []string{firstName, secondName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := router.Recognize(context.Background(), Request{ImageURL: "https://example.com/a.jpg"})
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	if result.Provider != secondName || result.CropType != "wheat" {
+		t.Errorf("result = %+v, want wheat from %s", result, secondName)
+	}
+	if first.calls != 1 || second.calls != 1 {
+		t.Errorf("calls = %d/%d, want 1/1", first.calls, second.calls)
+	}
+	// 回退链上的结果是副本，不修改提供商自身的结果
+	if second.result.Provider != "" {
+		t.Errorf("provider result mutated: %+v", second.result)
+	}
+}
+
+func TestRouterJoinsErrorsWhenAllFail(t *testing.T) {
+	errA, errB := errors.New("a down"), errors.New("b down")
+	a, b := registerFake(t, &fakeProvider{err: errA}), registerFake(t, &fakeProvider{err: errB})
+
+	router, err := NewRouterProvider(RouterConfig{Chain: []string{a, b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = router.Recognize(context.Background(), Request{ImageURL: "https://example.com/a.jpg"})
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("err = %v, want both provider errors", err)
+	}
+}
+
+func TestRouterTimeoutFallsBack(t *testing.T) {
+	slow := &fakeProvider{delay: 200 * time.Millisecond, result: &RecognitionResult{CropType: "rice"}}
+	fast := &fakeProvider{result: &RecognitionResult{CropType: "wheat"}}
+	slowName, fastName := registerFake(t, slow), registerFake(t, fast)
+
+	router, err := NewRouterProvider(RouterConfig{
+		Chain:    []string{slowName, fastName},
+		Timeouts: map[string]time.Duration{slowName: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := router.Recognize(context.Background(), Request{ImageURL: "https://example.com/a.jpg"})
+	if err != nil || result.Provider != fastName {
+		t.Fatalf("result = %+v, err %v, want fallback to %s", result, err, fastName)
+	}
+}
+
+func TestRouterRuleSelectsChain(t *testing.T) {
+	def := &fakeProvider{result: &RecognitionResult{CropType: "wheat"}}
+	pro := &fakeProvider{result: &RecognitionResult{CropType: "rice"}}
+	defName, proName := registerFake(t, def), registerFake(t, pro)
+
+	router, err := NewRouterProvider(RouterConfig{
+		Chain: []string{defName},
+		Rules: []RouteRule{
+			{Plan: "pro", MinImageSize: 1024, Providers: []string{proName}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		info RouteInfo
+		want string
+	}{
+		{"rule matches", RouteInfo{Plan: "PRO", ImageSize: 2048}, proName},
+		{"plan differs", RouteInfo{Plan: "free", ImageSize: 2048}, defName},
+		{"image too small", RouteInfo{Plan: "pro", ImageSize: 512}, defName},
+		{"no route info", RouteInfo{}, defName},
+	}
+	for _, tc := range cases {
+		result, err := router.RecognizeRoute(context.Background(), Request{ImageURL: "https://example.com/a.jpg"}, tc.info)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if result.Provider != tc.want {
+			t.Errorf("%s: provider = %s, want %s", tc.name, result.Provider, tc.want)
+		}
+	}
+}
+
+func TestNewRouterProviderRejectsUnknownProvider(t *testing.T) {
+	known := registerFake(t, &fakeProvider{})
+	if _, err := NewRouterProvider(RouterConfig{Chain: []string{known, "missing-provider"}}); err == nil {
+		t.Error("unknown chain provider was accepted")
+	}
+	if _, err := NewRouterProvider(RouterConfig{
+		Chain: []string{known},
+		Rules: []RouteRule{{Providers: []string{"missing-provider"}}},
+	}); err == nil {
+		t.Error("unknown rule provider was accepted")
+	}
+	if _, err := NewRouterProvider(RouterConfig{Chain: []string{" ", ""}}); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("empty chain err = %v, want ErrNoProvider", err)
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	got, err := ParseTimeouts(" openai=30s, mock=1500ms ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["openai"] != 30*time.Second || got["mock"] != 1500*time.Millisecond {
+		t.Errorf("ParseTimeouts = %v", got)
+	}
+	if got, err := ParseTimeouts(""); err != nil || len(got) != 0 {
+		t.Errorf("empty = %v, %v", got, err)
+	}
+	for _, raw := range []string{"openai", "openai=fast", "openai=30s,mock"} {
+		if _, err := ParseTimeouts(raw); err == nil {
+			t.Errorf("ParseTimeouts(%q) should fail", raw)
+		}
+	}
+}
+
+func TestParseRouteRules(t *testing.T) {
+	rules, err := ParseRouteRules(`[{"plan":"pro","max_image_size":1048576,"providers":["openai","mock"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Plan != "pro" || rules[0].MaxImageSize != 1048576 || len(rules[0].Providers) != 2 {
+		t.Errorf("rules = %+v", rules)
+	}
+	if rules, err := ParseRouteRules("  "); err != nil || rules != nil {
+		t.Errorf("blank = %v, %v", rules, err)
+	}
+	for _, raw := range []string{`{"plan":"pro"}`, `[{"plan":`, "openai"} {
+		if _, err := ParseRouteRules(raw); err == nil {
+			t.Errorf("ParseRouteRules(%q) should fail", raw)
+		}
+	}
+}
+
+// blockingProvider 阻塞到请求被取消为止
+type blockingProvider struct{ name string }
+
+func (p *blockingProvider) Name() string { return p.name }
+
+func (p *blockingProvider) Recognize(ctx context.Context, req Request) (*RecognitionResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func registerTestProvider(t *testing.T, p Provider) {
+	t.Helper()
+	RegisterProvider(p.Name(), p)
+	t.Cleanup(func() { delete(providers, p.Name()) })
+}
+
+func TestRouterPinKeepsTimeoutAndBreaker(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	slow := &blockingProvider{name: fmt.Sprintf("pin-slow-%d", suffix)}
+	other := &countingProvider{name: fmt.Sprintf("pin-other-%d", suffix)}
+	registerTestProvider(t, slow)
+	registerTestProvider(t, other)
+	router, err := NewRouterProvider(RouterConfig{
+		Chain:          []string{other.name},
+		Timeouts:       map[string]time.Duration{slow.name: 20 * time.Millisecond},
+		DefaultTimeout: time.Minute,
+		Rules:          []RouteRule{{Plan: "pro", Providers: []string{other.name}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned, err := router.Pin(slow.name)
+	if err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if pinned.Name() != slow.name || len(pinned.Chain()) != 1 {
+		t.Fatalf("pinned = %s %v", pinned.Name(), pinned.Chain())
+	}
+	if chain := pinned.ResolveChain(RouteInfo{Plan: "pro"}); len(chain) != 1 || chain[0] != slow.name {
+		t.Errorf("pinned router still applies rules: %v", chain)
+	}
+
+	start := time.Now()
+	_, err = pinned.RecognizeRoute(context.Background(), Request{ImageURL: "https://example.com/a.jpg"}, RouteInfo{Plan: "pro"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("per-provider timeout not applied, took %s", elapsed)
+	}
+	if other.calls != 0 {
+		t.Errorf("pinned router fell back to %s", other.name)
+	}
+	if total, failures := breakerFor(slow.name).counts(); total != 1 || failures != 1 {
+		t.Errorf("breaker window = %d/%d, want 1/1", failures, total)
+	}
+}
+
+func TestRouterPinUnknownProvider(t *testing.T) {
+	name := fmt.Sprintf("pin-known-%d", time.Now().UnixNano())
+	registerTestProvider(t, &countingProvider{name: name})
+	router, err := NewRouterProvider(RouterConfig{Chain: []string{name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.Pin("no-such-provider"); err == nil {
+		t.Error("pinning an unregistered provider should fail")
+	}
+}
@@ -0,0 +1,270 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 结构化输出失败码，RecordFailure 直接使用作为 error_code
+const (
+	OutputNotJSON       = "output_not_json"
+	OutputSchemaInvalid = "output_schema_invalid"
+	OutputRefused       = "output_refused"
+	OutputTruncated     = "output_truncated"
+	OutputEmpty         = "output_empty"
+)
+
+// OutputError 模型输出不符合约定时的错误
+type OutputError struct {
+	Code     string
+	Detail   string
+	Repaired bool // 是否已经过一次修复重试
+}
+
+func (e *OutputError) Error() string {
+	if e.Repaired {
+		return fmt.Sprintf("%s after repair: %s", e.Code, e.Detail)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+// Repairable 格式类错误可以通过修复提示词重试
+func (e *OutputError) Repairable() bool {
+	return !e.Repaired && (e.Code == OutputNotJSON || e.Code == OutputSchemaInvalid)
+}
+
+// recognitionSchema RecognitionResult 的 JSON Schema（strict 模式要求全部字段必填）
+var recognitionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"crop_type": map[string]interface{}{
+			"type":        "string",
+			"description": "作物类型英文名，无法判断时为 unknown",
+		},
+		"confidence": map[string]interface{}{
+			"type":        "number",
+			"description": "0 到 1 之间的置信度",
+		},
+		"description": map[string]interface{}{
+			"type": "string",
+		},
+		"growth_stage": map[string]interface{}{
+			"type":        []string{"string", "null"},
+			"description": "生育期名称，无法判断时为 null",
+		},
+		"growth_stage_code": map[string]interface{}{
+			"type":        []string{"string", "null"},
+			"description": "BBCH 两位生育期代码，如 31，无法判断时为 null",
+		},
+		"possible_issue": map[string]interface{}{
+			"type":        []string{"string", "null"},
+			"description": "可能的病虫草害或异常，没有时为 null",
+		},
+		"candidates": map[string]interface{}{
+			"type":        "array",
+			"description": "按置信度降序的候选作物，最多 3 个，第一个与 crop_type 一致",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"crop_type":  map[string]interface{}{"type": "string"},
+					"confidence": map[string]interface{}{"type": "number"},
+				},
+				"required":             []string{"crop_type", "confidence"},
+				"additionalProperties": false,
+			},
+		},
+		"findings": map[string]interface{}{
+			"type":        "array",
+			"description": "病害/虫害/杂草结论，仅识别作物时为空数组",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"category":   map[string]interface{}{"type": "string", "enum": []string{"disease", "pest", "weed"}},
+					"name":       map[string]interface{}{"type": "string"},
+					"confidence": map[string]interface{}{"type": "number"},
+				},
+				"required":             []string{"category", "name", "confidence"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"crop_type", "confidence", "description", "growth_stage", "growth_stage_code", "possible_issue", "candidates", "findings"},
+	"additionalProperties": false,
+}
+
+// recognitionResponseFormat OpenAI response_format 参数
+func recognitionResponseFormat() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "crop_recognition",
+			"strict": true,
+			"schema": recognitionSchema,
+		},
+	}
+}
+
+// parseCropResponse 解析并校验作物识别的 JSON 响应
+func parseCropResponse(content string) (*RecognitionResult, error) {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return nil, &OutputError{Code: OutputEmpty, Detail: "empty content"}
+	}
+
+	raw, ok := extractJSONObject(trimmed)
+	if !ok {
+		return nil, &OutputError{Code: OutputNotJSON, Detail: "no json object in content"}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, &OutputError{Code: OutputNotJSON, Detail: err.Error()}
+	}
+
+	result, err := validateRecognition(fields)
+	if err != nil {
+		return nil, &OutputError{Code: OutputSchemaInvalid, Detail: err.Error()}
+	}
+	result.RawText = content
+	return result, nil
+}
+
+// extractJSONObject 优先整体解析，否则截取 markdown 代码块或首尾花括号之间的内容
+func extractJSONObject(content string) ([]byte, bool) {
+	if json.Valid([]byte(content)) {
+		return []byte(content), true
+	}
+	if strings.HasPrefix(content, "```") {
+		inner := strings.TrimPrefix(content, "```json")
+		inner = strings.TrimPrefix(inner, "```")
+		inner = strings.TrimSuffix(strings.TrimSpace(inner), "```")
+		if json.Valid([]byte(strings.TrimSpace(inner))) {
+			return []byte(strings.TrimSpace(inner)), true
+		}
+	}
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start >= 0 && end > start {
+		candidate := []byte(strings.TrimSpace(content[start : end+1]))
+		if json.Valid(candidate) {
+			return candidate, true
+		}
+	}
+	return nil, false
+}
+
+// validateRecognition 按 schema 校验每个字段
+func validateRecognition(fields map[string]json.RawMessage) (*RecognitionResult, error) {
+	var problems []string
+	result := &RecognitionResult{}
+
+	if v, ok := fields["crop_type"]; !ok {
+		problems = append(problems, "crop_type missing")
+	} else if err := json.Unmarshal(v, &result.CropType); err != nil {
+		problems = append(problems, "crop_type must be string")
+	} else if strings.TrimSpace(result.CropType) == "" {
+		problems = append(problems, "crop_type empty")
+	}
+
+	if v, ok := fields["confidence"]; !ok {
+		problems = append(problems, "confidence missing")
+	} else if err := json.Unmarshal(v, &result.Confidence); err != nil {
+		problems = append(problems, "confidence must be number")
+	} else if result.Confidence < 0 || result.Confidence > 1 {
+		problems = append(problems, "confidence out of range [0,1]")
+	}
+
+	if v, ok := fields["description"]; !ok {
+		problems = append(problems, "description missing")
+	} else if err := json.Unmarshal(v, &result.Description); err != nil {
+		problems = append(problems, "description must be string")
+	}
+
+	for _, key := range []string{"growth_stage", "possible_issue"} {
+		v, ok := fields[key]
+		if !ok {
+			problems = append(problems, key+" missing")
+			continue
+		}
+		val, err := nullableString(v)
+		if err != nil {
+			problems = append(problems, key+" must be string or null")
+			continue
+		}
+		if key == "growth_stage" {
+			result.GrowthStage = val
+		} else {
+			result.PossibleIssue = val
+		}
+	}
+
+	// growth_stage_code 为后加字段，缺失视为 null；格式交由服务端按作物生育期表校验
+	if v, ok := fields["growth_stage_code"]; ok {
+		val, err := nullableString(v)
+		if err != nil {
+			problems = append(problems, "growth_stage_code must be string or null")
+		} else {
+			result.GrowthStageCode = val
+		}
+	}
+
+	// candidates 为后加字段，缺失时由服务端以 crop_type 作为唯一候选
+	if v, ok := fields["candidates"]; ok && !bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+		var candidates []Candidate
+		if err := json.Unmarshal(v, &candidates); err != nil {
+			problems = append(problems, "candidates must be array of {crop_type,confidence}")
+		} else {
+			for i, c := range candidates {
+				switch {
+				case strings.TrimSpace(c.CropType) == "":
+					problems = append(problems, fmt.Sprintf("candidates[%d].crop_type empty", i))
+				case c.Confidence < 0 || c.Confidence > 1:
+					problems = append(problems, fmt.Sprintf("candidates[%d].confidence out of range [0,1]", i))
+				}
+			}
+			result.Candidates = candidates
+		}
+	}
+
+	// findings 为后加字段，旧版提示词不返回时视为空
+	if v, ok := fields["findings"]; ok && !bytes.Equal(bytes.TrimSpace(v), []byte("null")) {
+		var findings []Finding
+		if err := json.Unmarshal(v, &findings); err != nil {
+			problems = append(problems, "findings must be array of {category,name,confidence}")
+		} else {
+			for i, f := range findings {
+				switch {
+				case f.Category != "disease" && f.Category != "pest" && f.Category != "weed":
+					problems = append(problems, fmt.Sprintf("findings[%d].category invalid", i))
+				case strings.TrimSpace(f.Name) == "":
+					problems = append(problems, fmt.Sprintf("findings[%d].name empty", i))
+				case f.Confidence < 0 || f.Confidence > 1:
+					problems = append(problems, fmt.Sprintf("findings[%d].confidence out of range [0,1]", i))
+				}
+			}
+			result.Findings = findings
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return result, nil
+}
+
+func nullableString(raw json.RawMessage) (*string, error) {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	return &s, nil
+}
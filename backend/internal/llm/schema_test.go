@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const validCropJSON = `{"crop_type":"wheat","confidence":0.91,"description":"小麦","growth_stage":"拔节期","possible_issue":null}`
+
+func TestExtractJSONObject(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    string
+		ok      bool
+	}{
+		{"plain object", validCropJSON, validCropJSON, true},
+		{"json code fence", "```json\n" + validCropJSON + "\n```", validCropJSON, true},
+		{"bare code fence", "```\n" + validCropJSON + "\n```", validCropJSON, true},
+		{"surrounded by prose", "识别结果如下：\n" + validCropJSON + "\n以上仅供参考。", validCropJSON, true},
+		{"no object", "这是一株小麦", "", false},
+		{"broken object", `{"crop_type":"wheat",`, "", false},
+	}
+	for _, tc := range cases {
+		got, ok := extractJSONObject(tc.content)
+		if ok != tc.ok || string(got) != tc.want {
+			t.Errorf("%s: got %q, %v; want %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseCropResponse(t *testing.T) {
+	result, err := parseCropResponse("```json\n" + validCropJSON + "\n```")
+	if err != nil {
+		t.Fatalf("parseCropResponse: %v", err)
+	}
+	if result.CropType != "wheat" || result.Confidence != 0.91 || result.GrowthStage == nil || *result.GrowthStage != "拔节期" || result.PossibleIssue != nil {
+		t.Errorf("result = %+v", result)
+	}
+	if !strings.Contains(result.RawText, "```json") {
+		t.Errorf("RawText should keep the original content, got %q", result.RawText)
+	}
+
+	cases := []struct {
+		name    string
+		content string
+		code    string
+		detail  string
+	}{
+		{"empty", "  \n", OutputEmpty, ""},
+		{"prose only", "无法识别", OutputNotJSON, ""},
+		{"missing field", `{"crop_type":"wheat","confidence":0.9,"description":"","growth_stage":null}`, OutputSchemaInvalid, "possible_issue missing"},
+		{"wrong type", `{"crop_type":"wheat","confidence":"high","description":"","growth_stage":null,"possible_issue":null}`, OutputSchemaInvalid, "confidence must be number"},
+		{"out of range", `{"crop_type":"wheat","confidence":1.5,"description":"","growth_stage":null,"possible_issue":null}`, OutputSchemaInvalid, "confidence out of range"},
+		{"blank crop", `{"crop_type":" ","confidence":0.5,"description":"","growth_stage":null,"possible_issue":null}`, OutputSchemaInvalid, "crop_type empty"},
+		{"stage not string", `{"crop_type":"wheat","confidence":0.5,"description":"","growth_stage":3,"possible_issue":null}`, OutputSchemaInvalid, "growth_stage must be string or null"},
+	}
+	for _, tc := range cases {
+		_, err := parseCropResponse(tc.content)
+		var outErr *OutputError
+		if !errors.As(err, &outErr) {
+			t.Errorf("%s: err = %v, want OutputError", tc.name, err)
+			continue
+		}
+		if outErr.Code != tc.code || !strings.Contains(outErr.Detail, tc.detail) {
+			t.Errorf("%s: got %s %q, want %s containing %q", tc.name, outErr.Code, outErr.Detail, tc.code, tc.detail)
+		}
+	}
+}
+
+func TestValidateRecognitionReportsAllProblems(t *testing.T) {
+	_, err := parseCropResponse(`{"crop_type":1,"description":2}`)
+	var outErr *OutputError
+	if !errors.As(err, &outErr) || outErr.Code != OutputSchemaInvalid {
+		t.Fatalf("err = %v", err)
+	}
+	for _, want := range []string{"crop_type must be string", "confidence missing", "description must be string", "growth_stage missing", "possible_issue missing"} {
+		if !strings.Contains(outErr.Detail, want) {
+			t.Errorf("detail %q missing %q", outErr.Detail, want)
+		}
+	}
+}
+
+func TestOutputErrorRepairable(t *testing.T) {
+	cases := []struct {
+		err  OutputError
+		want bool
+	}{
+		{OutputError{Code: OutputNotJSON}, true},
+		{OutputError{Code: OutputSchemaInvalid}, true},
+		{OutputError{Code: OutputSchemaInvalid, Repaired: true}, false},
+		{OutputError{Code: OutputRefused}, false},
+		{OutputError{Code: OutputTruncated}, false},
+		{OutputError{Code: OutputEmpty}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.err.Repairable(); got != tc.want {
+			t.Errorf("%+v: Repairable = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
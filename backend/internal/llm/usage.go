@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage 一次上游调用的 token 用量，按次计费的接口 token 为 0
+type Usage struct {
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Calls            int    `json:"calls"`
+}
+
+// UsageRecorder 收集一次识别尝试内的全部上游调用用量（含修复重试、回退与投票），并发安全
+type UsageRecorder struct {
+	mu    sync.Mutex
+	items []Usage
+}
+
+type usageKey struct{}
+
+// WithUsageRecorder 在 context 中携带用量收集器
+func WithUsageRecorder(ctx context.Context, rec *UsageRecorder) context.Context {
+	return context.WithValue(ctx, usageKey{}, rec)
+}
+
+// recordUsage 记录一次上游调用，未设置收集器时忽略
+func recordUsage(ctx context.Context, provider, model string, promptTokens, completionTokens int) {
+	rec, ok := ctx.Value(usageKey{}).(*UsageRecorder)
+	if !ok || rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i := range rec.items {
+		if rec.items[i].Provider == provider && rec.items[i].Model == model {
+			rec.items[i].PromptTokens += promptTokens
+			rec.items[i].CompletionTokens += completionTokens
+			rec.items[i].Calls++
+			return
+		}
+	}
+	rec.items = append(rec.items, Usage{Provider: provider, Model: model, PromptTokens: promptTokens, CompletionTokens: completionTokens, Calls: 1})
+}
+
+// Items 按提供商/模型汇总的用量
+func (r *UsageRecorder) Items() []Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Usage(nil), r.items...)
+}
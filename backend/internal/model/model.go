@@ -31,30 +31,363 @@ type Image struct {
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 	UserID        uint           `gorm:"index" json:"user_id"`
 	OriginalURL   string         `gorm:"size:512" json:"original_url"`
-	CompressedURL string         `gorm:"size:512" json:"compressed_url"`
+	CompressedURL string         `gorm:"size:512" json:"compressed_url"` // 展示图，未生成时与原图相同
+	ThumbnailURL  string         `gorm:"size:512" json:"thumbnail_url"`  // 列表缩略图，未生成时为空
 	Latitude      *float64       `json:"latitude"`
 	Longitude     *float64       `json:"longitude"`
 	FileSize      int64          `json:"file_size"`
 	Width         int            `json:"width"`
 	Height        int            `json:"height"`
+	ContentHash   string         `gorm:"size:64;index" json:"content_hash"` // 图片内容 sha256，用于识别结果缓存
 }
 
 type RecognitionResult struct {
-	ID            uint           `gorm:"primarykey" json:"id"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
-	ImageID       uint           `gorm:"uniqueIndex" json:"image_id"`
-	Image         Image          `gorm:"foreignKey:ImageID" json:"image"`
-	RawText       string         `gorm:"type:text" json:"raw_text"`
-	CropType      string         `gorm:"size:64;index" json:"crop_type"`
-	Confidence    float64        `json:"confidence"`
-	Description   string         `gorm:"type:text" json:"description"`
-	GrowthStage   *string        `json:"growth_stage"`
-	PossibleIssue *string        `json:"possible_issue"`
-	Provider      string         `gorm:"size:32" json:"provider"` // 识别提供商
-	Source        string         `gorm:"size:16;index" json:"source"`
-	DurationMs    int            `json:"duration_ms"`
+	ID                   uint           `gorm:"primarykey" json:"id"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
+	ImageID              uint           `gorm:"uniqueIndex:idx_result_image_version,priority:1" json:"image_id"`
+	Image                Image          `gorm:"foreignKey:ImageID" json:"image"`
+	Version              int            `gorm:"uniqueIndex:idx_result_image_version,priority:2" json:"version"` // 同一图片的第几次识别，从 1 开始
+	IsCurrent            bool           `gorm:"index" json:"is_current"`                                        // 图片当前采用的结果，每张图片仅一条（部分唯一索引 idx_result_current_image）
+	RawText              string         `gorm:"type:text" json:"raw_text"`
+	CropType             string         `gorm:"size:64;index" json:"crop_type"` // 归一化后的 Crop.Code，未匹配时为原始值
+	CropTypeRaw          string         `gorm:"size:128" json:"crop_type_raw"`  // 提供商返回的原始作物名
+	Confidence           float64        `json:"confidence"`
+	CalibratedConfidence *float64       `json:"calibrated_confidence"` // 按提供商/作物校准后的置信度，无校准映射时为空
+	Description          string         `gorm:"type:text" json:"description"`
+	GrowthStage          *string        `json:"growth_stage"`
+	GrowthStageCode      *string        `gorm:"size:2;index" json:"growth_stage_code"` // BBCH 两位代码，校验通过时 GrowthStage 为对应名称
+	PossibleIssue        *string        `json:"possible_issue"`
+	Provider             string         `gorm:"size:32" json:"provider"` // 识别提供商
+	Source               string         `gorm:"size:16;index" json:"source"`
+	DurationMs           int            `json:"duration_ms"`
+	PromptVersion        int            `gorm:"index" json:"prompt_version"` // 0 表示使用内置提示词
+	Model                string         `gorm:"size:64" json:"model"`
+	Mode                 string         `gorm:"size:16;index;default:crop" json:"mode"` // crop/disease/pest/weed/full
+	Locale               string         `gorm:"size:16" json:"locale"`                  // 提示词语言，缓存按语言区分
+	CacheHit             bool           `gorm:"index" json:"cache_hit"`                 // 命中内容哈希缓存，未调用提供商
+	CachedFromID         *uint          `json:"cached_from_id"`                         // 缓存来源结果
+	BackfillID           *uint          `gorm:"index" json:"backfill_id"`               // 由批量重新识别产生
+	ExperimentID         *uint          `gorm:"index" json:"experiment_id"`             // 参与的 A/B 实验
+	ArmID                *uint          `gorm:"index" json:"arm_id"`                    // 实验中分到的组
+}
+
+// CalibrationMap 置信度校准映射，CropType 为空表示提供商级别的兜底映射
+type CalibrationMap struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Provider    string    `gorm:"size:32;uniqueIndex:idx_calibration_scope" json:"provider"`
+	CropType    string    `gorm:"size:64;uniqueIndex:idx_calibration_scope" json:"crop_type"`
+	Method      string    `gorm:"size:16" json:"method"`   // isotonic/temperature
+	Params      string    `gorm:"type:text" json:"params"` // isotonic 分段点或温度参数（JSON）
+	Bins        string    `gorm:"type:text" json:"bins"`   // 拟合样本的可靠性曲线（JSON）
+	Samples     int64     `json:"samples"`
+	ECEBefore   float64   `json:"ece_before"`
+	ECEAfter    float64   `json:"ece_after"`
+	BrierBefore float64   `json:"brier_before"`
+	BrierAfter  float64   `json:"brier_after"`
+}
+
+// UsageRecord 一次识别尝试在单个提供商/模型上的 token 用量与估算费用，失败的尝试同样记录
+type UsageRecord struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	UserID           uint      `gorm:"index" json:"user_id"`
+	Plan             string    `gorm:"size:16;index" json:"plan"`
+	ImageID          *uint     `gorm:"index" json:"image_id"`
+	ResultID         *uint     `gorm:"index" json:"result_id"`
+	CropType         string    `gorm:"size:64;index" json:"crop_type"` // 结果落库后回填
+	Provider         string    `gorm:"size:32;index" json:"provider"`
+	Model            string    `gorm:"size:64" json:"model"`
+	Calls            int       `json:"calls"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"` // 按价格表估算
+	Success          bool      `json:"success"`
+}
+
+// ShadowResult 影子模式下候选提供商/提示词对线上识别的作答，不展示给用户；生产侧字段为识别当时的快照
+type ShadowResult struct {
+	ID                uint      `gorm:"primarykey" json:"id"`
+	CreatedAt         time.Time `gorm:"index" json:"created_at"`
+	ResultID          uint      `gorm:"index" json:"result_id"` // 对应的生产结果
+	ImageID           uint      `gorm:"index" json:"image_id"`
+	Mode              string    `gorm:"size:16" json:"mode"`
+	Provider          string    `gorm:"size:32;index" json:"provider"`
+	Model             string    `gorm:"size:64" json:"model"`
+	PromptVersion     int       `gorm:"index" json:"prompt_version"`
+	CropType          string    `gorm:"size:64" json:"crop_type"`
+	Confidence        float64   `json:"confidence"`
+	DurationMs        int       `json:"duration_ms"`
+	PromptTokens      int       `json:"prompt_tokens"`
+	CompletionTokens  int       `json:"completion_tokens"`
+	Cost              float64   `json:"cost"`
+	ErrorCode         string    `gorm:"size:32" json:"error_code"`
+	ErrorMessage      string    `gorm:"type:text" json:"error_message"`
+	Agreed            bool      `json:"agreed"` // 与生产结果作物一致
+	ProdProvider      string    `gorm:"size:32" json:"prod_provider"`
+	ProdPromptVersion int       `json:"prod_prompt_version"`
+	ProdCropType      string    `gorm:"size:64" json:"prod_crop_type"`
+	ProdConfidence    float64   `json:"prod_confidence"`
+	ProdDurationMs    int       `json:"prod_duration_ms"`
+	ProdCost          float64   `json:"prod_cost"`
+}
+
+// 识别次数预占状态
+const (
+	QuotaReserved  = "reserved"
+	QuotaCommitted = "committed"
+	QuotaReleased  = "released"
+)
+
+// QuotaReservation 一次识别的次数预占：调用提供商前预占（需要看广告时同时扣一次广告额度），
+// 保存结果后确认，失败、取消或命中缓存时退回；每条只结算一次，记录保留作为次数变动的审计
+type QuotaReservation struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UserID    uint       `gorm:"index" json:"user_id"`           // 登录用户，匿名设备为 0
+	DeviceID  string     `gorm:"size:64;index" json:"device_id"` // 匿名设备
+	AdCredit  bool       `json:"ad_credit"`                      // 同时扣了一次广告额度
+	Source    string     `gorm:"size:32" json:"source"`          // 识别来源，批量识别为 batch
+	Status    string     `gorm:"size:16;index" json:"status"`
+	Reason    string     `gorm:"size:32" json:"reason"` // 结算原因，如 result_saved/recognize_failed/canceled/cache_hit/expired
+	ResultID  *uint      `json:"result_id"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"` // 同步识别超时未结算时自动退回；交给异步任务后为空，随任务结算
+	SettledAt *time.Time `json:"settled_at"`
+}
+
+// 幂等键状态
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyKey 幂等键，同一请求方重复提交相同 Idempotency-Key 时返回首次保存的响应，过期后删除
+type IdempotencyKey struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Scope          string    `gorm:"size:64;uniqueIndex:idx_idempotency_scope_key,priority:1" json:"scope"` // 请求方，如 user:12
+	Key            string    `gorm:"size:128;uniqueIndex:idx_idempotency_scope_key,priority:2" json:"key"`
+	Route          string    `gorm:"size:64" json:"route"`
+	RequestHash    string    `gorm:"size:64" json:"request_hash"` // 接口与请求体的摘要，同一键换了请求内容时拒绝
+	Status         string    `gorm:"size:16" json:"status"`
+	ResponseStatus int       `json:"response_status"`
+	ResponseType   string    `gorm:"size:128" json:"response_type"`
+	ResponseBody   string    `gorm:"type:text" json:"-"`
+	ExpiresAt      time.Time `gorm:"index" json:"expires_at"`
+}
+
+// Webhook 事件类型
+const (
+	WebhookResultCreated      = "result.created"
+	WebhookFeedbackCreated    = "feedback.created"
+	WebhookLabelApproved      = "label.approved"
+	WebhookMembershipApproved = "membership.approved"
+)
+
+// WebhookSubscription 外部系统订阅的 Webhook 地址，按 Secret 对请求体做 HMAC-SHA256 签名
+type WebhookSubscription struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"size:64" json:"name"`
+	URL       string    `gorm:"size:512" json:"url"`
+	Secret    string    `gorm:"size:128" json:"-"`
+	Events    string    `gorm:"size:256" json:"events"` // 逗号分隔的事件类型
+	Enabled   bool      `json:"enabled"`
+}
+
+// Webhook 投递状态
+const (
+	WebhookPending    = "pending"
+	WebhookDelivering = "delivering"
+	WebhookSucceeded  = "succeeded"
+	WebhookDead       = "dead" // 重试用尽，进入死信列表等待人工重放
+)
+
+// WebhookDelivery 待投递事件（outbox），每个订阅一条，由后台按退避重试投递
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	SubscriptionID uint       `gorm:"index" json:"subscription_id"`
+	EventID        string     `gorm:"size:40;index" json:"event_id"` // 同一事件投递给多个订阅时相同，重放不变，接收方据此去重
+	EventType      string     `gorm:"size:32;index" json:"event_type"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"size:16;index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	MaxAttempts    int        `json:"max_attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	LockToken      string     `gorm:"size:32" json:"-"`
+	LockedUntil    *time.Time `json:"-"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `gorm:"size:512" json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// 实验状态
+const (
+	ExperimentDraft   = "draft"
+	ExperimentRunning = "running"
+	ExperimentStopped = "stopped"
+)
+
+// 实验分组单位
+const (
+	ExperimentUnitUser   = "user"   // 登录用户按用户，匿名按设备
+	ExperimentUnitDevice = "device" // 一律按设备，无设备 ID 时按用户
+)
+
+// Experiment 识别 A/B 实验，同一时间最多一个 running；按 Unit 对用户或设备做确定性分组
+type Experiment struct {
+	ID          uint            `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Name        string          `gorm:"size:64" json:"name"`
+	Description string          `gorm:"type:text" json:"description"`
+	Status      string          `gorm:"size:16;index;default:draft" json:"status"`
+	Unit        string          `gorm:"size:16;default:user" json:"unit"`
+	Salt        string          `gorm:"size:32" json:"salt"` // 分组哈希盐，不同实验的分组互相独立
+	StartedAt   *time.Time      `json:"started_at"`
+	StoppedAt   *time.Time      `json:"stopped_at"`
+	Arms        []ExperimentArm `gorm:"foreignKey:ExperimentID" json:"arms"`
+}
+
+// ExperimentArm 实验组；Provider 为空时走默认路由，Model 为空时用提供商配置的模型，PromptVersion 为 0 时用生效版本
+type ExperimentArm struct {
+	ID            uint   `gorm:"primarykey" json:"id"`
+	ExperimentID  uint   `gorm:"index" json:"experiment_id"`
+	Name          string `gorm:"size:32" json:"name"`
+	Provider      string `gorm:"size:32" json:"provider"`
+	Model         string `gorm:"size:64" json:"model"`
+	PromptVersion int    `json:"prompt_version"`
+	Weight        int    `json:"weight"` // 流量权重
+}
+
+// 批量重新识别状态
+const (
+	BackfillPending   = "pending"
+	BackfillRunning   = "running"
+	BackfillPaused    = "paused"
+	BackfillCompleted = "completed"
+	BackfillCanceled  = "canceled"
+)
+
+// BackfillRun 管理员发起的批量重新识别：按筛选条件对历史图片重新识别，结果保存为新版本，不占用户次数
+type BackfillRun struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	CreatedBy       uint       `gorm:"index" json:"created_by"`
+	Status          string     `gorm:"size:16;index" json:"status"`
+	Provider        string     `gorm:"size:32" json:"provider"` // 为空时按路由规则选择
+	PromptVersion   int        `json:"prompt_version"`          // 0 表示使用生效的提示词
+	Mode            string     `gorm:"size:16" json:"mode"`
+	Filters         string     `gorm:"type:text" json:"filters"` // BackfillFilter（JSON）
+	Promote         bool       `json:"promote"`                  // 新结果是否设为图片的当前结果
+	RatePerMinute   int        `json:"rate_per_minute"`
+	Total           int        `json:"total"`
+	Processed       int        `json:"processed"`
+	Succeeded       int        `json:"succeeded"`
+	Failed          int        `json:"failed"`
+	Cursor          uint       `json:"cursor"` // 已处理到的图片 ID，按 ID 递增处理
+	EstimatedTokens int64      `json:"estimated_tokens"`
+	EstimatedCost   float64    `json:"estimated_cost"`
+	EvalRunID       *uint      `json:"eval_run_id"` // 按评测集筛选时，完成后自动评测的记录
+	LastError       string     `gorm:"type:text" json:"last_error"`
+	LockToken       string     `gorm:"size:32" json:"-"`
+	LockedUntil     *time.Time `json:"-"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+}
+
+// 异步识别任务状态
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// RecognitionJob 异步识别任务，提交时扣减次数，最终失败或取消时退回；
+// running 状态超过 LockedUntil 未完成视为执行者失联，重新可领取
+type RecognitionJob struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UserID        uint       `gorm:"index" json:"user_id"`
+	DeviceID      string     `gorm:"size:128" json:"-"`
+	BatchID       *uint      `gorm:"index" json:"batch_id,omitempty"`
+	ImageID       uint       `gorm:"index" json:"image_id"`
+	Source        string     `gorm:"size:32" json:"source"`
+	Locale        string     `gorm:"size:16" json:"locale"`
+	Mode          string     `gorm:"size:16" json:"mode"`
+	Status        string     `gorm:"size:16;index:idx_job_claim,priority:1" json:"status"`
+	RunAfter      time.Time  `gorm:"index:idx_job_claim,priority:2" json:"run_after"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"max_attempts"`
+	LockToken     string     `gorm:"size:32" json:"-"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	ResultID      *uint      `json:"result_id"`
+	ErrorCode     string     `gorm:"size:64" json:"error_code"`
+	ErrorMessage  string     `gorm:"type:text" json:"error_message"`
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	ReservationID *uint      `gorm:"index" json:"-"` // 提交时预占的识别次数，任务成功时确认，失败或取消时退回
+}
+
+// RecognitionBatch 批量识别，每张图片一个 RecognitionJob，同一批次同时执行的任务不超过 Concurrency
+type RecognitionBatch struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Source      string     `gorm:"size:32" json:"source"`
+	Mode        string     `gorm:"size:16" json:"mode"`
+	Total       int        `json:"total"`
+	Concurrency int        `json:"concurrency"`
+	CanceledAt  *time.Time `json:"canceled_at,omitempty"`
+}
+
+// EnsembleVote 多提供商投票时单个提供商的作答
+type EnsembleVote struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ResultID    uint      `gorm:"index" json:"result_id"`
+	Provider    string    `gorm:"size:32" json:"provider"`
+	Weight      float64   `json:"weight"`
+	CropType    string    `gorm:"size:64" json:"crop_type"` // 归一化后的作物代码
+	CropTypeRaw string    `gorm:"size:128" json:"crop_type_raw"`
+	Confidence  float64   `json:"confidence"`
+	Agreed      bool      `json:"agreed"` // 是否与最终结论一致
+	RawText     string    `gorm:"type:text" json:"raw_text"`
+	Error       string    `gorm:"type:text" json:"error"`
+	DurationMs  int       `json:"duration_ms"`
+}
+
+// RecognitionFinding 病害/虫害/杂草识别结论，名称取自启用的 Tag 词表
+type RecognitionFinding struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResultID   uint      `gorm:"index" json:"result_id"`
+	Category   string    `gorm:"size:16;index" json:"category"`
+	Name       string    `gorm:"size:64;index" json:"name"`
+	Confidence float64   `json:"confidence"`
+}
+
+// RecognitionCandidate 识别结果的候选作物，Rank 从 1 开始，Rank 1 与结果的 CropType 一致
+type RecognitionCandidate struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResultID   uint      `gorm:"index" json:"result_id"`
+	Rank       int       `json:"rank"`
+	CropType   string    `gorm:"size:64;index" json:"crop_type"`
+	Confidence float64   `json:"confidence"`
 }
 
 type RecognitionFailure struct {
@@ -100,6 +433,7 @@ type FieldNote struct {
 	Confidence       float64        `json:"confidence"`
 	Description      string         `gorm:"type:text" json:"description"`
 	GrowthStage      *string        `json:"growth_stage"`
+	GrowthStageCode  *string        `gorm:"size:2" json:"growth_stage_code"`
 	PossibleIssue    *string        `json:"possible_issue"`
 	Provider         string         `gorm:"size:32" json:"provider"`
 	Tags             string         `gorm:"type:text" json:"tags"`
@@ -111,6 +445,7 @@ type FieldNote struct {
 	LabelStatus      string         `gorm:"size:16;index" json:"label_status"` // pending/labeled/approved/rejected
 	LabelCategory    string         `gorm:"size:16;index" json:"label_category"`
 	LabelCropType    string         `gorm:"size:64;index" json:"label_crop_type"`
+	LabelCropTypeRaw string         `gorm:"size:128" json:"label_crop_type_raw"`
 	LabelTags        string         `gorm:"type:text" json:"label_tags"`
 	LabelNote        string         `gorm:"type:text" json:"label_note"`
 	ReviewedBy       string         `gorm:"size:64" json:"reviewed_by"`
@@ -139,6 +474,34 @@ type Crop struct {
 	Active    bool           `gorm:"index" json:"active"`
 }
 
+// UnknownCrop 无法归一化到作物目录的原始作物名，等待后台审核映射或忽略
+type UnknownCrop struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	RawValue       string     `gorm:"size:128;uniqueIndex" json:"raw_value"`
+	Source         string     `gorm:"size:16" json:"source"` // result/label
+	SeenCount      int64      `json:"seen_count"`
+	SampleResultID *uint      `json:"sample_result_id"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	Status         string     `gorm:"size:16;index;default:pending" json:"status"` // pending/mapped/ignored
+	MappedCode     string     `gorm:"size:32" json:"mapped_code"`
+	ReviewedBy     string     `gorm:"size:64" json:"reviewed_by"`
+	ReviewedAt     *time.Time `json:"reviewed_at"`
+}
+
+// CropStage 作物 BBCH 生育期表，识别返回的生育期代码按作物校验
+type CropStage struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	CropCode  string         `gorm:"size:32;uniqueIndex:idx_crop_stage" json:"crop_code"`
+	Code      string         `gorm:"size:2;uniqueIndex:idx_crop_stage" json:"code"` // 两位 BBCH 代码，如 31
+	Label     string         `gorm:"size:64" json:"label"`
+	Active    bool           `gorm:"index" json:"active"`
+}
+
 type Tag struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -158,19 +521,35 @@ type AppSetting struct {
 	Value     string         `gorm:"type:text" json:"value"`
 }
 
+// PromptTemplate 识别提示词模板，同名模板按版本递增，仅一个生效
+type PromptTemplate struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `gorm:"size:32;uniqueIndex:idx_prompt_name_version" json:"name"`
+	Version   int            `gorm:"uniqueIndex:idx_prompt_name_version" json:"version"`
+	Content   string         `gorm:"type:text" json:"content"`
+	Note      string         `gorm:"size:256" json:"note"`
+	Active    bool           `gorm:"index;default:false" json:"active"`
+}
+
 type PlanSetting struct {
-	ID            uint           `gorm:"primarykey" json:"id"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
-	Code          string         `gorm:"size:16;uniqueIndex" json:"code"`
-	Name          string         `gorm:"size:32" json:"name"`
-	Description   string         `gorm:"type:text" json:"description"`
-	QuotaTotal    int            `json:"quota_total"`
-	RetentionDays int            `json:"retention_days"`
-	RequireAd     bool           `json:"require_ad"`
-	PriceCents    int            `json:"price_cents"`
-	BillingUnit   string         `gorm:"size:16" json:"billing_unit"` // month/year/once
+	ID                uint           `gorm:"primarykey" json:"id"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+	Code              string         `gorm:"size:16;uniqueIndex" json:"code"`
+	Name              string         `gorm:"size:32" json:"name"`
+	Description       string         `gorm:"type:text" json:"description"`
+	QuotaTotal        int            `json:"quota_total"`
+	RetentionDays     int            `json:"retention_days"`
+	RequireAd         bool           `json:"require_ad"`
+	PriceCents        int            `json:"price_cents"`
+	BillingUnit       string         `gorm:"size:16" json:"billing_unit"`        // month/year/once
+	EnsembleMode      string         `gorm:"size:16" json:"ensemble_mode"`       // off/always/low_confidence
+	EnsembleProviders string         `gorm:"size:255" json:"ensemble_providers"` // name=weight 逗号分隔
+	EnsembleThreshold float64        `json:"ensemble_threshold"`                 // low_confidence 模式下触发投票的置信度阈值
 }
 
 type EmailOTP struct {
@@ -219,16 +598,18 @@ type AdminAuditLog struct {
 }
 
 type EvalRun struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
-	Days       int            `json:"days"`
-	Total      int64          `json:"total"`
-	Correct    int64          `json:"correct"`
-	Accuracy   float64        `json:"accuracy"`
-	ByCrop     string         `gorm:"type:text" json:"by_crop"`
-	Confusions string         `gorm:"type:text" json:"confusions"`
+	ID           uint           `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Days         int            `json:"days"`
+	Total        int64          `json:"total"`
+	Correct      int64          `json:"correct"`
+	Accuracy     float64        `json:"accuracy"`
+	ByCrop       string         `gorm:"type:text" json:"by_crop"`
+	Confusions   string         `gorm:"type:text" json:"confusions"`
+	Top3Correct  int64          `json:"top3_correct"`
+	Top3Accuracy float64        `json:"top3_accuracy"`
 }
 
 type QCSample struct {
@@ -280,18 +661,21 @@ type EvalSetItem struct {
 }
 
 type EvalSetRun struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
-	EvalSetID  uint           `gorm:"index" json:"eval_set_id"`
-	Total      int64          `json:"total"`
-	Correct    int64          `json:"correct"`
-	Accuracy   float64        `json:"accuracy"`
-	ByCrop     string         `gorm:"type:text" json:"by_crop"`
-	Confusions string         `gorm:"type:text" json:"confusions"`
-	BaselineID *uint          `gorm:"index" json:"baseline_id"`
-	DeltaAcc   float64        `json:"delta_acc"`
+	ID           uint           `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	EvalSetID    uint           `gorm:"index" json:"eval_set_id"`
+	Total        int64          `json:"total"`
+	Correct      int64          `json:"correct"`
+	Accuracy     float64        `json:"accuracy"`
+	ByCrop       string         `gorm:"type:text" json:"by_crop"`
+	Confusions   string         `gorm:"type:text" json:"confusions"`
+	Top3Correct  int64          `json:"top3_correct"`
+	Top3Accuracy float64        `json:"top3_accuracy"`
+	BaselineID   *uint          `gorm:"index" json:"baseline_id"`
+	DeltaAcc     float64        `json:"delta_acc"`
+	BackfillID   *uint          `gorm:"index" json:"backfill_id"` // 使用该次批量重新识别的结果评测，为空时使用评测集创建时的预测
 }
 
 type UserSession struct {
@@ -4,6 +4,8 @@ import (
 	"agri-scan/internal/model"
 	"strings"
 	"time"
+
+	"gorm.io/gorm/clause"
 )
 
 // Admin audit
@@ -175,6 +177,12 @@ func (r *Repository) UpdateLabelNote(noteID uint, fields map[string]interface{})
 	return r.db.Model(&model.FieldNote{}).Where("id = ?", noteID).Updates(fields).Error
 }
 
+func (r *Repository) GetNoteByID(id uint) (*model.FieldNote, error) {
+	var note model.FieldNote
+	err := r.db.First(&note, id).Error
+	return &note, err
+}
+
 func (r *Repository) GetNoteByResultID(resultID uint) (*model.FieldNote, error) {
 	var note model.FieldNote
 	err := r.db.Where("result_id = ?", resultID).Order("id DESC").First(&note).Error
@@ -184,8 +192,10 @@ func (r *Repository) GetNoteByResultID(resultID uint) (*model.FieldNote, error)
 	return &note, nil
 }
 
-func (r *Repository) BatchApproveLabelNotes(status, category, cropType string, start, end *time.Time, reviewer string, reviewedAt time.Time) (int64, error) {
-	query := r.db.Model(&model.FieldNote{})
+// BatchApproveLabelNotes 批量通过标注，返回本次通过的手记
+func (r *Repository) BatchApproveLabelNotes(status, category, cropType string, start, end *time.Time, reviewer string, reviewedAt time.Time) ([]model.FieldNote, error) {
+	var notes []model.FieldNote
+	query := r.db.Model(&notes).Clauses(clause.Returning{})
 	status = strings.TrimSpace(status)
 	if status == "" {
 		status = "labeled"
@@ -212,8 +222,8 @@ func (r *Repository) BatchApproveLabelNotes(status, category, cropType string, s
 		"reviewed_by":  reviewer,
 		"reviewed_at":  &reviewedAt,
 	}
-	res := query.Updates(fields)
-	return res.RowsAffected, res.Error
+	err := query.Updates(fields).Error
+	return notes, err
 }
 
 // Evaluation
@@ -145,45 +145,18 @@ func (r *Repository) UpdateDeviceUsage(usage *model.DeviceUsage) error {
 	return r.db.Save(usage).Error
 }
 
-func (r *Repository) IncrementDeviceRecognize(deviceID string) error {
-	return r.db.Model(&model.DeviceUsage{}).
-		Where("device_id = ?", deviceID).
-		Update("recognize_count", gorm.Expr("recognize_count + 1")).Error
-}
-
 func (r *Repository) IncrementDeviceAdCredits(deviceID string, delta int) error {
 	return r.db.Model(&model.DeviceUsage{}).
 		Where("device_id = ?", deviceID).
 		Update("ad_credits", gorm.Expr("ad_credits + ?", delta)).Error
 }
 
-func (r *Repository) DecrementDeviceAdCredits(deviceID string) (bool, error) {
-	res := r.db.Model(&model.DeviceUsage{}).
-		Where("device_id = ? AND ad_credits > 0", deviceID).
-		Update("ad_credits", gorm.Expr("ad_credits - 1"))
-	return res.RowsAffected > 0, res.Error
-}
-
-// User usage
-func (r *Repository) IncrementUserQuotaUsed(userID uint) error {
-	return r.db.Model(&model.User{}).
-		Where("id = ?", userID).
-		Update("quota_used", gorm.Expr("quota_used + 1")).Error
-}
-
 func (r *Repository) IncrementUserAdCredits(userID uint, delta int) error {
 	return r.db.Model(&model.User{}).
 		Where("id = ?", userID).
 		Update("ad_credits", gorm.Expr("ad_credits + ?", delta)).Error
 }
 
-func (r *Repository) DecrementUserAdCredits(userID uint) (bool, error) {
-	res := r.db.Model(&model.User{}).
-		Where("id = ? AND ad_credits > 0", userID).
-		Update("ad_credits", gorm.Expr("ad_credits - 1"))
-	return res.RowsAffected > 0, res.Error
-}
-
 func (r *Repository) TransferUserData(fromUserID, toUserID uint) error {
 	if fromUserID == 0 || toUserID == 0 || fromUserID == toUserID {
 		return nil
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BackfillFilter 批量重新识别的图片筛选条件，作物/提供商/来源按图片当前结果匹配
+type BackfillFilter struct {
+	StartDate *time.Time `json:"start_date,omitempty"`
+	EndDate   *time.Time `json:"end_date,omitempty"`
+	CropType  string     `json:"crop_type,omitempty"`
+	Provider  string     `json:"provider,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	EvalSetID *uint      `json:"eval_set_id,omitempty"`
+}
+
+func (r *Repository) backfillImageQuery(f BackfillFilter) *gorm.DB {
+	query := r.db.Model(&model.Image{}).
+		Joins("JOIN recognition_results ON recognition_results.image_id = images.id AND recognition_results.is_current = ? AND recognition_results.deleted_at IS NULL", true)
+	if f.StartDate != nil {
+		query = query.Where("images.created_at >= ?", *f.StartDate)
+	}
+	if f.EndDate != nil {
+		query = query.Where("images.created_at < ?", *f.EndDate)
+	}
+	if f.CropType != "" {
+		query = query.Where("recognition_results.crop_type = ?", f.CropType)
+	}
+	if f.Provider != "" {
+		query = query.Where("recognition_results.provider = ?", f.Provider)
+	}
+	if f.Source != "" {
+		query = query.Where("recognition_results.source = ?", f.Source)
+	}
+	if f.EvalSetID != nil {
+		sub := r.db.Model(&model.EvalSetItem{}).Select("image_id").Where("eval_set_id = ?", *f.EvalSetID)
+		query = query.Where("images.id IN (?)", sub)
+	}
+	return query
+}
+
+func (r *Repository) CountBackfillImages(f BackfillFilter) (int64, error) {
+	var count int64
+	err := r.backfillImageQuery(f).Count(&count).Error
+	return count, err
+}
+
+// NextBackfillImages 按 ID 递增取 cursor 之后的待处理图片
+func (r *Repository) NextBackfillImages(f BackfillFilter, cursor uint, limit int) ([]model.Image, error) {
+	var items []model.Image
+	err := r.backfillImageQuery(f).
+		Where("images.id > ?", cursor).
+		Order("images.id ASC").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) CreateBackfillRun(run *model.BackfillRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r *Repository) GetBackfillRun(id uint) (*model.BackfillRun, error) {
+	var run model.BackfillRun
+	err := r.db.First(&run, id).Error
+	return &run, err
+}
+
+func (r *Repository) ListBackfillRuns(status string, limit, offset int) ([]model.BackfillRun, error) {
+	var items []model.BackfillRun
+	query := r.db.Model(&model.BackfillRun{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// TransitionBackfillRun 仅当当前状态属于 from 时更新，返回是否更新成功
+func (r *Repository) TransitionBackfillRun(id uint, from []string, updates map[string]interface{}) (bool, error) {
+	res := r.db.Model(&model.BackfillRun{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// LeaseBackfillRun 领取一个运行中且未被其他实例持有的批量重新识别，多实例部署时同一时刻只有一个执行者
+func (r *Repository) LeaseBackfillRun(token string, leaseFor time.Duration) (*model.BackfillRun, error) {
+	var runs []model.BackfillRun
+	err := r.db.Raw(`
+UPDATE backfill_runs SET lock_token = ?, locked_until = ?, updated_at = ?
+WHERE id = (
+	SELECT id FROM backfill_runs
+	WHERE status = ? AND (locked_until IS NULL OR locked_until < ?)
+	ORDER BY id ASC
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`, token, time.Now().Add(leaseFor), time.Now(), model.BackfillRunning, time.Now()).Scan(&runs).Error
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return &runs[0], nil
+}
+
+// AdvanceBackfillRun 记录一张图片的处理结果并续租，租约已被其他执行者取得时返回 false
+func (r *Repository) AdvanceBackfillRun(id uint, token string, cursor uint, success bool, lastError string, leaseFor time.Duration) (bool, error) {
+	updates := map[string]interface{}{
+		"cursor":       cursor,
+		"processed":    gorm.Expr("processed + 1"),
+		"locked_until": time.Now().Add(leaseFor),
+	}
+	if success {
+		updates["succeeded"] = gorm.Expr("succeeded + 1")
+	} else {
+		updates["failed"] = gorm.Expr("failed + 1")
+		updates["last_error"] = lastError
+	}
+	res := r.db.Model(&model.BackfillRun{}).
+		Where("id = ? AND lock_token = ?", id, token).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReleaseBackfillRun 释放租约，暂停或取消后由执行者调用
+func (r *Repository) ReleaseBackfillRun(id uint, token string) error {
+	return r.db.Model(&model.BackfillRun{}).
+		Where("id = ? AND lock_token = ?", id, token).
+		Updates(map[string]interface{}{"lock_token": "", "locked_until": nil}).Error
+}
+
+// ListBackfillResults 某次批量重新识别产生的结果
+func (r *Repository) ListBackfillResults(backfillID uint) ([]model.RecognitionResult, error) {
+	var items []model.RecognitionResult
+	err := r.db.Where("backfill_id = ?", backfillID).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+// UsageAverage 单次识别尝试的平均用量
+type UsageAverage struct {
+	Samples          int64   `json:"samples"`
+	Calls            float64 `json:"calls"`
+	PromptTokens     float64 `json:"prompt_tokens"`
+	CompletionTokens float64 `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// AverageUsage 近期成功尝试的平均用量，provider 为空时统计全部提供商
+func (r *Repository) AverageUsage(provider string, since time.Time) (UsageAverage, error) {
+	var row UsageAverage
+	query := r.db.Model(&model.UsageRecord{}).
+		Select("count(*) as samples, coalesce(avg(calls), 0) as calls, coalesce(avg(prompt_tokens), 0) as prompt_tokens, coalesce(avg(completion_tokens), 0) as completion_tokens, coalesce(avg(cost), 0) as cost").
+		Where("success = ? AND created_at >= ?", true, since)
+	if provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	err := query.Scan(&row).Error
+	return row, err
+}
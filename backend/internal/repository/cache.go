@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+)
+
+// UpdateImageContentHash 记录图片内容哈希，fileSize 为 0 时不更新大小
+func (r *Repository) UpdateImageContentHash(imageID uint, hash string, fileSize int64) error {
+	updates := map[string]interface{}{"content_hash": hash}
+	if fileSize > 0 {
+		updates["file_size"] = fileSize
+	}
+	return r.db.Model(&model.Image{}).Where("id = ?", imageID).Updates(updates).Error
+}
+
+// ListCachedResults 同一图片内容在有效期内由指定提供商以相同模式、语言产出的结果，不含缓存命中产生的副本，按时间倒序
+func (r *Repository) ListCachedResults(contentHash, mode, locale string, promptVersion int, providers []string, since time.Time, limit int) ([]model.RecognitionResult, error) {
+	var items []model.RecognitionResult
+	err := r.db.Model(&model.RecognitionResult{}).
+		Joins("JOIN images ON images.id = recognition_results.image_id AND images.deleted_at IS NULL").
+		Where("images.content_hash = ?", contentHash).
+		Where("recognition_results.mode = ? AND recognition_results.locale = ? AND recognition_results.prompt_version = ?", mode, locale, promptVersion).
+		Where("recognition_results.provider IN ?", providers).
+		Where("recognition_results.cache_hit = ? AND recognition_results.updated_at >= ?", false, since).
+		Order("recognition_results.updated_at DESC").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CalibrationSampleRow 校准样本：识别结果的原始置信度与反馈/标注
+type CalibrationSampleRow struct {
+	ResultID      uint
+	Provider      string
+	CropType      string
+	Confidence    float64
+	IsCorrect     *bool
+	LabelCropType string
+}
+
+// ListFeedbackCalibrationSamples 用户反馈样本
+func (r *Repository) ListFeedbackCalibrationSamples(since time.Time) ([]CalibrationSampleRow, error) {
+	var rows []CalibrationSampleRow
+	err := r.db.Table("user_feedbacks").
+		Select("recognition_results.id as result_id, recognition_results.provider, recognition_results.crop_type, recognition_results.confidence, user_feedbacks.is_correct").
+		Joins("JOIN recognition_results ON recognition_results.id = user_feedbacks.result_id AND recognition_results.deleted_at IS NULL").
+		Where("user_feedbacks.deleted_at IS NULL AND user_feedbacks.created_at >= ?", since).
+		Order("user_feedbacks.id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ListLabelCalibrationSamples 审核通过的标注样本
+func (r *Repository) ListLabelCalibrationSamples(since time.Time) ([]CalibrationSampleRow, error) {
+	var rows []CalibrationSampleRow
+	err := r.db.Table("field_notes").
+		Select("recognition_results.id as result_id, recognition_results.provider, recognition_results.crop_type, recognition_results.confidence, field_notes.label_crop_type").
+		Joins("JOIN recognition_results ON recognition_results.id = field_notes.result_id AND recognition_results.deleted_at IS NULL").
+		Where("field_notes.deleted_at IS NULL AND field_notes.label_status = ? AND field_notes.label_crop_type <> '' AND field_notes.updated_at >= ?", "approved", since).
+		Order("field_notes.id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *Repository) ListCalibrationMaps(provider string) ([]model.CalibrationMap, error) {
+	var items []model.CalibrationMap
+	query := r.db.Model(&model.CalibrationMap{})
+	if provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	err := query.Order("provider ASC, crop_type ASC").Find(&items).Error
+	return items, err
+}
+
+// ReplaceCalibrationMaps 整体替换校准映射
+func (r *Repository) ReplaceCalibrationMaps(items []model.CalibrationMap) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&model.CalibrationMap{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+}
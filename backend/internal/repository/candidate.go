@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ReplaceCandidates 覆盖结果的全部候选
+func (r *Repository) ReplaceCandidates(resultID uint, candidates []model.RecognitionCandidate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("result_id = ?", resultID).Delete(&model.RecognitionCandidate{}).Error; err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		for i := range candidates {
+			candidates[i].ResultID = resultID
+		}
+		return tx.Create(&candidates).Error
+	})
+}
+
+func (r *Repository) ListCandidatesByResultIDs(resultIDs []uint) ([]model.RecognitionCandidate, error) {
+	if len(resultIDs) == 0 {
+		return []model.RecognitionCandidate{}, nil
+	}
+	var items []model.RecognitionCandidate
+	err := r.db.Where("result_id IN ?", resultIDs).Order("result_id ASC, rank ASC").Find(&items).Error
+	return items, err
+}
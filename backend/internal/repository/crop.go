@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordUnknownCrop 记录一次未能归一化的作物名，同名累加次数
+func (r *Repository) RecordUnknownCrop(raw, source string, resultID *uint) error {
+	now := time.Now()
+	item := model.UnknownCrop{
+		RawValue:       raw,
+		Source:         source,
+		SeenCount:      1,
+		SampleResultID: resultID,
+		LastSeenAt:     now,
+		Status:         "pending",
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "raw_value"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"seen_count":   gorm.Expr("unknown_crops.seen_count + 1"),
+			"last_seen_at": now,
+			"updated_at":   now,
+		}),
+	}).Create(&item).Error
+}
+
+func (r *Repository) ListUnknownCrops(status string, limit, offset int) ([]model.UnknownCrop, error) {
+	var items []model.UnknownCrop
+	query := r.db.Model(&model.UnknownCrop{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("seen_count DESC, id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) GetUnknownCropByID(id uint) (*model.UnknownCrop, error) {
+	var item model.UnknownCrop
+	if err := r.db.First(&item, id).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *Repository) UpdateUnknownCrop(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&model.UnknownCrop{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// AppendCropAlias 为作物追加别名（已存在时忽略）
+func (r *Repository) AppendCropAlias(code, alias string) error {
+	var crop model.Crop
+	if err := r.db.Where("code = ?", code).First(&crop).Error; err != nil {
+		return err
+	}
+	for _, a := range strings.Split(crop.Aliases, ",") {
+		if strings.EqualFold(strings.TrimSpace(a), alias) {
+			return nil
+		}
+	}
+	aliases := alias
+	if strings.TrimSpace(crop.Aliases) != "" {
+		aliases = crop.Aliases + "," + alias
+	}
+	return r.db.Model(&model.Crop{}).Where("id = ?", crop.ID).Update("aliases", aliases).Error
+}
+
+// RemapCropType 将仍为原始值的结果、手记与标注改写为作物代码，返回影响行数
+func (r *Repository) RemapCropType(raw, code string) (int64, error) {
+	var total int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.RecognitionResult{}).
+			Where("crop_type = ?", raw).
+			Updates(map[string]interface{}{"crop_type": code, "crop_type_raw": raw})
+		if res.Error != nil {
+			return res.Error
+		}
+		total += res.RowsAffected
+		res = tx.Model(&model.FieldNote{}).Where("crop_type = ?", raw).Update("crop_type", code)
+		if res.Error != nil {
+			return res.Error
+		}
+		total += res.RowsAffected
+		res = tx.Model(&model.FieldNote{}).
+			Where("label_crop_type = ?", raw).
+			Updates(map[string]interface{}{"label_crop_type": code, "label_crop_type_raw": raw})
+		if res.Error != nil {
+			return res.Error
+		}
+		total += res.RowsAffected
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,23 @@
+package repository
+
+import "agri-scan/internal/model"
+
+// GetCropStages 返回启用的生育期，cropCode 为空时返回全部作物
+func (r *Repository) GetCropStages(cropCode string) ([]model.CropStage, error) {
+	var items []model.CropStage
+	query := r.db.Where("active = ?", true)
+	if cropCode != "" {
+		query = query.Where("crop_code = ?", cropCode)
+	}
+	err := query.Order("crop_code ASC, code ASC").Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) GetCropStage(cropCode, code string) (*model.CropStage, error) {
+	var item model.CropStage
+	err := r.db.Where("crop_code = ? AND code = ? AND active = ?", cropCode, code, true).First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ReplaceEnsembleVotes 覆盖结果的全部投票明细
+func (r *Repository) ReplaceEnsembleVotes(resultID uint, votes []model.EnsembleVote) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("result_id = ?", resultID).Delete(&model.EnsembleVote{}).Error; err != nil {
+			return err
+		}
+		if len(votes) == 0 {
+			return nil
+		}
+		for i := range votes {
+			votes[i].ResultID = resultID
+		}
+		return tx.Create(&votes).Error
+	})
+}
+
+func (r *Repository) ListEnsembleVotesByResultIDs(resultIDs []uint) ([]model.EnsembleVote, error) {
+	if len(resultIDs) == 0 {
+		return []model.EnsembleVote{}, nil
+	}
+	var items []model.EnsembleVote
+	err := r.db.Where("result_id IN ?", resultIDs).Order("result_id ASC, id ASC").Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrExperimentRunning 已有其他实验在运行
+var ErrExperimentRunning = errors.New("another experiment is running")
+
+func (r *Repository) CreateExperiment(exp *model.Experiment) error {
+	return r.db.Create(exp).Error
+}
+
+func (r *Repository) GetExperiment(id uint) (*model.Experiment, error) {
+	var exp model.Experiment
+	err := r.db.Preload("Arms", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&exp, id).Error
+	return &exp, err
+}
+
+func (r *Repository) ListExperiments(status string, limit, offset int) ([]model.Experiment, error) {
+	items := make([]model.Experiment, 0)
+	query := r.db.Model(&model.Experiment{}).Preload("Arms", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// GetRunningExperiment 当前运行中的实验，没有时返回 nil
+func (r *Repository) GetRunningExperiment() (*model.Experiment, error) {
+	var items []model.Experiment
+	err := r.db.Preload("Arms", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("status = ?", model.ExperimentRunning).Order("id ASC").Limit(1).Find(&items).Error
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// StartExperiment 将草稿实验置为运行中，已有其他实验运行时返回 ErrExperimentRunning；返回是否更新成功
+func (r *Repository) StartExperiment(id uint, startedAt time.Time) (bool, error) {
+	updated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 事务级咨询锁串行化启动，避免两个实验同时进入 running
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('experiments_start'))").Error; err != nil {
+			return err
+		}
+		var running int64
+		if err := tx.Model(&model.Experiment{}).Where("status = ?", model.ExperimentRunning).Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrExperimentRunning
+		}
+		res := tx.Model(&model.Experiment{}).
+			Where("id = ? AND status = ?", id, model.ExperimentDraft).
+			Updates(map[string]interface{}{"status": model.ExperimentRunning, "started_at": &startedAt})
+		updated = res.RowsAffected > 0
+		return res.Error
+	})
+	return updated, err
+}
+
+// TransitionExperiment 仅当当前状态属于 from 时更新，返回是否更新成功
+func (r *Repository) TransitionExperiment(id uint, from []string, updates map[string]interface{}) (bool, error) {
+	res := r.db.Model(&model.Experiment{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ExperimentArmStat 实验组的结果统计；延迟与费用只统计实际调用提供商的结果
+type ExperimentArmStat struct {
+	ArmID           uint
+	Results         int64
+	CacheHits       int64
+	LowConfidence   int64
+	Calls           int64
+	AvgDurationMs   float64
+	StdDurationMs   float64
+	AvgCost         float64
+	StdCost         float64
+	TotalCost       float64
+	FeedbackTotal   int64
+	FeedbackCorrect int64
+}
+
+// ExperimentArmStats 按组汇总实验结果，反馈取每条结果最近一次
+func (r *Repository) ExperimentArmStats(experimentID uint, start, end *time.Time, lowConfidence float64) (map[uint]*ExperimentArmStat, error) {
+	var rows []ExperimentArmStat
+	query := r.db.Table("recognition_results r").
+		Select(`r.arm_id,
+			count(*) AS results,
+			count(*) FILTER (WHERE r.cache_hit) AS cache_hits,
+			count(*) FILTER (WHERE r.confidence >= 0 AND r.confidence < ?) AS low_confidence,
+			count(*) FILTER (WHERE NOT r.cache_hit) AS calls,
+			coalesce(avg(r.duration_ms) FILTER (WHERE NOT r.cache_hit), 0) AS avg_duration_ms,
+			coalesce(stddev_samp(r.duration_ms) FILTER (WHERE NOT r.cache_hit), 0) AS std_duration_ms,
+			coalesce(avg(coalesce(u.cost, 0)) FILTER (WHERE NOT r.cache_hit), 0) AS avg_cost,
+			coalesce(stddev_samp(coalesce(u.cost, 0)) FILTER (WHERE NOT r.cache_hit), 0) AS std_cost,
+			coalesce(sum(u.cost), 0) AS total_cost,
+			count(fb.is_correct) AS feedback_total,
+			count(*) FILTER (WHERE fb.is_correct) AS feedback_correct`, lowConfidence).
+		Joins("LEFT JOIN (SELECT result_id, sum(cost) AS cost FROM usage_records WHERE result_id IN (SELECT id FROM recognition_results WHERE experiment_id = ?) GROUP BY result_id) u ON u.result_id = r.id", experimentID).
+		Joins("LEFT JOIN LATERAL (SELECT is_correct FROM user_feedbacks WHERE user_feedbacks.result_id = r.id AND user_feedbacks.deleted_at IS NULL ORDER BY id DESC LIMIT 1) fb ON true").
+		Where("r.experiment_id = ? AND r.arm_id IS NOT NULL AND r.deleted_at IS NULL", experimentID)
+	if start != nil {
+		query = query.Where("r.created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("r.created_at < ?", *end)
+	}
+	if err := query.Group("r.arm_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]*ExperimentArmStat, len(rows))
+	for i := range rows {
+		out[rows[i].ArmID] = &rows[i]
+	}
+	return out, nil
+}
@@ -46,7 +46,7 @@ func (r *Repository) ListFailureTop(since time.Time, limit int, stage string) ([
 	rows := make([]FailureTopRow, 0)
 	query := r.db.Model(&model.RecognitionFailure{}).
 		Select("recognition_failures.stage, recognition_failures.error_code, max(recognition_failures.error_message) as error_message, count(*) as count, sum(recognition_failures.retry_count) as retry_total, sum(case when recognition_results.id is not null then 1 else 0 end) as success_count").
-		Joins("LEFT JOIN recognition_results ON recognition_results.image_id = recognition_failures.image_id").
+		Joins("LEFT JOIN recognition_results ON recognition_results.image_id = recognition_failures.image_id AND recognition_results.is_current = ?", true).
 		Where("recognition_failures.created_at >= ?", since)
 	if stage != "" {
 		query = query.Where("recognition_failures.stage = ?", stage)
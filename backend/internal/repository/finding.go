@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ResultFilter 识别结果的扩展过滤条件（识别模式、病虫草结论与 BBCH 生育期）
+type ResultFilter struct {
+	Mode            string
+	FindingCategory string
+	FindingName     string
+	GrowthStage     string // BBCH 代码精确匹配
+	MinStage        string // BBCH 代码区间，两位代码按字符串比较
+	MaxStage        string
+}
+
+// ApplyResultFilter 在以 recognition_results 为主表的查询上追加过滤
+func ApplyResultFilter(query *gorm.DB, f ResultFilter) *gorm.DB {
+	if f.Mode != "" {
+		query = query.Where("recognition_results.mode = ?", f.Mode)
+	}
+	if f.GrowthStage != "" {
+		query = query.Where("recognition_results.growth_stage_code = ?", f.GrowthStage)
+	}
+	if f.MinStage != "" {
+		query = query.Where("recognition_results.growth_stage_code >= ?", f.MinStage)
+	}
+	if f.MaxStage != "" {
+		query = query.Where("recognition_results.growth_stage_code <= ?", f.MaxStage)
+	}
+	if f.FindingCategory != "" || f.FindingName != "" {
+		sub := "SELECT 1 FROM recognition_findings WHERE recognition_findings.result_id = recognition_results.id"
+		args := []interface{}{}
+		if f.FindingCategory != "" {
+			sub += " AND recognition_findings.category = ?"
+			args = append(args, f.FindingCategory)
+		}
+		if f.FindingName != "" {
+			sub += " AND recognition_findings.name = ?"
+			args = append(args, f.FindingName)
+		}
+		query = query.Where("EXISTS ("+sub+")", args...)
+	}
+	return query
+}
+
+// ReplaceFindings 覆盖结果的全部结论
+func (r *Repository) ReplaceFindings(resultID uint, findings []model.RecognitionFinding) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("result_id = ?", resultID).Delete(&model.RecognitionFinding{}).Error; err != nil {
+			return err
+		}
+		if len(findings) == 0 {
+			return nil
+		}
+		for i := range findings {
+			findings[i].ResultID = resultID
+		}
+		return tx.Create(&findings).Error
+	})
+}
+
+func (r *Repository) ListFindingsByResultIDs(resultIDs []uint) ([]model.RecognitionFinding, error) {
+	if len(resultIDs) == 0 {
+		return []model.RecognitionFinding{}, nil
+	}
+	var items []model.RecognitionFinding
+	err := r.db.Where("result_id IN ?", resultIDs).Order("confidence DESC").Find(&items).Error
+	return items, err
+}
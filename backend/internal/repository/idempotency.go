@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// AcquireIdempotencyKey 尝试占用幂等键；已过期或处理中超过 staleBefore 未更新的旧记录先删除再占用。
+// 占用成功返回 item 与 true，否则返回已有记录与 false
+func (r *Repository) AcquireIdempotencyKey(item *model.IdempotencyKey, staleBefore time.Time) (*model.IdempotencyKey, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(item)
+		if res.Error != nil {
+			return nil, false, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return item, true, nil
+		}
+		var existing model.IdempotencyKey
+		if err := r.db.Where("scope = ? AND key = ?", item.Scope, item.Key).First(&existing).Error; err != nil {
+			return nil, false, err
+		}
+		now := time.Now()
+		if existing.ExpiresAt.After(now) && !(existing.Status == model.IdempotencyProcessing && existing.UpdatedAt.Before(staleBefore)) {
+			return &existing, false, nil
+		}
+		// 按 updated_at 条件删除，避免并发时删掉别人刚占用的记录
+		if err := r.db.Where("id = ? AND updated_at = ?", existing.ID, existing.UpdatedAt).Delete(&model.IdempotencyKey{}).Error; err != nil {
+			return nil, false, err
+		}
+		item.ID = 0
+	}
+	var existing model.IdempotencyKey
+	err := r.db.Where("scope = ? AND key = ?", item.Scope, item.Key).First(&existing).Error
+	return &existing, false, err
+}
+
+// CompleteIdempotencyKey 保存首次请求的响应
+func (r *Repository) CompleteIdempotencyKey(id uint, status int, contentType, body string) error {
+	return r.db.Model(&model.IdempotencyKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          model.IdempotencyCompleted,
+		"response_status": status,
+		"response_type":   contentType,
+		"response_body":   body,
+	}).Error
+}
+
+func (r *Repository) DeleteIdempotencyKey(id uint) error {
+	return r.db.Delete(&model.IdempotencyKey{}, id).Error
+}
+
+// PurgeExpiredIdempotencyKeys 删除过期的幂等键
+func (r *Repository) PurgeExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	res := r.db.Where("expires_at < ?", before).Delete(&model.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
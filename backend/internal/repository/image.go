@@ -0,0 +1,29 @@
+package repository
+
+import "agri-scan/internal/model"
+
+// ListImagesWithoutThumbnail 还没有缩略图的图片，按 ID 顺序从 afterID 之后取
+func (r *Repository) ListImagesWithoutThumbnail(afterID uint, limit int) ([]model.Image, error) {
+	var items []model.Image
+	err := r.db.Where("id > ? AND (thumbnail_url = '' OR thumbnail_url IS NULL)", afterID).
+		Order("id ASC").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) CountImagesWithoutThumbnail(afterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Image{}).
+		Where("id > ? AND (thumbnail_url = '' OR thumbnail_url IS NULL)", afterID).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdateImageVariants 回填展示图、缩略图与原图尺寸
+func (r *Repository) UpdateImageVariants(id uint, compressedURL, thumbnailURL string, width, height int) error {
+	return r.db.Model(&model.Image{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"compressed_url": compressedURL,
+		"thumbnail_url":  thumbnailURL,
+		"width":          width,
+		"height":         height,
+	}).Error
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *Repository) CreateRecognitionJob(job *model.RecognitionJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *Repository) GetRecognitionJob(id uint) (*model.RecognitionJob, error) {
+	var job model.RecognitionJob
+	err := r.db.First(&job, id).Error
+	return &job, err
+}
+
+// ClaimRecognitionJob 领取一个到期的排队任务或锁已过期的执行中任务，批量任务受批次并发上限约束，没有可领取任务时返回 nil
+func (r *Repository) ClaimRecognitionJob(token string, lockFor time.Duration) (*model.RecognitionJob, error) {
+	now := time.Now()
+	var claimed *model.RecognitionJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var candidate model.RecognitionJob
+		res := tx.Raw(`SELECT j.* FROM recognition_jobs j
+			LEFT JOIN recognition_batches b ON b.id = j.batch_id
+			WHERE ((j.status = ? AND j.run_after <= ?) OR (j.status = ? AND j.locked_until < ?))
+				AND (j.batch_id IS NULL OR b.concurrency > (
+					SELECT count(*) FROM recognition_jobs r
+					WHERE r.batch_id = j.batch_id AND r.status = ? AND r.locked_until >= ?
+				))
+			ORDER BY j.run_after, j.id
+			LIMIT 1
+			FOR UPDATE OF j SKIP LOCKED`,
+			model.JobQueued, now, model.JobRunning, now,
+			model.JobRunning, now,
+		).Scan(&candidate)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if candidate.BatchID != nil {
+			// 锁住批次行串行化同批次的领取，再按已提交的数据复核并发数；
+			// 否则两个执行者各自领取同批次的不同任务时都会看到未满的并发数
+			var batch model.RecognitionBatch
+			if err := tx.Raw("SELECT * FROM recognition_batches WHERE id = ? FOR UPDATE", *candidate.BatchID).Scan(&batch).Error; err != nil {
+				return err
+			}
+			var running int64
+			if err := tx.Model(&model.RecognitionJob{}).
+				Where("batch_id = ? AND status = ? AND locked_until >= ? AND id <> ?", batch.ID, model.JobRunning, now, candidate.ID).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running >= int64(batch.Concurrency) {
+				return nil
+			}
+		}
+		var jobs []model.RecognitionJob
+		if err := tx.Raw(`UPDATE recognition_jobs SET status = ?, lock_token = ?, locked_until = ?, attempts = attempts + 1,
+			started_at = COALESCE(started_at, ?), updated_at = ?
+			WHERE id = ?
+			RETURNING *`,
+			model.JobRunning, token, now.Add(lockFor), now, now, candidate.ID,
+		).Scan(&jobs).Error; err != nil {
+			return err
+		}
+		if len(jobs) > 0 {
+			claimed = &jobs[0]
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// RenewRecognitionJobLock 仍持有锁时延长锁期限，锁已被其他执行者接管时返回 false
+func (r *Repository) RenewRecognitionJobLock(id uint, token string, lockFor time.Duration) (bool, error) {
+	res := r.db.Model(&model.RecognitionJob{}).
+		Where("id = ? AND status = ? AND lock_token = ?", id, model.JobRunning, token).
+		Update("locked_until", time.Now().Add(lockFor))
+	return res.RowsAffected > 0, res.Error
+}
+
+// FinishRecognitionJob 在仍持有锁时更新任务，锁已被其他执行者接管时返回 false
+func (r *Repository) FinishRecognitionJob(id uint, token string, updates map[string]interface{}) (bool, error) {
+	updates["lock_token"] = ""
+	updates["locked_until"] = nil
+	res := r.db.Model(&model.RecognitionJob{}).
+		Where("id = ? AND status = ? AND lock_token = ?", id, model.JobRunning, token).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// CancelRecognitionJob 仅取消尚未开始执行的任务
+func (r *Repository) CancelRecognitionJob(id uint) (bool, error) {
+	now := time.Now()
+	res := r.db.Model(&model.RecognitionJob{}).
+		Where("id = ? AND status = ?", id, model.JobQueued).
+		Updates(map[string]interface{}{"status": model.JobCanceled, "finished_at": &now})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repository) ListRecognitionJobs(userID uint, status string, limit, offset int) ([]model.RecognitionJob, error) {
+	var items []model.RecognitionJob
+	query := r.db.Model(&model.RecognitionJob{})
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id desc").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// JobStatusCount 各状态任务数
+type JobStatusCount struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+func (r *Repository) CountRecognitionJobsByStatus() ([]JobStatusCount, error) {
+	var rows []JobStatusCount
+	err := r.db.Model(&model.RecognitionJob{}).
+		Select("status, count(*) as count").
+		Group("status").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// CreateRecognitionBatch 在同一事务内创建批次与全部任务
+func (r *Repository) CreateRecognitionBatch(batch *model.RecognitionBatch, jobs []model.RecognitionJob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		for i := range jobs {
+			jobs[i].BatchID = &batch.ID
+		}
+		return tx.CreateInBatches(jobs, 100).Error
+	})
+}
+
+func (r *Repository) GetRecognitionBatch(id uint) (*model.RecognitionBatch, error) {
+	var batch model.RecognitionBatch
+	err := r.db.First(&batch, id).Error
+	return &batch, err
+}
+
+func (r *Repository) ListBatchJobs(batchID uint) ([]model.RecognitionJob, error) {
+	var items []model.RecognitionJob
+	err := r.db.Where("batch_id = ?", batchID).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) CountBatchJobs(batchID uint, statuses ...string) (int64, error) {
+	var count int64
+	query := r.db.Model(&model.RecognitionJob{}).Where("batch_id = ?", batchID)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// RequeueBatchJobs 将批次中失败或已取消的任务重新排队，每个任务绑定一条新的次数预占，最多重新排队 len(reservationIDs) 个
+func (r *Repository) RequeueBatchJobs(batchID uint, reservationIDs []uint) (int64, error) {
+	var requeued int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&model.RecognitionJob{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("batch_id = ? AND status IN ?", batchID, []string{model.JobFailed, model.JobCanceled}).
+			Order("id ASC").
+			Limit(len(reservationIDs)).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for i, id := range ids {
+			res := tx.Model(&model.RecognitionJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"status":         model.JobQueued,
+				"run_after":      now,
+				"attempts":       0,
+				"error_code":     "",
+				"error_message":  "",
+				"finished_at":    nil,
+				"reservation_id": reservationIDs[i],
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			requeued += res.RowsAffected
+		}
+		return tx.Model(&model.RecognitionBatch{}).Where("id = ?", batchID).Update("canceled_at", nil).Error
+	})
+	return requeued, err
+}
+
+// CancelBatchJobs 取消批次中尚未开始的任务，返回被取消的任务
+func (r *Repository) CancelBatchJobs(batchID uint) ([]model.RecognitionJob, error) {
+	now := time.Now()
+	var canceled []model.RecognitionJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&canceled).
+			Clauses(clause.Returning{}).
+			Where("batch_id = ? AND status = ?", batchID, model.JobQueued).
+			Updates(map[string]interface{}{"status": model.JobCanceled, "finished_at": &now})
+		if res.Error != nil {
+			return res.Error
+		}
+		return tx.Model(&model.RecognitionBatch{}).Where("id = ?", batchID).Update("canceled_at", &now).Error
+	})
+	return canceled, err
+}
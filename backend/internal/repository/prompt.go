@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func (r *Repository) ListPromptTemplates(name string, limit, offset int) ([]model.PromptTemplate, error) {
+	var items []model.PromptTemplate
+	query := r.db.Model(&model.PromptTemplate{})
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+	err := query.Order("name ASC, version DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) GetPromptTemplateByID(id uint) (*model.PromptTemplate, error) {
+	var item model.PromptTemplate
+	err := r.db.First(&item, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *Repository) GetPromptTemplateVersion(name string, version int) (*model.PromptTemplate, error) {
+	var item model.PromptTemplate
+	err := r.db.Where("name = ? AND version = ?", name, version).First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *Repository) GetActivePromptTemplate(name string) (*model.PromptTemplate, error) {
+	var item model.PromptTemplate
+	err := r.db.Where("name = ? AND active = ?", name, true).Order("version DESC").First(&item).Error
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CreatePromptTemplate 以当前最大版本号 +1 创建新版本，activate 时同时设为生效
+func (r *Repository) CreatePromptTemplate(item *model.PromptTemplate, activate bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var maxVersion int
+		if err := tx.Unscoped().Model(&model.PromptTemplate{}).
+			Where("name = ?", item.Name).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+		item.Version = maxVersion + 1
+		item.Active = false
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if !activate {
+			return nil
+		}
+		return activatePromptTemplate(tx, item)
+	})
+}
+
+// ActivatePromptTemplate 将指定版本设为生效，同名其它版本失效
+func (r *Repository) ActivatePromptTemplate(id uint) (*model.PromptTemplate, error) {
+	var item model.PromptTemplate
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, id).Error; err != nil {
+			return err
+		}
+		return activatePromptTemplate(tx, &item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func activatePromptTemplate(tx *gorm.DB, item *model.PromptTemplate) error {
+	if err := tx.Model(&model.PromptTemplate{}).
+		Where("name = ? AND id <> ?", item.Name, item.ID).
+		Update("active", false).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.PromptTemplate{}).
+		Where("id = ?", item.ID).
+		Update("active", true).Error; err != nil {
+		return err
+	}
+	item.Active = true
+	return nil
+}
@@ -8,14 +8,18 @@ import (
 )
 
 type QCResultRow struct {
-	ResultID   uint
-	ImageID    uint
-	ImageURL   string
-	CropType   string
-	Confidence float64
-	Provider   string
-	Source     string
-	CreatedAt  time.Time
+	ResultID        uint
+	ImageID         uint
+	ImageURL        string
+	CropType        string
+	Confidence      float64
+	Provider        string
+	Source          string
+	CreatedAt       time.Time
+	PromptVersion   int
+	Model           string
+	Mode            string
+	GrowthStageCode *string
 }
 
 func (r *Repository) CreateQCSamples(samples []model.QCSample) (int64, error) {
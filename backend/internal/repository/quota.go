@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrQuotaInsufficient    = errors.New("quota insufficient")
+	ErrAdCreditInsufficient = errors.New("ad credits insufficient")
+)
+
+// QuotaHolder 预占次数的主体：UserID 大于 0 时扣用户次数，否则扣设备次数；Limit 为 0 表示不限
+type QuotaHolder struct {
+	UserID   uint
+	DeviceID string
+	Limit    int
+	AdCredit bool
+}
+
+// ReserveQuota 在一个事务内扣减次数与广告额度并写入预占记录，次数不足返回 ErrQuotaInsufficient，广告额度不足返回 ErrAdCreditInsufficient
+func (r *Repository) ReserveQuota(holder QuotaHolder, items []model.QuotaReservation) error {
+	n := len(items)
+	if n == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var query *gorm.DB
+		if holder.UserID > 0 {
+			query = tx.Model(&model.User{}).Where("id = ?", holder.UserID)
+			if holder.Limit > 0 {
+				query = query.Where("quota_used + ? <= ?", n, holder.Limit)
+			}
+			query = query.Update("quota_used", gorm.Expr("quota_used + ?", n))
+		} else {
+			query = tx.Model(&model.DeviceUsage{}).Where("device_id = ?", holder.DeviceID)
+			if holder.Limit > 0 {
+				query = query.Where("recognize_count + ? <= ?", n, holder.Limit)
+			}
+			query = query.Update("recognize_count", gorm.Expr("recognize_count + ?", n))
+		}
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			return ErrQuotaInsufficient
+		}
+		if holder.AdCredit {
+			var res *gorm.DB
+			if holder.UserID > 0 {
+				res = tx.Model(&model.User{}).
+					Where("id = ? AND ad_credits >= ?", holder.UserID, n).
+					Update("ad_credits", gorm.Expr("ad_credits - ?", n))
+			} else {
+				res = tx.Model(&model.DeviceUsage{}).
+					Where("device_id = ? AND ad_credits >= ?", holder.DeviceID, n).
+					Update("ad_credits", gorm.Expr("ad_credits - ?", n))
+			}
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrAdCreditInsufficient
+			}
+		}
+		for i := range items {
+			items[i].UserID = holder.UserID
+			items[i].DeviceID = holder.DeviceID
+			items[i].AdCredit = holder.AdCredit
+			items[i].Status = model.QuotaReserved
+		}
+		return tx.CreateInBatches(items, 100).Error
+	})
+}
+
+// SettleQuotaReservation 确认或退回预占，仅对仍为 reserved 的记录生效，退回时在同一事务内归还次数与广告额度；返回是否结算成功
+func (r *Repository) SettleQuotaReservation(id uint, status, reason string, resultID *uint) (bool, error) {
+	settled := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var items []model.QuotaReservation
+		res := tx.Model(&items).
+			Clauses(clause.Returning{}).
+			Where("id = ? AND status = ?", id, model.QuotaReserved).
+			Updates(map[string]interface{}{
+				"status":     status,
+				"reason":     reason,
+				"result_id":  resultID,
+				"settled_at": &now,
+				"expires_at": nil,
+			})
+		if res.Error != nil || res.RowsAffected == 0 || len(items) == 0 {
+			return res.Error
+		}
+		settled = true
+		if status != model.QuotaReleased {
+			return nil
+		}
+		return refundQuota(tx, items[0].UserID, items[0].DeviceID, items[0].AdCredit)
+	})
+	return settled, err
+}
+
+// RefundQuota 归还一次识别次数，用于没有预占记录的旧任务
+func (r *Repository) RefundQuota(userID uint, deviceID string, adCredit bool) error {
+	return refundQuota(r.db, userID, deviceID, adCredit)
+}
+
+func refundQuota(tx *gorm.DB, userID uint, deviceID string, adCredit bool) error {
+	if userID > 0 {
+		if err := tx.Model(&model.User{}).
+			Where("id = ? AND quota_used > 0", userID).
+			Update("quota_used", gorm.Expr("quota_used - 1")).Error; err != nil {
+			return err
+		}
+		if adCredit {
+			return tx.Model(&model.User{}).Where("id = ?", userID).Update("ad_credits", gorm.Expr("ad_credits + 1")).Error
+		}
+		return nil
+	}
+	if err := tx.Model(&model.DeviceUsage{}).
+		Where("device_id = ? AND recognize_count > 0", deviceID).
+		Update("recognize_count", gorm.Expr("recognize_count - 1")).Error; err != nil {
+		return err
+	}
+	if adCredit {
+		return tx.Model(&model.DeviceUsage{}).Where("device_id = ?", deviceID).Update("ad_credits", gorm.Expr("ad_credits + 1")).Error
+	}
+	return nil
+}
+
+// KeepQuotaReservations 预占交给异步任务后不再按超时退回，由任务结算
+func (r *Repository) KeepQuotaReservations(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.QuotaReservation{}).
+		Where("id IN ? AND status = ?", ids, model.QuotaReserved).
+		Update("expires_at", nil).Error
+}
+
+// ListExpiredQuotaReservations 超时仍未结算的预占
+func (r *Repository) ListExpiredQuotaReservations(now time.Time, limit int) ([]model.QuotaReservation, error) {
+	var items []model.QuotaReservation
+	err := r.db.Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", model.QuotaReserved, now).
+		Order("id ASC").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// QuotaReservationFilter 预占记录查询条件
+type QuotaReservationFilter struct {
+	UserID   uint
+	DeviceID string
+	Status   string
+	Start    *time.Time
+	End      *time.Time
+}
+
+func (r *Repository) ListQuotaReservations(f QuotaReservationFilter, limit, offset int) ([]model.QuotaReservation, error) {
+	items := make([]model.QuotaReservation, 0)
+	query := r.db.Model(&model.QuotaReservation{})
+	if f.UserID > 0 {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+	if f.DeviceID != "" {
+		query = query.Where("device_id = ?", f.DeviceID)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.Start != nil {
+		query = query.Where("created_at >= ?", *f.Start)
+	}
+	if f.End != nil {
+		query = query.Where("created_at < ?", *f.End)
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
@@ -2,11 +2,13 @@ package repository
 
 import (
 	"agri-scan/internal/model"
+	"context"
 	"fmt"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -36,19 +38,41 @@ func NewRepository(dsn string) (*Repository, error) {
 		&model.DeviceUsage{},
 		&model.Image{},
 		&model.RecognitionResult{},
+		&model.RecognitionFinding{},
+		&model.RecognitionCandidate{},
+		&model.CalibrationMap{},
+		&model.EnsembleVote{},
+		&model.UsageRecord{},
+		&model.RecognitionJob{},
+		&model.RecognitionBatch{},
+		&model.BackfillRun{},
+		&model.ShadowResult{},
+		&model.Experiment{},
+		&model.ExperimentArm{},
+		&model.IdempotencyKey{},
+		&model.QuotaReservation{},
+		&model.WebhookSubscription{},
+		&model.WebhookDelivery{},
 		&model.RecognitionFailure{},
 		&model.UserFeedback{},
 		&model.FieldNote{},
 		&model.ExportTemplate{},
 		&model.Crop{},
+		&model.CropStage{},
+		&model.UnknownCrop{},
 		&model.Tag{},
 		&model.AppSetting{},
 		&model.PlanSetting{},
+		&model.PromptTemplate{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate: %w", err)
 	}
 
+	if err := migrateResultVersions(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate result versions: %w", err)
+	}
+
 	if err := seedDefaults(db); err != nil {
 		return nil, fmt.Errorf("failed to seed defaults: %w", err)
 	}
@@ -56,6 +80,54 @@ func NewRepository(dsn string) (*Repository, error) {
 	return &Repository{db: db}, nil
 }
 
+// migrateResultVersions 识别结果改为按版本保留：去掉 image_id 唯一索引，已有结果记为第 1 版并设为当前结果；
+// 数据库层保证同一图片的版本号唯一、未删除的当前结果最多一条
+func migrateResultVersions(db *gorm.DB) error {
+	if err := db.Exec("DROP INDEX IF EXISTS idx_recognition_results_image_id").Error; err != nil {
+		return err
+	}
+	if err := db.Unscoped().Model(&model.RecognitionResult{}).
+		Where("version = 0").
+		Updates(map[string]interface{}{"version": 1, "is_current": true}).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 早期的 (image_id, version) 索引不是唯一索引，先修正并发写入留下的重复版本号再重建
+		var nonUnique int64
+		if err := tx.Raw("SELECT count(*) FROM pg_index WHERE indexrelid = to_regclass('idx_result_image_version') AND NOT indisunique").
+			Scan(&nonUnique).Error; err != nil {
+			return err
+		}
+		if nonUnique > 0 {
+			if err := tx.Exec(`UPDATE recognition_results r SET version = v.rn
+				FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY image_id ORDER BY version, id) AS rn
+					FROM recognition_results
+					WHERE image_id IN (SELECT image_id FROM recognition_results GROUP BY image_id, version HAVING count(*) > 1)
+				) v
+				WHERE r.id = v.id AND r.version <> v.rn`).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DROP INDEX idx_result_image_version").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE UNIQUE INDEX idx_result_image_version ON recognition_results (image_id, version)").Error; err != nil {
+				return err
+			}
+		}
+		// 每张图片最多一条当前结果，多余的保留最新版本
+		if err := tx.Exec(`UPDATE recognition_results SET is_current = false
+			WHERE is_current AND deleted_at IS NULL AND id NOT IN (
+				SELECT DISTINCT ON (image_id) id FROM recognition_results
+				WHERE is_current AND deleted_at IS NULL
+				ORDER BY image_id, version DESC, id DESC
+			)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_result_current_image ON recognition_results (image_id) WHERE is_current AND deleted_at IS NULL").Error
+	})
+}
+
 func (r *Repository) GetCrops(activeOnly bool) ([]model.Crop, error) {
 	var items []model.Crop
 	query := r.db
@@ -95,6 +167,18 @@ func (r *Repository) DeleteExportTemplate(id uint, userID uint) error {
 	return r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.ExportTemplate{}).Error
 }
 
+// WithContext 返回绑定请求 context 的仓储，请求取消后数据库查询随之中止
+func (r *Repository) WithContext(ctx context.Context) *Repository {
+	return &Repository{db: r.db.WithContext(ctx)}
+}
+
+// Transaction 在同一事务中执行 fn，fn 收到的 Repository 绑定该事务
+func (r *Repository) Transaction(fn func(tx *Repository) error) error {
+	return r.db.Transaction(func(db *gorm.DB) error {
+		return fn(&Repository{db: db})
+	})
+}
+
 func (r *Repository) DB() *gorm.DB {
 	return r.db
 }
@@ -120,34 +204,75 @@ func (r *Repository) GetImagesByIDs(ids []uint) ([]model.Image, error) {
 }
 
 // FieldNote 操作（按识别结果）
-func (r *Repository) GetNoteByResultID(userID uint, resultID uint) (*model.FieldNote, error) {
+func (r *Repository) GetUserNoteByResultID(userID uint, resultID uint) (*model.FieldNote, error) {
 	var note model.FieldNote
 	err := r.db.Where("user_id = ? AND result_id = ?", userID, resultID).First(&note).Error
 	return &note, err
 }
 
 // RecognitionResult 操作
-func (r *Repository) CreateResult(result *model.RecognitionResult) error {
-	return r.db.Create(result).Error
+// CreateResultVersion 以新版本保存识别结果，makeCurrent 时设为当前结果，旧版本保留；锁定图片行使并发识别的版本号依次递增
+func (r *Repository) CreateResultVersion(result *model.RecognitionResult, makeCurrent bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var img model.Image
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&img, result.ImageID).Error; err != nil {
+			return err
+		}
+		var maxVersion int
+		if err := tx.Unscoped().Model(&model.RecognitionResult{}).
+			Where("image_id = ?", result.ImageID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+		result.Version = maxVersion + 1
+		result.IsCurrent = makeCurrent
+		if !makeCurrent {
+			return tx.Create(result).Error
+		}
+		if err := tx.Model(&model.RecognitionResult{}).
+			Where("image_id = ? AND is_current = ?", result.ImageID, true).
+			Update("is_current", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(result).Error
+	})
 }
 
+// GetResultByImageID 图片当前采用的识别结果
 func (r *Repository) GetResultByImageID(imageID uint) (*model.RecognitionResult, error) {
 	var result model.RecognitionResult
-	err := r.db.Where("image_id = ?", imageID).First(&result).Error
+	err := r.db.Where("image_id = ? AND is_current = ?", imageID, true).First(&result).Error
 	return &result, err
 }
 
+// ListResultVersions 图片的全部识别结果，新版本在前
+func (r *Repository) ListResultVersions(imageID uint) ([]model.RecognitionResult, error) {
+	var items []model.RecognitionResult
+	err := r.db.Where("image_id = ?", imageID).Order("version DESC").Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) GetResultsByIDs(ids []uint) ([]model.RecognitionResult, error) {
+	if len(ids) == 0 {
+		return []model.RecognitionResult{}, nil
+	}
+	var items []model.RecognitionResult
+	err := r.db.Where("id IN ?", ids).Find(&items).Error
+	return items, err
+}
+
 func (r *Repository) GetResultByID(id uint) (*model.RecognitionResult, error) {
 	var result model.RecognitionResult
 	err := r.db.First(&result, id).Error
 	return &result, err
 }
 
-func (r *Repository) GetResultsByUserID(userID uint, limit, offset int, startDate, endDate *time.Time, cropType string, minConf, maxConf *float64, minLat, maxLat, minLng, maxLng *float64, source string) ([]model.RecognitionResult, error) {
+func (r *Repository) GetResultsByUserID(userID uint, limit, offset int, startDate, endDate *time.Time, cropType string, minConf, maxConf *float64, minLat, maxLat, minLng, maxLng *float64, source string, filter ResultFilter) ([]model.RecognitionResult, error) {
 	var results []model.RecognitionResult
 	query := r.db.
 		Joins("JOIN images ON images.id = recognition_results.image_id").
-		Where("images.user_id = ?", userID)
+		Where("images.user_id = ? AND recognition_results.is_current = ?", userID, true)
 	if startDate != nil {
 		query = query.Where("recognition_results.created_at >= ?", *startDate)
 	}
@@ -178,6 +303,7 @@ func (r *Repository) GetResultsByUserID(userID uint, limit, offset int, startDat
 	if source != "" {
 		query = query.Where("recognition_results.source = ?", source)
 	}
+	query = ApplyResultFilter(query, filter)
 	err := query.
 		Order("recognition_results.created_at DESC").
 		Limit(limit).
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newTestRepository 连接 TEST_DATABASE_DSN（key=value 形式）指定的 Postgres，在独立 schema 中迁移；未设置时跳过
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("test_repo_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	repo, err := NewRepository(dsn + " search_path=" + schema)
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := repo.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return repo
+}
+
+func createTestImage(t *testing.T, r *Repository) *model.Image {
+	t.Helper()
+	img := &model.Image{UserID: 1, OriginalURL: "https://img.example.com/a.jpg"}
+	if err := r.CreateImage(img); err != nil {
+		t.Fatalf("create image: %v", err)
+	}
+	return img
+}
+
+func resultVersions(t *testing.T, r *Repository, imageID uint) []model.RecognitionResult {
+	t.Helper()
+	var items []model.RecognitionResult
+	if err := r.db.Unscoped().Where("image_id = ?", imageID).Order("id ASC").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestCreateResultVersion(t *testing.T) {
+	r := newTestRepository(t)
+	img := createTestImage(t, r)
+	for _, current := range []bool{true, false, true} {
+		if err := r.CreateResultVersion(&model.RecognitionResult{ImageID: img.ID, CropType: "wheat"}, current); err != nil {
+			t.Fatalf("CreateResultVersion: %v", err)
+		}
+	}
+	items := resultVersions(t, r, img.ID)
+	if len(items) != 3 {
+		t.Fatalf("got %d results", len(items))
+	}
+	for i, item := range items {
+		if item.Version != i+1 {
+			t.Errorf("result %d version = %d, want %d", item.ID, item.Version, i+1)
+		}
+		if item.IsCurrent != (i == 2) {
+			t.Errorf("result %d is_current = %v", item.ID, item.IsCurrent)
+		}
+	}
+	current, err := r.GetResultByImageID(img.ID)
+	if err != nil || current.Version != 3 {
+		t.Errorf("current = %+v, err %v", current, err)
+	}
+}
+
+func TestResultVersionConstraints(t *testing.T) {
+	r := newTestRepository(t)
+	img := createTestImage(t, r)
+	first := &model.RecognitionResult{ImageID: img.ID, Version: 1, IsCurrent: true}
+	if err := r.db.Create(first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.db.Create(&model.RecognitionResult{ImageID: img.ID, Version: 1}).Error; err == nil {
+		t.Error("duplicate (image_id, version) was accepted")
+	}
+	if err := r.db.Create(&model.RecognitionResult{ImageID: img.ID, Version: 2, IsCurrent: true}).Error; err == nil {
+		t.Error("second current result was accepted")
+	}
+	// 已删除的当前结果不占用名额
+	if err := r.db.Delete(first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.db.Create(&model.RecognitionResult{ImageID: img.ID, Version: 2, IsCurrent: true}).Error; err != nil {
+		t.Errorf("current result after soft delete: %v", err)
+	}
+}
+
+func TestMigrateResultVersionsRepairsLegacyData(t *testing.T) {
+	r := newTestRepository(t)
+	for _, stmt := range []string{
+		"DROP INDEX idx_result_current_image",
+		"DROP INDEX idx_result_image_version",
+		"CREATE INDEX idx_result_image_version ON recognition_results (image_id, version)",
+	} {
+		if err := r.db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	img := createTestImage(t, r)
+	for _, item := range []model.RecognitionResult{
+		{ImageID: img.ID, Version: 1, IsCurrent: true},
+		{ImageID: img.ID, Version: 1, IsCurrent: true},
+		{ImageID: img.ID, Version: 2},
+	} {
+		if err := r.db.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateResultVersions(r.db); err != nil {
+		t.Fatalf("migrateResultVersions: %v", err)
+	}
+
+	items := resultVersions(t, r, img.ID)
+	wantVersions := []int{1, 2, 3}
+	wantCurrent := []bool{false, true, false}
+	for i, item := range items {
+		if item.Version != wantVersions[i] || item.IsCurrent != wantCurrent[i] {
+			t.Errorf("result %d = version %d current %v, want %d %v", i, item.Version, item.IsCurrent, wantVersions[i], wantCurrent[i])
+		}
+	}
+	for _, name := range []string{"idx_result_image_version", "idx_result_current_image"} {
+		var unique int64
+		if err := r.db.Raw("SELECT count(*) FROM pg_index WHERE indexrelid = to_regclass(?) AND indisunique", name).Scan(&unique).Error; err != nil {
+			t.Fatal(err)
+		}
+		if unique != 1 {
+			t.Errorf("%s is not a unique index", name)
+		}
+	}
+	// 再次执行不做任何修改
+	if err := migrateResultVersions(r.db); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+}
@@ -12,9 +12,49 @@ func seedDefaults(db *gorm.DB) error {
 	if err := seedTags(db); err != nil {
 		return err
 	}
+	if err := seedCropStages(db); err != nil {
+		return err
+	}
+	if err := seedPromptTemplates(db); err != nil {
+		return err
+	}
 	return nil
 }
 
+const promptJSONSpec = `candidates 按置信度降序列出最多 3 个候选作物，第一个与 crop_type 一致。生育期使用 BBCH 两位代码，只能从以下按作物划分的生育期表中选择：{{stage_list_json}}。
+仅返回JSON：{"crop_type":"作物类型英文名","confidence":0.0-1.0,"description":"简短描述","growth_stage":"生育期名称，无法判断填null","growth_stage_code":"BBCH 两位代码，无法判断填null","possible_issue":"可能的病虫草害，没有填null","candidates":[{"crop_type":"候选作物英文名","confidence":0.0-1.0}],"findings":[{"category":"disease|pest|weed","name":"词表中的名称","confidence":0.0-1.0}]}`
+
+// DefaultPromptTemplates 各识别模式的初始提示词模板
+var DefaultPromptTemplates = map[string]string{
+	"crop": `请识别图片中的作物植物，使用 {{locale}} 语言撰写 description。优先从以下作物清单中选择：{{crop_list_json}}。findings 返回空数组。
+` + promptJSONSpec,
+	"disease": `请识别图片中作物的病害，使用 {{locale}} 语言撰写 description。作物参考：{{crop_list_json}}。findings 只能使用以下病害名称：{{tag_list_json}}，category 填 disease，未发现病害时返回空数组。
+` + promptJSONSpec,
+	"pest": `请识别图片中作物的虫害，使用 {{locale}} 语言撰写 description。作物参考：{{crop_list_json}}。findings 只能使用以下害虫名称：{{tag_list_json}}，category 填 pest，未发现虫害时返回空数组。
+` + promptJSONSpec,
+	"weed": `请识别图片中的杂草，使用 {{locale}} 语言撰写 description。作物参考：{{crop_list_json}}。findings 只能使用以下杂草名称：{{tag_list_json}}，category 填 weed，未发现杂草时返回空数组。
+` + promptJSONSpec,
+	"full": `请识别图片中的作物，并检查病害、虫害与杂草，使用 {{locale}} 语言撰写 description。作物参考：{{crop_list_json}}。findings 的名称只能取自以下按类别划分的词表：{{tag_list_json}}，未发现问题时返回空数组。
+` + promptJSONSpec,
+}
+
+// seedPromptTemplates 为缺少模板的识别模式写入初始版本
+func seedPromptTemplates(db *gorm.DB) error {
+	for name, content := range DefaultPromptTemplates {
+		var count int64
+		if err := db.Unscoped().Model(&model.PromptTemplate{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		item := model.PromptTemplate{Name: name, Version: 1, Content: content, Note: "初始版本", Active: true}
+		if err := db.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
 func seedCrops(db *gorm.DB) error {
 	var count int64
 	if err := db.Model(&model.Crop{}).Count(&count).Error; err != nil {
@@ -24,11 +64,11 @@ func seedCrops(db *gorm.DB) error {
 		return nil
 	}
 	items := []model.Crop{
-		{Code: "corn", Name: "玉米", Aliases: "玉米", Active: true},
-		{Code: "wheat", Name: "小麦", Aliases: "小麦", Active: true},
-		{Code: "rice", Name: "水稻", Aliases: "稻", Active: true},
-		{Code: "soybean", Name: "大豆", Aliases: "黄豆", Active: true},
-		{Code: "tomato", Name: "番茄", Aliases: "西红柿", Active: true},
+		{Code: "corn", Name: "玉米", Aliases: "玉米,苞米,玉蜀黍,yumi,maize,zea mays", Active: true},
+		{Code: "wheat", Name: "小麦", Aliases: "小麦,麦子,xiaomai,common wheat,bread wheat,triticum aestivum", Active: true},
+		{Code: "rice", Name: "水稻", Aliases: "稻,稻谷,大米,shuidao,paddy,oryza sativa", Active: true},
+		{Code: "soybean", Name: "大豆", Aliases: "黄豆,dadou,soya,soy,glycine max", Active: true},
+		{Code: "tomato", Name: "番茄", Aliases: "西红柿,fanqie,xihongshi,solanum lycopersicum", Active: true},
 	}
 	return db.Create(&items).Error
 }
@@ -63,3 +103,49 @@ func seedTags(db *gorm.DB) error {
 	}
 	return db.Create(&items).Error
 }
+
+// seedCropStages 第一批作物的 BBCH 主要生育期
+func seedCropStages(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&model.CropStage{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	table := map[string][][2]string{
+		"wheat": {
+			{"00", "种子萌动"}, {"10", "出苗期"}, {"13", "三叶期"}, {"21", "分蘖始期"}, {"25", "分蘖盛期"},
+			{"30", "起身期"}, {"31", "拔节期"}, {"37", "旗叶露尖"}, {"39", "旗叶展开"}, {"45", "孕穗期"},
+			{"51", "抽穗始期"}, {"59", "抽穗期"}, {"61", "开花始期"}, {"65", "开花盛期"}, {"71", "灌浆期"},
+			{"75", "乳熟期"}, {"85", "蜡熟期"}, {"89", "完熟期"},
+		},
+		"rice": {
+			{"00", "种子萌动"}, {"10", "出苗期"}, {"13", "三叶期"}, {"21", "分蘖始期"}, {"25", "分蘖盛期"},
+			{"30", "拔节期"}, {"37", "剑叶露尖"}, {"45", "孕穗期"}, {"51", "抽穗始期"}, {"59", "齐穗期"},
+			{"65", "扬花期"}, {"71", "灌浆期"}, {"75", "乳熟期"}, {"85", "蜡熟期"}, {"89", "完熟期"},
+		},
+		"corn": {
+			{"00", "种子萌动"}, {"09", "出苗期"}, {"13", "三叶期"}, {"16", "六叶期"}, {"19", "九叶及以上"},
+			{"30", "拔节期"}, {"39", "大喇叭口期"}, {"51", "抽雄始期"}, {"59", "抽雄期"}, {"63", "散粉期"},
+			{"65", "吐丝期"}, {"71", "籽粒形成期"}, {"75", "乳熟期"}, {"85", "蜡熟期"}, {"89", "完熟期"},
+		},
+		"soybean": {
+			{"00", "种子萌动"}, {"09", "出苗期"}, {"10", "子叶期"}, {"12", "第一复叶期"}, {"19", "多复叶期"},
+			{"51", "现蕾期"}, {"60", "初花期"}, {"65", "盛花期"}, {"70", "结荚期"}, {"79", "鼓粒期"},
+			{"81", "初熟期"}, {"89", "完熟期"},
+		},
+		"tomato": {
+			{"00", "种子萌动"}, {"09", "出苗期"}, {"10", "子叶展开"}, {"13", "三叶期"}, {"19", "九叶及以上"},
+			{"51", "第一花序现蕾"}, {"61", "第一花序开花"}, {"65", "盛花期"}, {"71", "坐果期"}, {"79", "果实膨大期"},
+			{"81", "转色期"}, {"89", "完熟期"},
+		},
+	}
+	items := make([]model.CropStage, 0, 80)
+	for crop, stages := range table {
+		for _, st := range stages {
+			items = append(items, model.CropStage{CropCode: crop, Code: st[0], Label: st[1], Active: true})
+		}
+	}
+	return db.Create(&items).Error
+}
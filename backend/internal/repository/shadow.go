@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+)
+
+func (r *Repository) CreateShadowResult(item *model.ShadowResult) error {
+	return r.db.Create(item).Error
+}
+
+// SumResultCost 生产结果已归属的用量费用
+func (r *Repository) SumResultCost(resultID uint) (float64, error) {
+	var cost float64
+	err := r.db.Model(&model.UsageRecord{}).
+		Select("coalesce(sum(cost), 0)").
+		Where("result_id = ?", resultID).
+		Scan(&cost).Error
+	return cost, err
+}
+
+// ShadowRow 影子作答及生产结果最近一次的用户反馈
+type ShadowRow struct {
+	model.ShadowResult
+	FeedbackCorrect       *bool   `json:"feedback_correct"`
+	FeedbackCorrectedType *string `json:"feedback_corrected_type"`
+}
+
+// ListShadowRows 按时间、候选提供商筛选影子作答，agreed 不为空时只返回一致或不一致的记录
+func (r *Repository) ListShadowRows(start, end *time.Time, provider string, agreed *bool, limit, offset int) ([]ShadowRow, error) {
+	rows := make([]ShadowRow, 0)
+	query := r.db.Model(&model.ShadowResult{}).
+		Select("shadow_results.*, fb.is_correct as feedback_correct, fb.corrected_type as feedback_corrected_type").
+		Joins("LEFT JOIN LATERAL (SELECT is_correct, corrected_type FROM user_feedbacks WHERE user_feedbacks.result_id = shadow_results.result_id AND user_feedbacks.deleted_at IS NULL ORDER BY id DESC LIMIT 1) fb ON true")
+	if start != nil {
+		query = query.Where("shadow_results.created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("shadow_results.created_at < ?", *end)
+	}
+	if provider != "" {
+		query = query.Where("shadow_results.provider = ?", provider)
+	}
+	if agreed != nil {
+		query = query.Where("shadow_results.agreed = ? AND shadow_results.error_code = ''", *agreed)
+	}
+	err := query.Order("shadow_results.id DESC").Limit(limit).Offset(offset).Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+)
+
+func (r *Repository) CreateUsageRecords(items []model.UsageRecord) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return r.db.Create(&items).Error
+}
+
+// AttachUsageToResult 结果落库后回填该图片尚未关联结果的用量记录
+func (r *Repository) AttachUsageToResult(imageID, resultID uint, cropType string) error {
+	return r.db.Model(&model.UsageRecord{}).
+		Where("image_id = ? AND result_id IS NULL", imageID).
+		Updates(map[string]interface{}{"result_id": resultID, "crop_type": cropType}).Error
+}
+
+// UsageSummaryRow 用量汇总
+type UsageSummaryRow struct {
+	Name             string  `json:"name"`
+	Attempts         int64   `json:"attempts"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	FailedCost       float64 `json:"failed_cost"`
+}
+
+// SummarizeUsage 按 groupExpr 分组汇总用量，groupExpr 由调用方给出固定的列或表达式
+func (r *Repository) SummarizeUsage(groupExpr string, start, end *time.Time) ([]UsageSummaryRow, error) {
+	var rows []UsageSummaryRow
+	query := r.db.Model(&model.UsageRecord{}).
+		Select(groupExpr + " as name, count(*) as attempts, coalesce(sum(calls), 0) as calls, coalesce(sum(prompt_tokens), 0) as prompt_tokens, coalesce(sum(completion_tokens), 0) as completion_tokens, coalesce(sum(cost), 0) as cost, coalesce(sum(CASE WHEN success THEN 0 ELSE cost END), 0) as failed_cost")
+	if start != nil {
+		query = query.Where("created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("created_at < ?", *end)
+	}
+	err := query.Group("name").Order("name ASC").Scan(&rows).Error
+	return rows, err
+}
+
+// UsageDailyRow 按天、用户、提供商/模型汇总的用量，用于对账导出
+type UsageDailyRow struct {
+	Day              string  `json:"day"`
+	UserID           uint    `json:"user_id"`
+	Plan             string  `json:"plan"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	Attempts         int64   `json:"attempts"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	FailedCost       float64 `json:"failed_cost"`
+}
+
+func (r *Repository) ListUsageDaily(userID uint, start, end *time.Time) ([]UsageDailyRow, error) {
+	var rows []UsageDailyRow
+	query := r.db.Model(&model.UsageRecord{}).
+		Select("to_char(created_at, 'YYYY-MM-DD') as day, user_id, plan, provider, model, count(*) as attempts, coalesce(sum(calls), 0) as calls, coalesce(sum(prompt_tokens), 0) as prompt_tokens, coalesce(sum(completion_tokens), 0) as completion_tokens, coalesce(sum(cost), 0) as cost, coalesce(sum(CASE WHEN success THEN 0 ELSE cost END), 0) as failed_cost")
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if start != nil {
+		query = query.Where("created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("created_at < ?", *end)
+	}
+	err := query.Group("day, user_id, plan, provider, model").
+		Order("day ASC, user_id ASC, provider ASC, model ASC").
+		Scan(&rows).Error
+	return rows, err
+}
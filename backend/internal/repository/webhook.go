@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"agri-scan/internal/model"
+	"time"
+)
+
+func (r *Repository) CreateWebhookSubscription(item *model.WebhookSubscription) error {
+	return r.db.Create(item).Error
+}
+
+func (r *Repository) GetWebhookSubscription(id uint) (*model.WebhookSubscription, error) {
+	var item model.WebhookSubscription
+	err := r.db.First(&item, id).Error
+	return &item, err
+}
+
+func (r *Repository) ListWebhookSubscriptions(limit, offset int) ([]model.WebhookSubscription, error) {
+	items := make([]model.WebhookSubscription, 0)
+	err := r.db.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// ListEnabledWebhookSubscriptions 启用中的订阅，由调用方按事件类型筛选
+func (r *Repository) ListEnabledWebhookSubscriptions() ([]model.WebhookSubscription, error) {
+	var items []model.WebhookSubscription
+	err := r.db.Where("enabled = ?", true).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+func (r *Repository) UpdateWebhookSubscription(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&model.WebhookSubscription{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// DeleteWebhookSubscription 删除订阅，已有投递记录保留，未投递的在投递时进入死信
+func (r *Repository) DeleteWebhookSubscription(id uint) error {
+	return r.db.Delete(&model.WebhookSubscription{}, id).Error
+}
+
+func (r *Repository) CreateWebhookDeliveries(items []model.WebhookDelivery) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(items, 100).Error
+}
+
+// ClaimWebhookDelivery 领取一条到期待投递或锁已过期的投递中记录，没有可领取的记录时返回 nil
+func (r *Repository) ClaimWebhookDelivery(token string, lockFor time.Duration) (*model.WebhookDelivery, error) {
+	now := time.Now()
+	var items []model.WebhookDelivery
+	err := r.db.Raw(`UPDATE webhook_deliveries SET status = ?, lock_token = ?, locked_until = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM webhook_deliveries
+			WHERE (status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		model.WebhookDelivering, token, now.Add(lockFor), now,
+		model.WebhookPending, now, model.WebhookDelivering, now,
+	).Scan(&items).Error
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// FinishWebhookDelivery 在仍持有锁时更新投递结果，锁已被其他执行者接管时返回 false
+func (r *Repository) FinishWebhookDelivery(id uint, token string, updates map[string]interface{}) (bool, error) {
+	updates["lock_token"] = ""
+	updates["locked_until"] = nil
+	res := r.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND lock_token = ?", id, model.WebhookDelivering, token).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repository) GetWebhookDelivery(id uint) (*model.WebhookDelivery, error) {
+	var item model.WebhookDelivery
+	err := r.db.First(&item, id).Error
+	return &item, err
+}
+
+// WebhookDeliveryFilter 投递记录查询条件
+type WebhookDeliveryFilter struct {
+	SubscriptionID uint
+	Status         string
+	EventType      string
+	EventID        string
+}
+
+func (r *Repository) ListWebhookDeliveries(f WebhookDeliveryFilter, limit, offset int) ([]model.WebhookDelivery, error) {
+	items := make([]model.WebhookDelivery, 0)
+	query := r.db.Model(&model.WebhookDelivery{})
+	if f.SubscriptionID > 0 {
+		query = query.Where("subscription_id = ?", f.SubscriptionID)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.EventType != "" {
+		query = query.Where("event_type = ?", f.EventType)
+	}
+	if f.EventID != "" {
+		query = query.Where("event_id = ?", f.EventID)
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error
+	return items, err
+}
+
+// ReplayWebhookDelivery 将已结束（成功或死信）的投递重新排队，重试次数重新计算
+func (r *Repository) ReplayWebhookDelivery(id uint, maxAttempts int) (bool, error) {
+	res := r.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status IN ?", id, []string{model.WebhookDead, model.WebhookSucceeded}).
+		Updates(map[string]interface{}{
+			"status":          model.WebhookPending,
+			"attempts":        0,
+			"max_attempts":    maxAttempts,
+			"next_attempt_at": time.Now(),
+			"last_error":      "",
+		})
+	return res.RowsAffected > 0, res.Error
+}
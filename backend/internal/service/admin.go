@@ -37,19 +37,29 @@ type AdminStats struct {
 }
 
 type AdminMetrics struct {
-	ResultsByDay           []DayCount   `json:"results_by_day"`
-	UsersByPlan            []NamedCount `json:"users_by_plan"`
-	UsersByStatus          []NamedCount `json:"users_by_status"`
-	ResultsByProvider      []NamedCount `json:"results_by_provider"`
-	ResultsByCrop          []NamedCount `json:"results_by_crop"`
-	ResultsBySource        []NamedCount `json:"results_by_source"`
-	AvgDurationMs          float64      `json:"avg_duration_ms"`
-	FeedbackTotal          int64        `json:"feedback_total"`
-	FeedbackCorrect        int64        `json:"feedback_correct"`
-	FeedbackAccuracy       float64      `json:"feedback_accuracy"`
-	LowConfidenceTotal     int64        `json:"low_confidence_total"`
-	LowConfidenceRatio     float64      `json:"low_confidence_ratio"`
-	LowConfidenceThreshold float64      `json:"low_confidence_threshold"`
+	ResultsByDay           []DayCount        `json:"results_by_day"`
+	UsersByPlan            []NamedCount      `json:"users_by_plan"`
+	UsersByStatus          []NamedCount      `json:"users_by_status"`
+	ResultsByProvider      []NamedCount      `json:"results_by_provider"`
+	ResultsByCrop          []NamedCount      `json:"results_by_crop"`
+	ResultsBySource        []NamedCount      `json:"results_by_source"`
+	AvgDurationMs          float64           `json:"avg_duration_ms"`
+	FeedbackTotal          int64             `json:"feedback_total"`
+	FeedbackCorrect        int64             `json:"feedback_correct"`
+	FeedbackAccuracy       float64           `json:"feedback_accuracy"`
+	LowConfidenceTotal     int64             `json:"low_confidence_total"`
+	LowConfidenceRatio     float64           `json:"low_confidence_ratio"`
+	LowConfidenceThreshold float64           `json:"low_confidence_threshold"`
+	CacheHits              int64             `json:"cache_hits"`
+	CacheHitRate           float64           `json:"cache_hit_rate"`
+	UsagePromptTokens      int64             `json:"usage_prompt_tokens"`
+	UsageCompletionTokens  int64             `json:"usage_completion_tokens"`
+	UsageCost              float64           `json:"usage_cost"`
+	UsageFailedCost        float64           `json:"usage_failed_cost"` // 失败尝试产生的费用
+	CostByProvider         []UsageSummary    `json:"cost_by_provider"`
+	CostByPlan             []UsageSummary    `json:"cost_by_plan"`
+	CostByCrop             []UsageSummary    `json:"cost_by_crop"`
+	Experiment             *ExperimentReport `json:"experiment"` // 运行中的实验在统计区间内的分组对比，无实验时为空
 }
 
 type DayCount struct {
@@ -63,11 +73,24 @@ type NamedCount struct {
 }
 
 type EvalSummary struct {
-	Total      int64           `json:"total"`
-	Correct    int64           `json:"correct"`
-	Accuracy   float64         `json:"accuracy"`
-	ByCrop     []EvalCropStat  `json:"by_crop"`
-	Confusions []EvalConfusion `json:"confusions"`
+	Total        int64            `json:"total"`
+	Correct      int64            `json:"correct"`
+	Accuracy     float64          `json:"accuracy"`
+	Top1Accuracy float64          `json:"top1_accuracy"`
+	Top3Correct  int64            `json:"top3_correct"`
+	Top3Accuracy float64          `json:"top3_accuracy"`
+	ByCrop       []EvalCropStat   `json:"by_crop"`
+	Confusions   []EvalConfusion  `json:"confusions"`
+	ByPrompt     []EvalPromptStat `json:"by_prompt"`
+}
+
+// EvalPromptStat 按提示词版本与模型拆分的准确率
+type EvalPromptStat struct {
+	PromptVersion int     `json:"prompt_version"`
+	Model         string  `json:"model"`
+	Total         int64   `json:"total"`
+	Correct       int64   `json:"correct"`
+	Accuracy      float64 `json:"accuracy"`
 }
 
 type EvalCropStat struct {
@@ -100,14 +123,17 @@ type EvalDatasetRow struct {
 }
 
 type EvalRunView struct {
-	ID         uint            `json:"id"`
-	CreatedAt  string          `json:"created_at"`
-	Days       int             `json:"days"`
-	Total      int64           `json:"total"`
-	Correct    int64           `json:"correct"`
-	Accuracy   float64         `json:"accuracy"`
-	ByCrop     []EvalCropStat  `json:"by_crop"`
-	Confusions []EvalConfusion `json:"confusions"`
+	ID           uint            `json:"id"`
+	CreatedAt    string          `json:"created_at"`
+	Days         int             `json:"days"`
+	Total        int64           `json:"total"`
+	Correct      int64           `json:"correct"`
+	Accuracy     float64         `json:"accuracy"`
+	Top1Accuracy float64         `json:"top1_accuracy"`
+	Top3Correct  int64           `json:"top3_correct"`
+	Top3Accuracy float64         `json:"top3_accuracy"`
+	ByCrop       []EvalCropStat  `json:"by_crop"`
+	Confusions   []EvalConfusion `json:"confusions"`
 }
 
 type EvalSetView struct {
@@ -120,15 +146,19 @@ type EvalSetView struct {
 }
 
 type EvalSetRunView struct {
-	ID         uint            `json:"id"`
-	CreatedAt  string          `json:"created_at"`
-	Total      int64           `json:"total"`
-	Correct    int64           `json:"correct"`
-	Accuracy   float64         `json:"accuracy"`
-	ByCrop     []EvalCropStat  `json:"by_crop"`
-	Confusions []EvalConfusion `json:"confusions"`
-	BaselineID *uint           `json:"baseline_id"`
-	DeltaAcc   float64         `json:"delta_acc"`
+	ID           uint            `json:"id"`
+	CreatedAt    string          `json:"created_at"`
+	Total        int64           `json:"total"`
+	Correct      int64           `json:"correct"`
+	Accuracy     float64         `json:"accuracy"`
+	Top1Accuracy float64         `json:"top1_accuracy"`
+	Top3Correct  int64           `json:"top3_correct"`
+	Top3Accuracy float64         `json:"top3_accuracy"`
+	ByCrop       []EvalCropStat  `json:"by_crop"`
+	Confusions   []EvalConfusion `json:"confusions"`
+	BaselineID   *uint           `json:"baseline_id"`
+	DeltaAcc     float64         `json:"delta_acc"`
+	BackfillID   *uint           `json:"backfill_id,omitempty"`
 }
 
 type QCSampleView struct {
@@ -159,14 +189,18 @@ type QCReviewUpdate struct {
 }
 
 type RecognizeResultView struct {
-	ResultID   uint    `json:"result_id"`
-	ImageID    uint    `json:"image_id"`
-	ImageURL   string  `json:"image_url"`
-	CropType   string  `json:"crop_type"`
-	Confidence float64 `json:"confidence"`
-	Provider   string  `json:"provider"`
-	Source     string  `json:"source"`
-	CreatedAt  string  `json:"created_at"`
+	ResultID        uint    `json:"result_id"`
+	ImageID         uint    `json:"image_id"`
+	ImageURL        string  `json:"image_url"`
+	CropType        string  `json:"crop_type"`
+	Confidence      float64 `json:"confidence"`
+	Provider        string  `json:"provider"`
+	Source          string  `json:"source"`
+	CreatedAt       string  `json:"created_at"`
+	PromptVersion   int     `json:"prompt_version,omitempty"`
+	Model           string  `json:"model,omitempty"`
+	Mode            string  `json:"mode,omitempty"`
+	GrowthStageCode *string `json:"growth_stage_code,omitempty"`
 }
 
 func (s *Service) GetAdminStats() (AdminStats, error) {
@@ -234,7 +268,7 @@ func (s *Service) GetAdminMetrics(days int) (AdminMetrics, error) {
 		days = 30
 	}
 	since := time.Now().AddDate(0, 0, -days+1)
-	lowConfidenceThreshold := 0.5
+	lowConfidenceThreshold := defaultLowConfidence
 	db := s.repo.DB()
 	metrics := AdminMetrics{}
 
@@ -328,8 +362,39 @@ func (s *Service) GetAdminMetrics(days int) (AdminMetrics, error) {
 		return metrics, err
 	}
 	metrics.LowConfidenceThreshold = lowConfidenceThreshold
+	if err := db.Model(&model.RecognitionResult{}).
+		Where("created_at >= ? AND cache_hit = ?", since, true).
+		Count(&metrics.CacheHits).Error; err != nil {
+		return metrics, err
+	}
 	if resultsTotal > 0 {
 		metrics.LowConfidenceRatio = float64(metrics.LowConfidenceTotal) / float64(resultsTotal)
+		metrics.CacheHitRate = float64(metrics.CacheHits) / float64(resultsTotal)
+	}
+	var err error
+	if metrics.CostByProvider, err = s.SummarizeUsage("provider", &since, nil); err != nil {
+		return metrics, err
+	}
+	for _, row := range metrics.CostByProvider {
+		metrics.UsagePromptTokens += row.PromptTokens
+		metrics.UsageCompletionTokens += row.CompletionTokens
+		metrics.UsageCost += row.Cost
+		metrics.UsageFailedCost += row.FailedCost
+	}
+	if metrics.CostByPlan, err = s.SummarizeUsage("plan", &since, nil); err != nil {
+		return metrics, err
+	}
+	if metrics.CostByCrop, err = s.SummarizeUsage("crop", &since, nil); err != nil {
+		return metrics, err
+	}
+	running, err := s.repo.GetRunningExperiment()
+	if err != nil {
+		return metrics, err
+	}
+	if running != nil {
+		if metrics.Experiment, err = s.GetExperimentReport(running.ID, &since, nil); err != nil {
+			return metrics, err
+		}
 	}
 	return metrics, nil
 }
@@ -423,12 +488,14 @@ func (s *Service) UpdateLabelNote(noteID uint, category, cropType string, tags [
 	if !s.getSettingBool(settingLabelEnabled, false) {
 		return fmt.Errorf("label flow disabled")
 	}
+	labelCrop, labelRaw := s.normalizeLabelCrop(cropType, nil)
 	fields := map[string]interface{}{
-		"label_status":    "labeled",
-		"label_category":  category,
-		"label_crop_type": cropType,
-		"label_tags":      joinTags(tags),
-		"label_note":      note,
+		"label_status":        "labeled",
+		"label_category":      category,
+		"label_crop_type":     labelCrop,
+		"label_crop_type_raw": labelRaw,
+		"label_tags":          joinTags(tags),
+		"label_note":          note,
 	}
 	return s.repo.UpdateLabelNote(noteID, fields)
 }
@@ -446,7 +513,28 @@ func (s *Service) ReviewLabelNote(noteID uint, status, reviewer string) error {
 		"reviewed_by":  reviewer,
 		"reviewed_at":  &now,
 	}
-	return s.repo.UpdateLabelNote(noteID, fields)
+	if status != "approved" {
+		return s.repo.UpdateLabelNote(noteID, fields)
+	}
+	if err := s.approveLabelNote(noteID, fields); err != nil {
+		return err
+	}
+	s.wakeWebhookWorker()
+	return nil
+}
+
+// approveLabelNote 更新标注为通过，与通知的待投递记录同一事务提交
+func (s *Service) approveLabelNote(noteID uint, fields map[string]interface{}) error {
+	return s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.UpdateLabelNote(noteID, fields); err != nil {
+			return err
+		}
+		note, err := tx.GetNoteByID(noteID)
+		if err != nil {
+			return err
+		}
+		return s.enqueueLabelApproved(tx, note)
+	})
 }
 
 func (s *Service) BatchApproveLabelNotes(status, category, cropType, reviewer string, start, end *time.Time) (int64, error) {
@@ -457,7 +545,29 @@ func (s *Service) BatchApproveLabelNotes(status, category, cropType, reviewer st
 		reviewer = "admin"
 	}
 	now := time.Now()
-	return s.repo.BatchApproveLabelNotes(status, category, cropType, start, end, reviewer, now)
+	var notes []model.FieldNote
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		var err error
+		notes, err = tx.BatchApproveLabelNotes(status, category, cropType, start, end, reviewer, now)
+		if err != nil {
+			return err
+		}
+		// 重新审核已通过的标注不重复通知
+		if strings.TrimSpace(status) == "approved" {
+			return nil
+		}
+		for i := range notes {
+			if err := s.enqueueLabelApproved(tx, &notes[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.wakeWebhookWorker()
+	return int64(len(notes)), nil
 }
 
 func (s *Service) GetNoteByResultID(resultID uint) (*model.FieldNote, error) {
@@ -499,12 +609,14 @@ func (s *Service) LabelFromQCSample(sampleID uint, category, cropType string, ta
 		return 0, "", err
 	}
 	status := "labeled"
+	labelCrop, labelRaw := s.normalizeLabelCrop(cropType, &sample.ResultID)
 	fields := map[string]interface{}{
-		"label_status":    status,
-		"label_category":  strings.TrimSpace(category),
-		"label_crop_type": strings.TrimSpace(cropType),
-		"label_tags":      joinTags(tags),
-		"label_note":      strings.TrimSpace(note),
+		"label_status":        status,
+		"label_category":      strings.TrimSpace(category),
+		"label_crop_type":     labelCrop,
+		"label_crop_type_raw": labelRaw,
+		"label_tags":          joinTags(tags),
+		"label_note":          strings.TrimSpace(note),
 	}
 	if approved {
 		status = "approved"
@@ -516,9 +628,16 @@ func (s *Service) LabelFromQCSample(sampleID uint, category, cropType string, ta
 		fields["reviewed_by"] = reviewer
 		fields["reviewed_at"] = &now
 	}
-	if err := s.repo.UpdateLabelNote(noteID, fields); err != nil {
+	if !approved {
+		if err := s.repo.UpdateLabelNote(noteID, fields); err != nil {
+			return 0, "", err
+		}
+		return noteID, status, nil
+	}
+	if err := s.approveLabelNote(noteID, fields); err != nil {
 		return 0, "", err
 	}
+	s.wakeWebhookWorker()
 	return noteID, status, nil
 }
 
@@ -531,8 +650,11 @@ func (s *Service) GetEvalSummary(days int) (EvalSummary, error) {
 	offset := 0
 	var total int64
 	var correct int64
+	var top3Correct int64
 	cropStats := map[string]*EvalCropStat{}
 	confusions := map[string]map[string]int64{}
+	promptStats := map[string]*EvalPromptStat{}
+	matcher, _ := s.loadCropMatcher()
 	for {
 		items, err := s.repo.ListApprovedLabels(limit, offset, &since, nil)
 		if err != nil {
@@ -541,20 +663,56 @@ func (s *Service) GetEvalSummary(days int) (EvalSummary, error) {
 		if len(items) == 0 {
 			break
 		}
+		resultIDs := make([]uint, 0, len(items))
+		for _, n := range items {
+			if n.ResultID != nil {
+				resultIDs = append(resultIDs, *n.ResultID)
+			}
+		}
+		results, err := s.repo.GetResultsByIDs(resultIDs)
+		if err != nil {
+			return EvalSummary{}, err
+		}
+		resultByID := make(map[uint]model.RecognitionResult, len(results))
+		for _, r := range results {
+			resultByID[r.ID] = r
+		}
+		candidatesMap, err := s.GetCandidatesMap(resultIDs)
+		if err != nil {
+			return EvalSummary{}, err
+		}
 		for _, n := range items {
 			if n.LabelCropType == "" || n.CropType == "" {
 				continue
 			}
 			total++
+			var res model.RecognitionResult
+			if n.ResultID != nil {
+				res = resultByID[*n.ResultID]
+			}
+			promptKey := fmt.Sprintf("%d|%s", res.PromptVersion, res.Model)
+			pstat, ok := promptStats[promptKey]
+			if !ok {
+				pstat = &EvalPromptStat{PromptVersion: res.PromptVersion, Model: res.Model}
+				promptStats[promptKey] = pstat
+			}
+			pstat.Total++
+			hit := sameCrop(matcher, n.LabelCropType, n.CropType)
+			if hit {
+				pstat.Correct++
+			}
 			stat, ok := cropStats[n.LabelCropType]
 			if !ok {
 				stat = &EvalCropStat{CropType: n.LabelCropType}
 				cropStats[n.LabelCropType] = stat
 			}
 			stat.Total++
-			if n.LabelCropType == n.CropType {
+			if hit {
 				correct++
 				stat.Correct++
+				top3Correct++
+			} else if n.ResultID != nil && inTopK(matcher, candidatesMap[*n.ResultID], n.LabelCropType, 3) {
+				top3Correct++
 			}
 			if _, ok := confusions[n.LabelCropType]; !ok {
 				confusions[n.LabelCropType] = map[string]int64{}
@@ -564,8 +722,10 @@ func (s *Service) GetEvalSummary(days int) (EvalSummary, error) {
 		offset += len(items)
 	}
 	acc := 0.0
+	top3Acc := 0.0
 	if total > 0 {
 		acc = float64(correct) / float64(total)
+		top3Acc = float64(top3Correct) / float64(total)
 	}
 	byCrop := make([]EvalCropStat, 0, len(cropStats))
 	for _, stat := range cropStats {
@@ -601,7 +761,20 @@ func (s *Service) GetEvalSummary(days int) (EvalSummary, error) {
 	if len(confusionList) > 20 {
 		confusionList = confusionList[:20]
 	}
-	return EvalSummary{Total: total, Correct: correct, Accuracy: acc, ByCrop: byCrop, Confusions: confusionList}, nil
+	byPrompt := make([]EvalPromptStat, 0, len(promptStats))
+	for _, stat := range promptStats {
+		if stat.Total > 0 {
+			stat.Accuracy = float64(stat.Correct) / float64(stat.Total)
+		}
+		byPrompt = append(byPrompt, *stat)
+	}
+	sort.Slice(byPrompt, func(i, j int) bool {
+		if byPrompt[i].PromptVersion == byPrompt[j].PromptVersion {
+			return byPrompt[i].Model < byPrompt[j].Model
+		}
+		return byPrompt[i].PromptVersion > byPrompt[j].PromptVersion
+	})
+	return EvalSummary{Total: total, Correct: correct, Accuracy: acc, Top1Accuracy: acc, Top3Correct: top3Correct, Top3Accuracy: top3Acc, ByCrop: byCrop, Confusions: confusionList, ByPrompt: byPrompt}, nil
 }
 
 func (s *Service) CreateEvalRun(days int) (EvalRunView, error) {
@@ -615,25 +788,30 @@ func (s *Service) CreateEvalRun(days int) (EvalRunView, error) {
 	byCrop, _ := json.Marshal(summary.ByCrop)
 	confusions, _ := json.Marshal(summary.Confusions)
 	run := &model.EvalRun{
-		Days:       days,
-		Total:      summary.Total,
-		Correct:    summary.Correct,
-		Accuracy:   summary.Accuracy,
-		ByCrop:     string(byCrop),
-		Confusions: string(confusions),
+		Days:         days,
+		Total:        summary.Total,
+		Correct:      summary.Correct,
+		Accuracy:     summary.Accuracy,
+		ByCrop:       string(byCrop),
+		Confusions:   string(confusions),
+		Top3Correct:  summary.Top3Correct,
+		Top3Accuracy: summary.Top3Accuracy,
 	}
 	if err := s.repo.CreateEvalRun(run); err != nil {
 		return EvalRunView{}, err
 	}
 	return EvalRunView{
-		ID:         run.ID,
-		CreatedAt:  run.CreatedAt.Format("2006-01-02 15:04:05"),
-		Days:       run.Days,
-		Total:      run.Total,
-		Correct:    run.Correct,
-		Accuracy:   run.Accuracy,
-		ByCrop:     summary.ByCrop,
-		Confusions: summary.Confusions,
+		ID:           run.ID,
+		CreatedAt:    run.CreatedAt.Format("2006-01-02 15:04:05"),
+		Days:         run.Days,
+		Total:        run.Total,
+		Correct:      run.Correct,
+		Accuracy:     run.Accuracy,
+		Top1Accuracy: run.Accuracy,
+		Top3Correct:  run.Top3Correct,
+		Top3Accuracy: run.Top3Accuracy,
+		ByCrop:       summary.ByCrop,
+		Confusions:   summary.Confusions,
 	}, nil
 }
 
@@ -652,14 +830,17 @@ func (s *Service) ListEvalRuns(limit, offset int) ([]EvalRunView, error) {
 		_ = json.Unmarshal([]byte(item.ByCrop), &byCrop)
 		_ = json.Unmarshal([]byte(item.Confusions), &confusions)
 		out = append(out, EvalRunView{
-			ID:         item.ID,
-			CreatedAt:  item.CreatedAt.Format("2006-01-02 15:04:05"),
-			Days:       item.Days,
-			Total:      item.Total,
-			Correct:    item.Correct,
-			Accuracy:   item.Accuracy,
-			ByCrop:     byCrop,
-			Confusions: confusions,
+			ID:           item.ID,
+			CreatedAt:    item.CreatedAt.Format("2006-01-02 15:04:05"),
+			Days:         item.Days,
+			Total:        item.Total,
+			Correct:      item.Correct,
+			Accuracy:     item.Accuracy,
+			Top1Accuracy: item.Accuracy,
+			Top3Correct:  item.Top3Correct,
+			Top3Accuracy: item.Top3Accuracy,
+			ByCrop:       byCrop,
+			Confusions:   confusions,
 		})
 	}
 	return out, nil
@@ -981,15 +1162,33 @@ func (s *Service) ListEvalSets(limit, offset int) ([]EvalSetView, error) {
 	return out, nil
 }
 
-func (s *Service) RunEvalSet(setID uint, baselineID *uint) (EvalSetRunView, error) {
+// RunEvalSet 评测集打分；backfillID 不为空时改用该次批量重新识别的结果作为预测，未重新识别的样本不计入
+func (s *Service) RunEvalSet(setID uint, baselineID, backfillID *uint) (EvalSetRunView, error) {
 	items, err := s.repo.ListEvalSetItems(setID, 200000, 0)
 	if err != nil {
 		return EvalSetRunView{}, err
 	}
+	if backfillID != nil {
+		if items, err = s.applyBackfillPredictions(items, *backfillID); err != nil {
+			return EvalSetRunView{}, err
+		}
+	}
 	var total int64
 	var correct int64
+	var top3Correct int64
 	cropStats := map[string]*EvalCropStat{}
 	confusions := map[string]map[string]int64{}
+	matcher, _ := s.loadCropMatcher()
+	resultIDs := make([]uint, 0, len(items))
+	for _, it := range items {
+		if it.ResultID != nil {
+			resultIDs = append(resultIDs, *it.ResultID)
+		}
+	}
+	candidatesMap, err := s.GetCandidatesMap(resultIDs)
+	if err != nil {
+		return EvalSetRunView{}, err
+	}
 	for _, it := range items {
 		if it.LabelCropType == "" || it.CropTypePred == "" {
 			continue
@@ -1001,9 +1200,12 @@ func (s *Service) RunEvalSet(setID uint, baselineID *uint) (EvalSetRunView, erro
 			cropStats[it.LabelCropType] = stat
 		}
 		stat.Total++
-		if it.LabelCropType == it.CropTypePred {
+		if sameCrop(matcher, it.LabelCropType, it.CropTypePred) {
 			correct++
 			stat.Correct++
+			top3Correct++
+		} else if it.ResultID != nil && inTopK(matcher, candidatesMap[*it.ResultID], it.LabelCropType, 3) {
+			top3Correct++
 		}
 		if _, ok := confusions[it.LabelCropType]; !ok {
 			confusions[it.LabelCropType] = map[string]int64{}
@@ -1011,8 +1213,10 @@ func (s *Service) RunEvalSet(setID uint, baselineID *uint) (EvalSetRunView, erro
 		confusions[it.LabelCropType][it.CropTypePred]++
 	}
 	acc := 0.0
+	top3Acc := 0.0
 	if total > 0 {
 		acc = float64(correct) / float64(total)
+		top3Acc = float64(top3Correct) / float64(total)
 	}
 	byCrop := make([]EvalCropStat, 0, len(cropStats))
 	for _, stat := range cropStats {
@@ -1051,14 +1255,17 @@ func (s *Service) RunEvalSet(setID uint, baselineID *uint) (EvalSetRunView, erro
 	byCropJSON, _ := json.Marshal(byCrop)
 	confJSON, _ := json.Marshal(confusionList)
 	run := &model.EvalSetRun{
-		EvalSetID:  setID,
-		Total:      total,
-		Correct:    correct,
-		Accuracy:   acc,
-		ByCrop:     string(byCropJSON),
-		Confusions: string(confJSON),
-		BaselineID: baselineID,
-		DeltaAcc:   0,
+		EvalSetID:    setID,
+		Total:        total,
+		Correct:      correct,
+		Accuracy:     acc,
+		ByCrop:       string(byCropJSON),
+		Confusions:   string(confJSON),
+		Top3Correct:  top3Correct,
+		Top3Accuracy: top3Acc,
+		BaselineID:   baselineID,
+		DeltaAcc:     0,
+		BackfillID:   backfillID,
 	}
 	if baselineID != nil {
 		if base, err := s.repo.GetEvalSetRunByID(*baselineID); err == nil && base != nil {
@@ -1069,18 +1276,48 @@ func (s *Service) RunEvalSet(setID uint, baselineID *uint) (EvalSetRunView, erro
 		return EvalSetRunView{}, err
 	}
 	return EvalSetRunView{
-		ID:         run.ID,
-		CreatedAt:  run.CreatedAt.Format("2006-01-02 15:04:05"),
-		Total:      run.Total,
-		Correct:    run.Correct,
-		Accuracy:   run.Accuracy,
-		ByCrop:     byCrop,
-		Confusions: confusionList,
-		BaselineID: run.BaselineID,
-		DeltaAcc:   run.DeltaAcc,
+		ID:           run.ID,
+		CreatedAt:    run.CreatedAt.Format("2006-01-02 15:04:05"),
+		Total:        run.Total,
+		Correct:      run.Correct,
+		Accuracy:     run.Accuracy,
+		Top1Accuracy: run.Accuracy,
+		Top3Correct:  run.Top3Correct,
+		Top3Accuracy: run.Top3Accuracy,
+		ByCrop:       byCrop,
+		Confusions:   confusionList,
+		BaselineID:   run.BaselineID,
+		DeltaAcc:     run.DeltaAcc,
+		BackfillID:   run.BackfillID,
 	}, nil
 }
 
+// applyBackfillPredictions 用批量重新识别的结果替换评测样本的预测
+func (s *Service) applyBackfillPredictions(items []model.EvalSetItem, backfillID uint) ([]model.EvalSetItem, error) {
+	results, err := s.repo.ListBackfillResults(backfillID)
+	if err != nil {
+		return nil, err
+	}
+	byImage := make(map[uint]model.RecognitionResult, len(results))
+	for _, r := range results {
+		byImage[r.ImageID] = r
+	}
+	out := make([]model.EvalSetItem, 0, len(items))
+	for _, it := range items {
+		r, ok := byImage[it.ImageID]
+		if !ok {
+			continue
+		}
+		id := r.ID
+		it.ResultID = &id
+		it.CropTypePred = r.CropType
+		it.Provider = r.Provider
+		it.Confidence = r.Confidence
+		out = append(out, it)
+	}
+	return out, nil
+}
+
 func (s *Service) ListEvalSetRuns(setID uint, limit, offset int) ([]EvalSetRunView, error) {
 	if limit <= 0 {
 		limit = 20
@@ -1096,15 +1333,19 @@ func (s *Service) ListEvalSetRuns(setID uint, limit, offset int) ([]EvalSetRunVi
 		_ = json.Unmarshal([]byte(item.ByCrop), &byCrop)
 		_ = json.Unmarshal([]byte(item.Confusions), &confusions)
 		out = append(out, EvalSetRunView{
-			ID:         item.ID,
-			CreatedAt:  item.CreatedAt.Format("2006-01-02 15:04:05"),
-			Total:      item.Total,
-			Correct:    item.Correct,
-			Accuracy:   item.Accuracy,
-			ByCrop:     byCrop,
-			Confusions: confusions,
-			BaselineID: item.BaselineID,
-			DeltaAcc:   item.DeltaAcc,
+			ID:           item.ID,
+			CreatedAt:    item.CreatedAt.Format("2006-01-02 15:04:05"),
+			Total:        item.Total,
+			Correct:      item.Correct,
+			Accuracy:     item.Accuracy,
+			Top1Accuracy: item.Accuracy,
+			Top3Correct:  item.Top3Correct,
+			Top3Accuracy: item.Top3Accuracy,
+			ByCrop:       byCrop,
+			Confusions:   confusions,
+			BaselineID:   item.BaselineID,
+			DeltaAcc:     item.DeltaAcc,
+			BackfillID:   item.BackfillID,
 		})
 	}
 	return out, nil
@@ -1358,14 +1599,15 @@ func (s *Service) ExportFailedResultsJSON(w io.Writer, days int, provider, cropT
 	return json.NewEncoder(w).Encode(items)
 }
 
-func (s *Service) SearchResults(limit, offset int, provider, cropType, source string, minConf, maxConf *float64, minDuration, maxDuration *int, start, end *time.Time) ([]RecognizeResultView, error) {
+func (s *Service) SearchResults(limit, offset int, provider, cropType, source string, minConf, maxConf *float64, minDuration, maxDuration *int, start, end *time.Time, filter ResultFilter) ([]RecognizeResultView, error) {
 	if limit <= 0 {
 		limit = 20
 	}
 	var items []repository.QCResultRow
 	query := s.repo.DB().Model(&model.RecognitionResult{}).
-		Select("recognition_results.id as result_id, recognition_results.image_id as image_id, recognition_results.crop_type, recognition_results.confidence, recognition_results.provider, recognition_results.source, recognition_results.created_at as created_at, images.original_url as image_url").
+		Select("recognition_results.id as result_id, recognition_results.image_id as image_id, recognition_results.crop_type, recognition_results.confidence, recognition_results.provider, recognition_results.source, recognition_results.created_at as created_at, recognition_results.prompt_version, recognition_results.model, recognition_results.mode, recognition_results.growth_stage_code, images.original_url as image_url").
 		Joins("JOIN images ON images.id = recognition_results.image_id")
+	query = repository.ApplyResultFilter(query, filter)
 	if provider != "" {
 		query = query.Where("recognition_results.provider = ?", provider)
 	}
@@ -1403,14 +1645,18 @@ func (s *Service) SearchResults(limit, offset int, provider, cropType, source st
 	out := make([]RecognizeResultView, 0, len(items))
 	for _, it := range items {
 		out = append(out, RecognizeResultView{
-			ResultID:   it.ResultID,
-			ImageID:    it.ImageID,
-			ImageURL:   it.ImageURL,
-			CropType:   it.CropType,
-			Confidence: it.Confidence,
-			Provider:   it.Provider,
-			Source:     it.Source,
-			CreatedAt:  it.CreatedAt.Format("2006-01-02 15:04:05"),
+			ResultID:        it.ResultID,
+			ImageID:         it.ImageID,
+			ImageURL:        it.ImageURL,
+			CropType:        it.CropType,
+			Confidence:      it.Confidence,
+			Provider:        it.Provider,
+			Source:          it.Source,
+			CreatedAt:       it.CreatedAt.Format("2006-01-02 15:04:05"),
+			PromptVersion:   it.PromptVersion,
+			Model:           it.Model,
+			Mode:            it.Mode,
+			GrowthStageCode: it.GrowthStageCode,
 		})
 	}
 	return out, nil
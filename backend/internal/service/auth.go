@@ -2,6 +2,7 @@ package service
 
 import (
 	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
 	"context"
 	"crypto/rand"
 	"crypto/tls"
@@ -124,7 +125,16 @@ func (s *Service) ApproveMembershipRequest(id uint, plan string, quotaTotal *int
 	if err != nil {
 		return nil, err
 	}
-	_ = s.repo.UpdateMembershipRequestStatus(req.ID, "approved")
+	err = s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.UpdateMembershipRequestStatus(req.ID, "approved"); err != nil {
+			return err
+		}
+		return s.enqueueMembershipApproved(tx, req, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.wakeWebhookWorker()
 	return user, nil
 }
 
@@ -403,46 +413,6 @@ func (s *Service) GetEntitlements(user *model.User, deviceID string) (Entitlemen
 	return ent, nil
 }
 
-func (s *Service) ConsumeRecognition(user *model.User, deviceID string) error {
-	if user != nil && user.ID > 0 && !isGuestUser(user) {
-		planCfg := s.getPlanSetting(user.Plan)
-		quotaTotal := user.QuotaTotal
-		if quotaTotal == 0 {
-			quotaTotal = planCfg.QuotaTotal
-		}
-		if quotaTotal > 0 && user.QuotaUsed >= quotaTotal {
-			return ErrQuotaExceeded
-		}
-		if planCfg.RequireAd {
-			if ok, err := s.repo.DecrementUserAdCredits(user.ID); err != nil {
-				return err
-			} else if !ok {
-				return ErrAdRequired
-			}
-		}
-		_ = s.repo.IncrementUserQuotaUsed(user.ID)
-		return nil
-	}
-
-	if strings.TrimSpace(deviceID) == "" {
-		return ErrLoginRequired
-	}
-	usage := s.ensureDeviceUsage(deviceID)
-	anonLimit := s.getSettingInt(settingAnonLimit, s.auth.AnonLimit)
-	if anonLimit <= 0 || usage.RecognizeCount >= anonLimit {
-		return ErrLoginRequired
-	}
-	if s.getSettingBool(settingAnonRequireAd, true) {
-		if ok, err := s.repo.DecrementDeviceAdCredits(deviceID); err != nil {
-			return err
-		} else if !ok {
-			return ErrAdRequired
-		}
-	}
-	_ = s.repo.IncrementDeviceRecognize(deviceID)
-	return nil
-}
-
 func (s *Service) RewardAd(user *model.User, deviceID string) error {
 	if user != nil && user.ID > 0 && !isGuestUser(user) {
 		return s.repo.IncrementUserAdCredits(user.ID, 1)
@@ -537,13 +507,16 @@ func (s *Service) PurgeUserNotesByRetention(user *model.User) (int64, error) {
 				break
 			}
 			for _, img := range images {
-				key := extractObjectKey(img.OriginalURL)
-				if key == "" {
-					continue
-				}
-				if err := s.storage.Delete(context.Background(), key); err != nil {
-					// 不阻断清理流程
-					continue
+				// 原图与展示图、缩略图一并删除，展示图沿用原图时只删一次
+				deleted := map[string]bool{}
+				for _, u := range []string{img.OriginalURL, img.CompressedURL, img.ThumbnailURL} {
+					key := extractObjectKey(u)
+					if key == "" || deleted[key] {
+						continue
+					}
+					deleted[key] = true
+					// 失败不阻断清理流程
+					_ = s.storage.Delete(context.Background(), key)
 				}
 			}
 			offset += len(images)
@@ -19,6 +19,27 @@ type AuthConfig struct {
 	RetentionPurgeEnabled       bool
 	RetentionPurgeIntervalHours int
 	RetentionPurgeBatchSize     int
+	RecognizeTimeoutSeconds     int
+	RecognitionCacheTTLMinutes  int
+	LLMPriceTable               string
+	JobWorkers                  int
+	JobMaxAttempts              int
+	JobVisibilitySeconds        int
+	BatchMaxItems               int
+	BatchConcurrency            int
+	ShadowProvider              string
+	ShadowPromptVersion         int
+	ShadowPercent               int
+	ShadowConcurrency           int
+	IdempotencyTTLHours         int
+	WebhookWorkers              int
+	WebhookMaxAttempts          int
+	WebhookTimeoutSeconds       int
+	ImageDisplayMaxSide         int
+	ImageDisplayQuality         int
+	ImageThumbMaxSide           int
+	ImageThumbQuality           int
+	ImageProviderMinSide        int
 }
 
 func loadAuthConfig() AuthConfig {
@@ -58,6 +79,27 @@ func loadAuthConfig() AuthConfig {
 		RetentionPurgeEnabled:       getEnvBool("RETENTION_PURGE_ENABLED", true),
 		RetentionPurgeIntervalHours: getEnvInt("RETENTION_PURGE_INTERVAL_HOURS", 24),
 		RetentionPurgeBatchSize:     getEnvInt("RETENTION_PURGE_BATCH_SIZE", 200),
+		RecognizeTimeoutSeconds:     getEnvInt("RECOGNIZE_TIMEOUT_SECONDS", 90),
+		RecognitionCacheTTLMinutes:  getEnvInt("RECOGNITION_CACHE_TTL_MINUTES", 1440),
+		LLMPriceTable:               os.Getenv("LLM_PRICE_TABLE"),
+		JobWorkers:                  getEnvInt("RECOGNITION_JOB_WORKERS", 4),
+		JobMaxAttempts:              getEnvInt("RECOGNITION_JOB_MAX_ATTEMPTS", 3),
+		JobVisibilitySeconds:        getEnvInt("RECOGNITION_JOB_VISIBILITY_SECONDS", 180),
+		BatchMaxItems:               getEnvInt("RECOGNITION_BATCH_MAX_ITEMS", 200),
+		BatchConcurrency:            getEnvInt("RECOGNITION_BATCH_CONCURRENCY", 4),
+		ShadowProvider:              os.Getenv("SHADOW_PROVIDER"),
+		ShadowPromptVersion:         getEnvInt("SHADOW_PROMPT_VERSION", 0),
+		ShadowPercent:               getEnvInt("SHADOW_PERCENT", 0),
+		ShadowConcurrency:           getEnvInt("SHADOW_CONCURRENCY", 4),
+		IdempotencyTTLHours:         getEnvInt("IDEMPOTENCY_TTL_HOURS", 24),
+		WebhookWorkers:              getEnvInt("WEBHOOK_WORKERS", 2),
+		WebhookMaxAttempts:          getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeoutSeconds:       getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		ImageDisplayMaxSide:         getEnvInt("IMAGE_DISPLAY_MAX_SIDE", 1600),
+		ImageDisplayQuality:         getEnvInt("IMAGE_DISPLAY_QUALITY", 82),
+		ImageThumbMaxSide:           getEnvInt("IMAGE_THUMB_MAX_SIDE", 320),
+		ImageThumbQuality:           getEnvInt("IMAGE_THUMB_QUALITY", 70),
+		ImageProviderMinSide:        getEnvInt("IMAGE_PROVIDER_MIN_SIDE", 1024),
 	}
 }
 
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBackfillEmpty = errors.New("no images match the filters")
+	ErrBackfillState = errors.New("backfill status does not allow this action")
+)
+
+const (
+	backfillDefaultRate  = 30
+	backfillMaxRate      = 600
+	backfillPageSize     = 50
+	backfillLease        = 2 * time.Minute
+	backfillPollInterval = 5 * time.Second
+	backfillUsageWindow  = 30 * 24 * time.Hour
+	backfillSource       = "backfill"
+)
+
+type BackfillFilter = repository.BackfillFilter
+
+// BackfillCreate 创建批量重新识别的参数，Provider 为空时按路由规则选择
+type BackfillCreate struct {
+	Provider      string
+	PromptVersion int
+	Mode          string
+	Filter        BackfillFilter
+	RatePerMinute int
+	Promote       bool
+}
+
+// BackfillView 批量重新识别进度，filters 为解析后的筛选条件
+type BackfillView struct {
+	model.BackfillRun
+	Filters          BackfillFilter `json:"filters"`
+	Progress         float64        `json:"progress"`
+	EstimatedMinutes float64        `json:"estimated_minutes"` // 按限速估算的剩余时长
+}
+
+func toBackfillView(run *model.BackfillRun) BackfillView {
+	view := BackfillView{BackfillRun: *run}
+	_ = json.Unmarshal([]byte(run.Filters), &view.Filters)
+	if run.Total > 0 {
+		view.Progress = float64(run.Processed) / float64(run.Total)
+	}
+	if remaining := run.Total - run.Processed; remaining > 0 && run.RatePerMinute > 0 {
+		view.EstimatedMinutes = float64(remaining) / float64(run.RatePerMinute)
+	}
+	return view
+}
+
+// CreateBackfill 统计待处理图片并估算费用，创建后为 pending，需管理员确认启动
+func (s *Service) CreateBackfill(adminID uint, req BackfillCreate) (BackfillView, error) {
+	mode, err := NormalizeMode(req.Mode)
+	if err != nil {
+		return BackfillView{}, err
+	}
+	provider := strings.TrimSpace(req.Provider)
+	if provider != "" {
+		if _, err := llm.GetProvider(provider); err != nil {
+			return BackfillView{}, err
+		}
+	}
+	if req.PromptVersion > 0 {
+		if _, err := s.repo.GetPromptTemplateVersion(mode, req.PromptVersion); err != nil {
+			return BackfillView{}, fmt.Errorf("prompt template %s v%d not found", mode, req.PromptVersion)
+		}
+	}
+	rate := req.RatePerMinute
+	if rate <= 0 {
+		rate = backfillDefaultRate
+	}
+	if rate > backfillMaxRate {
+		rate = backfillMaxRate
+	}
+	filter := req.Filter
+	filter.CropType = strings.TrimSpace(filter.CropType)
+	filter.Provider = strings.TrimSpace(filter.Provider)
+	filter.Source = strings.TrimSpace(filter.Source)
+
+	total, err := s.repo.CountBackfillImages(filter)
+	if err != nil {
+		return BackfillView{}, err
+	}
+	if total == 0 {
+		return BackfillView{}, ErrBackfillEmpty
+	}
+	tokens, cost, err := s.estimateBackfill(provider, total)
+	if err != nil {
+		return BackfillView{}, err
+	}
+	filters, _ := json.Marshal(filter)
+	run := &model.BackfillRun{
+		CreatedBy:       adminID,
+		Status:          model.BackfillPending,
+		Provider:        provider,
+		PromptVersion:   req.PromptVersion,
+		Mode:            mode,
+		Filters:         string(filters),
+		Promote:         req.Promote,
+		RatePerMinute:   rate,
+		Total:           int(total),
+		EstimatedTokens: tokens,
+		EstimatedCost:   cost,
+	}
+	if err := s.repo.CreateBackfillRun(run); err != nil {
+		return BackfillView{}, err
+	}
+	return toBackfillView(run), nil
+}
+
+// estimateBackfill 按近 30 天成功尝试的平均用量估算 token 与费用；指定提供商时按其价格计算，无历史用量时退回全部提供商的平均值
+func (s *Service) estimateBackfill(provider string, total int64) (int64, float64, error) {
+	since := time.Now().Add(-backfillUsageWindow)
+	avg, err := s.repo.AverageUsage(provider, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	if avg.Samples == 0 && provider != "" {
+		if avg, err = s.repo.AverageUsage("", since); err != nil {
+			return 0, 0, err
+		}
+	}
+	tokens := int64(math.Round((avg.PromptTokens + avg.CompletionTokens) * float64(total)))
+	perImage := avg.Cost
+	if provider != "" {
+		calls := int(math.Round(avg.Calls))
+		if calls < 1 {
+			calls = 1
+		}
+		perImage = estimateCost(s.priceTable(), llm.Usage{
+			Provider:         provider,
+			Model:            llm.ProviderModel(provider),
+			PromptTokens:     int(math.Round(avg.PromptTokens)),
+			CompletionTokens: int(math.Round(avg.CompletionTokens)),
+			Calls:            calls,
+		})
+	}
+	return tokens, perImage * float64(total), nil
+}
+
+func (s *Service) GetBackfill(id uint) (BackfillView, error) {
+	run, err := s.repo.GetBackfillRun(id)
+	if err != nil {
+		return BackfillView{}, err
+	}
+	return toBackfillView(run), nil
+}
+
+func (s *Service) ListBackfills(status string, limit, offset int) ([]BackfillView, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	items, err := s.repo.ListBackfillRuns(strings.TrimSpace(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]BackfillView, 0, len(items))
+	for i := range items {
+		out = append(out, toBackfillView(&items[i]))
+	}
+	return out, nil
+}
+
+// StartBackfill 确认估算后开始执行
+func (s *Service) StartBackfill(id uint) (BackfillView, error) {
+	now := time.Now()
+	return s.transitionBackfill(id, []string{model.BackfillPending}, map[string]interface{}{
+		"status":     model.BackfillRunning,
+		"started_at": &now,
+	})
+}
+
+// PauseBackfill 暂停，执行者处理完当前图片后停止
+func (s *Service) PauseBackfill(id uint) (BackfillView, error) {
+	return s.transitionBackfill(id, []string{model.BackfillRunning}, map[string]interface{}{
+		"status": model.BackfillPaused,
+	})
+}
+
+// ResumeBackfill 从暂停处继续
+func (s *Service) ResumeBackfill(id uint) (BackfillView, error) {
+	return s.transitionBackfill(id, []string{model.BackfillPaused}, map[string]interface{}{
+		"status": model.BackfillRunning,
+	})
+}
+
+// CancelBackfill 取消，已保存的结果版本保留
+func (s *Service) CancelBackfill(id uint) (BackfillView, error) {
+	now := time.Now()
+	return s.transitionBackfill(id, []string{model.BackfillPending, model.BackfillRunning, model.BackfillPaused}, map[string]interface{}{
+		"status":      model.BackfillCanceled,
+		"finished_at": &now,
+	})
+}
+
+func (s *Service) transitionBackfill(id uint, from []string, updates map[string]interface{}) (BackfillView, error) {
+	ok, err := s.repo.TransitionBackfillRun(id, from, updates)
+	if err != nil {
+		return BackfillView{}, err
+	}
+	if !ok {
+		return BackfillView{}, ErrBackfillState
+	}
+	return s.GetBackfill(id)
+}
+
+// StartBackfillRunner 启动批量重新识别执行者，每个实例一个，同一批次通过租约保证只有一个实例执行
+func (s *Service) StartBackfillRunner(ctx context.Context) {
+	go func() {
+		for {
+			run, err := s.repo.LeaseBackfillRun(newLockToken(), backfillLease)
+			if err != nil {
+				log.Printf("lease backfill failed: %v", err)
+			}
+			if run != nil {
+				s.runBackfill(ctx, run)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backfillPollInterval):
+			}
+		}
+	}()
+}
+
+// runBackfill 按图片 ID 顺序逐张重新识别，按 rate_per_minute 限速；状态不再是 running 或租约丢失时停止
+func (s *Service) runBackfill(ctx context.Context, run *model.BackfillRun) {
+	var filter BackfillFilter
+	_ = json.Unmarshal([]byte(run.Filters), &filter)
+	interval := time.Minute / time.Duration(max(run.RatePerMinute, 1))
+	cursor := run.Cursor
+	for {
+		images, err := s.repo.NextBackfillImages(filter, cursor, backfillPageSize)
+		if err != nil {
+			log.Printf("backfill %d list images failed: %v", run.ID, err)
+			_ = s.repo.ReleaseBackfillRun(run.ID, run.LockToken)
+			return
+		}
+		if len(images) == 0 {
+			s.finishBackfill(run, filter)
+			return
+		}
+		for i := range images {
+			if ctx.Err() != nil {
+				_ = s.repo.ReleaseBackfillRun(run.ID, run.LockToken)
+				return
+			}
+			current, err := s.repo.GetBackfillRun(run.ID)
+			if err != nil || current.Status != model.BackfillRunning || current.LockToken != run.LockToken {
+				_ = s.repo.ReleaseBackfillRun(run.ID, run.LockToken)
+				return
+			}
+			started := time.Now()
+			errMsg := s.backfillImage(ctx, run, &images[i])
+			ok, err := s.repo.AdvanceBackfillRun(run.ID, run.LockToken, images[i].ID, errMsg == "", errMsg, backfillLease)
+			if err != nil || !ok {
+				log.Printf("backfill %d advance failed: ok=%v err=%v", run.ID, ok, err)
+				return
+			}
+			cursor = images[i].ID
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(started.Add(interval))):
+			}
+		}
+	}
+}
+
+// backfillImage 重新识别一张图片并保存为新版本，来源沿用当前结果；失败时返回错误信息
+func (s *Service) backfillImage(ctx context.Context, run *model.BackfillRun, img *model.Image) string {
+	source := backfillSource
+	if current, err := s.repo.GetResultByImageID(img.ID); err == nil && current.Source != "" {
+		source = current.Source
+	}
+	recognizeCtx, cancel := s.RecognizeContext(ctx)
+	defer cancel()
+	started := time.Now()
+	result, err := s.Recognize(recognizeCtx, nil, img, RecognizeOptions{
+		Source:        source,
+		Mode:          run.Mode,
+		Provider:      run.Provider,
+		PromptVersion: run.PromptVersion,
+		SkipCache:     true,
+	})
+	if err != nil {
+		s.RecordFailure(0, &img.ID, run.Provider, backfillSource, err)
+		_, msg := classifyFailure(err)
+		return msg
+	}
+	runID := run.ID
+	durationMs := int(time.Since(started).Milliseconds())
+	if _, err := s.saveResult(context.WithoutCancel(ctx), img.ID, result, source, durationMs, &runID, run.Promote); err != nil {
+		s.RecordFailure(0, &img.ID, result.Provider, "save_result", err)
+		return err.Error()
+	}
+	return ""
+}
+
+// finishBackfill 标记完成；按评测集筛选时用新结果跑一次评测，以该评测集最近一次评测为基线
+func (s *Service) finishBackfill(run *model.BackfillRun, filter BackfillFilter) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       model.BackfillCompleted,
+		"finished_at":  &now,
+		"lock_token":   "",
+		"locked_until": nil,
+	}
+	if filter.EvalSetID != nil {
+		var baselineID *uint
+		if runs, err := s.repo.ListEvalSetRuns(*filter.EvalSetID, 1, 0); err == nil && len(runs) > 0 {
+			baselineID = &runs[0].ID
+		}
+		runID := run.ID
+		if view, err := s.RunEvalSet(*filter.EvalSetID, baselineID, &runID); err == nil {
+			updates["eval_run_id"] = view.ID
+		} else {
+			log.Printf("backfill %d eval failed: %v", run.ID, err)
+		}
+	}
+	if _, err := s.repo.TransitionBackfillRun(run.ID, []string{model.BackfillRunning}, updates); err != nil {
+		log.Printf("finish backfill %d failed: %v", run.ID, err)
+	}
+}
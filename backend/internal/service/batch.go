@@ -0,0 +1,292 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBatchEmpty    = errors.New("batch is empty")
+	ErrBatchTooLarge = errors.New("batch too large")
+	ErrBatchNotFound = errors.New("batch image not found")
+)
+
+// BatchSubmit 批量识别请求，image_ids 与 image_urls 可混合
+type BatchSubmit struct {
+	ImageIDs    []uint
+	ImageURLs   []string
+	Source      string
+	Locale      string
+	Mode        string
+	Concurrency int
+}
+
+// BatchItemView 批次中单张图片的处理结果
+type BatchItemView struct {
+	JobID        uint     `json:"job_id"`
+	ImageID      uint     `json:"image_id"`
+	Status       string   `json:"status"`
+	Attempts     int      `json:"attempts"`
+	ResultID     *uint    `json:"result_id"`
+	CropType     string   `json:"crop_type,omitempty"`
+	Confidence   *float64 `json:"confidence,omitempty"`
+	ErrorCode    string   `json:"error_code,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+}
+
+// BatchView 批次进度，status 为 running/completed/partial/failed/canceled
+type BatchView struct {
+	ID          uint            `json:"batch_id"`
+	Status      string          `json:"status"`
+	Mode        string          `json:"mode"`
+	Source      string          `json:"source"`
+	Total       int             `json:"total"`
+	Concurrency int             `json:"concurrency"`
+	Counts      map[string]int  `json:"counts"`
+	CreatedAt   string          `json:"created_at"`
+	Items       []BatchItemView `json:"items"`
+}
+
+func (s *Service) batchLimits() (int, int) {
+	maxItems := s.auth.BatchMaxItems
+	if maxItems <= 0 {
+		maxItems = 200
+	}
+	concurrency := s.auth.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	return maxItems, concurrency
+}
+
+// SubmitRecognitionBatch 校验图片并按整批一次扣减次数后创建任务，任一环节失败整批退回
+func (s *Service) SubmitRecognitionBatch(ctx context.Context, user *model.User, req BatchSubmit) (*model.RecognitionBatch, error) {
+	if user == nil || user.ID == 0 || isGuestUser(user) {
+		return nil, ErrLoginRequired
+	}
+	seen := map[uint]bool{}
+	ids := make([]uint, 0, len(req.ImageIDs))
+	for _, id := range req.ImageIDs {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	urls := make([]string, 0, len(req.ImageURLs))
+	for _, u := range req.ImageURLs {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	total := len(ids) + len(urls)
+	maxItems, defaultConcurrency := s.batchLimits()
+	if total == 0 {
+		return nil, ErrBatchEmpty
+	}
+	if total > maxItems {
+		return nil, fmt.Errorf("%w: max %d items", ErrBatchTooLarge, maxItems)
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 || concurrency > defaultConcurrency {
+		concurrency = defaultConcurrency
+	}
+
+	repo := s.repo.WithContext(ctx)
+	if len(ids) > 0 {
+		images, err := repo.GetImagesByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+		// 他人的图片与不存在的图片一样报不存在，不暴露图片是否存在
+		found := map[uint]bool{}
+		for _, img := range images {
+			if img.UserID == user.ID {
+				found[img.ID] = true
+			}
+		}
+		var missing []string
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, fmt.Sprint(id))
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrBatchNotFound, strings.Join(missing, ","))
+		}
+	}
+
+	reservations, err := s.ReserveRecognitions(user, total, "batch")
+	if err != nil {
+		return nil, err
+	}
+	refund := func(reason string) {
+		for i := range reservations {
+			s.ReleaseRecognition(&reservations[i], reason)
+		}
+	}
+
+	for _, u := range urls {
+		img, err := s.CreateImageFromURL(ctx, user.ID, u)
+		if err != nil {
+			refund("create_image_failed")
+			return nil, err
+		}
+		ids = append(ids, img.ID)
+	}
+
+	source := strings.TrimSpace(req.Source)
+	if source == "" {
+		source = "batch"
+	}
+	maxAttempts := s.auth.JobMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	now := time.Now()
+	jobs := make([]model.RecognitionJob, 0, total)
+	for i, id := range ids {
+		jobs = append(jobs, model.RecognitionJob{
+			UserID:        user.ID,
+			ReservationID: &reservations[i].ID,
+			ImageID:       id,
+			Source:        source,
+			Locale:        req.Locale,
+			Mode:          req.Mode,
+			Status:        model.JobQueued,
+			RunAfter:      now,
+			MaxAttempts:   maxAttempts,
+		})
+	}
+	batch := &model.RecognitionBatch{
+		UserID:      user.ID,
+		Source:      source,
+		Mode:        req.Mode,
+		Total:       total,
+		Concurrency: concurrency,
+	}
+	if err := repo.CreateRecognitionBatch(batch, jobs); err != nil {
+		refund("create_job_failed")
+		return nil, err
+	}
+	s.holdForJobs(reservations)
+	s.wakeJobWorker()
+	return batch, nil
+}
+
+func (s *Service) GetRecognitionBatch(id uint) (*model.RecognitionBatch, error) {
+	return s.repo.GetRecognitionBatch(id)
+}
+
+// GetBatchView 批次进度与逐项结果
+func (s *Service) GetBatchView(batch *model.RecognitionBatch) (BatchView, error) {
+	jobs, err := s.repo.ListBatchJobs(batch.ID)
+	if err != nil {
+		return BatchView{}, err
+	}
+	var resultIDs []uint
+	for _, job := range jobs {
+		if job.ResultID != nil {
+			resultIDs = append(resultIDs, *job.ResultID)
+		}
+	}
+	results, err := s.repo.GetResultsByIDs(resultIDs)
+	if err != nil {
+		return BatchView{}, err
+	}
+	resultMap := make(map[uint]model.RecognitionResult, len(results))
+	for _, r := range results {
+		resultMap[r.ID] = r
+	}
+
+	view := BatchView{
+		ID:          batch.ID,
+		Mode:        batch.Mode,
+		Source:      batch.Source,
+		Total:       batch.Total,
+		Concurrency: batch.Concurrency,
+		Counts:      map[string]int{},
+		CreatedAt:   batch.CreatedAt.Format("2006-01-02 15:04:05"),
+		Items:       make([]BatchItemView, 0, len(jobs)),
+	}
+	for _, job := range jobs {
+		view.Counts[job.Status]++
+		item := BatchItemView{
+			JobID:        job.ID,
+			ImageID:      job.ImageID,
+			Status:       job.Status,
+			Attempts:     job.Attempts,
+			ResultID:     job.ResultID,
+			ErrorCode:    job.ErrorCode,
+			ErrorMessage: job.ErrorMessage,
+		}
+		if job.ResultID != nil {
+			if r, ok := resultMap[*job.ResultID]; ok {
+				item.CropType = r.CropType
+				confidence := r.Confidence
+				item.Confidence = &confidence
+			}
+		}
+		view.Items = append(view.Items, item)
+	}
+	view.Status = batchStatus(batch, view.Counts)
+	return view, nil
+}
+
+func batchStatus(batch *model.RecognitionBatch, counts map[string]int) string {
+	switch {
+	case counts[model.JobQueued]+counts[model.JobRunning] > 0:
+		return "running"
+	case batch.CanceledAt != nil:
+		return "canceled"
+	case counts[model.JobFailed] == 0:
+		return "completed"
+	case counts[model.JobSucceeded] == 0:
+		return "failed"
+	}
+	return "partial"
+}
+
+// ResumeRecognitionBatch 将失败或已取消的项重新排队，按重新排队的数量再次预占次数，未用上的预占退回
+func (s *Service) ResumeRecognitionBatch(user *model.User, batch *model.RecognitionBatch) (int, error) {
+	pending, err := s.repo.CountBatchJobs(batch.ID, model.JobFailed, model.JobCanceled)
+	if err != nil || pending == 0 {
+		return 0, err
+	}
+	reservations, err := s.ReserveRecognitions(user, int(pending), "batch")
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]uint, 0, len(reservations))
+	for _, item := range reservations {
+		ids = append(ids, item.ID)
+	}
+	requeued, err := s.repo.RequeueBatchJobs(batch.ID, ids)
+	if err != nil {
+		requeued = 0
+	}
+	s.holdForJobs(reservations[:requeued])
+	for i := requeued; i < int64(len(reservations)); i++ {
+		s.ReleaseRecognition(&reservations[i], "not_requeued")
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.wakeJobWorker()
+	return int(requeued), nil
+}
+
+// CancelRecognitionBatch 取消尚未开始的项并退回次数，执行中的项继续完成
+func (s *Service) CancelRecognitionBatch(user *model.User, batch *model.RecognitionBatch) (int, error) {
+	canceled, err := s.repo.CancelBatchJobs(batch.ID)
+	if err != nil {
+		return 0, err
+	}
+	for i := range canceled {
+		s.settleJobQuota(&canceled[i], nil, QuotaReasonCanceled)
+	}
+	return len(canceled), nil
+}
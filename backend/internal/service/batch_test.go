@@ -0,0 +1,90 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitRecognitionBatchRejectsOtherUsersImages(t *testing.T) {
+	s := newTestService(t)
+	owner := createTestUser(t, s, 10)
+	other := createTestUser(t, s, 10)
+	mine := createTestImage(t, s, other.ID, contentHash([]byte("mine")))
+	theirs := createTestImage(t, s, owner.ID, contentHash([]byte("theirs")))
+
+	_, err := s.SubmitRecognitionBatch(context.Background(), other, BatchSubmit{ImageIDs: []uint{mine.ID, theirs.ID}})
+	if !errors.Is(err, ErrBatchNotFound) {
+		t.Fatalf("err = %v, want ErrBatchNotFound", err)
+	}
+
+	var stored model.User
+	if err := s.repo.DB().First(&stored, other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.QuotaUsed != 0 {
+		t.Errorf("quota used = %d, want 0 after rejected batch", stored.QuotaUsed)
+	}
+	var jobs int64
+	if err := s.repo.DB().Model(&model.RecognitionJob{}).Where("image_id = ?", theirs.ID).Count(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if jobs != 0 {
+		t.Errorf("created %d jobs for another user's image", jobs)
+	}
+
+	batch, err := s.SubmitRecognitionBatch(context.Background(), other, BatchSubmit{ImageIDs: []uint{mine.ID}})
+	if err != nil {
+		t.Fatalf("own image: %v", err)
+	}
+	if batch.Total != 1 || batch.UserID != other.ID {
+		t.Errorf("batch = %+v", batch)
+	}
+}
+
+func TestSubmitRecognitionBatchRequiresLogin(t *testing.T) {
+	s := &Service{}
+	if _, err := s.SubmitRecognitionBatch(context.Background(), nil, BatchSubmit{ImageIDs: []uint{1}}); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("err = %v, want ErrLoginRequired", err)
+	}
+}
+
+func TestClaimRecognitionJobRespectsBatchConcurrency(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 10)
+	batch := &model.RecognitionBatch{UserID: user.ID, Total: 4, Concurrency: 1}
+	var jobs []model.RecognitionJob
+	for i := 0; i < 4; i++ {
+		img := createTestImage(t, s, user.ID, contentHash([]byte(fmt.Sprint("claim-", i))))
+		jobs = append(jobs, model.RecognitionJob{UserID: user.ID, ImageID: img.ID, Status: model.JobQueued, MaxAttempts: 3, RunAfter: time.Now()})
+	}
+	if err := s.repo.CreateRecognitionBatch(batch, jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多个执行者同时领取，同批次最多只能有一个任务在执行
+	var wg sync.WaitGroup
+	var claimed atomic.Int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job, err := s.repo.ClaimRecognitionJob(fmt.Sprint("worker-", i), time.Minute)
+			if err != nil {
+				t.Errorf("claim: %v", err)
+			}
+			if job != nil {
+				claimed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Errorf("claimed %d jobs, want 1 with batch concurrency 1", claimed.Load())
+	}
+}
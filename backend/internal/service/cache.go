@@ -0,0 +1,159 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// contentHash 图片内容 sha256
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadImageData 读取图片内容，支持 data URL 与 http(s) 地址
+func loadImageData(ctx context.Context, imageURL string) ([]byte, error) {
+	if strings.HasPrefix(imageURL, "data:") {
+		comma := strings.Index(imageURL, ",")
+		if comma < 0 {
+			return nil, fmt.Errorf("malformed data url")
+		}
+		return base64.StdEncoding.DecodeString(imageURL[comma+1:])
+	}
+	_, data, err := llm.FetchImage(ctx, imageURL)
+	return data, err
+}
+
+// ensureContentHash data URL 图片没有哈希时解码后计算并回写；外部 URL 图片不下载，返回空哈希
+func (s *Service) ensureContentHash(ctx context.Context, img *model.Image) (string, error) {
+	if img.ContentHash != "" {
+		return img.ContentHash, nil
+	}
+	if !strings.HasPrefix(img.OriginalURL, "data:") {
+		return "", nil
+	}
+	data, err := loadImageData(ctx, img.OriginalURL)
+	if err != nil {
+		return "", err
+	}
+	hash := contentHash(data)
+	var fileSize int64
+	if img.FileSize == 0 {
+		fileSize = int64(len(data))
+		img.FileSize = fileSize
+	}
+	img.ContentHash = hash
+	if err := s.repo.WithContext(ctx).UpdateImageContentHash(img.ID, hash, fileSize); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// cacheProviders 本次请求可能产出结果的提供商
+func (s *Service) cacheProviders(provider llm.Provider, info llm.RouteInfo, ensemble ensembleConfig) []string {
+	if ensemble.Mode == EnsembleAlways {
+		return []string{ensembleProvider}
+	}
+	var providers []string
+	if router, ok := provider.(interface {
+		ResolveChain(info llm.RouteInfo) []string
+	}); ok {
+		providers = router.ResolveChain(info)
+	} else {
+		providers = []string{provider.Name()}
+	}
+	if ensemble.Mode == EnsembleLowConfidence {
+		providers = append(providers, ensembleProvider)
+	}
+	return providers
+}
+
+// lookupCachedResult 在有效期内查找同一图片内容、同一提供商/模型/提示词版本/模式/语言的结果，未命中返回 nil；
+// modelName 为空时按提供商当前配置的模型比较
+func (s *Service) lookupCachedResult(ctx context.Context, img *model.Image, mode, locale string, promptVersion int, providers []string, modelName string) *llm.RecognitionResult {
+	ttl := s.getSettingInt(settingCacheTTLMinutes, s.auth.RecognitionCacheTTLMinutes)
+	if ttl <= 0 {
+		return nil
+	}
+	hash, err := s.ensureContentHash(ctx, img)
+	if err != nil {
+		log.Printf("content hash for image %d failed: %v", img.ID, err)
+		return nil
+	}
+	if hash == "" {
+		// 外部 URL 图片没有内容哈希，为查缓存下载整张图片不划算
+		return nil
+	}
+	repo := s.repo.WithContext(ctx)
+	since := time.Now().Add(-time.Duration(ttl) * time.Minute)
+	items, err := repo.ListCachedResults(hash, mode, locale, promptVersion, providers, since, 10)
+	if err != nil {
+		log.Printf("recognition cache lookup failed: %v", err)
+		return nil
+	}
+	for _, item := range items {
+		if item.ImageID == img.ID {
+			continue
+		}
+		// 提供商切换了模型后旧结果不再复用
+		current := modelName
+		if current == "" {
+			current = llm.ProviderModel(item.Provider)
+		}
+		if current != "" && item.Model != "" && current != item.Model {
+			continue
+		}
+		return s.resultFromCache(item)
+	}
+	return nil
+}
+
+// resultFromCache 将缓存结果还原为提供商返回的结构，交由 SaveResult 落库
+func (s *Service) resultFromCache(item model.RecognitionResult) *llm.RecognitionResult {
+	cropType := item.CropTypeRaw
+	if cropType == "" {
+		cropType = item.CropType
+	}
+	out := &llm.RecognitionResult{
+		RawText:         item.RawText,
+		CropType:        cropType,
+		Confidence:      item.Confidence,
+		Description:     item.Description,
+		GrowthStage:     item.GrowthStage,
+		GrowthStageCode: item.GrowthStageCode,
+		PossibleIssue:   item.PossibleIssue,
+		Provider:        item.Provider,
+		Model:           item.Model,
+		PromptVersion:   item.PromptVersion,
+		Mode:            item.Mode,
+		Locale:          item.Locale,
+		CachedFrom:      item.ID,
+	}
+	if findings, err := s.repo.ListFindingsByResultIDs([]uint{item.ID}); err == nil {
+		for _, f := range findings {
+			out.Findings = append(out.Findings, llm.Finding{Category: f.Category, Name: f.Name, Confidence: f.Confidence})
+		}
+	}
+	if candidates, err := s.repo.ListCandidatesByResultIDs([]uint{item.ID}); err == nil {
+		for _, c := range candidates {
+			out.Candidates = append(out.Candidates, llm.Candidate{CropType: c.CropType, Confidence: c.Confidence})
+		}
+	}
+	return out
+}
+
+func cachedFromID(result *llm.RecognitionResult) *uint {
+	if result.CachedFrom == 0 {
+		return nil
+	}
+	id := result.CachedFrom
+	return &id
+}
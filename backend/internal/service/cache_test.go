@@ -0,0 +1,175 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestContentHash(t *testing.T) {
+	// sha256("abc")
+	if got := contentHash([]byte("abc")); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("contentHash = %s", got)
+	}
+}
+
+func TestLoadImageDataURL(t *testing.T) {
+	data, err := loadImageData(context.Background(), "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("png-bytes")))
+	if err != nil || string(data) != "png-bytes" {
+		t.Fatalf("loadImageData = %q, %v", data, err)
+	}
+	if _, err := loadImageData(context.Background(), "data:image/png;base64"); err == nil {
+		t.Error("malformed data url should fail")
+	}
+}
+
+// createCachedResult 写入一条可被缓存复用的原始识别结果
+func createCachedResult(t *testing.T, s *Service, imageID uint, provider, modelName string) *model.RecognitionResult {
+	t.Helper()
+	r := &model.RecognitionResult{
+		ImageID:     imageID,
+		Version:     1,
+		IsCurrent:   true,
+		CropType:    "wheat",
+		CropTypeRaw: "小麦",
+		Confidence:  0.9,
+		Provider:    provider,
+		Model:       modelName,
+		Mode:        "crop",
+		Locale:      "zh-CN",
+	}
+	if err := s.repo.DB().Create(r).Error; err != nil {
+		t.Fatalf("create result: %v", err)
+	}
+	return r
+}
+
+func TestLookupCachedResult(t *testing.T) {
+	s := newTestService(t)
+	s.auth.RecognitionCacheTTLMinutes = 60
+	ctx := context.Background()
+	user := createTestUser(t, s, 10)
+	hash := contentHash([]byte("same image"))
+
+	first := createTestImage(t, s, user.ID, hash)
+	source := createCachedResult(t, s, first.ID, "qwen", "qwen-vl-max")
+	if err := s.repo.DB().Create(&model.RecognitionCandidate{ResultID: source.ID, Rank: 1, CropType: "wheat", Confidence: 0.9}).Error; err != nil {
+		t.Fatal(err)
+	}
+	second := createTestImage(t, s, user.ID, hash)
+
+	hit := s.lookupCachedResult(ctx, second, "crop", "zh-CN", 0, []string{"qwen"}, "qwen-vl-max")
+	if hit == nil {
+		t.Fatal("expected cache hit for identical content")
+	}
+	if hit.CachedFrom != source.ID || hit.CropType != "小麦" || hit.Provider != "qwen" {
+		t.Errorf("hit = %+v", hit)
+	}
+	if len(hit.Candidates) != 1 || hit.Candidates[0].CropType != "wheat" {
+		t.Errorf("candidates = %+v", hit.Candidates)
+	}
+	if id := cachedFromID(hit); id == nil || *id != source.ID {
+		t.Errorf("cachedFromID = %v", id)
+	}
+
+	misses := []struct {
+		name          string
+		img           *model.Image
+		mode          string
+		locale        string
+		promptVersion int
+		provider      string
+		model         string
+	}{
+		{"own image", first, "crop", "zh-CN", 0, "qwen", "qwen-vl-max"},
+		{"other mode", second, "disease", "zh-CN", 0, "qwen", "qwen-vl-max"},
+		{"other locale", second, "crop", "en-US", 0, "qwen", "qwen-vl-max"},
+		{"other prompt version", second, "crop", "zh-CN", 3, "qwen", "qwen-vl-max"},
+		{"other provider", second, "crop", "zh-CN", 0, "baidu", ""},
+		{"model changed", second, "crop", "zh-CN", 0, "qwen", "qwen-vl-plus"},
+	}
+	for _, tc := range misses {
+		if hit := s.lookupCachedResult(ctx, tc.img, tc.mode, tc.locale, tc.promptVersion, []string{tc.provider}, tc.model); hit != nil {
+			t.Errorf("%s: expected cache miss, got result %d", tc.name, hit.CachedFrom)
+		}
+	}
+}
+
+func TestLookupCachedResultHonoursTTL(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	user := createTestUser(t, s, 10)
+	hash := contentHash([]byte("stale image"))
+	source := createCachedResult(t, s, createTestImage(t, s, user.ID, hash).ID, "qwen", "")
+	other := createTestImage(t, s, user.ID, hash)
+
+	s.auth.RecognitionCacheTTLMinutes = 0
+	if s.lookupCachedResult(ctx, other, "crop", "zh-CN", 0, []string{"qwen"}, "") != nil {
+		t.Error("TTL 0 should disable the cache")
+	}
+
+	s.auth.RecognitionCacheTTLMinutes = 60
+	old := time.Now().Add(-2 * time.Hour)
+	if err := s.repo.DB().Model(source).UpdateColumn("updated_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.lookupCachedResult(ctx, other, "crop", "zh-CN", 0, []string{"qwen"}, "") != nil {
+		t.Error("expired result should not be reused")
+	}
+}
+
+func TestLookupCachedResultSkipsCacheCopies(t *testing.T) {
+	s := newTestService(t)
+	s.auth.RecognitionCacheTTLMinutes = 60
+	user := createTestUser(t, s, 10)
+	hash := contentHash([]byte("copied image"))
+	copied := createCachedResult(t, s, createTestImage(t, s, user.ID, hash).ID, "qwen", "")
+	if err := s.repo.DB().Model(copied).UpdateColumn("cache_hit", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.lookupCachedResult(context.Background(), createTestImage(t, s, user.ID, hash), "crop", "zh-CN", 0, []string{"qwen"}, "") != nil {
+		t.Error("results produced by cache hits must not seed further hits")
+	}
+}
+
+func TestEnsureContentHashBackfillsImage(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 10)
+	img := &model.Image{UserID: user.ID, OriginalURL: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString([]byte("jpeg-bytes"))}
+	if err := s.repo.DB().Create(img).Error; err != nil {
+		t.Fatal(err)
+	}
+	hash, err := s.ensureContentHash(context.Background(), img)
+	if err != nil {
+		t.Fatalf("ensureContentHash: %v", err)
+	}
+	if hash != contentHash([]byte("jpeg-bytes")) || img.FileSize != int64(len("jpeg-bytes")) {
+		t.Errorf("hash %s size %d", hash, img.FileSize)
+	}
+	var stored model.Image
+	if err := s.repo.DB().First(&stored, img.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ContentHash != hash || stored.FileSize != img.FileSize {
+		t.Errorf("stored image = %+v", stored)
+	}
+}
+
+func TestEnsureContentHashSkipsRemoteImage(t *testing.T) {
+	s := newTestService(t)
+	s.auth.RecognitionCacheTTLMinutes = 60
+	user := createTestUser(t, s, 10)
+	img, err := s.CreateImageFromURL(context.Background(), user.ID, "http://127.0.0.1:1/never-fetched.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := s.ensureContentHash(context.Background(), img)
+	if err != nil || hash != "" {
+		t.Fatalf("ensureContentHash = %q, %v; want no download and empty hash", hash, err)
+	}
+	if s.lookupCachedResult(context.Background(), img, "crop", "zh-CN", 0, []string{"qwen"}, "") != nil {
+		t.Error("unhashed remote image should skip the cache")
+	}
+}
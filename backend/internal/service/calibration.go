@@ -0,0 +1,602 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 校准方法
+const (
+	CalibrationIsotonic    = "isotonic"
+	CalibrationTemperature = "temperature"
+)
+
+const (
+	calibrationDefaultDays       = 90
+	calibrationDefaultMinSamples = 30
+	reliabilityBinCount          = 10
+	wilsonZ                      = 1.96
+)
+
+var ErrInvalidCalibrationMethod = errors.New("invalid calibration method")
+
+// calibrationSample 单个校准样本
+type calibrationSample struct {
+	ResultID   uint
+	Provider   string
+	CropType   string
+	Confidence float64
+	Correct    bool
+}
+
+// isotonicPoint 保序回归的一个分段：X 为段内原始置信度均值，Y 为段内准确率
+type isotonicPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	N int64   `json:"n"`
+}
+
+type calibrationParams struct {
+	Points      []isotonicPoint `json:"points,omitempty"`
+	Temperature float64         `json:"temperature,omitempty"`
+}
+
+// ReliabilityBin 可靠性曲线的一个分箱
+type ReliabilityBin struct {
+	Lower          float64 `json:"lower"`
+	Upper          float64 `json:"upper"`
+	Count          int64   `json:"count"`
+	MeanRaw        float64 `json:"mean_raw"`
+	MeanCalibrated float64 `json:"mean_calibrated"`
+	Accuracy       float64 `json:"accuracy"`
+}
+
+// calibrator 已加载的校准映射
+type calibrator struct {
+	method string
+	params calibrationParams
+	bins   []ReliabilityBin
+}
+
+func (c *calibrator) apply(p float64) float64 {
+	p = clamp01(p)
+	switch c.method {
+	case CalibrationTemperature:
+		return temperatureScale(p, c.params.Temperature)
+	default:
+		return isotonicApply(c.params.Points, p)
+	}
+}
+
+// support 原始置信度所在分箱的样本数，用于估计区间宽度
+func (c *calibrator) support(p float64) int64 {
+	idx := binIndex(p)
+	if idx < len(c.bins) {
+		return c.bins[idx].Count
+	}
+	return 0
+}
+
+func clamp01(p float64) float64 {
+	if p < 0 {
+		return 0
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+func binIndex(p float64) int {
+	idx := int(clamp01(p) * reliabilityBinCount)
+	if idx >= reliabilityBinCount {
+		idx = reliabilityBinCount - 1
+	}
+	return idx
+}
+
+// fitIsotonic PAV 算法拟合单调不减的准确率曲线
+func fitIsotonic(samples []calibrationSample) []isotonicPoint {
+	sorted := append([]calibrationSample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Confidence < sorted[j].Confidence })
+	type block struct{ sumX, sumY, n float64 }
+	blocks := make([]block, 0, len(sorted))
+	for _, s := range sorted {
+		y := 0.0
+		if s.Correct {
+			y = 1
+		}
+		blocks = append(blocks, block{sumX: clamp01(s.Confidence), sumY: y, n: 1})
+		for len(blocks) > 1 {
+			last := blocks[len(blocks)-1]
+			prev := blocks[len(blocks)-2]
+			if prev.sumY/prev.n <= last.sumY/last.n {
+				break
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{sumX: prev.sumX + last.sumX, sumY: prev.sumY + last.sumY, n: prev.n + last.n})
+		}
+	}
+	points := make([]isotonicPoint, 0, len(blocks))
+	for _, b := range blocks {
+		points = append(points, isotonicPoint{X: b.sumX / b.n, Y: b.sumY / b.n, N: int64(b.n)})
+	}
+	return points
+}
+
+// isotonicApply 在分段点之间线性插值，两端取端点值
+func isotonicApply(points []isotonicPoint, p float64) float64 {
+	if len(points) == 0 {
+		return p
+	}
+	if p <= points[0].X {
+		return points[0].Y
+	}
+	last := points[len(points)-1]
+	if p >= last.X {
+		return last.Y
+	}
+	for i := 1; i < len(points); i++ {
+		if p <= points[i].X {
+			a, b := points[i-1], points[i]
+			if b.X == a.X {
+				return b.Y
+			}
+			return a.Y + (b.Y-a.Y)*(p-a.X)/(b.X-a.X)
+		}
+	}
+	return last.Y
+}
+
+func temperatureScale(p, t float64) float64 {
+	if t <= 0 {
+		return p
+	}
+	p = math.Min(math.Max(p, 1e-6), 1-1e-6)
+	logit := math.Log(p / (1 - p))
+	return 1 / (1 + math.Exp(-logit/t))
+}
+
+// fitTemperature 在对数空间用黄金分割搜索最小化负对数似然
+func fitTemperature(samples []calibrationSample) float64 {
+	nll := func(logT float64) float64 {
+		t := math.Exp(logT)
+		sum := 0.0
+		for _, s := range samples {
+			q := math.Min(math.Max(temperatureScale(s.Confidence, t), 1e-6), 1-1e-6)
+			if s.Correct {
+				sum -= math.Log(q)
+			} else {
+				sum -= math.Log(1 - q)
+			}
+		}
+		return sum
+	}
+	lo, hi := math.Log(0.05), math.Log(20)
+	ratio := (math.Sqrt(5) - 1) / 2
+	a := hi - ratio*(hi-lo)
+	b := lo + ratio*(hi-lo)
+	fa, fb := nll(a), nll(b)
+	for i := 0; i < 60; i++ {
+		if fa < fb {
+			hi, b, fb = b, a, fa
+			a = hi - ratio*(hi-lo)
+			fa = nll(a)
+		} else {
+			lo, a, fa = a, b, fb
+			b = lo + ratio*(hi-lo)
+			fb = nll(b)
+		}
+	}
+	return math.Exp((lo + hi) / 2)
+}
+
+// reliability 计算可靠性曲线、ECE 与 Brier 分数，apply 为空时校准值等于原始值
+func reliability(samples []calibrationSample, apply func(calibrationSample) float64) ([]ReliabilityBin, float64, float64, float64, float64) {
+	bins := make([]ReliabilityBin, reliabilityBinCount)
+	correct := make([]float64, reliabilityBinCount)
+	for i := range bins {
+		bins[i].Lower = float64(i) / reliabilityBinCount
+		bins[i].Upper = float64(i+1) / reliabilityBinCount
+	}
+	var brierRaw, brierCal float64
+	for _, s := range samples {
+		raw := clamp01(s.Confidence)
+		cal := raw
+		if apply != nil {
+			cal = clamp01(apply(s))
+		}
+		y := 0.0
+		if s.Correct {
+			y = 1
+		}
+		brierRaw += (raw - y) * (raw - y)
+		brierCal += (cal - y) * (cal - y)
+		idx := binIndex(raw)
+		bins[idx].Count++
+		bins[idx].MeanRaw += raw
+		bins[idx].MeanCalibrated += cal
+		correct[idx] += y
+	}
+	n := float64(len(samples))
+	var eceRaw, eceCal float64
+	for i := range bins {
+		if bins[i].Count == 0 {
+			continue
+		}
+		cnt := float64(bins[i].Count)
+		bins[i].MeanRaw /= cnt
+		bins[i].MeanCalibrated /= cnt
+		bins[i].Accuracy = correct[i] / cnt
+		eceRaw += cnt / n * math.Abs(bins[i].MeanRaw-bins[i].Accuracy)
+		eceCal += cnt / n * math.Abs(bins[i].MeanCalibrated-bins[i].Accuracy)
+	}
+	if n > 0 {
+		brierRaw /= n
+		brierCal /= n
+	}
+	return bins, eceRaw, eceCal, brierRaw, brierCal
+}
+
+// loadCalibrationSamples 合并反馈与审核通过的标注，同一结果以标注为准
+func (s *Service) loadCalibrationSamples(days int) ([]calibrationSample, error) {
+	if days <= 0 {
+		days = calibrationDefaultDays
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	feedback, err := s.repo.ListFeedbackCalibrationSamples(since)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := s.repo.ListLabelCalibrationSamples(since)
+	if err != nil {
+		return nil, err
+	}
+	matcher, _ := s.loadCropMatcher()
+	byResult := map[uint]calibrationSample{}
+	for _, row := range feedback {
+		if row.IsCorrect == nil {
+			continue
+		}
+		byResult[row.ResultID] = calibrationSample{ResultID: row.ResultID, Provider: row.Provider, CropType: row.CropType, Confidence: row.Confidence, Correct: *row.IsCorrect}
+	}
+	for _, row := range labels {
+		byResult[row.ResultID] = calibrationSample{
+			ResultID:   row.ResultID,
+			Provider:   row.Provider,
+			CropType:   row.CropType,
+			Confidence: row.Confidence,
+			Correct:    sameCrop(matcher, row.CropType, row.LabelCropType),
+		}
+	}
+	out := make([]calibrationSample, 0, len(byResult))
+	for _, sample := range byResult {
+		out = append(out, sample)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ResultID < out[j].ResultID })
+	return out, nil
+}
+
+// CalibrationRefitRequest 重新拟合参数
+type CalibrationRefitRequest struct {
+	Method     string `json:"method"`
+	Days       int    `json:"days"`
+	MinSamples int    `json:"min_samples"`
+	Reapply    bool   `json:"reapply"` // 是否用新映射重算已有结果的校准置信度
+}
+
+// CalibrationMapView 校准映射
+type CalibrationMapView struct {
+	ID          uint             `json:"id"`
+	Provider    string           `json:"provider"`
+	CropType    string           `json:"crop_type"`
+	Method      string           `json:"method"`
+	Temperature float64          `json:"temperature,omitempty"`
+	Points      []isotonicPoint  `json:"points,omitempty"`
+	Bins        []ReliabilityBin `json:"bins"`
+	Samples     int64            `json:"samples"`
+	ECEBefore   float64          `json:"ece_before"`
+	ECEAfter    float64          `json:"ece_after"`
+	BrierBefore float64          `json:"brier_before"`
+	BrierAfter  float64          `json:"brier_after"`
+	UpdatedAt   string           `json:"updated_at"`
+}
+
+// CalibrationRefitResult 拟合结果
+type CalibrationRefitResult struct {
+	Samples   int                  `json:"samples"`
+	Maps      []CalibrationMapView `json:"maps"`
+	Reapplied int64                `json:"reapplied"`
+}
+
+// RefitCalibration 按提供商及提供商×作物拟合校准映射，样本不足的作用域不生成映射
+func (s *Service) RefitCalibration(req CalibrationRefitRequest) (CalibrationRefitResult, error) {
+	method := strings.ToLower(strings.TrimSpace(req.Method))
+	if method == "" {
+		method = CalibrationIsotonic
+	}
+	if method != CalibrationIsotonic && method != CalibrationTemperature {
+		return CalibrationRefitResult{}, ErrInvalidCalibrationMethod
+	}
+	minSamples := req.MinSamples
+	if minSamples <= 0 {
+		minSamples = calibrationDefaultMinSamples
+	}
+	samples, err := s.loadCalibrationSamples(req.Days)
+	if err != nil {
+		return CalibrationRefitResult{}, err
+	}
+
+	groups := map[[2]string][]calibrationSample{}
+	for _, sample := range samples {
+		groups[[2]string{sample.Provider, ""}] = append(groups[[2]string{sample.Provider, ""}], sample)
+		groups[[2]string{sample.Provider, sample.CropType}] = append(groups[[2]string{sample.Provider, sample.CropType}], sample)
+	}
+	keys := make([][2]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] == keys[j][0] {
+			return keys[i][1] < keys[j][1]
+		}
+		return keys[i][0] < keys[j][0]
+	})
+
+	items := make([]model.CalibrationMap, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < minSamples {
+			continue
+		}
+		c := &calibrator{method: method}
+		if method == CalibrationTemperature {
+			c.params.Temperature = fitTemperature(group)
+		} else {
+			c.params.Points = fitIsotonic(group)
+		}
+		bins, eceRaw, eceCal, brierRaw, brierCal := reliability(group, func(sample calibrationSample) float64 {
+			return c.apply(sample.Confidence)
+		})
+		params, _ := json.Marshal(c.params)
+		binsJSON, _ := json.Marshal(bins)
+		items = append(items, model.CalibrationMap{
+			Provider:    key[0],
+			CropType:    key[1],
+			Method:      method,
+			Params:      string(params),
+			Bins:        string(binsJSON),
+			Samples:     int64(len(group)),
+			ECEBefore:   eceRaw,
+			ECEAfter:    eceCal,
+			BrierBefore: brierRaw,
+			BrierAfter:  brierCal,
+		})
+	}
+	if err := s.repo.ReplaceCalibrationMaps(items); err != nil {
+		return CalibrationRefitResult{}, err
+	}
+	s.invalidateCalibration()
+
+	out := CalibrationRefitResult{Samples: len(samples), Maps: make([]CalibrationMapView, 0, len(items))}
+	for _, item := range items {
+		out.Maps = append(out.Maps, toCalibrationMapView(item))
+	}
+	if req.Reapply {
+		n, err := s.reapplyCalibration()
+		if err != nil {
+			return out, err
+		}
+		out.Reapplied = n
+	}
+	return out, nil
+}
+
+func toCalibrationMapView(item model.CalibrationMap) CalibrationMapView {
+	var params calibrationParams
+	var bins []ReliabilityBin
+	_ = json.Unmarshal([]byte(item.Params), &params)
+	_ = json.Unmarshal([]byte(item.Bins), &bins)
+	return CalibrationMapView{
+		ID:          item.ID,
+		Provider:    item.Provider,
+		CropType:    item.CropType,
+		Method:      item.Method,
+		Temperature: params.Temperature,
+		Points:      params.Points,
+		Bins:        bins,
+		Samples:     item.Samples,
+		ECEBefore:   item.ECEBefore,
+		ECEAfter:    item.ECEAfter,
+		BrierBefore: item.BrierBefore,
+		BrierAfter:  item.BrierAfter,
+		UpdatedAt:   item.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// ListCalibrationMaps 当前生效的校准映射
+func (s *Service) ListCalibrationMaps(provider string) ([]CalibrationMapView, error) {
+	items, err := s.repo.ListCalibrationMaps(strings.TrimSpace(provider))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CalibrationMapView, 0, len(items))
+	for _, item := range items {
+		out = append(out, toCalibrationMapView(item))
+	}
+	return out, nil
+}
+
+// ReliabilityReport 可靠性曲线报告
+type ReliabilityReport struct {
+	Provider        string           `json:"provider"`
+	CropType        string           `json:"crop_type"`
+	Samples         int              `json:"samples"`
+	Bins            []ReliabilityBin `json:"bins"`
+	ECERaw          float64          `json:"ece_raw"`
+	ECECalibrated   float64          `json:"ece_calibrated"`
+	BrierRaw        float64          `json:"brier_raw"`
+	BrierCalibrated float64          `json:"brier_calibrated"`
+}
+
+// GetReliabilityReport 用当前映射在最近样本上计算原始与校准后的可靠性曲线
+func (s *Service) GetReliabilityReport(provider, cropType string, days int) (ReliabilityReport, error) {
+	provider = strings.TrimSpace(provider)
+	cropType = strings.TrimSpace(cropType)
+	samples, err := s.loadCalibrationSamples(days)
+	if err != nil {
+		return ReliabilityReport{}, err
+	}
+	filtered := make([]calibrationSample, 0, len(samples))
+	for _, sample := range samples {
+		if provider != "" && sample.Provider != provider {
+			continue
+		}
+		if cropType != "" && sample.CropType != cropType {
+			continue
+		}
+		filtered = append(filtered, sample)
+	}
+	// 每个样本按自己的提供商/作物取映射
+	bins, eceRaw, eceCal, brierRaw, brierCal := reliability(filtered, func(sample calibrationSample) float64 {
+		if c := s.calibratorFor(sample.Provider, sample.CropType); c != nil {
+			return c.apply(sample.Confidence)
+		}
+		return sample.Confidence
+	})
+	return ReliabilityReport{
+		Provider:        provider,
+		CropType:        cropType,
+		Samples:         len(filtered),
+		Bins:            bins,
+		ECERaw:          eceRaw,
+		ECECalibrated:   eceCal,
+		BrierRaw:        brierRaw,
+		BrierCalibrated: brierCal,
+	}, nil
+}
+
+// invalidateCalibration 拟合后清空内存中的映射缓存
+func (s *Service) invalidateCalibration() {
+	s.calibMu.Lock()
+	s.calibMaps = nil
+	s.calibMu.Unlock()
+}
+
+// calibratorFor 先取提供商×作物映射，没有时退回提供商级别映射
+func (s *Service) calibratorFor(provider, cropType string) *calibrator {
+	s.calibMu.RLock()
+	maps := s.calibMaps
+	s.calibMu.RUnlock()
+	if maps == nil {
+		items, err := s.repo.ListCalibrationMaps("")
+		if err != nil {
+			return nil
+		}
+		maps = make(map[string]*calibrator, len(items))
+		for _, item := range items {
+			c := &calibrator{method: item.Method}
+			_ = json.Unmarshal([]byte(item.Params), &c.params)
+			_ = json.Unmarshal([]byte(item.Bins), &c.bins)
+			maps[item.Provider+"|"+item.CropType] = c
+		}
+		s.calibMu.Lock()
+		s.calibMaps = maps
+		s.calibMu.Unlock()
+	}
+	if c, ok := maps[provider+"|"+cropType]; ok {
+		return c
+	}
+	return maps[provider+"|"]
+}
+
+// calibrate 返回校准后的置信度，没有可用映射时返回 nil
+func (s *Service) calibrate(provider, cropType string, confidence float64) *float64 {
+	c := s.calibratorFor(provider, cropType)
+	if c == nil {
+		return nil
+	}
+	v := c.apply(confidence)
+	return &v
+}
+
+// reapplyCalibration 用当前映射重算全部结果的校准置信度
+func (s *Service) reapplyCalibration() (int64, error) {
+	db := s.repo.DB()
+	var updated int64
+	var lastID uint
+	for {
+		var items []model.RecognitionResult
+		if err := db.Select("id", "provider", "crop_type", "confidence", "calibrated_confidence").
+			Where("id > ?", lastID).Order("id ASC").Limit(500).Find(&items).Error; err != nil {
+			return updated, err
+		}
+		if len(items) == 0 {
+			return updated, nil
+		}
+		for _, item := range items {
+			lastID = item.ID
+			cal := s.calibrate(item.Provider, item.CropType, item.Confidence)
+			if cal == nil && item.CalibratedConfidence == nil {
+				continue
+			}
+			if cal != nil && item.CalibratedConfidence != nil && *cal == *item.CalibratedConfidence {
+				continue
+			}
+			if err := db.Model(&model.RecognitionResult{}).Where("id = ?", item.ID).
+				Update("calibrated_confidence", cal).Error; err != nil {
+				return updated, fmt.Errorf("update result %d: %w", item.ID, err)
+			}
+			updated++
+		}
+	}
+}
+
+// ExplainConfidence 基于校准置信度给出区间与风险等级；有校准映射时区间取所在分箱样本量的 Wilson 区间
+func (s *Service) ExplainConfidence(r *model.RecognitionResult) (float64, float64, string, string) {
+	p := clamp01(r.Confidence)
+	var support int64
+	if r.CalibratedConfidence != nil {
+		p = clamp01(*r.CalibratedConfidence)
+		if c := s.calibratorFor(r.Provider, r.CropType); c != nil {
+			support = c.support(r.Confidence)
+		}
+	}
+
+	var low, high float64
+	if support >= 5 {
+		n := float64(support)
+		z2 := wilsonZ * wilsonZ
+		center := (p + z2/(2*n)) / (1 + z2/n)
+		half := wilsonZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+		low, high = center-half, center+half
+	} else {
+		// 未校准时样本量未知，按置信度给出经验区间
+		delta := 0.12
+		switch {
+		case p >= 0.9:
+			delta = 0.05
+		case p >= 0.75:
+			delta = 0.08
+		}
+		low, high = p-delta, p+delta
+	}
+	low, high = clamp01(low), clamp01(high)
+
+	riskLevel := "high"
+	riskNote := "不确定性较高，建议补拍清晰照片或手动标注。"
+	if p >= 0.85 {
+		riskLevel = "low"
+		riskNote = "可信度较高，可直接参考结果。"
+	} else if p >= 0.6 {
+		riskLevel = "medium"
+		riskNote = "存在一定不确定性，建议结合肉眼判断。"
+	}
+	return low, high, riskLevel, riskNote
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBinIndex(t *testing.T) {
+	cases := map[float64]int{-0.2: 0, 0: 0, 0.05: 0, 0.1: 1, 0.35: 3, 0.99: 9, 1: 9, 1.5: 9}
+	for p, want := range cases {
+		if got := binIndex(p); got != want {
+			t.Errorf("binIndex(%v) = %d, want %d", p, got, want)
+		}
+	}
+}
+
+func TestReliabilityBins(t *testing.T) {
+	samples := []calibrationSample{
+		{Confidence: 0.95, Correct: true},
+		{Confidence: 0.92, Correct: true},
+		{Confidence: 0.91, Correct: false},
+		{Confidence: 0.15, Correct: false},
+		{Confidence: 1.2, Correct: true}, // 越界按 1 计入最后一箱
+	}
+	bins, eceRaw, eceCal, brierRaw, brierCal := reliability(samples, nil)
+	if len(bins) != reliabilityBinCount {
+		t.Fatalf("got %d bins", len(bins))
+	}
+	if !approx(bins[9].Lower, 0.9) || !approx(bins[9].Upper, 1) {
+		t.Errorf("bin 9 bounds = [%v, %v)", bins[9].Lower, bins[9].Upper)
+	}
+	if bins[9].Count != 4 || bins[1].Count != 1 {
+		t.Fatalf("counts: bin9=%d bin1=%d", bins[9].Count, bins[1].Count)
+	}
+	if !approx(bins[9].MeanRaw, (0.95+0.92+0.91+1)/4) || !approx(bins[9].Accuracy, 0.75) {
+		t.Errorf("bin 9 = %+v", bins[9])
+	}
+	if bins[1].Accuracy != 0 || !approx(bins[1].MeanRaw, 0.15) {
+		t.Errorf("bin 1 = %+v", bins[1])
+	}
+	for i, b := range bins {
+		if i != 1 && i != 9 && b.Count != 0 {
+			t.Errorf("bin %d should be empty: %+v", i, b)
+		}
+	}
+	wantECE := 4.0/5*math.Abs(bins[9].MeanRaw-0.75) + 1.0/5*0.15
+	if !approx(eceRaw, wantECE) || !approx(eceCal, eceRaw) {
+		t.Errorf("ece raw %v cal %v, want %v", eceRaw, eceCal, wantECE)
+	}
+	wantBrier := (0.05*0.05 + 0.08*0.08 + 0.91*0.91 + 0.15*0.15 + 0) / 5
+	if !approx(brierRaw, wantBrier) || !approx(brierCal, brierRaw) {
+		t.Errorf("brier raw %v cal %v, want %v", brierRaw, brierCal, wantBrier)
+	}
+}
+
+func TestReliabilityCalibratedImprovesOverconfidence(t *testing.T) {
+	var samples []calibrationSample
+	for i := 0; i < 100; i++ {
+		samples = append(samples, calibrationSample{Confidence: 0.9, Correct: i < 60})
+	}
+	_, eceRaw, eceCal, _, _ := reliability(samples, func(calibrationSample) float64 { return 0.6 })
+	if !approx(eceRaw, 0.3) || !approx(eceCal, 0) {
+		t.Errorf("ece raw %v cal %v, want 0.3 and 0", eceRaw, eceCal)
+	}
+}
+
+func TestFitIsotonicMonotone(t *testing.T) {
+	samples := []calibrationSample{
+		{Confidence: 0.2, Correct: false},
+		{Confidence: 0.3, Correct: true},
+		{Confidence: 0.4, Correct: false}, // 与上一点违反单调，合并为一段
+		{Confidence: 0.8, Correct: true},
+		{Confidence: 0.9, Correct: true},
+	}
+	points := fitIsotonic(samples)
+	if len(points) != 4 {
+		t.Fatalf("points = %+v", points)
+	}
+	if !approx(points[1].X, 0.35) || !approx(points[1].Y, 0.5) || points[1].N != 2 {
+		t.Errorf("pooled point = %+v", points[1])
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].Y < points[i-1].Y {
+			t.Errorf("not monotone: %+v", points)
+		}
+	}
+	if got := isotonicApply(points, 0.1); got != 0 {
+		t.Errorf("below range = %v", got)
+	}
+	if got := isotonicApply(points, 0.95); got != 1 {
+		t.Errorf("above range = %v", got)
+	}
+	// 0.35 与 0.8 之间线性插值
+	if got := isotonicApply(points, 0.6); !approx(got, 0.5+0.5*(0.6-0.35)/(0.8-0.35)) {
+		t.Errorf("interpolated = %v", got)
+	}
+	if got := isotonicApply(nil, 0.42); got != 0.42 {
+		t.Errorf("empty map should be identity, got %v", got)
+	}
+}
+
+func TestFitTemperatureShrinksOverconfidence(t *testing.T) {
+	var samples []calibrationSample
+	for i := 0; i < 200; i++ {
+		samples = append(samples, calibrationSample{Confidence: 0.95, Correct: i%10 < 7})
+	}
+	temp := fitTemperature(samples)
+	if temp <= 1 {
+		t.Fatalf("temperature = %v, want > 1 for overconfident samples", temp)
+	}
+	if got := temperatureScale(0.95, temp); math.Abs(got-0.7) > 0.01 {
+		t.Errorf("scaled confidence = %v, want ~0.7", got)
+	}
+	if got := temperatureScale(0.8, 0); got != 0.8 {
+		t.Errorf("non-positive temperature should be identity, got %v", got)
+	}
+}
+
+func TestCalibratorForFallsBackToProviderMap(t *testing.T) {
+	providerMap := &calibrator{method: CalibrationTemperature, params: calibrationParams{Temperature: 2}}
+	cropMap := &calibrator{
+		method: CalibrationIsotonic,
+		params: calibrationParams{Points: []isotonicPoint{{X: 0.5, Y: 0.4}, {X: 0.9, Y: 0.8}}},
+		bins:   []ReliabilityBin{{Count: 3}, {}, {}, {}, {}, {}, {}, {}, {Count: 12}, {Count: 40}},
+	}
+	s := &Service{calibMaps: map[string]*calibrator{
+		"qwen|":      providerMap,
+		"qwen|wheat": cropMap,
+	}}
+	if c := s.calibratorFor("qwen", "wheat"); c != cropMap {
+		t.Error("expected provider×crop map")
+	}
+	if c := s.calibratorFor("qwen", "rice"); c != providerMap {
+		t.Error("expected provider-level fallback")
+	}
+	if c := s.calibratorFor("baidu", "wheat"); c != nil {
+		t.Error("expected no map for uncalibrated provider")
+	}
+	if v := s.calibrate("qwen", "wheat", 0.7); v == nil || !approx(*v, 0.6) {
+		t.Errorf("calibrate = %v, want 0.6", v)
+	}
+	if v := s.calibrate("baidu", "wheat", 0.7); v != nil {
+		t.Errorf("calibrate without map = %v, want nil", *v)
+	}
+	if n := cropMap.support(0.95); n != 40 {
+		t.Errorf("support(0.95) = %d", n)
+	}
+	if n := cropMap.support(0.85); n != 12 {
+		t.Errorf("support(0.85) = %d", n)
+	}
+}
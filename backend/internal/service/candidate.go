@@ -0,0 +1,68 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"sort"
+	"strings"
+)
+
+// maxCandidates 每个结果保存的候选数量上限
+const maxCandidates = 5
+
+// buildCandidates 以 CropType 为第一名，合并模型返回的候选并去重排序
+func buildCandidates(result *llm.RecognitionResult) []model.RecognitionCandidate {
+	items := make([]llm.Candidate, 0, len(result.Candidates))
+	for _, c := range result.Candidates {
+		c.CropType = strings.TrimSpace(c.CropType)
+		if c.CropType == "" || strings.EqualFold(c.CropType, result.CropType) {
+			continue
+		}
+		items = append(items, c)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Confidence > items[j].Confidence
+	})
+
+	out := make([]model.RecognitionCandidate, 0, maxCandidates)
+	seen := map[string]bool{}
+	add := func(cropType string, conf float64) {
+		key := strings.ToLower(cropType)
+		if cropType == "" || seen[key] || len(out) >= maxCandidates {
+			return
+		}
+		seen[key] = true
+		out = append(out, model.RecognitionCandidate{Rank: len(out) + 1, CropType: cropType, Confidence: conf})
+	}
+	add(result.CropType, result.Confidence)
+	for _, c := range items {
+		add(c.CropType, c.Confidence)
+	}
+	return out
+}
+
+// GetCandidatesMap 批量加载结果的候选
+func (s *Service) GetCandidatesMap(resultIDs []uint) (map[uint][]model.RecognitionCandidate, error) {
+	items, err := s.repo.ListCandidatesByResultIDs(resultIDs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint][]model.RecognitionCandidate, len(resultIDs))
+	for _, item := range items {
+		out[item.ResultID] = append(out[item.ResultID], item)
+	}
+	return out, nil
+}
+
+// inTopK 标注作物是否出现在前 k 个候选中
+func inTopK(m *cropMatcher, candidates []model.RecognitionCandidate, label string, k int) bool {
+	for _, c := range candidates {
+		if c.Rank > k {
+			break
+		}
+		if sameCrop(m, c.CropType, label) {
+			return true
+		}
+	}
+	return false
+}
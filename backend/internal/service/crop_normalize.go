@@ -0,0 +1,448 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 归一化匹配方式
+const (
+	cropMatchExact    = "exact"
+	cropMatchContains = "contains"
+	cropMatchFuzzy    = "fuzzy"
+)
+
+// cropMatcher 基于作物目录 Code/Name/Aliases 的归一化匹配器
+type cropMatcher struct {
+	keys map[string]string // 归一化 key -> Crop.Code
+}
+
+// newCropMatcher 用启用的作物构建匹配器，别名以逗号分隔，可包含英文名与拼音
+func newCropMatcher(crops []model.Crop) *cropMatcher {
+	m := &cropMatcher{keys: map[string]string{}}
+	for _, c := range crops {
+		code := strings.TrimSpace(c.Code)
+		if code == "" {
+			continue
+		}
+		names := append([]string{code, c.Name}, splitAliases(c.Aliases)...)
+		for _, name := range names {
+			if key := normalizeCropKey(name); key != "" {
+				m.keys[key] = code
+			}
+		}
+	}
+	return m
+}
+
+func splitAliases(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '，' || r == ';' || r == '；' || r == '、' || r == '|'
+	})
+}
+
+// pinyinTones 带声调的拼音字母还原为不带声调形式
+var pinyinTones = map[rune]rune{
+	'ā': 'a', 'á': 'a', 'ǎ': 'a', 'à': 'a',
+	'ē': 'e', 'é': 'e', 'ě': 'e', 'è': 'e',
+	'ī': 'i', 'í': 'i', 'ǐ': 'i', 'ì': 'i',
+	'ō': 'o', 'ó': 'o', 'ǒ': 'o', 'ò': 'o',
+	'ū': 'u', 'ú': 'u', 'ǔ': 'u', 'ù': 'u',
+	'ǖ': 'v', 'ǘ': 'v', 'ǚ': 'v', 'ǜ': 'v', 'ü': 'v',
+}
+
+// cropNameSuffixes 对匹配无意义的通用后缀
+var cropNameSuffixes = []string{"plants", "plant", "crops", "crop", "seedlings", "seedling", "植株", "作物", "植物", "幼苗", "苗"}
+
+// normalizeCropKey 小写、去声调、去空白与标点，并去掉通用后缀，如 "Xiǎo Mài" -> "xiaomai"
+func normalizeCropKey(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(raw)) {
+		if plain, ok := pinyinTones[r]; ok {
+			r = plain
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	key := b.String()
+	for _, suffix := range cropNameSuffixes {
+		if trimmed := strings.TrimSuffix(key, suffix); trimmed != key && trimmed != "" {
+			return trimmed
+		}
+	}
+	return key
+}
+
+// Match 依次尝试精确匹配、单词/子串包含与编辑距离，返回作物代码与匹配方式
+func (m *cropMatcher) Match(raw string) (string, string, bool) {
+	key := normalizeCropKey(raw)
+	if key == "" {
+		return "", "", false
+	}
+	if code, ok := m.keys[key]; ok {
+		return code, cropMatchExact, true
+	}
+	// 英文复数
+	if strings.HasSuffix(key, "es") {
+		if code, ok := m.keys[strings.TrimSuffix(key, "es")]; ok {
+			return code, cropMatchExact, true
+		}
+	}
+	if strings.HasSuffix(key, "s") {
+		if code, ok := m.keys[strings.TrimSuffix(key, "s")]; ok {
+			return code, cropMatchExact, true
+		}
+	}
+
+	// "common wheat" 取中心词，英文中心词通常在最后
+	words := strings.Fields(strings.ToLower(raw))
+	for i := len(words) - 1; i >= 0 && len(words) > 1; i-- {
+		if code, ok := m.keys[normalizeCropKey(words[i])]; ok {
+			return code, cropMatchContains, true
+		}
+	}
+	// "冬小麦" 包含中文名或别名，取最长的命中
+	bestLen := 0
+	bestCode := ""
+	for alias, code := range m.keys {
+		n := len([]rune(alias))
+		if n < 2 || !hasHan(alias) || !strings.Contains(key, alias) {
+			continue
+		}
+		if n > bestLen {
+			bestLen, bestCode = n, code
+		}
+	}
+	if bestCode != "" {
+		return bestCode, cropMatchContains, true
+	}
+
+	maxDist := fuzzyDistance(key)
+	if maxDist == 0 {
+		return "", "", false
+	}
+	best := maxDist + 1
+	bestCode = ""
+	ambiguous := false
+	for alias, code := range m.keys {
+		d := levenshtein(key, alias)
+		switch {
+		case d < best:
+			best, bestCode, ambiguous = d, code, false
+		case d == best && code != bestCode:
+			ambiguous = true
+		}
+	}
+	if bestCode == "" || ambiguous {
+		return "", "", false
+	}
+	return bestCode, cropMatchFuzzy, true
+}
+
+// fuzzyDistance 允许的编辑距离，短词和中文不做模糊匹配以免误判
+func fuzzyDistance(key string) int {
+	if hasHan(key) {
+		return 0
+	}
+	n := len([]rune(key))
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 5:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func hasHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// loadCropMatcher 读取启用的作物目录构建匹配器
+func (s *Service) loadCropMatcher() (*cropMatcher, error) {
+	crops, err := s.repo.GetCrops(true)
+	if err != nil {
+		return nil, err
+	}
+	return newCropMatcher(crops), nil
+}
+
+// isUnknownCropValue 提供商表示无法识别的取值，不进入审核队列
+func isUnknownCropValue(raw string) bool {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	return v == "" || v == "unknown" || v == "none" || v == "null" || v == "未知"
+}
+
+// canonicalCropType 归一化为作物代码，未匹配时返回去空白的原始值
+func canonicalCropType(m *cropMatcher, raw string) (string, bool) {
+	trimmed := strings.TrimSpace(raw)
+	if m != nil {
+		if code, _, ok := m.Match(trimmed); ok {
+			return code, true
+		}
+	}
+	return trimmed, false
+}
+
+// flagUnknownCrop 将未匹配的作物名记入审核队列
+func (s *Service) flagUnknownCrop(raw, source string, resultID *uint) {
+	raw = strings.TrimSpace(raw)
+	if isUnknownCropValue(raw) {
+		return
+	}
+	if runes := []rune(raw); len(runes) > 128 {
+		raw = string(runes[:128])
+	}
+	if err := s.repo.RecordUnknownCrop(raw, source, resultID); err != nil {
+		log.Printf("record unknown crop %q failed: %v", raw, err)
+	}
+}
+
+// normalizeLabelCrop 归一化人工标注的作物，返回写入 label_crop_type 的值与原始值
+func (s *Service) normalizeLabelCrop(raw string, resultID *uint) (string, string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ""
+	}
+	matcher, err := s.loadCropMatcher()
+	if err != nil {
+		return raw, raw
+	}
+	code, ok := canonicalCropType(matcher, raw)
+	if !ok {
+		s.flagUnknownCrop(raw, "label", resultID)
+	}
+	return code, raw
+}
+
+// sameCrop 评测时比较两个作物名是否指向同一作物
+func sameCrop(m *cropMatcher, a, b string) bool {
+	if a == b {
+		return true
+	}
+	if m == nil {
+		return false
+	}
+	ca, _, okA := m.Match(a)
+	cb, _, okB := m.Match(b)
+	return okA && okB && ca == cb
+}
+
+// ListUnknownCrops 未归一化作物的审核队列
+func (s *Service) ListUnknownCrops(status string, limit, offset int) ([]model.UnknownCrop, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.ListUnknownCrops(strings.TrimSpace(status), limit, offset)
+}
+
+var ErrUnknownCropResolved = errors.New("unknown crop already reviewed")
+
+// ResolveUnknownCrop 审核未知作物：code 非空时映射到该作物并改写历史数据，addAlias 时同时追加为别名；code 为空时忽略
+func (s *Service) ResolveUnknownCrop(id uint, code string, addAlias bool, reviewer string) (int64, error) {
+	item, err := s.repo.GetUnknownCropByID(id)
+	if err != nil {
+		return 0, err
+	}
+	if item.Status != "pending" {
+		return 0, ErrUnknownCropResolved
+	}
+	if strings.TrimSpace(reviewer) == "" {
+		reviewer = "admin"
+	}
+	now := time.Now()
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return 0, s.repo.UpdateUnknownCrop(id, map[string]interface{}{
+			"status":      "ignored",
+			"reviewed_by": reviewer,
+			"reviewed_at": &now,
+		})
+	}
+
+	crops, err := s.repo.GetCrops(true)
+	if err != nil {
+		return 0, err
+	}
+	found := false
+	for _, c := range crops {
+		if c.Code == code {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("crop %s not found", code)
+	}
+	if addAlias {
+		if err := s.repo.AppendCropAlias(code, item.RawValue); err != nil {
+			return 0, err
+		}
+	}
+	affected, err := s.repo.RemapCropType(item.RawValue, code)
+	if err != nil {
+		return 0, err
+	}
+	return affected, s.repo.UpdateUnknownCrop(id, map[string]interface{}{
+		"status":      "mapped",
+		"mapped_code": code,
+		"reviewed_by": reviewer,
+		"reviewed_at": &now,
+	})
+}
+
+// CropBackfillStats 作物归一化回填统计
+type CropBackfillStats struct {
+	Results        int64 `json:"results"`
+	ResultsChanged int64 `json:"results_changed"`
+	Labels         int64 `json:"labels"`
+	LabelsChanged  int64 `json:"labels_changed"`
+	Unknown        int64 `json:"unknown"`
+}
+
+// BackfillCropNormalization 一次性回填已有结果、候选、手记与标注的作物代码，dryRun 时只统计不写入
+func (s *Service) BackfillCropNormalization(dryRun bool) (CropBackfillStats, error) {
+	var stats CropBackfillStats
+	m, err := s.loadCropMatcher()
+	if err != nil {
+		return stats, err
+	}
+	db := s.repo.DB()
+	unknown := map[string]bool{}
+	const batch = 500
+
+	var lastID uint
+	for {
+		var results []model.RecognitionResult
+		if err := db.Where("id > ?", lastID).Order("id ASC").Limit(batch).Find(&results).Error; err != nil {
+			return stats, err
+		}
+		if len(results) == 0 {
+			break
+		}
+		for _, r := range results {
+			lastID = r.ID
+			stats.Results++
+			raw := r.CropTypeRaw
+			if raw == "" {
+				raw = r.CropType
+			}
+			code, _, ok := m.Match(raw)
+			if !ok {
+				if !isUnknownCropValue(raw) && !unknown[raw] {
+					unknown[raw] = true
+					if !dryRun {
+						id := r.ID
+						s.flagUnknownCrop(raw, "result", &id)
+					}
+				}
+				code = r.CropType
+			}
+			if code == r.CropType && r.CropTypeRaw != "" {
+				continue
+			}
+			stats.ResultsChanged++
+			if dryRun {
+				continue
+			}
+			if err := db.Model(&model.RecognitionResult{}).Where("id = ?", r.ID).
+				Updates(map[string]interface{}{"crop_type": code, "crop_type_raw": raw}).Error; err != nil {
+				return stats, err
+			}
+			if err := db.Model(&model.FieldNote{}).Where("result_id = ? AND crop_type = ?", r.ID, r.CropType).
+				Update("crop_type", code).Error; err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	var candidateTypes []string
+	if err := db.Model(&model.RecognitionCandidate{}).Distinct("crop_type").Pluck("crop_type", &candidateTypes).Error; err != nil {
+		return stats, err
+	}
+	for _, cropType := range candidateTypes {
+		code, _, ok := m.Match(cropType)
+		if !ok || code == cropType || dryRun {
+			continue
+		}
+		if err := db.Model(&model.RecognitionCandidate{}).Where("crop_type = ?", cropType).
+			Update("crop_type", code).Error; err != nil {
+			return stats, err
+		}
+	}
+
+	lastID = 0
+	for {
+		var notes []model.FieldNote
+		if err := db.Where("id > ? AND label_crop_type <> ''", lastID).Order("id ASC").Limit(batch).Find(&notes).Error; err != nil {
+			return stats, err
+		}
+		if len(notes) == 0 {
+			break
+		}
+		for _, n := range notes {
+			lastID = n.ID
+			stats.Labels++
+			raw := n.LabelCropTypeRaw
+			if raw == "" {
+				raw = n.LabelCropType
+			}
+			code, _, ok := m.Match(raw)
+			if !ok {
+				if !isUnknownCropValue(raw) && !unknown[raw] {
+					unknown[raw] = true
+					if !dryRun {
+						s.flagUnknownCrop(raw, "label", n.ResultID)
+					}
+				}
+				code = n.LabelCropType
+			}
+			if code == n.LabelCropType && n.LabelCropTypeRaw != "" {
+				continue
+			}
+			stats.LabelsChanged++
+			if dryRun {
+				continue
+			}
+			if err := db.Model(&model.FieldNote{}).Where("id = ?", n.ID).
+				Updates(map[string]interface{}{"label_crop_type": code, "label_crop_type_raw": raw}).Error; err != nil {
+				return stats, err
+			}
+		}
+	}
+	stats.Unknown = int64(len(unknown))
+	return stats, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"testing"
+)
+
+func testCropMatcher() *cropMatcher {
+	return newCropMatcher([]model.Crop{
+		{Code: "corn", Name: "玉米", Aliases: "玉米,苞米,玉蜀黍,yumi,maize,zea mays", Active: true},
+		{Code: "wheat", Name: "小麦", Aliases: "小麦,麦子,xiaomai,common wheat,bread wheat,triticum aestivum", Active: true},
+		{Code: "rice", Name: "水稻", Aliases: "稻,稻谷,大米,shuidao,paddy,oryza sativa", Active: true},
+		{Code: "soybean", Name: "大豆", Aliases: "黄豆；dadou|soya、soy", Active: true},
+		{Code: "tomato", Name: "番茄", Aliases: "西红柿,fanqie,xihongshi,solanum lycopersicum", Active: true},
+		{Code: "", Name: "无代码", Aliases: "ignored"},
+	})
+}
+
+func TestNormalizeCropKey(t *testing.T) {
+	cases := map[string]string{
+		"  Wheat ":    "wheat",
+		"Xiǎo Mài":    "xiaomai",
+		"Zea mays":    "zeamays",
+		"Corn Plants": "corn",
+		"玉米 幼苗":       "玉米",
+		"番茄植株":        "番茄",
+		"plant":       "plant",
+		"Lǜ dòu":      "lvdou",
+		"wheat (冬小麦)": "wheat冬小麦",
+		"!!!":         "",
+	}
+	for in, want := range cases {
+		if got := normalizeCropKey(in); got != want {
+			t.Errorf("normalizeCropKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCropMatcherMatch(t *testing.T) {
+	m := testCropMatcher()
+	cases := []struct {
+		raw   string
+		code  string
+		how   string
+		found bool
+	}{
+		{"Wheat", "wheat", cropMatchExact, true},
+		{"小麦", "wheat", cropMatchExact, true},
+		{"Xiǎo Mài", "wheat", cropMatchExact, true},
+		{"Triticum aestivum", "wheat", cropMatchExact, true},
+		{"Corn plants", "corn", cropMatchExact, true},
+		{"玉米苗", "corn", cropMatchExact, true},
+		{"tomatoes", "tomato", cropMatchExact, true},
+		{"soybeans", "soybean", cropMatchExact, true},
+		{"soya", "soybean", cropMatchExact, true},
+		{"winter wheat", "wheat", cropMatchContains, true},
+		{"冬小麦", "wheat", cropMatchContains, true},
+		{"杂交水稻", "rice", cropMatchContains, true},
+		{"tomatto", "tomato", cropMatchFuzzy, true},
+		{"xihongshl", "tomato", cropMatchFuzzy, true},
+		{"rica", "", "", false},
+		{"sorghum", "", "", false},
+		{"高粱", "", "", false},
+		{"ignored", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tc := range cases {
+		code, how, ok := m.Match(tc.raw)
+		if code != tc.code || how != tc.how || ok != tc.found {
+			t.Errorf("Match(%q) = (%q, %q, %v), want (%q, %q, %v)", tc.raw, code, how, ok, tc.code, tc.how, tc.found)
+		}
+	}
+}
+
+func TestCropMatcherRejectsAmbiguousFuzzyMatch(t *testing.T) {
+	m := newCropMatcher([]model.Crop{
+		{Code: "barley", Name: "大麦", Aliases: "barleyx"},
+		{Code: "other", Name: "其他", Aliases: "barleyz"},
+	})
+	if code, _, ok := m.Match("barleyy"); ok {
+		t.Fatalf("ambiguous fuzzy match resolved to %q", code)
+	}
+}
+
+func TestCanonicalCropType(t *testing.T) {
+	m := testCropMatcher()
+	if code, ok := canonicalCropType(m, " maize "); code != "corn" || !ok {
+		t.Errorf("canonicalCropType(maize) = %q, %v", code, ok)
+	}
+	if code, ok := canonicalCropType(m, " 高粱 "); code != "高粱" || ok {
+		t.Errorf("canonicalCropType(高粱) = %q, %v", code, ok)
+	}
+	if code, ok := canonicalCropType(nil, " wheat "); code != "wheat" || ok {
+		t.Errorf("canonicalCropType(nil) = %q, %v", code, ok)
+	}
+}
+
+func TestSameCrop(t *testing.T) {
+	m := testCropMatcher()
+	if !sameCrop(m, "玉米", "Maize") {
+		t.Error("玉米 and Maize should be the same crop")
+	}
+	if sameCrop(m, "玉米", "wheat") {
+		t.Error("玉米 and wheat should differ")
+	}
+	if sameCrop(m, "高粱", "sorghum") {
+		t.Error("unmatched names should not compare equal")
+	}
+	if !sameCrop(nil, "高粱", "高粱") {
+		t.Error("identical raw names should compare equal")
+	}
+}
+
+func TestIsUnknownCropValue(t *testing.T) {
+	for _, v := range []string{"", " Unknown ", "none", "NULL", "未知"} {
+		if !isUnknownCropValue(v) {
+			t.Errorf("isUnknownCropValue(%q) = false", v)
+		}
+	}
+	if isUnknownCropValue("wheat") {
+		t.Error("isUnknownCropValue(wheat) = true")
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 多提供商投票触发方式
+const (
+	EnsembleOff           = "off"
+	EnsembleAlways        = "always"
+	EnsembleLowConfidence = "low_confidence"
+)
+
+// ensembleProvider 投票结果记录的提供商名称
+const ensembleProvider = "ensemble"
+
+var ErrEnsembleFailed = errors.New("ensemble: all providers failed")
+
+// ensembleConfig 套餐的投票配置
+type ensembleConfig struct {
+	Mode      string
+	Members   []llm.EnsembleMember
+	Threshold float64
+}
+
+// normalizeEnsembleMode 空值视为 off
+func normalizeEnsembleMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return EnsembleOff, nil
+	case EnsembleOff, EnsembleAlways, EnsembleLowConfidence:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid ensemble_mode")
+}
+
+// parseEnsembleProviders 解析成员配置并要求提供商已注册
+func parseEnsembleProviders(raw string) ([]llm.EnsembleMember, error) {
+	members, err := llm.ParseEnsembleMembers(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if _, err := llm.GetProvider(m.Provider); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// ensembleSettings 读取套餐投票配置，成员少于 2 个时视为关闭
+func (s *Service) ensembleSettings(plan string) ensembleConfig {
+	view, err := s.getPlanSettingView(plan)
+	if err != nil {
+		return ensembleConfig{Mode: EnsembleOff}
+	}
+	mode, err := normalizeEnsembleMode(view.EnsembleMode)
+	if err != nil || mode == EnsembleOff {
+		return ensembleConfig{Mode: EnsembleOff}
+	}
+	members, err := parseEnsembleProviders(view.EnsembleProviders)
+	if err != nil || len(members) < 2 {
+		return ensembleConfig{Mode: EnsembleOff}
+	}
+	return ensembleConfig{Mode: mode, Members: members, Threshold: view.EnsembleThreshold}
+}
+
+// recognizeEnsemble 并行调用成员并按权重投票；first 为已拿到的单提供商结果，作为其提供商的一票复用
+func (s *Service) recognizeEnsemble(ctx context.Context, req llm.Request, cfg ensembleConfig, first *llm.RecognitionResult) (*llm.RecognitionResult, error) {
+	members := make([]llm.EnsembleMember, 0, len(cfg.Members))
+	var votes []llm.Vote
+	if first != nil {
+		weight := 1.0
+		for _, m := range cfg.Members {
+			if m.Provider == first.Provider {
+				weight = m.Weight
+			}
+		}
+		votes = append(votes, llm.Vote{Provider: first.Provider, Weight: weight, Result: first})
+	}
+	for _, m := range cfg.Members {
+		if first != nil && m.Provider == first.Provider {
+			continue
+		}
+		members = append(members, m)
+	}
+	votes = append(votes, llm.Ensemble(ctx, s.llm, req, members)...)
+
+	matcher, _ := s.loadCropMatcher()
+	return combineVotes(matcher, votes)
+}
+
+// combineVotes 加权投票：每票得分为 权重×置信度，最终置信度为胜出作物得分占成功作答总权重的比例，
+// 因此提供商之间的分歧会直接拉低置信度
+func combineVotes(matcher *cropMatcher, votes []llm.Vote) (*llm.RecognitionResult, error) {
+	scores := map[string]float64{}
+	var order []string
+	var totalWeight float64
+	var errs []string
+	var providers []string
+	for _, v := range votes {
+		if v.Result == nil {
+			errs = append(errs, v.Provider+": "+v.Error)
+			continue
+		}
+		crop, _ := canonicalCropType(matcher, v.Result.CropType)
+		if _, ok := scores[crop]; !ok {
+			order = append(order, crop)
+		}
+		scores[crop] += v.Weight * v.Result.Confidence
+		totalWeight += v.Weight
+		providers = append(providers, v.Provider)
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEnsembleFailed, strings.Join(errs, "; "))
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	winner := order[0]
+
+	// 取胜出作物中加权得分最高的作答作为描述、生育期与病虫害结论的来源
+	var base *llm.Vote
+	for i := range votes {
+		v := &votes[i]
+		if v.Result == nil {
+			continue
+		}
+		if crop, _ := canonicalCropType(matcher, v.Result.CropType); crop != winner {
+			continue
+		}
+		if base == nil || v.Weight*v.Result.Confidence > base.Weight*base.Result.Confidence {
+			base = v
+		}
+	}
+
+	// crop_type 保留原始值，由 SaveResult 统一归一化并记录 crop_type_raw
+	out := *base.Result
+	out.Confidence = scores[winner] / totalWeight
+	out.Provider = ensembleProvider
+	out.Model = strings.Join(providers, "+")
+	out.Candidates = make([]llm.Candidate, 0, len(order))
+	for _, crop := range order {
+		out.Candidates = append(out.Candidates, llm.Candidate{CropType: crop, Confidence: scores[crop] / totalWeight})
+	}
+	out.Votes = votes
+	return &out, nil
+}
+
+// buildEnsembleVotes 投票明细落库，作物按目录归一化并标记是否与最终结论一致
+func buildEnsembleVotes(matcher *cropMatcher, result *llm.RecognitionResult) []model.EnsembleVote {
+	out := make([]model.EnsembleVote, 0, len(result.Votes))
+	for _, v := range result.Votes {
+		item := model.EnsembleVote{
+			Provider:   v.Provider,
+			Weight:     v.Weight,
+			Error:      v.Error,
+			DurationMs: v.DurationMs,
+		}
+		if v.Result != nil {
+			item.CropTypeRaw = strings.TrimSpace(v.Result.CropType)
+			item.CropType, _ = canonicalCropType(matcher, item.CropTypeRaw)
+			item.Confidence = v.Result.Confidence
+			item.RawText = v.Result.RawText
+			item.Agreed = sameCrop(matcher, item.CropType, result.CropType)
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// GetEnsembleVotesMap 批量加载结果的投票明细
+func (s *Service) GetEnsembleVotesMap(resultIDs []uint) (map[uint][]model.EnsembleVote, error) {
+	items, err := s.repo.ListEnsembleVotesByResultIDs(resultIDs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint][]model.EnsembleVote, len(resultIDs))
+	for _, item := range items {
+		out[item.ResultID] = append(out[item.ResultID], item)
+	}
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// vote 构造一张成功的作答，描述记为提供商名便于断言取用了哪一票
+func vote(provider string, weight float64, crop string, confidence float64) llm.Vote {
+	return llm.Vote{
+		Provider: provider,
+		Weight:   weight,
+		Result:   &llm.RecognitionResult{CropType: crop, Confidence: confidence, Description: provider},
+	}
+}
+
+func TestCombineVotesSingleVoter(t *testing.T) {
+	out, err := combineVotes(testCropMatcher(), []llm.Vote{vote("qwen", 2, "wheat", 0.8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 单票时置信度等于该票的置信度，与权重无关
+	if out.CropType != "wheat" || !approx(out.Confidence, 0.8) || out.Provider != ensembleProvider || out.Model != "qwen" {
+		t.Errorf("out = %+v", out)
+	}
+	if len(out.Candidates) != 1 || len(out.Votes) != 1 {
+		t.Errorf("candidates %v votes %v", out.Candidates, out.Votes)
+	}
+}
+
+func TestCombineVotesWeightedWinner(t *testing.T) {
+	out, err := combineVotes(testCropMatcher(), []llm.Vote{
+		vote("qwen", 1, "rice", 0.9),
+		vote("openai", 2, "wheat", 0.7),
+		vote("baidu", 1, "wheat", 0.6),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wheat = 2×0.7 + 1×0.6 = 2.0，rice = 0.9，总权重 4
+	if out.CropType != "wheat" || !approx(out.Confidence, 0.5) {
+		t.Errorf("winner %s confidence %v", out.CropType, out.Confidence)
+	}
+	// 描述取胜出作物中加权得分最高的作答
+	if out.Description != "openai" {
+		t.Errorf("base vote = %s, want openai", out.Description)
+	}
+	if len(out.Candidates) != 2 || out.Candidates[1].CropType != "rice" || !approx(out.Candidates[1].Confidence, 0.225) {
+		t.Errorf("candidates = %+v", out.Candidates)
+	}
+}
+
+func TestCombineVotesTieKeepsFirstAnswer(t *testing.T) {
+	out, err := combineVotes(testCropMatcher(), []llm.Vote{
+		vote("qwen", 1, "rice", 0.8),
+		vote("openai", 1, "wheat", 0.8),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.CropType != "rice" || !approx(out.Confidence, 0.4) {
+		t.Errorf("tie winner %s confidence %v, want rice 0.4", out.CropType, out.Confidence)
+	}
+	if out.Candidates[0].CropType != "rice" || out.Candidates[1].CropType != "wheat" {
+		t.Errorf("candidates = %+v", out.Candidates)
+	}
+}
+
+func TestCombineVotesMergesNormalizedNames(t *testing.T) {
+	out, err := combineVotes(testCropMatcher(), []llm.Vote{
+		vote("qwen", 1, "小麦", 0.6),
+		vote("openai", 1, "Wheat", 0.7),
+		vote("baidu", 1, "corn", 0.9),
+		vote("mock", 1, "麦子", 0.5),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 小麦/Wheat/麦子 归一化为同一作物：1.8 对 0.9
+	if len(out.Candidates) != 2 || out.Candidates[0].CropType != "wheat" || !approx(out.Confidence, 0.45) {
+		t.Errorf("confidence %v candidates %+v", out.Confidence, out.Candidates)
+	}
+	// 结果保留胜出作答的原始作物名，由 SaveResult 归一化
+	if out.CropType != "Wheat" {
+		t.Errorf("crop_type = %q, want raw value of the base vote", out.CropType)
+	}
+}
+
+func TestCombineVotesSkipsFailedVoters(t *testing.T) {
+	out, err := combineVotes(testCropMatcher(), []llm.Vote{
+		{Provider: "openai", Weight: 5, Error: "timeout"},
+		vote("qwen", 1, "rice", 0.9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 失败成员不计入总权重
+	if out.CropType != "rice" || !approx(out.Confidence, 0.9) || out.Model != "qwen" || len(out.Votes) != 2 {
+		t.Errorf("out = %+v", out)
+	}
+}
+
+func TestCombineVotesAllFailed(t *testing.T) {
+	_, err := combineVotes(testCropMatcher(), []llm.Vote{
+		{Provider: "openai", Weight: 1, Error: "timeout"},
+		{Provider: "qwen", Weight: 1, Error: "rate limited"},
+	})
+	if !errors.Is(err, ErrEnsembleFailed) {
+		t.Fatalf("err = %v, want ErrEnsembleFailed", err)
+	}
+	if !strings.Contains(err.Error(), "openai: timeout") || !strings.Contains(err.Error(), "qwen: rate limited") {
+		t.Errorf("err = %v, want per-provider reasons", err)
+	}
+	if _, err := combineVotes(testCropMatcher(), nil); !errors.Is(err, ErrEnsembleFailed) {
+		t.Errorf("no votes err = %v", err)
+	}
+}
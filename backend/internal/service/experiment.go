@@ -0,0 +1,300 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrExperimentState   = errors.New("experiment status does not allow this action")
+	ErrExperimentRunning = repository.ErrExperimentRunning
+)
+
+const (
+	defaultLowConfidence = 0.5
+	experimentZ          = 1.96 // 95% 置信水平
+)
+
+// ExperimentArmInput 创建实验时的分组参数
+type ExperimentArmInput struct {
+	Name          string
+	Provider      string
+	Model         string
+	PromptVersion int
+	Weight        int
+}
+
+// ExperimentCreate 创建实验的参数，Unit 为空时按用户分组
+type ExperimentCreate struct {
+	Name        string
+	Description string
+	Unit        string
+	Arms        []ExperimentArmInput
+}
+
+// ExperimentArmReport 实验组指标，区间为 95% 置信区间：比例用 Wilson 区间，均值用正态近似
+type ExperimentArmReport struct {
+	ArmID              uint       `json:"arm_id"`
+	Name               string     `json:"name"`
+	Provider           string     `json:"provider"`
+	Model              string     `json:"model"`
+	PromptVersion      int        `json:"prompt_version"`
+	Weight             int        `json:"weight"`
+	Results            int64      `json:"results"`
+	CacheHits          int64      `json:"cache_hits"`
+	FeedbackTotal      int64      `json:"feedback_total"`
+	FeedbackCorrect    int64      `json:"feedback_correct"`
+	FeedbackAccuracy   float64    `json:"feedback_accuracy"`
+	FeedbackAccuracyCI [2]float64 `json:"feedback_accuracy_ci"`
+	LowConfidence      int64      `json:"low_confidence"`
+	LowConfidenceRate  float64    `json:"low_confidence_rate"`
+	LowConfidenceCI    [2]float64 `json:"low_confidence_ci"`
+	Calls              int64      `json:"calls"` // 实际调用提供商的结果数，延迟与费用按此统计
+	AvgDurationMs      float64    `json:"avg_duration_ms"`
+	AvgDurationCI      [2]float64 `json:"avg_duration_ci"`
+	AvgCost            float64    `json:"avg_cost"`
+	AvgCostCI          [2]float64 `json:"avg_cost_ci"`
+	TotalCost          float64    `json:"total_cost"`
+}
+
+// ExperimentReport 实验各组对比
+type ExperimentReport struct {
+	Experiment             model.Experiment      `json:"experiment"`
+	ConfidenceLevel        float64               `json:"confidence_level"`
+	LowConfidenceThreshold float64               `json:"low_confidence_threshold"`
+	Arms                   []ExperimentArmReport `json:"arms"`
+}
+
+// CreateExperiment 创建草稿实验，至少两个分组，组名不可重复
+func (s *Service) CreateExperiment(req ExperimentCreate) (*model.Experiment, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name required")
+	}
+	unit := strings.TrimSpace(req.Unit)
+	if unit == "" {
+		unit = model.ExperimentUnitUser
+	}
+	if unit != model.ExperimentUnitUser && unit != model.ExperimentUnitDevice {
+		return nil, fmt.Errorf("invalid unit: %s", unit)
+	}
+	if len(req.Arms) < 2 {
+		return nil, errors.New("at least two arms required")
+	}
+	seen := map[string]bool{}
+	arms := make([]model.ExperimentArm, 0, len(req.Arms))
+	for _, in := range req.Arms {
+		arm := model.ExperimentArm{
+			Name:          strings.TrimSpace(in.Name),
+			Provider:      strings.TrimSpace(in.Provider),
+			Model:         strings.TrimSpace(in.Model),
+			PromptVersion: in.PromptVersion,
+			Weight:        in.Weight,
+		}
+		if arm.Name == "" || seen[arm.Name] {
+			return nil, fmt.Errorf("arm name empty or duplicated: %q", arm.Name)
+		}
+		seen[arm.Name] = true
+		if arm.Provider != "" {
+			if _, err := llm.GetProvider(arm.Provider); err != nil {
+				return nil, err
+			}
+		} else if arm.Model != "" {
+			return nil, fmt.Errorf("arm %s: model requires provider", arm.Name)
+		}
+		if arm.PromptVersion < 0 {
+			return nil, fmt.Errorf("arm %s: invalid prompt version", arm.Name)
+		}
+		if arm.Weight <= 0 {
+			arm.Weight = 1
+		}
+		arms = append(arms, arm)
+	}
+	exp := &model.Experiment{
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		Status:      model.ExperimentDraft,
+		Unit:        unit,
+		Salt:        newLockToken()[:16],
+		Arms:        arms,
+	}
+	if err := s.repo.CreateExperiment(exp); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+func (s *Service) GetExperiment(id uint) (*model.Experiment, error) {
+	return s.repo.GetExperiment(id)
+}
+
+func (s *Service) ListExperiments(status string, limit, offset int) ([]model.Experiment, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListExperiments(strings.TrimSpace(status), limit, offset)
+}
+
+// StartExperiment 草稿实验开始分流，同一时间只允许一个实验运行
+func (s *Service) StartExperiment(id uint) (*model.Experiment, error) {
+	ok, err := s.repo.StartExperiment(id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrExperimentState
+	}
+	return s.repo.GetExperiment(id)
+}
+
+// StopExperiment 停止分流，已记录的结果保留用于对比；停止后不可重新启动
+func (s *Service) StopExperiment(id uint) (*model.Experiment, error) {
+	now := time.Now()
+	ok, err := s.repo.TransitionExperiment(id, []string{model.ExperimentDraft, model.ExperimentRunning}, map[string]interface{}{
+		"status":     model.ExperimentStopped,
+		"stopped_at": &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrExperimentState
+	}
+	return s.repo.GetExperiment(id)
+}
+
+// assignArm 按运行中的实验为本次识别分组，无实验或无法确定分组单位时返回 nil
+func (s *Service) assignArm(user *model.User, deviceID string) (*model.Experiment, *model.ExperimentArm) {
+	exp, err := s.repo.GetRunningExperiment()
+	if err != nil {
+		log.Printf("load running experiment failed: %v", err)
+		return nil, nil
+	}
+	if exp == nil || len(exp.Arms) == 0 {
+		return nil, nil
+	}
+	key := experimentUnitKey(exp.Unit, user, strings.TrimSpace(deviceID))
+	if key == "" {
+		return nil, nil
+	}
+	return exp, pickArm(exp, key)
+}
+
+// experimentUnitKey 分组单位：按用户分组时登录用户用用户 ID，匿名与游客用设备 ID；都没有时退回另一种
+func experimentUnitKey(unit string, user *model.User, deviceID string) string {
+	hasUser := user != nil && user.ID > 0
+	switch {
+	case unit == model.ExperimentUnitUser && hasUser && !isGuestUser(user):
+		return fmt.Sprintf("user:%d", user.ID)
+	case deviceID != "":
+		return "device:" + deviceID
+	case hasUser:
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	return ""
+}
+
+// pickArm 对 盐+分组单位 做 FNV 哈希后按权重落组，同一用户或设备在实验期间始终落在同一组
+func pickArm(exp *model.Experiment, key string) *model.ExperimentArm {
+	var total uint64
+	for _, arm := range exp.Arms {
+		total += uint64(max(arm.Weight, 1))
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(exp.Salt + "|" + key))
+	point := h.Sum64() % total
+	for i := range exp.Arms {
+		weight := uint64(max(exp.Arms[i].Weight, 1))
+		if point < weight {
+			return &exp.Arms[i]
+		}
+		point -= weight
+	}
+	return &exp.Arms[len(exp.Arms)-1]
+}
+
+// GetExperimentReport 各组的反馈准确率、低置信度比例、延迟与单次费用及置信区间；start/end 为空时统计全部
+func (s *Service) GetExperimentReport(id uint, start, end *time.Time) (*ExperimentReport, error) {
+	exp, err := s.repo.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.ExperimentArmStats(id, start, end, defaultLowConfidence)
+	if err != nil {
+		return nil, err
+	}
+	report := &ExperimentReport{
+		Experiment:             *exp,
+		ConfidenceLevel:        0.95,
+		LowConfidenceThreshold: defaultLowConfidence,
+		Arms:                   make([]ExperimentArmReport, 0, len(exp.Arms)),
+	}
+	for _, arm := range exp.Arms {
+		item := ExperimentArmReport{
+			ArmID:         arm.ID,
+			Name:          arm.Name,
+			Provider:      arm.Provider,
+			Model:         arm.Model,
+			PromptVersion: arm.PromptVersion,
+			Weight:        arm.Weight,
+		}
+		if st, ok := stats[arm.ID]; ok {
+			item.Results = st.Results
+			item.CacheHits = st.CacheHits
+			item.FeedbackTotal = st.FeedbackTotal
+			item.FeedbackCorrect = st.FeedbackCorrect
+			item.FeedbackAccuracy, item.FeedbackAccuracyCI = wilsonInterval(st.FeedbackCorrect, st.FeedbackTotal)
+			item.LowConfidence = st.LowConfidence
+			item.LowConfidenceRate, item.LowConfidenceCI = wilsonInterval(st.LowConfidence, st.Results)
+			item.Calls = st.Calls
+			item.AvgDurationMs = st.AvgDurationMs
+			item.AvgDurationCI = meanInterval(st.AvgDurationMs, st.StdDurationMs, st.Calls)
+			item.AvgCost = st.AvgCost
+			item.AvgCostCI = meanInterval(st.AvgCost, st.StdCost, st.Calls)
+			item.TotalCost = st.TotalCost
+		}
+		report.Arms = append(report.Arms, item)
+	}
+	return report, nil
+}
+
+// wilsonInterval 比例及其 Wilson 区间，样本少或比例接近 0/1 时比正态近似稳健
+func wilsonInterval(success, total int64) (float64, [2]float64) {
+	if total <= 0 {
+		return 0, [2]float64{}
+	}
+	n := float64(total)
+	p := float64(success) / n
+	z2 := experimentZ * experimentZ
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	half := experimentZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+	return p, [2]float64{math.Max(0, center-half), math.Min(1, center+half)}
+}
+
+// meanInterval 均值的正态近似区间，少于两个样本时区间退化为均值本身
+func meanInterval(mean, std float64, n int64) [2]float64 {
+	if n < 2 {
+		return [2]float64{mean, mean}
+	}
+	half := experimentZ * std / math.Sqrt(float64(n))
+	return [2]float64{math.Max(0, mean-half), mean + half}
+}
+
+// optionalID 0 表示未设置
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func testExperiment(salt string, weights ...int) *model.Experiment {
+	exp := &model.Experiment{Salt: salt}
+	for i, w := range weights {
+		exp.Arms = append(exp.Arms, model.ExperimentArm{Name: fmt.Sprint("arm", i), Weight: w})
+	}
+	return exp
+}
+
+func TestPickArmIsStable(t *testing.T) {
+	exp := testExperiment("salt-a", 1, 1, 1)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		first := pickArm(exp, key).Name
+		for j := 0; j < 3; j++ {
+			if got := pickArm(testExperiment("salt-a", 1, 1, 1), key).Name; got != first {
+				t.Fatalf("%s: arm %s then %s for the same key and salt", key, first, got)
+			}
+		}
+	}
+
+	// 换盐后重新分组，至少有一部分单位换组
+	moved := 0
+	other := testExperiment("salt-b", 1, 1, 1)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("device:%d", i)
+		if pickArm(exp, key).Name != pickArm(other, key).Name {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Error("changing the salt did not reshuffle any unit")
+	}
+}
+
+func TestPickArmFollowsWeights(t *testing.T) {
+	cases := []struct {
+		name    string
+		weights []int
+		want    []float64
+	}{
+		{"even split", []int{1, 1}, []float64{0.5, 0.5}},
+		{"one to three", []int{1, 3}, []float64{0.25, 0.75}},
+		{"three arms", []int{2, 1, 1}, []float64{0.5, 0.25, 0.25}},
+		{"zero weight counts as one", []int{0, 1}, []float64{0.5, 0.5}},
+		{"single arm", []int{5}, []float64{1}},
+	}
+	const n = 20000
+	for _, tc := range cases {
+		exp := testExperiment("split-"+tc.name, tc.weights...)
+		counts := make(map[string]int)
+		for i := 0; i < n; i++ {
+			counts[pickArm(exp, fmt.Sprintf("user:%d", i)).Name]++
+		}
+		for i, want := range tc.want {
+			got := float64(counts[fmt.Sprint("arm", i)]) / n
+			if math.Abs(got-want) > 0.02 {
+				t.Errorf("%s: arm%d share = %.3f, want about %.2f", tc.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	cases := []struct {
+		name           string
+		success, total int64
+		rate           float64
+		low, high      float64
+	}{
+		{"no samples", 0, 0, 0, 0, 0},
+		{"none of ten", 0, 10, 0, 0, 0.2775},
+		{"all of ten", 10, 10, 1, 0.7225, 1},
+		{"half of hundred", 50, 100, 0.5, 0.4038, 0.5962},
+		{"eight of ten", 8, 10, 0.8, 0.4902, 0.9433},
+	}
+	for _, tc := range cases {
+		rate, ci := wilsonInterval(tc.success, tc.total)
+		if !approx(rate, tc.rate) || math.Abs(ci[0]-tc.low) > 1e-4 || math.Abs(ci[1]-tc.high) > 1e-4 {
+			t.Errorf("%s: rate %.4f ci [%.4f, %.4f], want %.4f [%.4f, %.4f]", tc.name, rate, ci[0], ci[1], tc.rate, tc.low, tc.high)
+		}
+		if ci[0] > rate || ci[1] < rate {
+			t.Errorf("%s: interval [%.4f, %.4f] excludes the rate %.4f", tc.name, ci[0], ci[1], rate)
+		}
+	}
+}
+
+func TestMeanInterval(t *testing.T) {
+	if ci := meanInterval(120, 30, 1); ci != [2]float64{120, 120} {
+		t.Errorf("single sample = %v", ci)
+	}
+	// 1.96 × 30 / √36 = 9.8
+	if ci := meanInterval(120, 30, 36); math.Abs(ci[0]-110.2) > 1e-9 || math.Abs(ci[1]-129.8) > 1e-9 {
+		t.Errorf("ci = %v, want [110.2, 129.8]", ci)
+	}
+	if ci := meanInterval(1, 30, 36); ci[0] != 0 {
+		t.Errorf("lower bound = %v, want clamped to 0", ci[0])
+	}
+}
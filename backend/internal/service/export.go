@@ -12,7 +12,7 @@ import (
 
 // ExportNotesCSV 导出手记为 CSV
 func (s *Service) ExportNotesCSV(w io.Writer, userID uint, limit, offset int, category, cropType string, startDate, endDate *time.Time, fields string) error {
-	notes, err := s.GetNotes(userID, limit, offset, category, cropType, startDate, endDate)
+	notes, err := s.GetNotes(userID, limit, offset, category, cropType, startDate, endDate, false)
 	if err != nil {
 		return err
 	}
@@ -36,6 +36,10 @@ func (s *Service) ExportNotesCSV(w io.Writer, userID uint, limit, offset int, ca
 		if n.GrowthStage != nil {
 			growth = *n.GrowthStage
 		}
+		stageCode := ""
+		if n.GrowthStageCode != nil {
+			stageCode = *n.GrowthStageCode
+		}
 		issue := ""
 		if n.PossibleIssue != nil {
 			issue = *n.PossibleIssue
@@ -63,6 +67,7 @@ func (s *Service) ExportNotesCSV(w io.Writer, userID uint, limit, offset int, ca
 			"confidence":     strconv.FormatFloat(n.Confidence, 'f', 4, 64),
 			"description":    n.Description,
 			"growth_stage":   growth,
+			"growth_stage_code": stageCode,
 			"possible_issue": issue,
 			"provider":       n.Provider,
 			"note":           n.Note,
@@ -90,7 +95,7 @@ func (s *Service) ExportNotesCSV(w io.Writer, userID uint, limit, offset int, ca
 
 // ExportNotesJSON 导出手记为 JSON
 func (s *Service) ExportNotesJSON(w io.Writer, userID uint, limit, offset int, category, cropType string, startDate, endDate *time.Time, fields string) error {
-	notes, err := s.GetNotes(userID, limit, offset, category, cropType, startDate, endDate)
+	notes, err := s.GetNotes(userID, limit, offset, category, cropType, startDate, endDate, false)
 	if err != nil {
 		return err
 	}
@@ -111,6 +116,10 @@ func (s *Service) ExportNotesJSON(w io.Writer, userID uint, limit, offset int, c
 		if n.GrowthStage != nil {
 			growth = *n.GrowthStage
 		}
+		var stageCode any
+		if n.GrowthStageCode != nil {
+			stageCode = *n.GrowthStageCode
+		}
 		var issue any
 		if n.PossibleIssue != nil {
 			issue = *n.PossibleIssue
@@ -136,6 +145,7 @@ func (s *Service) ExportNotesJSON(w io.Writer, userID uint, limit, offset int, c
 			"confidence":     n.Confidence,
 			"description":    n.Description,
 			"growth_stage":   growth,
+			"growth_stage_code": stageCode,
 			"possible_issue": issue,
 			"provider":       n.Provider,
 			"note":           n.Note,
@@ -174,6 +184,7 @@ func parseFields(fields string) []string {
 		"confidence",
 		"description",
 		"growth_stage",
+		"growth_stage_code",
 		"possible_issue",
 		"provider",
 		"note",
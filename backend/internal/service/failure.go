@@ -1,8 +1,8 @@
 package service
 
 import (
+	"agri-scan/internal/llm"
 	"agri-scan/internal/model"
-	"agri-scan/internal/repository"
 	"strings"
 	"time"
 )
@@ -21,8 +21,13 @@ func (s *Service) RecordFailure(userID uint, imageID *uint, provider, stage stri
 		return
 	}
 	code, msg := classifyFailure(err)
-	if provider == "" && s.llm != nil {
-		provider = s.llm.Name()
+	if provider == "" {
+		provider = llm.ErrorProvider(err)
+	}
+	if provider == "" {
+		if current := s.defaultLLM(); current != nil {
+			provider = current.Name()
+		}
 	}
 	now := time.Now()
 	item := &model.RecognitionFailure{
@@ -64,27 +69,23 @@ func (s *Service) ListFailureTop(days, limit int, stage string) ([]FailureTopVie
 	return out, nil
 }
 
+// classifyFailure 识别失败取 llm 类型化错误的错误码，上传/存储类失败按错误描述归类
 func classifyFailure(err error) (string, string) {
 	msg := strings.TrimSpace(err.Error())
 	lower := strings.ToLower(msg)
-	code := "unknown"
-	switch {
-	case strings.Contains(lower, "invalid_request") || strings.Contains(lower, "invalid_parameter"):
-		code = "invalid_request"
-	case strings.Contains(lower, "download") && strings.Contains(lower, "image"):
-		code = "download_failed"
-	case strings.Contains(lower, "timeout"):
-		code = "timeout"
-	case strings.Contains(lower, "unauthorized") || strings.Contains(lower, "401"):
-		code = "unauthorized"
-	case strings.Contains(lower, "storage not configured"):
-		code = "storage_not_configured"
-	case strings.Contains(lower, "failed to upload"):
-		code = "upload_failed"
-	case strings.Contains(lower, "failed to decode base64"):
-		code = "invalid_base64"
-	case strings.Contains(lower, "no image file"):
-		code = "missing_file"
+	code := llm.ErrorCode(err)
+	if code == "" {
+		code = "unknown"
+		switch {
+		case strings.Contains(lower, "storage not configured"):
+			code = "storage_not_configured"
+		case strings.Contains(lower, "failed to upload"):
+			code = "upload_failed"
+		case strings.Contains(lower, "failed to decode base64"):
+			code = "invalid_base64"
+		case strings.Contains(lower, "no image file"):
+			code = "missing_file"
+		}
 	}
 	if len(msg) > 400 {
 		msg = msg[:400]
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrIdempotencyMismatch   = errors.New("idempotency key was used with a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+const idempotencyPurgeInterval = time.Hour
+
+// IdempotencyBegin 幂等键占用结果：Replay 不为空时直接返回保存的响应，否则执行请求后调用 Complete 或 Release
+type IdempotencyBegin struct {
+	ID     uint
+	Replay *model.IdempotencyKey
+}
+
+// BeginIdempotent 占用请求方的幂等键；同一键对应不同接口或请求体时返回 ErrIdempotencyMismatch，首次请求尚未结束时返回 ErrIdempotencyInProgress
+func (s *Service) BeginIdempotent(scope, key, route, requestHash string) (IdempotencyBegin, error) {
+	now := time.Now()
+	ttl := time.Duration(max(s.auth.IdempotencyTTLHours, 1)) * time.Hour
+	item := &model.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Route:       route,
+		RequestHash: requestHash,
+		Status:      model.IdempotencyProcessing,
+		ExpiresAt:   now.Add(ttl),
+	}
+	// 处理中超过识别总时限仍未更新的记录视为请求方所在实例已失联
+	staleBefore := now.Add(-time.Duration(max(s.auth.RecognizeTimeoutSeconds, 60))*time.Second - time.Minute)
+	existing, acquired, err := s.repo.AcquireIdempotencyKey(item, staleBefore)
+	if err != nil {
+		return IdempotencyBegin{}, err
+	}
+	if acquired {
+		return IdempotencyBegin{ID: existing.ID}, nil
+	}
+	if existing.Route != route || existing.RequestHash != requestHash {
+		return IdempotencyBegin{}, ErrIdempotencyMismatch
+	}
+	if existing.Status != model.IdempotencyCompleted {
+		return IdempotencyBegin{}, ErrIdempotencyInProgress
+	}
+	return IdempotencyBegin{ID: existing.ID, Replay: existing}, nil
+}
+
+// CompleteIdempotent 保存首次响应，之后相同请求直接返回
+func (s *Service) CompleteIdempotent(id uint, status int, contentType string, body []byte) {
+	if err := s.repo.CompleteIdempotencyKey(id, status, contentType, string(body)); err != nil {
+		log.Printf("complete idempotency key %d failed: %v", id, err)
+	}
+}
+
+// ReleaseIdempotent 释放幂等键，客户端可用同一键重试
+func (s *Service) ReleaseIdempotent(id uint) {
+	if err := s.repo.DeleteIdempotencyKey(id); err != nil {
+		log.Printf("release idempotency key %d failed: %v", id, err)
+	}
+}
+
+// StartIdempotencyJanitor 定期删除过期的幂等键
+func (s *Service) StartIdempotencyJanitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(idempotencyPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.repo.PurgeExpiredIdempotencyKeys(time.Now()); err != nil {
+				log.Printf("purge idempotency keys failed: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d expired idempotency keys", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBeginIdempotentReplayAndConflict(t *testing.T) {
+	s := newTestService(t)
+	const scope, key, route = "user:1", "key-1", "/api/v1/recognize"
+
+	first, err := s.BeginIdempotent(scope, key, route, "hash-a")
+	if err != nil || first.ID == 0 || first.Replay != nil {
+		t.Fatalf("first begin = %+v, %v", first, err)
+	}
+	if _, err := s.BeginIdempotent(scope, key, route, "hash-a"); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Errorf("concurrent begin = %v, want in progress", err)
+	}
+	if _, err := s.BeginIdempotent(scope, key, route, "hash-b"); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("other body = %v, want mismatch", err)
+	}
+	if _, err := s.BeginIdempotent(scope, key, "/api/v1/upload", "hash-a"); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("other route = %v, want mismatch", err)
+	}
+
+	s.CompleteIdempotent(first.ID, 201, "application/json", []byte(`{"id":7}`))
+	replay, err := s.BeginIdempotent(scope, key, route, "hash-a")
+	if err != nil || replay.Replay == nil {
+		t.Fatalf("replay begin = %+v, %v", replay, err)
+	}
+	if replay.Replay.ResponseStatus != 201 || replay.Replay.ResponseType != "application/json" || replay.Replay.ResponseBody != `{"id":7}` {
+		t.Errorf("replayed response = %+v", replay.Replay)
+	}
+	if _, err := s.BeginIdempotent(scope, key, route, "hash-b"); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("other body after completion = %v, want mismatch", err)
+	}
+
+	// 幂等键按请求方隔离
+	other, err := s.BeginIdempotent("user:2", key, route, "hash-b")
+	if err != nil || other.Replay != nil || other.ID == first.ID {
+		t.Errorf("other scope = %+v, %v", other, err)
+	}
+}
+
+func TestReleaseIdempotentAllowsRetry(t *testing.T) {
+	s := newTestService(t)
+	first, err := s.BeginIdempotent("user:1", "key-1", "/r", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ReleaseIdempotent(first.ID)
+	retry, err := s.BeginIdempotent("user:1", "key-1", "/r", "hash-changed")
+	if err != nil || retry.Replay != nil || retry.ID == 0 {
+		t.Fatalf("retry after release = %+v, %v", retry, err)
+	}
+}
+
+func TestBeginIdempotentTakesOverStaleOrExpiredKeys(t *testing.T) {
+	s := newTestService(t)
+	db := s.repo.DB()
+
+	stale, err := s.BeginIdempotent("user:1", "stale", "/r", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&model.IdempotencyKey{}).Where("id = ?", stale.ID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.BeginIdempotent("user:1", "stale", "/r", "hash")
+	if err != nil || got.Replay != nil || got.ID == stale.ID {
+		t.Errorf("stale processing key = %+v, %v; want a fresh acquisition", got, err)
+	}
+
+	done, err := s.BeginIdempotent("user:1", "expired", "/r", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CompleteIdempotent(done.ID, 200, "application/json", []byte(`{}`))
+	if err := db.Model(&model.IdempotencyKey{}).Where("id = ?", done.ID).UpdateColumn("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.BeginIdempotent("user:1", "expired", "/r", "other-hash")
+	if err != nil || got.Replay != nil {
+		t.Errorf("expired key = %+v, %v; want a fresh acquisition", got, err)
+	}
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+)
+
+// imageMaxPixels 超过该像素数的图片不做压缩，避免解码占用过多内存
+const imageMaxPixels = 50_000_000
+
+// imageVariants 上传图片的派生版本；Display 为空表示原图已足够小，展示图沿用原图
+type imageVariants struct {
+	Width   int
+	Height  int
+	Display []byte
+	Thumb   []byte
+}
+
+// buildImageVariants 解码图片（按 EXIF 方向摆正）后生成 JPEG 展示图与缩略图，不支持的格式返回错误
+func (s *Service) buildImageVariants(data []byte) (*imageVariants, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if cfg.Width*cfg.Height > imageMaxPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	src := orientImage(flattenImage(decoded), orientation)
+	bounds := src.Bounds()
+	out := &imageVariants{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	display, resized := resizeFit(src, s.auth.ImageDisplayMaxSide)
+	displayData, err := encodeJPEG(display, s.auth.ImageDisplayQuality)
+	if err != nil {
+		return nil, err
+	}
+	// 原图已是方向正确的小 JPEG 且重新编码没有变小时沿用原图
+	if resized || format != "jpeg" || orientation != 1 || len(displayData) < len(data) {
+		out.Display = displayData
+	}
+	thumb, _ := resizeFit(display, s.auth.ImageThumbMaxSide)
+	if out.Thumb, err = encodeJPEG(thumb, s.auth.ImageThumbQuality); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// storeImageVariants 生成并上传展示图与缩略图，回填到 img；失败只记录日志，展示图沿用原图
+func (s *Service) storeImageVariants(ctx context.Context, img *model.Image, data []byte) {
+	variants, err := s.buildImageVariants(data)
+	if err != nil {
+		log.Printf("build image variants for user %d failed: %v", img.UserID, err)
+		return
+	}
+	img.Width, img.Height = variants.Width, variants.Height
+	if variants.Display != nil {
+		url, err := s.storage.Upload(ctx, s.storage.GenerateKey(img.UserID, "display.jpg"), bytes.NewReader(variants.Display))
+		if err != nil {
+			log.Printf("upload display image failed: %v", err)
+			return
+		}
+		img.CompressedURL = url
+	}
+	url, err := s.storage.Upload(ctx, s.storage.GenerateKey(img.UserID, "thumb.jpg"), bytes.NewReader(variants.Thumb))
+	if err != nil {
+		log.Printf("upload thumbnail failed: %v", err)
+		return
+	}
+	img.ThumbnailURL = url
+}
+
+// recognitionImageURL 交给提供商的图片：展示图分辨率足够时用展示图，减少下载与上传体积
+func (s *Service) recognitionImageURL(img *model.Image) string {
+	if img.CompressedURL == "" || img.CompressedURL == img.OriginalURL || s.auth.ImageProviderMinSide <= 0 {
+		return img.OriginalURL
+	}
+	long := max(img.Width, img.Height)
+	if long == 0 {
+		return img.OriginalURL
+	}
+	if long <= s.auth.ImageDisplayMaxSide || s.auth.ImageDisplayMaxSide >= s.auth.ImageProviderMinSide {
+		return img.CompressedURL
+	}
+	return img.OriginalURL
+}
+
+// ImageBackfillStats 图片压缩回填统计
+type ImageBackfillStats struct {
+	Scanned     int   `json:"scanned"`
+	Updated     int   `json:"updated"`
+	Failed      int   `json:"failed"`
+	NextAfterID uint  `json:"next_after_id"` // 下一批的起点，传回 after_id 继续
+	Remaining   int64 `json:"remaining"`
+	DryRun      bool  `json:"dry_run"`
+}
+
+// BackfillImageVariants 为还没有缩略图的已有图片生成展示图与缩略图，按 ID 顺序处理一批；
+// 无法读取或解码的图片跳过并计入 failed
+func (s *Service) BackfillImageVariants(ctx context.Context, afterID uint, limit int, dryRun bool) (ImageBackfillStats, error) {
+	stats := ImageBackfillStats{NextAfterID: afterID, DryRun: dryRun}
+	if err := s.ensureStorage(); err != nil {
+		return stats, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	images, err := s.repo.ListImagesWithoutThumbnail(afterID, limit)
+	if err != nil {
+		return stats, err
+	}
+	for i := range images {
+		if ctx.Err() != nil {
+			break
+		}
+		img := &images[i]
+		stats.Scanned++
+		stats.NextAfterID = img.ID
+		if dryRun {
+			continue
+		}
+		data, err := loadImageData(ctx, img.OriginalURL)
+		if err != nil {
+			log.Printf("backfill image %d: load failed: %v", img.ID, err)
+			stats.Failed++
+			continue
+		}
+		s.storeImageVariants(ctx, img, data)
+		if img.ThumbnailURL == "" {
+			stats.Failed++
+			continue
+		}
+		if err := s.repo.UpdateImageVariants(img.ID, img.CompressedURL, img.ThumbnailURL, img.Width, img.Height); err != nil {
+			return stats, err
+		}
+		stats.Updated++
+	}
+	if stats.Remaining, err = s.repo.CountImagesWithoutThumbnail(stats.NextAfterID); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// flattenImage 转为 RGBA，透明区域铺白底（JPEG 不支持透明）
+func flattenImage(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// resizeFit 按比例缩小到最长边不超过 maxSide，每个目标像素取覆盖的源像素平均值；不需要缩小时返回原图与 false
+func resizeFit(src *image.RGBA, maxSide int) (*image.RGBA, bool) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if maxSide <= 0 || (w <= maxSide && h <= maxSide) {
+		return src, false
+	}
+	scale := float64(maxSide) / float64(max(w, h))
+	dw := max(int(math.Round(float64(w)*scale)), 1)
+	dh := max(int(math.Round(float64(h)*scale)), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0 := y * h / dh
+		sy1 := max((y+1)*h/dh, sy0+1)
+		for x := 0; x < dw; x++ {
+			sx0 := x * w / dw
+			sx1 := max((x+1)*w/dw, sx0+1)
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				off := src.PixOffset(src.Rect.Min.X+sx0, src.Rect.Min.Y+sy)
+				for sx := sx0; sx < sx1; sx++ {
+					sum[0] += int(src.Pix[off])
+					sum[1] += int(src.Pix[off+1])
+					sum[2] += int(src.Pix[off+2])
+					sum[3] += int(src.Pix[off+3])
+					off += 4
+				}
+			}
+			n := (sy1 - sy0) * (sx1 - sx0)
+			off := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst, true
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// orientImage 按 EXIF Orientation（1-8）旋转或翻转为正常方向
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation 读取 JPEG 中 EXIF 的 Orientation，没有或无法解析时返回 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// 图像数据开始，EXIF 只会出现在之前
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// markedImage 每个像素的 R、G 分别编码 x、y，便于检查旋转后的位置
+func markedImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 10), G: uint8(y * 10), B: uint8((x*7 + y*13) % 256), A: 255})
+		}
+	}
+	return img
+}
+
+// exifSegment 构造只含 Orientation 一项的 APP1 段
+func exifSegment(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func encodeTestJPEG(t *testing.T, img image.Image, quality int, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if exif == nil {
+		return data
+	}
+	// 紧跟 SOI 插入 APP1
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exif...)
+	return append(out, data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := markedImage(8, 4)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, o := range []int{1, 3, 6, 8} {
+			if got := jpegOrientation(encodeTestJPEG(t, img, 90, exifSegment(order, o))); got != o {
+				t.Errorf("%v orientation %d: got %d", order, o, got)
+			}
+		}
+	}
+	cases := map[string][]byte{
+		"no exif":           encodeTestJPEG(t, img, 90, nil),
+		"out of range":      encodeTestJPEG(t, img, 90, exifSegment(binary.BigEndian, 9)),
+		"not a jpeg":        []byte("\x89PNG\r\n\x1a\n"),
+		"truncated segment": {0xFF, 0xD8, 0xFF, 0xE1, 0x01, 0x00, 'E', 'x'},
+	}
+	for name, data := range cases {
+		if got := jpegOrientation(data); got != 1 {
+			t.Errorf("%s: got %d, want 1", name, got)
+		}
+	}
+	if got := exifOrientation([]byte("XX\x00\x2a\x00\x00\x00\x08")); got != 1 {
+		t.Errorf("unknown byte order: got %d", got)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	const w, h = 4, 2
+	src := markedImage(w, h)
+	at := func(img *image.RGBA, x, y int) color.RGBA { return img.RGBAAt(x, y) }
+	cases := []struct {
+		orientation int
+		dw, dh      int
+		// 结果左上角与右上角对应的源像素
+		topLeft, topRight image.Point
+	}{
+		{1, w, h, image.Pt(0, 0), image.Pt(w-1, 0)},
+		{2, w, h, image.Pt(w-1, 0), image.Pt(0, 0)},
+		{3, w, h, image.Pt(w-1, h-1), image.Pt(0, h-1)},
+		{4, w, h, image.Pt(0, h-1), image.Pt(w-1, h-1)},
+		{5, h, w, image.Pt(0, 0), image.Pt(0, h-1)},
+		{6, h, w, image.Pt(0, h-1), image.Pt(0, 0)},
+		{7, h, w, image.Pt(w-1, h-1), image.Pt(w-1, 0)},
+		{8, h, w, image.Pt(w-1, 0), image.Pt(w-1, h-1)},
+	}
+	for _, tc := range cases {
+		got := orientImage(src, tc.orientation)
+		if got.Bounds().Dx() != tc.dw || got.Bounds().Dy() != tc.dh {
+			t.Errorf("orientation %d: size %v, want %dx%d", tc.orientation, got.Bounds().Size(), tc.dw, tc.dh)
+			continue
+		}
+		if at(got, 0, 0) != at(src, tc.topLeft.X, tc.topLeft.Y) || at(got, tc.dw-1, 0) != at(src, tc.topRight.X, tc.topRight.Y) {
+			t.Errorf("orientation %d: corners %v %v", tc.orientation, at(got, 0, 0), at(got, tc.dw-1, 0))
+		}
+	}
+}
+
+func TestResizeFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	values := []uint8{0, 100, 200, 40, 60, 80, 10, 30}
+	for i, v := range values {
+		src.SetRGBA(i%4, i/4, color.RGBA{R: v, G: v, B: v, A: 255})
+	}
+	dst, resized := resizeFit(src, 2)
+	if !resized || dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("resizeFit = %v %v", dst.Bounds(), resized)
+	}
+	// 每个目标像素是 2x2 源像素的四舍五入平均值
+	if got := dst.RGBAAt(0, 0).R; got != 60 { // (0+100+60+80)/4
+		t.Errorf("left = %d, want 60", got)
+	}
+	if got := dst.RGBAAt(1, 0).R; got != 70 { // (200+40+10+30)/4
+		t.Errorf("right = %d, want 70", got)
+	}
+	if got := dst.RGBAAt(0, 0).A; got != 255 {
+		t.Errorf("alpha = %d", got)
+	}
+
+	if same, resized := resizeFit(src, 4); resized || same != src {
+		t.Error("image within bounds should be returned as is")
+	}
+	if _, resized := resizeFit(src, 0); resized {
+		t.Error("maxSide 0 disables resizing")
+	}
+	wide, _ := resizeFit(image.NewRGBA(image.Rect(0, 0, 1000, 10)), 100)
+	if wide.Bounds().Dx() != 100 || wide.Bounds().Dy() != 1 {
+		t.Errorf("wide image resized to %v", wide.Bounds().Size())
+	}
+}
+
+func testImageService() *Service {
+	return &Service{auth: AuthConfig{
+		ImageDisplayMaxSide: 64,
+		ImageDisplayQuality: 80,
+		ImageThumbMaxSide:   16,
+		ImageThumbQuality:   70,
+	}}
+}
+
+func decodeSize(t *testing.T, data []byte) image.Point {
+	t.Helper()
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("variant is not a jpeg: %s %v", format, err)
+	}
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+func TestBuildImageVariantsLargePNG(t *testing.T) {
+	var buf bytes.Buffer
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	v, err := testImageService().buildImageVariants(buf.Bytes())
+	if err != nil {
+		t.Fatalf("buildImageVariants: %v", err)
+	}
+	if v.Width != 200 || v.Height != 100 {
+		t.Errorf("size = %dx%d", v.Width, v.Height)
+	}
+	if v.Display == nil {
+		t.Fatal("PNG should always get a JPEG display image")
+	}
+	if got := decodeSize(t, v.Display); got != image.Pt(64, 32) {
+		t.Errorf("display = %v", got)
+	}
+	if got := decodeSize(t, v.Thumb); got != image.Pt(16, 8) {
+		t.Errorf("thumb = %v", got)
+	}
+}
+
+func TestBuildImageVariantsSmallJPEG(t *testing.T) {
+	s := testImageService()
+	src := markedImage(32, 16)
+
+	// 方向正确、质量低于展示图质量的小 JPEG 重新编码不会更小，沿用原图
+	v, err := s.buildImageVariants(encodeTestJPEG(t, src, 30, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Display != nil || v.Width != 32 || v.Height != 16 {
+		t.Errorf("small jpeg: display %d bytes, size %dx%d", len(v.Display), v.Width, v.Height)
+	}
+	if got := decodeSize(t, v.Thumb); got != image.Pt(16, 8) {
+		t.Errorf("thumb = %v", got)
+	}
+
+	// 需要按 EXIF 旋转时必须重新编码
+	v, err = s.buildImageVariants(encodeTestJPEG(t, src, 30, exifSegment(binary.BigEndian, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Width != 16 || v.Height != 32 || v.Display == nil {
+		t.Fatalf("rotated jpeg: size %dx%d display %v", v.Width, v.Height, v.Display != nil)
+	}
+	if got := decodeSize(t, v.Display); got != image.Pt(16, 32) {
+		t.Errorf("rotated display = %v", got)
+	}
+
+	if _, err := s.buildImageVariants([]byte("not an image")); err == nil {
+		t.Error("unsupported data should fail")
+	}
+}
+
+func TestRecognitionImageURL(t *testing.T) {
+	const orig, display = "https://img.example.com/o.jpg", "https://img.example.com/d.jpg"
+	cases := []struct {
+		name       string
+		displayMax int
+		minSide    int
+		img        model.Image
+		want       string
+	}{
+		{"no display image", 1600, 1024, model.Image{OriginalURL: orig, Width: 4000, Height: 3000}, orig},
+		{"display is original", 1600, 1024, model.Image{OriginalURL: orig, CompressedURL: orig, Width: 4000}, orig},
+		{"disabled", 1600, 0, model.Image{OriginalURL: orig, CompressedURL: display, Width: 4000}, orig},
+		{"unknown size", 1600, 1024, model.Image{OriginalURL: orig, CompressedURL: display}, orig},
+		{"display large enough", 1600, 1024, model.Image{OriginalURL: orig, CompressedURL: display, Width: 4000, Height: 3000}, display},
+		{"original already small", 800, 1024, model.Image{OriginalURL: orig, CompressedURL: display, Width: 600, Height: 800}, display},
+		{"display too small", 800, 1024, model.Image{OriginalURL: orig, CompressedURL: display, Width: 3000, Height: 4000}, orig},
+	}
+	for _, tc := range cases {
+		s := &Service{auth: AuthConfig{ImageDisplayMaxSide: tc.displayMax, ImageProviderMinSide: tc.minSide}}
+		if got := s.recognitionImageURL(&tc.img); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
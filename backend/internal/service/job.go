@@ -0,0 +1,306 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrJobNotCancelable 任务已开始执行或已结束
+var ErrJobNotCancelable = errors.New("job not cancelable")
+
+const (
+	jobPollInterval   = 2 * time.Second
+	jobRetryBase      = 2 * time.Second
+	jobRetryMaxDelay  = 2 * time.Minute
+	jobWaitMax        = 30 * time.Second
+	jobWaitPollPeriod = 500 * time.Millisecond
+)
+
+// SubmitRecognitionJob 提交异步识别任务，识别次数由调用方在提交前预占，任务结束时按结果确认或退回
+func (s *Service) SubmitRecognitionJob(ctx context.Context, userID uint, deviceID string, imageID uint, reservation *model.QuotaReservation, opts RecognizeOptions) (*model.RecognitionJob, error) {
+	maxAttempts := s.auth.JobMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	job := &model.RecognitionJob{
+		UserID:      userID,
+		DeviceID:    strings.TrimSpace(deviceID),
+		ImageID:     imageID,
+		Source:      opts.Source,
+		Locale:      opts.Locale,
+		Mode:        opts.Mode,
+		Status:      model.JobQueued,
+		RunAfter:    time.Now(),
+		MaxAttempts: maxAttempts,
+	}
+	if reservation != nil {
+		job.ReservationID = &reservation.ID
+	}
+	if err := s.repo.WithContext(ctx).CreateRecognitionJob(job); err != nil {
+		return nil, err
+	}
+	if reservation != nil {
+		s.holdForJobs([]model.QuotaReservation{*reservation})
+	}
+	s.wakeJobWorker()
+	return job, nil
+}
+
+func (s *Service) wakeJobWorker() {
+	select {
+	case s.jobWake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) GetRecognitionJob(id uint) (*model.RecognitionJob, error) {
+	return s.repo.GetRecognitionJob(id)
+}
+
+// WaitRecognitionJob 长轮询：等待任务结束或超时后返回当前状态，wait 最长 30 秒
+func (s *Service) WaitRecognitionJob(ctx context.Context, id uint, wait time.Duration) (*model.RecognitionJob, error) {
+	if wait > jobWaitMax {
+		wait = jobWaitMax
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		job, err := s.repo.WithContext(ctx).GetRecognitionJob(id)
+		if err != nil || jobFinished(job.Status) || !time.Now().Before(deadline) {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-time.After(jobWaitPollPeriod):
+		}
+	}
+}
+
+func jobFinished(status string) bool {
+	return status == model.JobSucceeded || status == model.JobFailed || status == model.JobCanceled
+}
+
+// CancelRecognitionJob 取消尚未开始的任务并退回识别次数
+func (s *Service) CancelRecognitionJob(job *model.RecognitionJob) error {
+	ok, err := s.repo.CancelRecognitionJob(job.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrJobNotCancelable
+	}
+	s.settleJobQuota(job, nil, QuotaReasonCanceled)
+	return nil
+}
+
+func (s *Service) ListRecognitionJobs(userID uint, status string, limit, offset int) ([]model.RecognitionJob, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListRecognitionJobs(userID, strings.TrimSpace(status), limit, offset)
+}
+
+// CountRecognitionJobs 各状态任务数，用于观察积压
+func (s *Service) CountRecognitionJobs() (map[string]int64, error) {
+	rows, err := s.repo.CountRecognitionJobsByStatus()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int64{}
+	for _, row := range rows {
+		out[row.Status] = row.Count
+	}
+	return out, nil
+}
+
+// StartJobWorkers 启动固定数量的执行者轮询任务队列，RECOGNITION_JOB_WORKERS 为 0 时不启动
+func (s *Service) StartJobWorkers(ctx context.Context) {
+	for i := 0; i < s.auth.JobWorkers; i++ {
+		go s.jobWorker(ctx)
+	}
+}
+
+func (s *Service) jobVisibility() time.Duration {
+	if s.auth.JobVisibilitySeconds > 0 {
+		return time.Duration(s.auth.JobVisibilitySeconds) * time.Second
+	}
+	return 3 * time.Minute
+}
+
+func (s *Service) jobWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		job, err := s.repo.ClaimRecognitionJob(newLockToken(), s.jobVisibility())
+		if err != nil {
+			log.Printf("claim recognition job failed: %v", err)
+		}
+		if job != nil {
+			s.runJob(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.jobWake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// jobStage 失败记录的阶段，批量任务单独统计
+func jobStage(job *model.RecognitionJob) string {
+	if job.BatchID != nil {
+		return "batch"
+	}
+	return "job"
+}
+
+func newLockToken() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// runJob 执行一次任务：可重试错误按退避重新排队，重试用尽或不可重试时失败并退回次数
+func (s *Service) runJob(ctx context.Context, job *model.RecognitionJob) {
+	// 锁过期被重新领取时 attempts 会再加一，超过上限不再执行
+	if job.Attempts > job.MaxAttempts {
+		s.failJob(job, "attempts_exhausted", "lock expired on the last attempt")
+		return
+	}
+	runCtx, cancel := context.WithTimeout(ctx, s.jobVisibility())
+	defer cancel()
+
+	img, err := s.repo.WithContext(runCtx).GetImageByID(job.ImageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.failJob(job, "image_not_found", "image not found")
+		} else {
+			s.retryJob(job, err)
+		}
+		return
+	}
+	var user *model.User
+	if job.UserID > 0 {
+		if u, err := s.repo.GetUserByID(job.UserID); err == nil {
+			user = u
+		}
+	}
+
+	recognizeCtx, cancelRecognize := s.RecognizeContext(runCtx)
+	defer cancelRecognize()
+	started := time.Now()
+	result, err := s.Recognize(recognizeCtx, user, img, RecognizeOptions{Source: job.Source, Locale: job.Locale, Mode: job.Mode, DeviceID: job.DeviceID})
+	if err != nil {
+		s.RecordFailure(job.UserID, &img.ID, "", jobStage(job), err)
+		if ctx.Err() != nil {
+			// 服务关闭，放回队列由其他实例继续
+			s.requeueJob(job, time.Now(), job.Attempts-1, "", "")
+			return
+		}
+		s.retryJob(job, err)
+		return
+	}
+	durationMs := int(time.Since(started).Milliseconds())
+
+	// 保存前确认仍持有锁并续期，锁已过期被接管时不再保存，避免与接管者各写一份结果
+	if ok, err := s.repo.RenewRecognitionJobLock(job.ID, job.LockToken, s.jobVisibility()); err != nil || !ok {
+		log.Printf("recognition job %d lost its lock before saving: ok=%v err=%v", job.ID, ok, err)
+		return
+	}
+	saved, err := s.SaveResult(context.WithoutCancel(runCtx), img.ID, result, job.Source, durationMs)
+	if err != nil {
+		s.RecordFailure(job.UserID, &img.ID, "", "save_result", err)
+		s.retryJob(job, err)
+		return
+	}
+
+	now := time.Now()
+	ok, err := s.repo.FinishRecognitionJob(job.ID, job.LockToken, map[string]interface{}{
+		"status":        model.JobSucceeded,
+		"result_id":     saved.ID,
+		"error_code":    "",
+		"error_message": "",
+		"finished_at":   &now,
+	})
+	if err != nil || !ok {
+		// 锁已被其他执行者接管，次数与手记由接管者处理
+		log.Printf("finish recognition job %d failed: ok=%v err=%v", job.ID, ok, err)
+		return
+	}
+	// 命中缓存未调用提供商，不计入识别次数
+	s.settleJobQuota(job, saved, "")
+	_, _ = s.CreateNote(job.UserID, img.ID, &saved.ID, "", "crop", nil)
+}
+
+// jobRetryable 提供商错误按 llm 的分类判断；未分类的错误只有数据库连接中断与网络错误视为临时故障，其余直接失败
+func jobRetryable(err error) bool {
+	if llm.ErrorCode(err) != "" {
+		return llm.Retryable(err)
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryJob 可重试且未用尽次数时重新排队，否则标记失败
+func (s *Service) retryJob(job *model.RecognitionJob, err error) {
+	code, msg := classifyFailure(err)
+	if !jobRetryable(err) || llm.IsCircuitOpen(err) || job.Attempts >= job.MaxAttempts {
+		s.failJob(job, code, msg)
+		return
+	}
+	delay := llm.RetryAfter(err)
+	if delay <= 0 {
+		delay = llm.Backoff(job.Attempts, jobRetryBase, jobRetryMaxDelay)
+	}
+	s.requeueJob(job, time.Now().Add(delay), job.Attempts, code, msg)
+}
+
+func (s *Service) requeueJob(job *model.RecognitionJob, runAfter time.Time, attempts int, code, msg string) {
+	ok, err := s.repo.FinishRecognitionJob(job.ID, job.LockToken, map[string]interface{}{
+		"status":        model.JobQueued,
+		"run_after":     runAfter,
+		"attempts":      attempts,
+		"error_code":    code,
+		"error_message": msg,
+	})
+	if err != nil || !ok {
+		log.Printf("requeue recognition job %d failed: ok=%v err=%v", job.ID, ok, err)
+	}
+}
+
+func (s *Service) failJob(job *model.RecognitionJob, code, msg string) {
+	now := time.Now()
+	ok, err := s.repo.FinishRecognitionJob(job.ID, job.LockToken, map[string]interface{}{
+		"status":        model.JobFailed,
+		"error_code":    code,
+		"error_message": msg,
+		"finished_at":   &now,
+	})
+	if err != nil || !ok {
+		log.Printf("fail recognition job %d failed: ok=%v err=%v", job.ID, ok, err)
+		return
+	}
+	s.settleJobQuota(job, nil, QuotaReasonFailed)
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestJobRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"provider 5xx", &llm.ProviderError{Code: llm.CodeServerError, Retryable: true}, true},
+		{"provider 401", &llm.ProviderError{Code: llm.CodeUnauthorized}, false},
+		{"canceled transport", &llm.ProviderError{Code: llm.CodeCanceled, Err: &net.OpError{Op: "dial", Err: context.Canceled}}, false},
+		{"output invalid", &llm.OutputError{Code: llm.OutputSchemaInvalid}, false},
+		{"circuit open", llm.ErrCircuitOpen, false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"db connection lost", fmt.Errorf("save result: %w", driver.ErrBadConn), true},
+		{"db network error", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"record not found", gorm.ErrRecordNotFound, false},
+		{"constraint violation", errors.New("duplicate key value violates unique constraint"), false},
+	}
+	for _, tc := range cases {
+		if got := jobRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: jobRetryable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// createRunningJob 创建一个已被 token 领取的执行中任务
+func createRunningJob(t *testing.T, s *Service, user *model.User, img *model.Image, token string, attempts, maxAttempts int, reservation *model.QuotaReservation) *model.RecognitionJob {
+	t.Helper()
+	lockedUntil := time.Now().Add(time.Minute)
+	job := &model.RecognitionJob{
+		UserID:      user.ID,
+		ImageID:     img.ID,
+		Source:      "job",
+		Mode:        "crop",
+		Status:      model.JobRunning,
+		RunAfter:    time.Now(),
+		Attempts:    attempts,
+		MaxAttempts: maxAttempts,
+		LockToken:   token,
+		LockedUntil: &lockedUntil,
+	}
+	if reservation != nil {
+		job.ReservationID = &reservation.ID
+	}
+	if err := s.repo.DB().Create(job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+func TestRunJobFailsReclaimedJobPastMaxAttempts(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 10)
+	img := createTestImage(t, s, user.ID, contentHash([]byte("job image")))
+	reservation, err := s.ReserveRecognition(user, "", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := createRunningJob(t, s, user, img, "tok", 4, 3, reservation)
+
+	s.runJob(context.Background(), job)
+
+	stored, err := s.repo.GetRecognitionJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.JobFailed || stored.ErrorCode != "attempts_exhausted" || stored.ResultID != nil {
+		t.Errorf("job = status %s code %s result %v", stored.Status, stored.ErrorCode, stored.ResultID)
+	}
+	var res model.QuotaReservation
+	if err := s.repo.DB().First(&res, reservation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != model.QuotaReleased {
+		t.Errorf("reservation status = %s, want released", res.Status)
+	}
+}
+
+func TestRunJobSkipsSideEffectsWhenLockLost(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 10)
+	img := createTestImage(t, s, user.ID, contentHash([]byte("lost lock image")))
+	reservation, err := s.ReserveRecognition(user, "", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := createRunningJob(t, s, user, img, "new-owner", 2, 3, reservation)
+	// 本执行者持有的是已被接管的旧 token
+	mine := *stored
+	mine.LockToken = "old-owner"
+
+	s.runJob(context.Background(), &mine)
+
+	job, err := s.repo.GetRecognitionJob(stored.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.JobRunning || job.LockToken != "new-owner" {
+		t.Errorf("job taken over by another worker was modified: %+v", job)
+	}
+	var res model.QuotaReservation
+	if err := s.repo.DB().First(&res, reservation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != model.QuotaReserved {
+		t.Errorf("reservation settled by stale worker: %s", res.Status)
+	}
+	var notes int64
+	if err := s.repo.DB().Model(&model.FieldNote{}).Where("image_id = ?", img.ID).Count(&notes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if notes != 0 {
+		t.Errorf("stale worker created %d notes", notes)
+	}
+}
+
+func TestRunJobSucceedsAndSettles(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 10)
+	img := createTestImage(t, s, user.ID, contentHash([]byte("ok image")))
+	reservation, err := s.ReserveRecognition(user, "", "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := createRunningJob(t, s, user, img, "tok", 1, 3, reservation)
+
+	s.runJob(context.Background(), job)
+
+	stored, err := s.repo.GetRecognitionJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.JobSucceeded || stored.ResultID == nil {
+		t.Fatalf("job = status %s code %s", stored.Status, stored.ErrorCode)
+	}
+	var res model.QuotaReservation
+	if err := s.repo.DB().First(&res, reservation.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != model.QuotaCommitted || res.ResultID == nil || *res.ResultID != *stored.ResultID {
+		t.Errorf("reservation = %+v", res)
+	}
+}
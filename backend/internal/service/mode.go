@@ -0,0 +1,149 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"errors"
+	"strings"
+)
+
+// 识别模式
+const (
+	ModeCrop    = "crop"
+	ModeDisease = "disease"
+	ModePest    = "pest"
+	ModeWeed    = "weed"
+	ModeFull    = "full"
+)
+
+var ErrInvalidMode = errors.New("invalid_mode")
+
+// ResultFilter 历史与后台检索共用的扩展过滤条件
+type ResultFilter = repository.ResultFilter
+
+// modeCategories 各模式允许的结论类别
+var modeCategories = map[string][]string{
+	ModeCrop:    {},
+	ModeDisease: {"disease"},
+	ModePest:    {"pest"},
+	ModeWeed:    {"weed"},
+	ModeFull:    {"disease", "pest", "weed"},
+}
+
+// NormalizeMode 校验识别模式，空值为 crop
+func NormalizeMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return ModeCrop, nil
+	}
+	if _, ok := modeCategories[mode]; !ok {
+		return "", ErrInvalidMode
+	}
+	return mode, nil
+}
+
+// NormalizeResultFilter 校验过滤条件中的模式、结论类别与生育期代码
+func NormalizeResultFilter(raw ResultFilter) (ResultFilter, error) {
+	f := ResultFilter{
+		FindingCategory: strings.ToLower(strings.TrimSpace(raw.FindingCategory)),
+		FindingName:     strings.TrimSpace(raw.FindingName),
+	}
+	if strings.TrimSpace(raw.Mode) != "" {
+		m, err := NormalizeMode(raw.Mode)
+		if err != nil {
+			return f, err
+		}
+		f.Mode = m
+	}
+	if f.FindingCategory != "" && f.FindingCategory != "disease" && f.FindingCategory != "pest" && f.FindingCategory != "weed" {
+		return f, errors.New("invalid finding_category")
+	}
+	stages := []struct {
+		name string
+		raw  string
+		dst  *string
+	}{
+		{"growth_stage", raw.GrowthStage, &f.GrowthStage},
+		{"min_stage", raw.MinStage, &f.MinStage},
+		{"max_stage", raw.MaxStage, &f.MaxStage},
+	}
+	for _, st := range stages {
+		if strings.TrimSpace(st.raw) == "" {
+			continue
+		}
+		code, ok := NormalizeStageCode(st.raw)
+		if !ok {
+			return f, errors.New("invalid " + st.name)
+		}
+		*st.dst = code
+	}
+	if f.MinStage != "" && f.MaxStage != "" && f.MinStage > f.MaxStage {
+		return f, errors.New("invalid stage range")
+	}
+	return f, nil
+}
+
+// activeTagNames 按类别返回启用的 Tag 名称
+func (s *Service) activeTagNames(categories []string) map[string][]string {
+	out := make(map[string][]string, len(categories))
+	for _, cat := range categories {
+		tags, err := s.repo.GetTags(cat)
+		if err != nil {
+			continue
+		}
+		names := make([]string, 0, len(tags))
+		for _, t := range tags {
+			names = append(names, t.Name)
+		}
+		out[cat] = names
+	}
+	return out
+}
+
+// constrainFindings 丢弃不属于本模式或不在启用词表中的结论
+func (s *Service) constrainFindings(mode string, findings []llm.Finding) []model.RecognitionFinding {
+	vocab := s.activeTagNames(modeCategories[mode])
+	out := make([]model.RecognitionFinding, 0, len(findings))
+	seen := map[string]bool{}
+	for _, f := range findings {
+		name := strings.TrimSpace(f.Name)
+		names, ok := vocab[f.Category]
+		if !ok || !containsString(names, name) {
+			continue
+		}
+		key := f.Category + "|" + name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, model.RecognitionFinding{
+			Category:   f.Category,
+			Name:       name,
+			Confidence: f.Confidence,
+		})
+	}
+	return out
+}
+
+// GetFindingsMap 批量加载结果的结论
+func (s *Service) GetFindingsMap(resultIDs []uint) (map[uint][]model.RecognitionFinding, error) {
+	items, err := s.repo.ListFindingsByResultIDs(resultIDs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint][]model.RecognitionFinding, len(resultIDs))
+	for _, item := range items {
+		out[item.ResultID] = append(out[item.ResultID], item)
+	}
+	return out, nil
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"agri-scan/internal/llm"
 	"errors"
 	"strings"
 
@@ -16,16 +17,23 @@ type PlanSettingView struct {
 	RequireAd     bool   `json:"require_ad"`
 	PriceCents    int    `json:"price_cents"`
 	BillingUnit   string `json:"billing_unit"`
+	// 多提供商投票：off/always/low_confidence，成员为 name=weight 逗号分隔
+	EnsembleMode      string  `json:"ensemble_mode"`
+	EnsembleProviders string  `json:"ensemble_providers"`
+	EnsembleThreshold float64 `json:"ensemble_threshold"`
 }
 
 type PlanSettingUpdate struct {
-	Name          *string `json:"name"`
-	Description   *string `json:"description"`
-	QuotaTotal    *int    `json:"quota_total"`
-	RetentionDays *int    `json:"retention_days"`
-	RequireAd     *bool   `json:"require_ad"`
-	PriceCents    *int    `json:"price_cents"`
-	BillingUnit   *string `json:"billing_unit"`
+	Name              *string  `json:"name"`
+	Description       *string  `json:"description"`
+	QuotaTotal        *int     `json:"quota_total"`
+	RetentionDays     *int     `json:"retention_days"`
+	RequireAd         *bool    `json:"require_ad"`
+	PriceCents        *int     `json:"price_cents"`
+	BillingUnit       *string  `json:"billing_unit"`
+	EnsembleMode      *string  `json:"ensemble_mode"`
+	EnsembleProviders *string  `json:"ensemble_providers"`
+	EnsembleThreshold *float64 `json:"ensemble_threshold"`
 }
 
 func (s *Service) GetPlanSettings() ([]PlanSettingView, error) {
@@ -59,19 +67,40 @@ func (s *Service) UpdatePlanSetting(code string, update PlanSettingUpdate) (Plan
 	if update.PriceCents != nil && *update.PriceCents < 0 {
 		return PlanSettingView{}, errors.New("invalid price_cents")
 	}
+	if update.EnsembleMode != nil {
+		mode, err := normalizeEnsembleMode(*update.EnsembleMode)
+		if err != nil {
+			return PlanSettingView{}, err
+		}
+		update.EnsembleMode = &mode
+	}
+	if update.EnsembleProviders != nil {
+		members, err := parseEnsembleProviders(*update.EnsembleProviders)
+		if err != nil {
+			return PlanSettingView{}, err
+		}
+		formatted := llm.FormatEnsembleMembers(members)
+		update.EnsembleProviders = &formatted
+	}
+	if update.EnsembleThreshold != nil && (*update.EnsembleThreshold < 0 || *update.EnsembleThreshold > 1) {
+		return PlanSettingView{}, errors.New("invalid ensemble_threshold")
+	}
 	current, err := s.getPlanSettingView(code)
 	if err != nil {
 		return PlanSettingView{}, err
 	}
 	payload := map[string]interface{}{
-		"code":           code,
-		"name":           current.Name,
-		"description":    current.Description,
-		"quota_total":    current.QuotaTotal,
-		"retention_days": current.RetentionDays,
-		"require_ad":     current.RequireAd,
-		"price_cents":    current.PriceCents,
-		"billing_unit":   current.BillingUnit,
+		"code":               code,
+		"name":               current.Name,
+		"description":        current.Description,
+		"quota_total":        current.QuotaTotal,
+		"retention_days":     current.RetentionDays,
+		"require_ad":         current.RequireAd,
+		"price_cents":        current.PriceCents,
+		"billing_unit":       current.BillingUnit,
+		"ensemble_mode":      current.EnsembleMode,
+		"ensemble_providers": current.EnsembleProviders,
+		"ensemble_threshold": current.EnsembleThreshold,
 	}
 	if update.Name != nil {
 		payload["name"] = strings.TrimSpace(*update.Name)
@@ -94,6 +123,15 @@ func (s *Service) UpdatePlanSetting(code string, update PlanSettingUpdate) (Plan
 	if update.BillingUnit != nil {
 		payload["billing_unit"] = strings.TrimSpace(*update.BillingUnit)
 	}
+	if update.EnsembleMode != nil {
+		payload["ensemble_mode"] = *update.EnsembleMode
+	}
+	if update.EnsembleProviders != nil {
+		payload["ensemble_providers"] = *update.EnsembleProviders
+	}
+	if update.EnsembleThreshold != nil {
+		payload["ensemble_threshold"] = *update.EnsembleThreshold
+	}
 	if _, err := s.repo.UpsertPlanSetting(code, payload); err != nil {
 		return PlanSettingView{}, err
 	}
@@ -108,14 +146,17 @@ func (s *Service) getPlanSettingView(code string) (PlanSettingView, error) {
 	item, err := s.repo.GetPlanSettingByCode(code)
 	if err == nil && item != nil {
 		return PlanSettingView{
-			Code:          item.Code,
-			Name:          item.Name,
-			Description:   item.Description,
-			QuotaTotal:    item.QuotaTotal,
-			RetentionDays: item.RetentionDays,
-			RequireAd:     item.RequireAd,
-			PriceCents:    item.PriceCents,
-			BillingUnit:   item.BillingUnit,
+			Code:              item.Code,
+			Name:              item.Name,
+			Description:       item.Description,
+			QuotaTotal:        item.QuotaTotal,
+			RetentionDays:     item.RetentionDays,
+			RequireAd:         item.RequireAd,
+			PriceCents:        item.PriceCents,
+			BillingUnit:       item.BillingUnit,
+			EnsembleMode:      ensembleModeOrOff(item.EnsembleMode),
+			EnsembleProviders: item.EnsembleProviders,
+			EnsembleThreshold: item.EnsembleThreshold,
 		}, nil
 	}
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -136,6 +177,7 @@ func (s *Service) defaultPlanSettingView(code string) PlanSettingView {
 			RequireAd:     s.auth.PlanSilver.RequireAd,
 			PriceCents:    9900,
 			BillingUnit:   "month",
+			EnsembleMode:  EnsembleOff,
 		}
 	case "gold":
 		return PlanSettingView{
@@ -147,6 +189,7 @@ func (s *Service) defaultPlanSettingView(code string) PlanSettingView {
 			RequireAd:     s.auth.PlanGold.RequireAd,
 			PriceCents:    19900,
 			BillingUnit:   "month",
+			EnsembleMode:  EnsembleOff,
 		}
 	case "diamond":
 		return PlanSettingView{
@@ -158,6 +201,7 @@ func (s *Service) defaultPlanSettingView(code string) PlanSettingView {
 			RequireAd:     s.auth.PlanDiamond.RequireAd,
 			PriceCents:    39900,
 			BillingUnit:   "month",
+			EnsembleMode:  EnsembleOff,
 		}
 	default:
 		return PlanSettingView{
@@ -169,6 +213,15 @@ func (s *Service) defaultPlanSettingView(code string) PlanSettingView {
 			RequireAd:     true,
 			PriceCents:    0,
 			BillingUnit:   "month",
+			EnsembleMode:  EnsembleOff,
 		}
 	}
 }
+
+// ensembleModeOrOff 旧数据未配置投票时视为关闭
+func ensembleModeOrOff(mode string) string {
+	if mode == "" {
+		return EnsembleOff
+	}
+	return mode
+}
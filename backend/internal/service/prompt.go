@@ -0,0 +1,122 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// 提示词模板支持的占位符
+var promptPlaceholders = map[string]bool{
+	"crop_list_json":  true,
+	"tag_list_json":   true,
+	"stage_list_json": true,
+	"locale":          true,
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+var ErrPromptPlaceholder = errors.New("unknown_placeholder")
+
+type PromptTemplateCreate struct {
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	Note     string `json:"note"`
+	Activate bool   `json:"activate"`
+}
+
+func (s *Service) ListPromptTemplates(name string, limit, offset int) ([]model.PromptTemplate, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.ListPromptTemplates(strings.TrimSpace(name), limit, offset)
+}
+
+// CreatePromptTemplate 新建提示词版本，不修改已有版本以便结果可追溯
+func (s *Service) CreatePromptTemplate(req PromptTemplateCreate) (*model.PromptTemplate, error) {
+	name, err := NormalizeMode(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		return nil, errors.New("content required")
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(content, -1) {
+		if !promptPlaceholders[m[1]] {
+			return nil, ErrPromptPlaceholder
+		}
+	}
+	item := &model.PromptTemplate{
+		Name:    name,
+		Content: content,
+		Note:    strings.TrimSpace(req.Note),
+	}
+	if err := s.repo.CreatePromptTemplate(item, req.Activate); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Service) ActivatePromptTemplate(id uint) (*model.PromptTemplate, error) {
+	return s.repo.ActivatePromptTemplate(id)
+}
+
+// renderPrompt 渲染识别模式生效的提示词模板，没有生效模板时使用内置模板并记为版本 0；pinned 大于 0 时使用指定版本
+func (s *Service) renderPrompt(mode, locale string, pinned int) (string, int) {
+	content := repository.DefaultPromptTemplates[mode]
+	version := 0
+	var tpl *model.PromptTemplate
+	var err error
+	if pinned > 0 {
+		if tpl, err = s.repo.GetPromptTemplateVersion(mode, pinned); err != nil {
+			log.Printf("prompt template %s v%d not found, using active version", mode, pinned)
+		}
+	}
+	if tpl == nil {
+		tpl, err = s.repo.GetActivePromptTemplate(mode)
+	}
+	if err == nil && tpl != nil {
+		content = tpl.Content
+		version = tpl.Version
+	}
+	if content == "" {
+		return "", 0
+	}
+	values := map[string]string{
+		"crop_list_json":  s.getSettingString(settingCropSuggestions),
+		"tag_list_json":   s.tagListJSON(mode),
+		"stage_list_json": s.stageListJSON(),
+		"locale":          promptLocale(locale),
+	}
+	text := placeholderPattern.ReplaceAllStringFunc(content, func(m string) string {
+		key := placeholderPattern.FindStringSubmatch(m)[1]
+		return values[key]
+	})
+	return text, version
+}
+
+// promptLocale 未指定语言时使用简体中文
+func promptLocale(locale string) string {
+	if locale = strings.TrimSpace(locale); locale == "" {
+		return "zh-CN"
+	}
+	return locale
+}
+
+// tagListJSON 单类别模式输出名称数组，full 模式输出按类别分组的对象
+func (s *Service) tagListJSON(mode string) string {
+	categories := modeCategories[mode]
+	vocab := s.activeTagNames(categories)
+	var data []byte
+	if len(categories) == 1 {
+		data, _ = json.Marshal(vocab[categories[0]])
+	} else {
+		data, _ = json.Marshal(vocab)
+	}
+	return string(data)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// 结算原因
+const (
+	QuotaReasonResultSaved = "result_saved"
+	QuotaReasonFailed      = "recognize_failed"
+	QuotaReasonCanceled    = "canceled"
+	QuotaReasonCacheHit    = "cache_hit"
+	QuotaReasonExpired     = "expired"
+)
+
+const (
+	quotaReapInterval = time.Minute
+	quotaReapBatch    = 200
+)
+
+type QuotaReservationFilter = repository.QuotaReservationFilter
+
+// ReserveRecognition 调用提供商前预占一次识别：登录用户扣用户次数，匿名与游客扣设备次数，需要看广告时同时扣一次广告额度；
+// 未在识别总时限内结算的预占自动退回
+func (s *Service) ReserveRecognition(user *model.User, deviceID, source string) (*model.QuotaReservation, error) {
+	items, err := s.reserveQuota(user, deviceID, source, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// ReserveRecognitions 批量识别前一次预占 n 次，剩余次数或广告额度不足时整批拒绝；仅限登录用户
+func (s *Service) ReserveRecognitions(user *model.User, n int, source string) ([]model.QuotaReservation, error) {
+	if user == nil || user.ID == 0 || isGuestUser(user) {
+		return nil, ErrLoginRequired
+	}
+	return s.reserveQuota(user, "", source, n)
+}
+
+func (s *Service) reserveQuota(user *model.User, deviceID, source string, n int) ([]model.QuotaReservation, error) {
+	var holder repository.QuotaHolder
+	if user != nil && user.ID > 0 && !isGuestUser(user) {
+		planCfg := s.getPlanSetting(user.Plan)
+		quotaTotal := user.QuotaTotal
+		if quotaTotal == 0 {
+			quotaTotal = planCfg.QuotaTotal
+		}
+		holder = repository.QuotaHolder{UserID: user.ID, Limit: quotaTotal, AdCredit: planCfg.RequireAd}
+	} else {
+		deviceID = strings.TrimSpace(deviceID)
+		if deviceID == "" {
+			return nil, ErrLoginRequired
+		}
+		anonLimit := s.getSettingInt(settingAnonLimit, s.auth.AnonLimit)
+		if anonLimit <= 0 {
+			return nil, ErrLoginRequired
+		}
+		s.ensureDeviceUsage(deviceID)
+		holder = repository.QuotaHolder{DeviceID: deviceID, Limit: anonLimit, AdCredit: s.getSettingBool(settingAnonRequireAd, true)}
+	}
+	if len(source) > 32 {
+		source = source[:32]
+	}
+	expiresAt := time.Now().Add(s.quotaHoldTimeout())
+	items := make([]model.QuotaReservation, n)
+	for i := range items {
+		items[i].Source = source
+		items[i].ExpiresAt = &expiresAt
+	}
+	err := s.repo.ReserveQuota(holder, items)
+	switch {
+	case errors.Is(err, repository.ErrQuotaInsufficient):
+		if holder.UserID == 0 {
+			return nil, ErrLoginRequired
+		}
+		return nil, ErrQuotaExceeded
+	case errors.Is(err, repository.ErrAdCreditInsufficient):
+		return nil, ErrAdRequired
+	case err != nil:
+		return nil, err
+	}
+	return items, nil
+}
+
+// quotaHoldTimeout 同步识别预占的最长持有时间，超过识别总时限仍未结算视为请求已中断
+func (s *Service) quotaHoldTimeout() time.Duration {
+	return time.Duration(max(s.auth.RecognizeTimeoutSeconds, 60))*time.Second + 2*time.Minute
+}
+
+// CommitRecognition 保存结果后确认预占
+func (s *Service) CommitRecognition(reservation *model.QuotaReservation, resultID uint) {
+	if reservation == nil {
+		return
+	}
+	s.settleQuota(reservation.ID, model.QuotaCommitted, QuotaReasonResultSaved, &resultID)
+}
+
+// ReleaseRecognition 识别未产出计费结果（失败、取消、超时、命中缓存）时退回预占的次数与广告额度，重复调用只退回一次
+func (s *Service) ReleaseRecognition(reservation *model.QuotaReservation, reason string) {
+	if reservation == nil {
+		return
+	}
+	s.settleQuota(reservation.ID, model.QuotaReleased, reason, nil)
+}
+
+// SettleRecognition 按保存的结果结算：命中缓存未调用提供商时退回，否则确认
+func (s *Service) SettleRecognition(reservation *model.QuotaReservation, saved *model.RecognitionResult) {
+	if saved.CacheHit {
+		s.ReleaseRecognition(reservation, QuotaReasonCacheHit)
+		return
+	}
+	s.CommitRecognition(reservation, saved.ID)
+}
+
+func (s *Service) settleQuota(id uint, status, reason string, resultID *uint) {
+	ok, err := s.repo.SettleQuotaReservation(id, status, reason, resultID)
+	if err != nil {
+		log.Printf("settle quota reservation %d as %s failed: %v", id, status, err)
+		return
+	}
+	if !ok {
+		log.Printf("quota reservation %d already settled, skip %s (%s)", id, status, reason)
+	}
+}
+
+// holdForJobs 预占交给异步任务后随任务结算，不再按超时退回
+func (s *Service) holdForJobs(items []model.QuotaReservation) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if err := s.repo.KeepQuotaReservations(ids); err != nil {
+		log.Printf("keep quota reservations failed: %v", err)
+	}
+}
+
+// settleJobQuota 结算任务的预占；没有预占记录的旧任务按当前套餐直接退回
+func (s *Service) settleJobQuota(job *model.RecognitionJob, saved *model.RecognitionResult, reason string) {
+	if job.ReservationID != nil {
+		reservation := &model.QuotaReservation{ID: *job.ReservationID}
+		if saved != nil {
+			s.SettleRecognition(reservation, saved)
+		} else {
+			s.ReleaseRecognition(reservation, reason)
+		}
+		return
+	}
+	if saved != nil && !saved.CacheHit {
+		return
+	}
+	var user *model.User
+	if job.UserID > 0 {
+		if u, err := s.repo.GetUserByID(job.UserID); err == nil {
+			user = u
+		}
+	}
+	var err error
+	if user != nil && !isGuestUser(user) {
+		err = s.repo.RefundQuota(user.ID, "", s.getPlanSetting(user.Plan).RequireAd)
+	} else if job.DeviceID != "" {
+		err = s.repo.RefundQuota(0, job.DeviceID, s.getSettingBool(settingAnonRequireAd, true))
+	}
+	if err != nil {
+		log.Printf("refund legacy job %d failed: %v", job.ID, err)
+	}
+}
+
+// StartQuotaReaper 定期退回超时未结算的预占，覆盖实例崩溃等请求未走到结算的情况
+func (s *Service) StartQuotaReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(quotaReapInterval)
+		defer ticker.Stop()
+		for {
+			s.reapExpiredQuota(time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reapExpiredQuota 退回一批在 now 之前到期仍未结算的预占，返回处理的条数
+func (s *Service) reapExpiredQuota(now time.Time) int {
+	items, err := s.repo.ListExpiredQuotaReservations(now, quotaReapBatch)
+	if err != nil {
+		log.Printf("list expired quota reservations failed: %v", err)
+		return 0
+	}
+	for i := range items {
+		s.ReleaseRecognition(&items[i], QuotaReasonExpired)
+	}
+	return len(items)
+}
+
+// ListQuotaReservations 次数预占与结算记录
+func (s *Service) ListQuotaReservations(f QuotaReservationFilter, limit, offset int) ([]model.QuotaReservation, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	f.DeviceID = strings.TrimSpace(f.DeviceID)
+	f.Status = strings.TrimSpace(f.Status)
+	return s.repo.ListQuotaReservations(f, limit, offset)
+}
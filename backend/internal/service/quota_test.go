@@ -0,0 +1,165 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"errors"
+	"testing"
+	"time"
+)
+
+func loadUser(t *testing.T, s *Service, id uint) model.User {
+	t.Helper()
+	var u model.User
+	if err := s.repo.DB().First(&u, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func loadReservation(t *testing.T, s *Service, id uint) model.QuotaReservation {
+	t.Helper()
+	var r model.QuotaReservation
+	if err := s.repo.DB().First(&r, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReserveRequiresLoginOrDevice(t *testing.T) {
+	s := &Service{}
+	if _, err := s.ReserveRecognition(nil, " ", "upload"); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("anonymous without device = %v, want ErrLoginRequired", err)
+	}
+	if _, err := s.ReserveRecognitions(nil, 2, "batch"); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("batch without login = %v, want ErrLoginRequired", err)
+	}
+}
+
+func TestQuotaReserveCommitRelease(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 2)
+
+	first, err := s.ReserveRecognition(user, "", "upload")
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if first.Status != model.QuotaReserved || !first.AdCredit || first.ExpiresAt == nil {
+		t.Errorf("reservation = %+v", first)
+	}
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 1 || u.AdCredits != 1 {
+		t.Errorf("after reserve: used %d ad %d", u.QuotaUsed, u.AdCredits)
+	}
+
+	s.CommitRecognition(first, 99)
+	got := loadReservation(t, s, first.ID)
+	if got.Status != model.QuotaCommitted || got.Reason != QuotaReasonResultSaved || got.ResultID == nil || *got.ResultID != 99 || got.SettledAt == nil {
+		t.Errorf("committed reservation = %+v", got)
+	}
+	// 已结算的预占不能再退回
+	s.ReleaseRecognition(first, QuotaReasonFailed)
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 1 || u.AdCredits != 1 {
+		t.Errorf("release after commit refunded: used %d ad %d", u.QuotaUsed, u.AdCredits)
+	}
+
+	second, err := s.ReserveRecognition(user, "", "upload")
+	if err != nil {
+		t.Fatalf("second reserve: %v", err)
+	}
+	if _, err := s.ReserveRecognition(user, "", "upload"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("reserve over quota = %v, want ErrQuotaExceeded", err)
+	}
+	s.ReleaseRecognition(second, QuotaReasonFailed)
+	s.ReleaseRecognition(second, QuotaReasonFailed)
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 1 || u.AdCredits != 1 {
+		t.Errorf("double release: used %d ad %d, want one refund", u.QuotaUsed, u.AdCredits)
+	}
+	if got := loadReservation(t, s, second.ID); got.Status != model.QuotaReleased || got.Reason != QuotaReasonFailed {
+		t.Errorf("released reservation = %+v", got)
+	}
+}
+
+func TestQuotaReserveWithoutAdCredit(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 5)
+	if err := s.repo.DB().Model(user).UpdateColumn("ad_credits", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReserveRecognition(user, "", "upload"); !errors.Is(err, ErrAdRequired) {
+		t.Fatalf("err = %v, want ErrAdRequired", err)
+	}
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 0 {
+		t.Errorf("quota used = %d after rejected reservation", u.QuotaUsed)
+	}
+}
+
+func TestReserveRecognitionsAllOrNothing(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 2)
+	if _, err := s.ReserveRecognitions(user, 3, "batch"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+	}
+	items, err := s.ReserveRecognitions(user, 2, "batch")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("reserve 2 = %d, %v", len(items), err)
+	}
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 2 || u.AdCredits != 0 {
+		t.Errorf("used %d ad %d", u.QuotaUsed, u.AdCredits)
+	}
+}
+
+func TestSettleRecognitionReleasesCacheHits(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 2)
+	reservation, err := s.ReserveRecognition(user, "", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SettleRecognition(reservation, &model.RecognitionResult{ID: 5, CacheHit: true})
+	if got := loadReservation(t, s, reservation.ID); got.Status != model.QuotaReleased || got.Reason != QuotaReasonCacheHit {
+		t.Errorf("reservation = %+v", got)
+	}
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 0 || u.AdCredits != 2 {
+		t.Errorf("used %d ad %d, want full refund", u.QuotaUsed, u.AdCredits)
+	}
+}
+
+func TestReapExpiredQuota(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, 5)
+	items, err := s.ReserveRecognitions(user, 3, "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, live, held := items[0], items[1], items[2]
+	if err := s.repo.DB().Model(&model.QuotaReservation{}).Where("id = ?", expired.ID).UpdateColumn("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 交给异步任务的预占不按超时退回
+	s.holdForJobs([]model.QuotaReservation{held})
+
+	if n := s.reapExpiredQuota(time.Now()); n != 1 {
+		t.Fatalf("reaped %d, want 1", n)
+	}
+	if got := loadReservation(t, s, expired.ID); got.Status != model.QuotaReleased || got.Reason != QuotaReasonExpired {
+		t.Errorf("expired reservation = %+v", got)
+	}
+	for _, id := range []uint{live.ID, held.ID} {
+		if got := loadReservation(t, s, id); got.Status != model.QuotaReserved {
+			t.Errorf("reservation %d = %s, want reserved", id, got.Status)
+		}
+	}
+	if u := loadUser(t, s, user.ID); u.QuotaUsed != 2 || u.AdCredits != 3 {
+		t.Errorf("used %d ad %d after reaping one", u.QuotaUsed, u.AdCredits)
+	}
+	if n := s.reapExpiredQuota(time.Now()); n != 0 {
+		t.Errorf("second pass reaped %d", n)
+	}
+
+	// 超过持有时限后，未交给任务的预占全部退回
+	if n := s.reapExpiredQuota(time.Now().Add(s.quotaHoldTimeout() + time.Minute)); n != 1 {
+		t.Errorf("reaped %d after hold timeout, want 1", n)
+	}
+	if got := loadReservation(t, s, held.ID); got.Status != model.QuotaReserved {
+		t.Errorf("job reservation reaped: %s", got.Status)
+	}
+}
@@ -12,10 +12,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -26,6 +28,14 @@ type Service struct {
 	llm     llm.Provider
 	storage StorageInterface
 	auth    AuthConfig
+
+	calibMu   sync.RWMutex
+	calibMaps map[string]*calibrator // provider|crop_type -> 映射，nil 表示需要重新加载
+
+	jobWake     chan struct{} // 新任务提交时唤醒空闲的执行者
+	webhookWake chan struct{} // 新事件写入时唤醒空闲的投递者
+
+	shadowSlots chan struct{} // 影子识别并发上限，占满时跳过抽样
 }
 
 type StorageInterface interface {
@@ -36,11 +46,15 @@ type StorageInterface interface {
 
 // NewService 创建服务
 func NewService(repo *repository.Repository, provider llm.Provider, storage StorageInterface) *Service {
+	auth := loadAuthConfig()
 	return &Service{
-		repo:    repo,
-		llm:     provider,
-		storage: storage,
-		auth:    loadAuthConfig(),
+		repo:        repo,
+		llm:         provider,
+		storage:     storage,
+		auth:        auth,
+		jobWake:     make(chan struct{}, 1),
+		webhookWake: make(chan struct{}, 1),
+		shadowSlots: make(chan struct{}, max(auth.ShadowConcurrency, 1)),
 	}
 }
 
@@ -52,7 +66,7 @@ func (s *Service) ensureStorage() error {
 }
 
 // UploadImage 上传图片
-func (s *Service) UploadImage(userID uint, file *multipart.FileHeader, lat, lng *float64) (*model.Image, error) {
+func (s *Service) UploadImage(ctx context.Context, userID uint, file *multipart.FileHeader, lat, lng *float64) (*model.Image, error) {
 	if err := s.ensureStorage(); err != nil {
 		return nil, err
 	}
@@ -62,16 +76,18 @@ func (s *Service) UploadImage(userID uint, file *multipart.FileHeader, lat, lng
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
 
 	// 生成存储 key
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	filename := fmt.Sprintf("%d%s", time.Now().Unix(), ext)
 	key := s.storage.GenerateKey(userID, filename)
 
-	// 上传到对象存储
-	// 注意：这里需要将 context 转换为标准 context
-	// 在实际使用中，应传入 context.Context
-	url, err := s.storage.Upload(context.Background(), key, src)
+	// 上传原图到对象存储
+	url, err := s.storage.Upload(ctx, key, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload: %w", err)
 	}
@@ -80,13 +96,16 @@ func (s *Service) UploadImage(userID uint, file *multipart.FileHeader, lat, lng
 	img := &model.Image{
 		UserID:        userID,
 		OriginalURL:   url,
-		CompressedURL: url, // TODO: 压缩后再存储
-		FileSize:      file.Size,
+		CompressedURL: url,
+		FileSize:      int64(len(data)),
+		ContentHash:   contentHash(data),
 		Latitude:      lat,
 		Longitude:     lng,
 	}
+	// 生成展示图与缩略图
+	s.storeImageVariants(ctx, img, data)
 
-	err = s.repo.CreateImage(img)
+	err = s.repo.WithContext(ctx).CreateImage(img)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save image: %w", err)
 	}
@@ -95,7 +114,7 @@ func (s *Service) UploadImage(userID uint, file *multipart.FileHeader, lat, lng
 }
 
 // UploadImageBase64 上传 Base64 编码的图片（Web 端）
-func (s *Service) UploadImageBase64(userID uint, base64Data string, lat, lng *float64) (*model.Image, error) {
+func (s *Service) UploadImageBase64(ctx context.Context, userID uint, base64Data string, lat, lng *float64) (*model.Image, error) {
 	if err := s.ensureStorage(); err != nil {
 		return nil, err
 	}
@@ -104,7 +123,7 @@ func (s *Service) UploadImageBase64(userID uint, base64Data string, lat, lng *fl
 	if err != nil {
 		if strings.HasPrefix(base64Data, "data:") {
 			if comma := strings.Index(base64Data, ","); comma >= 0 {
-				return s.UploadImageBase64(userID, base64Data[comma+1:], lat, lng)
+				return s.UploadImageBase64(ctx, userID, base64Data[comma+1:], lat, lng)
 			}
 		}
 		return nil, fmt.Errorf("failed to decode base64: %w", err)
@@ -119,7 +138,7 @@ func (s *Service) UploadImageBase64(userID uint, base64Data string, lat, lng *fl
 	key := s.storage.GenerateKey(userID, filename)
 
 	// 上传到对象存储
-	url, err := s.storage.Upload(context.Background(), key, bytes.NewReader(data))
+	url, err := s.storage.Upload(ctx, key, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload: %w", err)
 	}
@@ -130,11 +149,13 @@ func (s *Service) UploadImageBase64(userID uint, base64Data string, lat, lng *fl
 		OriginalURL:   url,
 		CompressedURL: url,
 		FileSize:      int64(len(data)),
+		ContentHash:   contentHash(data),
 		Latitude:      lat,
 		Longitude:     lng,
 	}
+	s.storeImageVariants(ctx, img, data)
 
-	err = s.repo.CreateImage(img)
+	err = s.repo.WithContext(ctx).CreateImage(img)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save image: %w", err)
 	}
@@ -143,12 +164,12 @@ func (s *Service) UploadImageBase64(userID uint, base64Data string, lat, lng *fl
 }
 
 // GetImage 获取图片
-func (s *Service) GetImage(id uint) (*model.Image, error) {
-	return s.repo.GetImageByID(id)
+func (s *Service) GetImage(ctx context.Context, id uint) (*model.Image, error) {
+	return s.repo.WithContext(ctx).GetImageByID(id)
 }
 
 // CreateImageFromURL 创建外部图片记录
-func (s *Service) CreateImageFromURL(userID uint, imageURL string) (*model.Image, error) {
+func (s *Service) CreateImageFromURL(ctx context.Context, userID uint, imageURL string) (*model.Image, error) {
 	img := &model.Image{
 		UserID:        userID,
 		OriginalURL:   imageURL,
@@ -156,7 +177,7 @@ func (s *Service) CreateImageFromURL(userID uint, imageURL string) (*model.Image
 		FileSize:      0,
 	}
 
-	err := s.repo.CreateImage(img)
+	err := s.repo.WithContext(ctx).CreateImage(img)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save image: %w", err)
 	}
@@ -164,67 +185,243 @@ func (s *Service) CreateImageFromURL(userID uint, imageURL string) (*model.Image
 	return img, nil
 }
 
-// Recognize 调用大模型识别
-func (s *Service) Recognize(imageURL string) (*llm.RecognitionResult, error) {
-	return s.llm.Recognize(imageURL)
+// routeRecognizer 支持按请求信息路由的提供商
+type routeRecognizer interface {
+	RecognizeRoute(ctx context.Context, req llm.Request, info llm.RouteInfo) (*llm.RecognitionResult, error)
 }
 
-// SaveResult 保存识别结果
-func (s *Service) SaveResult(imageID uint, result *llm.RecognitionResult, source string, durationMs int) (*model.RecognitionResult, error) {
-	// 检查是否已存在结果
-	existing, err := s.repo.GetResultByImageID(imageID)
-	if err == nil && existing != nil {
-		// 已存在，更新
-		existing.RawText = result.RawText
-		existing.CropType = result.CropType
-		existing.Confidence = result.Confidence
-		existing.Description = result.Description
-		existing.GrowthStage = result.GrowthStage
-		existing.PossibleIssue = result.PossibleIssue
-		existing.Provider = s.llm.Name()
-		if source != "" {
-			existing.Source = source
+// RecognizeContext 为一次识别请求设置总时限，父 context 取消时一并取消
+func (s *Service) RecognizeContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if s.auth.RecognizeTimeoutSeconds <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(s.auth.RecognizeTimeoutSeconds)*time.Second)
+}
+
+// RecognizeOptions 识别请求参数
+type RecognizeOptions struct {
+	Source        string
+	Locale        string
+	Mode          string
+	Provider      string // 指定提供商，跳过路由与多提供商投票
+	Model         string // 指定模型，需同时指定提供商
+	PromptVersion int    // 指定提示词版本，0 使用生效版本
+	SkipCache     bool   // 不复用内容哈希缓存
+	DeviceID      string // 请求方设备 ID，用于实验分组
+}
+
+// Recognize 调用大模型识别，按用户套餐、来源和图片大小路由，使用生效的提示词模板；每次尝试记录 token 用量与费用
+// 未指定提供商与提示词版本时按运行中的实验分组，结果带上实验与分组
+func (s *Service) Recognize(ctx context.Context, user *model.User, img *model.Image, opts RecognizeOptions) (*llm.RecognitionResult, error) {
+	var exp *model.Experiment
+	var arm *model.ExperimentArm
+	if opts.Provider == "" && opts.PromptVersion == 0 {
+		if exp, arm = s.assignArm(user, opts.DeviceID); arm != nil {
+			opts.Provider, opts.Model, opts.PromptVersion = arm.Provider, arm.Model, arm.PromptVersion
+		}
+	}
+	rec := &llm.UsageRecorder{}
+	result, err := s.recognize(llm.WithUsageRecorder(ctx, rec), user, img, opts)
+	s.saveUsage(ctx, user, img, rec, err == nil)
+	if err == nil && arm != nil {
+		result.ExperimentID, result.ArmID = exp.ID, arm.ID
+	}
+	return result, err
+}
+
+func (s *Service) recognize(ctx context.Context, user *model.User, img *model.Image, opts RecognizeOptions) (*llm.RecognitionResult, error) {
+	mode, err := NormalizeMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	locale := promptLocale(opts.Locale)
+	prompt, promptVersion := s.renderPrompt(mode, locale, opts.PromptVersion)
+	// 展示图分辨率足够时交给提供商展示图
+	req := llm.Request{ImageURL: s.recognitionImageURL(img), Prompt: prompt}
+
+	provider := s.defaultLLM()
+	if opts.Provider != "" {
+		// 指定提供商时固定到该提供商，沿用路由的超时与熔断保护
+		pinned, err := s.pinLLM(opts.Provider)
+		if err != nil {
+			return nil, err
+		}
+		provider = pinned
+		req.Model = opts.Model
+	}
+	info := s.routeInfo(user, img, opts.Source)
+	ensemble := s.ensembleSettings(info.Plan)
+	if !opts.SkipCache {
+		providers := s.cacheProviders(provider, info, ensemble)
+		if opts.Provider != "" {
+			providers = []string{opts.Provider}
+		}
+		if cached := s.lookupCachedResult(ctx, img, mode, locale, promptVersion, providers, opts.Model); cached != nil {
+			return cached, nil
+		}
+	}
+	var result *llm.RecognitionResult
+	if opts.Provider == "" && ensemble.Mode == EnsembleAlways {
+		result, err = s.recognizeEnsemble(ctx, req, ensemble, nil)
+	} else if router, ok := provider.(routeRecognizer); ok {
+		result, err = router.RecognizeRoute(ctx, req, info)
+	} else {
+		result, err = provider.Recognize(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Provider == "" {
+		result.Provider = provider.Name()
+	}
+	if opts.Provider == "" && ensemble.Mode == EnsembleLowConfidence && result.Confidence < ensemble.Threshold && ctx.Err() == nil {
+		// 低置信度时追加其余成员投票，全部失败则保留单提供商结果
+		if voted, err := s.recognizeEnsemble(ctx, req, ensemble, result); err == nil {
+			result = voted
+		} else {
+			log.Printf("ensemble fallback failed: %v", err)
 		}
-		if durationMs > 0 {
-			existing.DurationMs = durationMs
+	}
+	result.PromptVersion = promptVersion
+	result.Mode = mode
+	result.Locale = locale
+	return result, nil
+}
+
+func (s *Service) routeInfo(user *model.User, img *model.Image, source string) llm.RouteInfo {
+	plan := "anonymous"
+	if user != nil && user.ID > 0 && !isGuestUser(user) {
+		plan = user.Plan
+		if plan == "" {
+			plan = "free"
 		}
-		return existing, s.repo.DB().Save(existing).Error
 	}
+	return llm.RouteInfo{
+		Plan:      plan,
+		Source:    source,
+		ImageSize: img.FileSize,
+	}
+}
+
+// SaveResult 保存识别结果
+// 已付费拿到的结果即使客户端已断开也要落库，因此不继承 ctx 的取消
+func (s *Service) SaveResult(ctx context.Context, imageID uint, result *llm.RecognitionResult, source string, durationMs int) (*model.RecognitionResult, error) {
+	saved, err := s.saveResult(ctx, imageID, result, source, durationMs, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	s.maybeShadow(saved)
+	return saved, nil
+}
 
-	// 创建新结果
+// saveResult 保存为图片的新版本，backfillID 标记批量重新识别产生的结果，makeCurrent 决定是否替换当前结果
+func (s *Service) saveResult(ctx context.Context, imageID uint, result *llm.RecognitionResult, source string, durationMs int, backfillID *uint, makeCurrent bool) (*model.RecognitionResult, error) {
+	if result.Provider == "" {
+		result.Provider = s.defaultLLM().Name()
+	}
+	mode := result.Mode
+	if mode == "" {
+		mode = ModeCrop
+	}
+	// 作物名归一化到目录代码，原始值单独保存
+	matcher, err := s.loadCropMatcher()
+	if err != nil {
+		log.Printf("load crop matcher failed: %v", err)
+	}
+	rawCrop := strings.TrimSpace(result.CropType)
+	normalized := *result
+	cropMatched := false
+	normalized.CropType, cropMatched = canonicalCropType(matcher, rawCrop)
+	normalized.Candidates = make([]llm.Candidate, 0, len(result.Candidates))
+	for _, c := range result.Candidates {
+		c.CropType, _ = canonicalCropType(matcher, c.CropType)
+		normalized.Candidates = append(normalized.Candidates, c)
+	}
+	result = &normalized
+	stageCode, stageLabel := s.resolveGrowthStage(result.CropType, result.GrowthStageCode, result.GrowthStage)
+	calibrated := s.calibrate(result.Provider, result.CropType, result.Confidence)
+	repo := s.repo.WithContext(context.WithoutCancel(ctx))
+	// 每次识别保存为新版本，旧版本及其反馈、手记、质检样本保持不变
 	saved := &model.RecognitionResult{
-		ImageID:       imageID,
-		RawText:       result.RawText,
-		CropType:      result.CropType,
-		Confidence:    result.Confidence,
-		Description:   result.Description,
-		GrowthStage:   result.GrowthStage,
-		PossibleIssue: result.PossibleIssue,
-		Provider:      s.llm.Name(),
-		Source:        source,
-		DurationMs:    durationMs,
-	}
-
-	err = s.repo.CreateResult(saved)
+		ImageID:              imageID,
+		RawText:              result.RawText,
+		CropType:             result.CropType,
+		CropTypeRaw:          rawCrop,
+		Confidence:           result.Confidence,
+		CalibratedConfidence: calibrated,
+		Description:          result.Description,
+		GrowthStage:          stageLabel,
+		GrowthStageCode:      stageCode,
+		PossibleIssue:        result.PossibleIssue,
+		Provider:             result.Provider,
+		Source:               source,
+		DurationMs:           durationMs,
+		PromptVersion:        result.PromptVersion,
+		Model:                result.Model,
+		Mode:                 mode,
+		Locale:               result.Locale,
+		CacheHit:             result.CachedFrom > 0,
+		CachedFromID:         cachedFromID(result),
+		BackfillID:           backfillID,
+		ExperimentID:         optionalID(result.ExperimentID),
+		ArmID:                optionalID(result.ArmID),
+	}
+
+	// 结果及其附属记录与通知的待投递记录同一事务提交；批量重新识别与未采用的版本不通知
+	publish := makeCurrent && backfillID == nil
+	err = repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.CreateResultVersion(saved, makeCurrent); err != nil {
+			return fmt.Errorf("failed to save result: %w", err)
+		}
+		if err := tx.ReplaceFindings(saved.ID, s.constrainFindings(mode, result.Findings)); err != nil {
+			return fmt.Errorf("failed to save findings: %w", err)
+		}
+		if err := tx.ReplaceCandidates(saved.ID, buildCandidates(result)); err != nil {
+			return fmt.Errorf("failed to save candidates: %w", err)
+		}
+		if len(result.Votes) > 0 {
+			if err := tx.ReplaceEnsembleVotes(saved.ID, buildEnsembleVotes(matcher, result)); err != nil {
+				return fmt.Errorf("failed to save ensemble votes: %w", err)
+			}
+		}
+		if err := tx.AttachUsageToResult(imageID, saved.ID, result.CropType); err != nil {
+			return fmt.Errorf("failed to attach usage: %w", err)
+		}
+		if publish {
+			return s.enqueueResultCreated(tx, saved)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to save result: %w", err)
+		return nil, err
+	}
+	if !cropMatched {
+		s.flagUnknownCrop(rawCrop, "result", &saved.ID)
+	}
+	if publish {
+		s.wakeWebhookWorker()
 	}
 
 	return saved, nil
 }
 
-// GetResultByImageID 根据图片 ID 获取识别结果
+// GetResultByImageID 根据图片 ID 获取当前识别结果
 func (s *Service) GetResultByImageID(imageID uint) (*model.RecognitionResult, error) {
 	return s.repo.GetResultByImageID(imageID)
 }
 
+// ListResultVersions 图片的识别结果历史，新版本在前
+func (s *Service) ListResultVersions(imageID uint) ([]model.RecognitionResult, error) {
+	return s.repo.ListResultVersions(imageID)
+}
+
 func (s *Service) GetResultByID(id uint) (*model.RecognitionResult, error) {
 	return s.repo.GetResultByID(id)
 }
 
 // GetHistory 获取用户历史记录
-func (s *Service) GetHistory(userID uint, limit, offset int, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64, source string) ([]model.RecognitionResult, error) {
-	return s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, source)
+func (s *Service) GetHistory(userID uint, limit, offset int, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64, source string, filter ResultFilter) ([]model.RecognitionResult, error) {
+	return s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, source, filter)
 }
 
 func (s *Service) GetFeedbackMap(resultIDs []uint) (map[uint]model.UserFeedback, error) {
@@ -244,14 +441,14 @@ func (s *Service) GetFeedbackMap(resultIDs []uint) (map[uint]model.UserFeedback,
 	return result, nil
 }
 
-func (s *Service) ExportHistoryCSV(w io.Writer, userID uint, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64) error {
+func (s *Service) ExportHistoryCSV(w io.Writer, userID uint, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64, filter ResultFilter) error {
 	writer := csv.NewWriter(w)
 	defer writer.Flush()
-	_ = writer.Write([]string{"result_id", "image_id", "image_url", "latitude", "longitude", "crop_type", "confidence", "provider", "feedback_correct", "created_at"})
+	_ = writer.Write([]string{"result_id", "image_id", "image_url", "latitude", "longitude", "crop_type", "confidence", "growth_stage_code", "growth_stage", "provider", "feedback_correct", "created_at"})
 	limit := 1000
 	offset := 0
 	for {
-		items, err := s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng)
+		items, err := s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, "", filter)
 		if err != nil {
 			return err
 		}
@@ -270,6 +467,14 @@ func (s *Service) ExportHistoryCSV(w io.Writer, userID uint, startDate, endDate
 			lat := ""
 			lng := ""
 			feedback := ""
+			stageCode := ""
+			stageLabel := ""
+			if r.GrowthStageCode != nil {
+				stageCode = *r.GrowthStageCode
+			}
+			if r.GrowthStage != nil {
+				stageLabel = *r.GrowthStage
+			}
 			if r.Image.Latitude != nil {
 				lat = strconv.FormatFloat(*r.Image.Latitude, 'f', 6, 64)
 			}
@@ -287,6 +492,8 @@ func (s *Service) ExportHistoryCSV(w io.Writer, userID uint, startDate, endDate
 				lng,
 				r.CropType,
 				strconv.FormatFloat(r.Confidence, 'f', 4, 64),
+				stageCode,
+				stageLabel,
 				r.Provider,
 				feedback,
 				r.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -297,7 +504,7 @@ func (s *Service) ExportHistoryCSV(w io.Writer, userID uint, startDate, endDate
 	return writer.Error()
 }
 
-func (s *Service) ExportHistoryJSON(w io.Writer, userID uint, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64) error {
+func (s *Service) ExportHistoryJSON(w io.Writer, userID uint, startDate, endDate *time.Time, cropType string, minConf, maxConf, minLat, maxLat, minLng, maxLng *float64, filter ResultFilter) error {
 	encoder := json.NewEncoder(w)
 	_, err := io.WriteString(w, "[")
 	if err != nil {
@@ -307,7 +514,7 @@ func (s *Service) ExportHistoryJSON(w io.Writer, userID uint, startDate, endDate
 	offset := 0
 	first := true
 	for {
-		items, err := s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng)
+		items, err := s.repo.GetResultsByUserID(userID, limit, offset, startDate, endDate, cropType, minConf, maxConf, minLat, maxLat, minLng, maxLng, "", filter)
 		if err != nil {
 			return err
 		}
@@ -324,15 +531,17 @@ func (s *Service) ExportHistoryJSON(w io.Writer, userID uint, startDate, endDate
 		}
 		for _, r := range items {
 			row := map[string]interface{}{
-				"result_id":  r.ID,
-				"image_id":   r.ImageID,
-				"image_url":  r.Image.OriginalURL,
-				"latitude":   r.Image.Latitude,
-				"longitude":  r.Image.Longitude,
-				"crop_type":  r.CropType,
-				"confidence": r.Confidence,
-				"provider":   r.Provider,
-				"created_at": r.CreatedAt.Format("2006-01-02 15:04:05"),
+				"result_id":         r.ID,
+				"image_id":          r.ImageID,
+				"image_url":         r.Image.OriginalURL,
+				"latitude":          r.Image.Latitude,
+				"longitude":         r.Image.Longitude,
+				"crop_type":         r.CropType,
+				"confidence":        r.Confidence,
+				"growth_stage_code": r.GrowthStageCode,
+				"growth_stage":      r.GrowthStage,
+				"provider":          r.Provider,
+				"created_at":        r.CreatedAt.Format("2006-01-02 15:04:05"),
 			}
 			if fb, ok := feedbackMap[r.ID]; ok {
 				row["feedback_correct"] = fb.IsCorrect
@@ -355,11 +564,18 @@ func (s *Service) ExportHistoryJSON(w io.Writer, userID uint, startDate, endDate
 
 // SaveFeedback 保存用户反馈
 func (s *Service) SaveFeedback(feedback *model.UserFeedback) error {
-	if err := s.repo.CreateFeedback(feedback); err != nil {
+	err := s.repo.Transaction(func(tx *repository.Repository) error {
+		if err := tx.CreateFeedback(feedback); err != nil {
+			return err
+		}
+		return s.enqueueFeedbackCreated(tx, feedback)
+	})
+	if err != nil {
 		return err
 	}
 	_ = s.repo.UpdateNoteFeedback(feedback.ResultID, feedback)
 	_ = s.ensureFeedbackNote(feedback)
+	s.wakeWebhookWorker()
 	return nil
 }
 
@@ -375,7 +591,7 @@ func (s *Service) ensureFeedbackNote(feedback *model.UserFeedback) error {
 	if err != nil {
 		return err
 	}
-	_, err = s.repo.GetNoteByResultID(img.UserID, result.ID)
+	_, err = s.repo.GetUserNoteByResultID(img.UserID, result.ID)
 	if err == nil {
 		return nil
 	}
@@ -400,6 +616,7 @@ func (s *Service) ensureFeedbackNote(feedback *model.UserFeedback) error {
 		Confidence:       result.Confidence,
 		Description:      result.Description,
 		GrowthStage:      result.GrowthStage,
+		GrowthStageCode:  result.GrowthStageCode,
 		PossibleIssue:    result.PossibleIssue,
 		Provider:         result.Provider,
 		IsCorrect:        &isCorrect,
@@ -448,6 +665,7 @@ func (s *Service) CreateNote(userID uint, imageID uint, resultID *uint, note str
 		item.Confidence = result.Confidence
 		item.Description = result.Description
 		item.GrowthStage = result.GrowthStage
+		item.GrowthStageCode = result.GrowthStageCode
 		item.PossibleIssue = result.PossibleIssue
 		item.Provider = result.Provider
 	}
@@ -518,14 +736,36 @@ func (s *Service) ListProviders() []string {
 	return llm.ListProviders()
 }
 
-// SetLLMProvider 设置大模型提供商
+// SetLLMProvider 设置默认大模型提供商，保存到系统设置，所有实例及重启后生效；name 为空恢复启动配置的路由
 func (s *Service) SetLLMProvider(name string) error {
-	provider, err := llm.GetProvider(name)
-	if err != nil {
-		return err
+	_, err := s.UpdateAppSetting(settingLLMProvider, name)
+	return err
+}
+
+// defaultLLM 系统设置指定了已注册的提供商时使用只含该提供商的路由，否则使用启动配置的路由
+func (s *Service) defaultLLM() llm.Provider {
+	if name := strings.TrimSpace(s.getSettingString(settingLLMProvider)); name != "" {
+		if pinned, err := s.pinLLM(name); err == nil {
+			return pinned
+		}
 	}
-	s.llm = provider
-	return nil
+	return s.llm
+}
+
+// pinLLM 只含指定提供商的路由，沿用启动配置的超时，仍受熔断保护
+func (s *Service) pinLLM(name string) (*llm.RouterProvider, error) {
+	if router, ok := s.llm.(*llm.RouterProvider); ok {
+		return router.Pin(name)
+	}
+	return llm.NewRouterProvider(llm.RouterConfig{Chain: []string{name}})
+}
+
+// ProviderHealth 各提供商熔断状态与近期错误率，probe 为 true 时先同步探测一轮
+func (s *Service) ProviderHealth(ctx context.Context, probe bool) []llm.BreakerSnapshot {
+	if probe {
+		llm.ProbeProviders(ctx, 10*time.Second)
+	}
+	return llm.BreakerSnapshots()
 }
 
 // GetDB 获取数据库连接（用于事务）
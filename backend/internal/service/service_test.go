@@ -0,0 +1,85 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var testSeq atomic.Int64
+
+// newTestService 连接 TEST_DATABASE_DSN（key=value 形式）指定的 Postgres，在独立 schema 中迁移后创建服务；
+// 未设置时跳过需要数据库的测试
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), testSeq.Add(1))
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	repo, err := repository.NewRepository(dsn + " search_path=" + schema)
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := repo.DB().DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewService(repo, llm.NewMockProvider(), nil)
+}
+
+// createTestUser 创建带配额的免费用户；免费套餐识别需扣广告额度，额度与次数相同
+func createTestUser(t *testing.T, s *Service, quota int) *model.User {
+	t.Helper()
+	n := testSeq.Add(1)
+	user := &model.User{
+		OpenID:     fmt.Sprintf("openid-%d", n),
+		Email:      fmt.Sprintf("user%d@example.com", n),
+		Plan:       "free",
+		Status:     "active",
+		QuotaTotal: quota,
+		AdCredits:  quota,
+	}
+	if err := s.repo.DB().Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// createTestImage 创建指定内容哈希的图片记录
+func createTestImage(t *testing.T, s *Service, userID uint, hash string) *model.Image {
+	t.Helper()
+	img := &model.Image{
+		UserID:      userID,
+		OriginalURL: fmt.Sprintf("https://img.example.com/%d.jpg", testSeq.Add(1)),
+		ContentHash: hash,
+		FileSize:    1024,
+	}
+	if err := s.repo.DB().Create(img).Error; err != nil {
+		t.Fatalf("create image: %v", err)
+	}
+	return img
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"agri-scan/internal/llm"
 	"errors"
 	"strconv"
 	"strings"
@@ -12,6 +13,12 @@ const (
 	settingLabelEnabled    = "label_flow_enabled"
 	settingLabelTemplates  = "label_templates_json"
 	settingCropSuggestions = "crop_list_json"
+	settingCacheTTLMinutes = "recognition_cache_ttl_minutes"
+	settingPriceTable      = "llm_price_table_json"
+	settingShadowProvider  = "shadow_provider"
+	settingShadowPrompt    = "shadow_prompt_version"
+	settingShadowPercent   = "shadow_percent"
+	settingLLMProvider     = "llm_provider"
 )
 
 type SettingItem struct {
@@ -64,6 +71,42 @@ func (s *Service) settingDefs() []settingDef {
 			Description: "第一批作物清单(JSON数组)",
 			Default:     `["水稻","小麦","玉米","大豆","番茄","黄瓜","柑橘","苹果"]`,
 		},
+		{
+			Key:         settingCacheTTLMinutes,
+			Type:        "int",
+			Description: "相同图片识别结果缓存有效期(分钟，0 关闭)",
+			Default:     strconv.Itoa(s.auth.RecognitionCacheTTLMinutes),
+		},
+		{
+			Key:         settingPriceTable,
+			Type:        "string",
+			Description: "模型价格表(JSON对象，键为 provider/model、model 或 provider)",
+			Default:     s.auth.LLMPriceTable,
+		},
+		{
+			Key:         settingShadowProvider,
+			Type:        "string",
+			Description: "影子模式候选提供商(为空时沿用生产提供商)",
+			Default:     s.auth.ShadowProvider,
+		},
+		{
+			Key:         settingShadowPrompt,
+			Type:        "int",
+			Description: "影子模式候选提示词版本(0 沿用生产版本)",
+			Default:     strconv.Itoa(s.auth.ShadowPromptVersion),
+		},
+		{
+			Key:         settingShadowPercent,
+			Type:        "int",
+			Description: "影子模式抽样比例(0-100，0 关闭)",
+			Default:     strconv.Itoa(s.auth.ShadowPercent),
+		},
+		{
+			Key:         settingLLMProvider,
+			Type:        "string",
+			Description: "默认识别提供商(为空时使用启动配置的路由与降级链)",
+			Default:     "",
+		},
 	}
 }
 
@@ -96,6 +139,11 @@ func (s *Service) UpdateAppSetting(key, value string) (SettingItem, error) {
 	if err != nil {
 		return SettingItem{}, err
 	}
+	if key == settingLLMProvider && normalized != "" {
+		if _, err := llm.GetProvider(normalized); err != nil {
+			return SettingItem{}, err
+		}
+	}
 	if _, err := s.repo.UpsertAppSetting(key, normalized); err != nil {
 		return SettingItem{}, err
 	}
@@ -169,3 +217,13 @@ func (s *Service) getSettingBool(key string, def bool) bool {
 	}
 	return def
 }
+
+func (s *Service) getSettingString(key string) string {
+	if item, err := s.repo.GetAppSettingByKey(key); err == nil && item != nil {
+		return item.Value
+	}
+	if def, ok := s.getSettingDef(key); ok {
+		return def.Default
+	}
+	return ""
+}
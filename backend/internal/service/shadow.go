@@ -0,0 +1,210 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"context"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const shadowReportMaxRows = 100000
+
+type ShadowRow = repository.ShadowRow
+
+// ShadowReport 按候选提供商/提示词版本汇总的影子对比；延迟在双方都成功的样本上比较，费用含失败尝试
+type ShadowReport struct {
+	Provider          string  `json:"provider"`
+	PromptVersion     int     `json:"prompt_version"`
+	Total             int64   `json:"total"`
+	Errors            int64   `json:"errors"`
+	Compared          int64   `json:"compared"`
+	Agreed            int64   `json:"agreed"`
+	AgreementRate     float64 `json:"agreement_rate"`
+	AvgDurationMs     float64 `json:"avg_duration_ms"`
+	ProdAvgDurationMs float64 `json:"prod_avg_duration_ms"`
+	Cost              float64 `json:"cost"`
+	ProdCost          float64 `json:"prod_cost"`
+	FeedbackTotal     int64   `json:"feedback_total"` // 生产结果收到反馈的样本数
+	ProdCorrect       int64   `json:"prod_correct"`   // 反馈认为生产结果正确
+	ProdAccuracy      float64 `json:"prod_accuracy"`
+	ShadowJudged      int64   `json:"shadow_judged"` // 可由反馈判断候选对错的样本数
+	ShadowCorrect     int64   `json:"shadow_correct"`
+	ShadowAccuracy    float64 `json:"shadow_accuracy"`
+}
+
+// maybeShadow 按 shadow_percent 抽样线上识别，异步交给候选提供商/提示词再识别一次，结果不展示给用户
+func (s *Service) maybeShadow(prod *model.RecognitionResult) {
+	if prod.CacheHit {
+		return
+	}
+	percent := s.getSettingInt(settingShadowPercent, s.auth.ShadowPercent)
+	if percent <= 0 || (percent < 100 && rand.Intn(100) >= percent) {
+		return
+	}
+	provider := strings.TrimSpace(s.getSettingString(settingShadowProvider))
+	promptVersion := s.getSettingInt(settingShadowPrompt, s.auth.ShadowPromptVersion)
+	if provider == "" {
+		provider = prod.Provider
+	}
+	if provider == ensembleProvider || (provider == prod.Provider && (promptVersion == 0 || promptVersion == prod.PromptVersion)) {
+		return
+	}
+	select {
+	case s.shadowSlots <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-s.shadowSlots }()
+		s.runShadow(prod, provider, promptVersion)
+	}()
+}
+
+func (s *Service) runShadow(prod *model.RecognitionResult, provider string, promptVersion int) {
+	img, err := s.repo.GetImageByID(prod.ImageID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := s.RecognizeContext(context.Background())
+	defer cancel()
+	prompt, version := s.renderPrompt(prod.Mode, prod.Locale, promptVersion)
+	rec := &llm.UsageRecorder{}
+	ctx = llm.WithUsageRecorder(ctx, rec)
+	started := time.Now()
+	var result *llm.RecognitionResult
+	pinned, err := s.pinLLM(provider)
+	if err == nil {
+		result, err = pinned.Recognize(ctx, llm.Request{ImageURL: s.recognitionImageURL(img), Prompt: prompt})
+	}
+
+	item := &model.ShadowResult{
+		ResultID:          prod.ID,
+		ImageID:           prod.ImageID,
+		Mode:              prod.Mode,
+		Provider:          provider,
+		Model:             llm.ProviderModel(provider),
+		PromptVersion:     version,
+		DurationMs:        int(time.Since(started).Milliseconds()),
+		ProdProvider:      prod.Provider,
+		ProdPromptVersion: prod.PromptVersion,
+		ProdCropType:      prod.CropType,
+		ProdConfidence:    prod.Confidence,
+		ProdDurationMs:    prod.DurationMs,
+	}
+	table := s.priceTable()
+	for _, u := range rec.Items() {
+		item.PromptTokens += u.PromptTokens
+		item.CompletionTokens += u.CompletionTokens
+		item.Cost += estimateCost(table, u)
+	}
+	if cost, err := s.repo.SumResultCost(prod.ID); err == nil {
+		item.ProdCost = cost
+	}
+	if err != nil {
+		item.ErrorCode, item.ErrorMessage = classifyFailure(err)
+	} else {
+		matcher, _ := s.loadCropMatcher()
+		item.CropType, _ = canonicalCropType(matcher, result.CropType)
+		item.Confidence = result.Confidence
+		item.Agreed = sameCrop(matcher, prod.CropType, item.CropType)
+		if result.Model != "" {
+			item.Model = result.Model
+		}
+	}
+	if err := s.repo.CreateShadowResult(item); err != nil {
+		log.Printf("save shadow result for %d failed: %v", prod.ID, err)
+	}
+}
+
+func (s *Service) ListShadowResults(start, end *time.Time, provider string, agreed *bool, limit, offset int) ([]ShadowRow, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListShadowRows(start, end, strings.TrimSpace(provider), agreed, limit, offset)
+}
+
+// GetShadowReport 影子模式对比报告，结合生产结果之后收到的用户反馈：
+// 反馈认为正确时候选与生产一致即为正确；反馈给出更正作物时与更正值比较；仅标记错误且无更正时无法判断候选
+func (s *Service) GetShadowReport(start, end *time.Time) ([]ShadowReport, error) {
+	rows, err := s.repo.ListShadowRows(start, end, "", nil, shadowReportMaxRows, 0)
+	if err != nil {
+		return nil, err
+	}
+	matcher, _ := s.loadCropMatcher()
+	type key struct {
+		provider string
+		version  int
+	}
+	groups := map[key]*ShadowReport{}
+	durations := map[key][2]int64{}
+	for _, row := range rows {
+		k := key{row.Provider, row.PromptVersion}
+		rep, ok := groups[k]
+		if !ok {
+			rep = &ShadowReport{Provider: row.Provider, PromptVersion: row.PromptVersion}
+			groups[k] = rep
+		}
+		rep.Total++
+		rep.Cost += row.Cost
+		rep.ProdCost += row.ProdCost
+		if row.ErrorCode != "" {
+			rep.Errors++
+			continue
+		}
+		rep.Compared++
+		if row.Agreed {
+			rep.Agreed++
+		}
+		d := durations[k]
+		d[0] += int64(row.DurationMs)
+		d[1] += int64(row.ProdDurationMs)
+		durations[k] = d
+		if row.FeedbackCorrect == nil {
+			continue
+		}
+		rep.FeedbackTotal++
+		switch {
+		case *row.FeedbackCorrect:
+			rep.ProdCorrect++
+			rep.ShadowJudged++
+			if row.Agreed {
+				rep.ShadowCorrect++
+			}
+		case row.FeedbackCorrectedType != nil && strings.TrimSpace(*row.FeedbackCorrectedType) != "":
+			rep.ShadowJudged++
+			if sameCrop(matcher, strings.TrimSpace(*row.FeedbackCorrectedType), row.CropType) {
+				rep.ShadowCorrect++
+			}
+		}
+	}
+	out := make([]ShadowReport, 0, len(groups))
+	for k, rep := range groups {
+		if rep.Compared > 0 {
+			rep.AgreementRate = float64(rep.Agreed) / float64(rep.Compared)
+			rep.AvgDurationMs = float64(durations[k][0]) / float64(rep.Compared)
+			rep.ProdAvgDurationMs = float64(durations[k][1]) / float64(rep.Compared)
+		}
+		if rep.FeedbackTotal > 0 {
+			rep.ProdAccuracy = float64(rep.ProdCorrect) / float64(rep.FeedbackTotal)
+		}
+		if rep.ShadowJudged > 0 {
+			rep.ShadowAccuracy = float64(rep.ShadowCorrect) / float64(rep.ShadowJudged)
+		}
+		out = append(out, *rep)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider == out[j].Provider {
+			return out[i].PromptVersion > out[j].PromptVersion
+		}
+		return out[i].Provider < out[j].Provider
+	})
+	return out, nil
+}
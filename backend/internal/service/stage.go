@@ -0,0 +1,61 @@
+package service
+
+import (
+	"agri-scan/internal/model"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// NormalizeStageCode 将 "31"、"BBCH 31"、"5" 等写法规整为两位 BBCH 代码
+func NormalizeStageCode(raw string) (string, bool) {
+	code := strings.TrimSpace(strings.ToUpper(raw))
+	code = strings.TrimSpace(strings.TrimPrefix(code, "BBCH"))
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 || n > 99 {
+		return "", false
+	}
+	if n < 10 {
+		return "0" + strconv.Itoa(n), true
+	}
+	return strconv.Itoa(n), true
+}
+
+// GetCropStages 返回作物的 BBCH 生育期表
+func (s *Service) GetCropStages(cropCode string) ([]model.CropStage, error) {
+	return s.repo.GetCropStages(strings.TrimSpace(cropCode))
+}
+
+// resolveGrowthStage 按作物生育期表校验模型返回的代码，通过时名称取表中标签，否则丢弃代码保留原始文本
+func (s *Service) resolveGrowthStage(cropType string, code, label *string) (*string, *string) {
+	if code == nil {
+		return nil, label
+	}
+	normalized, ok := NormalizeStageCode(*code)
+	if !ok {
+		return nil, label
+	}
+	stage, err := s.repo.GetCropStage(strings.ToLower(strings.TrimSpace(cropType)), normalized)
+	if err != nil {
+		return nil, label
+	}
+	name := stage.Label
+	return &normalized, &name
+}
+
+// stageListJSON 提示词占位符 {{stage_list_json}}：{"wheat":{"31":"拔节期",...}}
+func (s *Service) stageListJSON() string {
+	items, err := s.repo.GetCropStages("")
+	if err != nil {
+		return "{}"
+	}
+	out := map[string]map[string]string{}
+	for _, item := range items {
+		if out[item.CropCode] == nil {
+			out[item.CropCode] = map[string]string{}
+		}
+		out[item.CropCode][item.Code] = item.Label
+	}
+	data, _ := json.Marshal(out)
+	return string(data)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type UsageSummary = repository.UsageSummaryRow
+
+// ModelPrice 单个模型的价格，token 价格按每千 token 计
+type ModelPrice struct {
+	PromptPer1K     float64 `json:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k"`
+	PerCall         float64 `json:"per_call"`
+}
+
+// priceTable 读取价格表，键为 provider/model、model 或 provider，依次匹配
+func (s *Service) priceTable() map[string]ModelPrice {
+	raw := strings.TrimSpace(s.getSettingString(settingPriceTable))
+	if raw == "" {
+		return nil
+	}
+	var table map[string]ModelPrice
+	if err := json.Unmarshal([]byte(raw), &table); err != nil {
+		log.Printf("invalid %s: %v", settingPriceTable, err)
+		return nil
+	}
+	return table
+}
+
+// estimateCost 按价格表估算一次尝试的费用，未配置价格的模型记为 0
+func estimateCost(table map[string]ModelPrice, u llm.Usage) float64 {
+	price, ok := table[u.Provider+"/"+u.Model]
+	if !ok {
+		price, ok = table[u.Model]
+	}
+	if !ok {
+		price, ok = table[u.Provider]
+	}
+	if !ok {
+		return 0
+	}
+	return float64(u.PromptTokens)/1000*price.PromptPer1K +
+		float64(u.CompletionTokens)/1000*price.CompletionPer1K +
+		float64(u.Calls)*price.PerCall
+}
+
+// saveUsage 记录一次识别尝试的用量，客户端断开或失败的尝试同样计费
+func (s *Service) saveUsage(ctx context.Context, user *model.User, img *model.Image, rec *llm.UsageRecorder, success bool) {
+	items := rec.Items()
+	if len(items) == 0 {
+		return
+	}
+	table := s.priceTable()
+	plan := s.routeInfo(user, img, "").Plan
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+	records := make([]model.UsageRecord, 0, len(items))
+	for _, u := range items {
+		imageID := img.ID
+		records = append(records, model.UsageRecord{
+			UserID:           userID,
+			Plan:             plan,
+			ImageID:          &imageID,
+			Provider:         u.Provider,
+			Model:            u.Model,
+			Calls:            u.Calls,
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			Cost:             estimateCost(table, u),
+			Success:          success,
+		})
+	}
+	if err := s.repo.WithContext(context.WithoutCancel(ctx)).CreateUsageRecords(records); err != nil {
+		log.Printf("save usage failed: %v", err)
+	}
+}
+
+// usageGroups 允许的汇总维度
+var usageGroups = map[string]string{
+	"provider": "provider",
+	"model":    "model",
+	"plan":     "plan",
+	"crop":     "crop_type",
+	"user":     "CAST(user_id AS TEXT)",
+	"day":      "to_char(created_at, 'YYYY-MM-DD')",
+}
+
+// SummarizeUsage 按维度汇总用量与费用
+func (s *Service) SummarizeUsage(group string, start, end *time.Time) ([]UsageSummary, error) {
+	expr, ok := usageGroups[group]
+	if !ok {
+		expr = usageGroups["provider"]
+	}
+	return s.repo.SummarizeUsage(expr, start, end)
+}
+
+var usageExportHeader = []string{"day", "user_id", "plan", "provider", "model", "attempts", "calls", "prompt_tokens", "completion_tokens", "cost", "failed_cost"}
+
+// ExportUsageCSV 按天、用户、提供商/模型导出用量，用于对账
+func (s *Service) ExportUsageCSV(w io.Writer, userID uint, start, end *time.Time) error {
+	rows, err := s.repo.ListUsageDaily(userID, start, end)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	_ = writer.Write(usageExportHeader)
+	for _, row := range rows {
+		_ = writer.Write([]string{
+			row.Day,
+			strconv.FormatUint(uint64(row.UserID), 10),
+			row.Plan,
+			row.Provider,
+			row.Model,
+			strconv.FormatInt(row.Attempts, 10),
+			strconv.FormatInt(row.Calls, 10),
+			strconv.FormatInt(row.PromptTokens, 10),
+			strconv.FormatInt(row.CompletionTokens, 10),
+			strconv.FormatFloat(row.Cost, 'f', 6, 64),
+			strconv.FormatFloat(row.FailedCost, 'f', 6, 64),
+		})
+	}
+	return writer.Error()
+}
+
+func (s *Service) ExportUsageJSON(w io.Writer, userID uint, start, end *time.Time) error {
+	rows, err := s.repo.ListUsageDaily(userID, start, end)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"agri-scan/internal/repository"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookInvalid       = errors.New("invalid webhook subscription")
+	ErrWebhookNotReplayable = errors.New("only succeeded or dead deliveries can be replayed")
+)
+
+const (
+	webhookPollInterval   = 2 * time.Second
+	webhookRetryBase      = 30 * time.Second
+	webhookRetryMaxDelay  = time.Hour
+	webhookErrorBodyLimit = 256
+)
+
+// WebhookEventTypes 可订阅的事件类型
+var WebhookEventTypes = []string{
+	model.WebhookResultCreated,
+	model.WebhookFeedbackCreated,
+	model.WebhookLabelApproved,
+	model.WebhookMembershipApproved,
+}
+
+type WebhookDeliveryFilter = repository.WebhookDeliveryFilter
+
+// WebhookSubscriptionInput 创建或修改订阅，修改时为空的字段保持不变
+type WebhookSubscriptionInput struct {
+	Name    *string
+	URL     *string
+	Events  []string
+	Secret  *string
+	Enabled *bool
+}
+
+// WebhookEvent 投递给订阅方的请求体
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhookSubscription 创建订阅，未指定密钥时生成；返回的密钥只在创建时展示
+func (s *Service) CreateWebhookSubscription(in WebhookSubscriptionInput) (*model.WebhookSubscription, string, error) {
+	item := &model.WebhookSubscription{Enabled: true}
+	if in.URL == nil {
+		return nil, "", fmt.Errorf("%w: url required", ErrWebhookInvalid)
+	}
+	if in.Secret == nil || strings.TrimSpace(*in.Secret) == "" {
+		secret := newWebhookSecret()
+		in.Secret = &secret
+	}
+	fields, err := webhookFields(in)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := fields["events"]; !ok {
+		return nil, "", fmt.Errorf("%w: events required", ErrWebhookInvalid)
+	}
+	item.URL = fields["url"].(string)
+	item.Events = fields["events"].(string)
+	item.Secret = fields["secret"].(string)
+	if v, ok := fields["name"]; ok {
+		item.Name = v.(string)
+	}
+	if v, ok := fields["enabled"]; ok {
+		item.Enabled = v.(bool)
+	}
+	if err := s.repo.CreateWebhookSubscription(item); err != nil {
+		return nil, "", err
+	}
+	return item, item.Secret, nil
+}
+
+// UpdateWebhookSubscription 修改订阅
+func (s *Service) UpdateWebhookSubscription(id uint, in WebhookSubscriptionInput) (*model.WebhookSubscription, error) {
+	if _, err := s.repo.GetWebhookSubscription(id); err != nil {
+		return nil, err
+	}
+	fields, err := webhookFields(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		if err := s.repo.UpdateWebhookSubscription(id, fields); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.GetWebhookSubscription(id)
+}
+
+// webhookFields 校验输入并转换为待更新字段
+func webhookFields(in WebhookSubscriptionInput) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if in.Name != nil {
+		fields["name"] = strings.TrimSpace(*in.Name)
+	}
+	if in.URL != nil {
+		raw := strings.TrimSpace(*in.URL)
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > 512 {
+			return nil, fmt.Errorf("%w: url must be an absolute http(s) url", ErrWebhookInvalid)
+		}
+		fields["url"] = raw
+	}
+	if in.Events != nil {
+		events := make([]string, 0, len(in.Events))
+		for _, event := range in.Events {
+			event = strings.TrimSpace(event)
+			if !slices.Contains(WebhookEventTypes, event) {
+				return nil, fmt.Errorf("%w: unknown event %q", ErrWebhookInvalid, event)
+			}
+			events = append(events, event)
+		}
+		if len(events) == 0 {
+			return nil, fmt.Errorf("%w: events required", ErrWebhookInvalid)
+		}
+		fields["events"] = joinTags(events)
+	}
+	if in.Secret != nil {
+		secret := strings.TrimSpace(*in.Secret)
+		if len(secret) < 16 || len(secret) > 128 {
+			return nil, fmt.Errorf("%w: secret must be 16-128 characters", ErrWebhookInvalid)
+		}
+		fields["secret"] = secret
+	}
+	if in.Enabled != nil {
+		fields["enabled"] = *in.Enabled
+	}
+	return fields, nil
+}
+
+func newWebhookSecret() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+func (s *Service) GetWebhookSubscription(id uint) (*model.WebhookSubscription, error) {
+	return s.repo.GetWebhookSubscription(id)
+}
+
+func (s *Service) ListWebhookSubscriptions(limit, offset int) ([]model.WebhookSubscription, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListWebhookSubscriptions(limit, offset)
+}
+
+func (s *Service) DeleteWebhookSubscription(id uint) error {
+	return s.repo.DeleteWebhookSubscription(id)
+}
+
+// enqueueWebhook 在 repo 绑定的业务事务中为订阅了该事件的每个订阅写入一条待投递记录，没有订阅时不构造事件内容；
+// 出错时返回错误由业务事务一并回滚，事务提交后调用 wakeWebhookWorker
+func (s *Service) enqueueWebhook(repo *repository.Repository, eventType string, build func() (interface{}, error)) error {
+	subs, err := repo.ListEnabledWebhookSubscriptions()
+	if err != nil {
+		return fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+	matched := make([]model.WebhookSubscription, 0, len(subs))
+	for _, sub := range subs {
+		if slices.Contains(strings.Split(sub.Events, ","), eventType) {
+			matched = append(matched, sub)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	data, err := build()
+	if err != nil {
+		return fmt.Errorf("build webhook event %s: %w", eventType, err)
+	}
+	event := WebhookEvent{ID: "evt_" + newLockToken(), Type: eventType, CreatedAt: time.Now(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal webhook event %s: %w", eventType, err)
+	}
+	items := make([]model.WebhookDelivery, 0, len(matched))
+	for _, sub := range matched {
+		items = append(items, model.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         model.WebhookPending,
+			MaxAttempts:    s.webhookMaxAttempts(),
+			NextAttemptAt:  event.CreatedAt,
+		})
+	}
+	if err := repo.CreateWebhookDeliveries(items); err != nil {
+		return fmt.Errorf("save webhook event %s: %w", eventType, err)
+	}
+	return nil
+}
+
+func (s *Service) webhookMaxAttempts() int {
+	return max(s.auth.WebhookMaxAttempts, 1)
+}
+
+func (s *Service) webhookTimeout() time.Duration {
+	return time.Duration(max(s.auth.WebhookTimeoutSeconds, 1)) * time.Second
+}
+
+func (s *Service) wakeWebhookWorker() {
+	select {
+	case s.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueResultCreated 识别结果保存后通知订阅方
+func (s *Service) enqueueResultCreated(tx *repository.Repository, saved *model.RecognitionResult) error {
+	return s.enqueueWebhook(tx, model.WebhookResultCreated, func() (interface{}, error) {
+		img, err := tx.GetImageByID(saved.ImageID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"user_id": img.UserID, "image_id": img.ID, "result": saved}, nil
+	})
+}
+
+// enqueueFeedbackCreated 用户提交反馈后通知订阅方
+func (s *Service) enqueueFeedbackCreated(tx *repository.Repository, feedback *model.UserFeedback) error {
+	return s.enqueueWebhook(tx, model.WebhookFeedbackCreated, func() (interface{}, error) {
+		result, err := tx.GetResultByID(feedback.ResultID)
+		if err != nil {
+			return nil, err
+		}
+		img, err := tx.GetImageByID(result.ImageID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"user_id": img.UserID, "image_id": img.ID, "feedback": feedback}, nil
+	})
+}
+
+// enqueueLabelApproved 标注审核通过后通知订阅方
+func (s *Service) enqueueLabelApproved(tx *repository.Repository, note *model.FieldNote) error {
+	return s.enqueueWebhook(tx, model.WebhookLabelApproved, func() (interface{}, error) {
+		return map[string]interface{}{"user_id": note.UserID, "note": note}, nil
+	})
+}
+
+// enqueueMembershipApproved 会员申请通过后通知订阅方
+func (s *Service) enqueueMembershipApproved(tx *repository.Repository, req *model.MembershipRequest, user *model.User) error {
+	return s.enqueueWebhook(tx, model.WebhookMembershipApproved, func() (interface{}, error) {
+		return map[string]interface{}{"request_id": req.ID, "user_id": user.ID, "plan": user.Plan, "quota_total": user.QuotaTotal}, nil
+	})
+}
+
+// StartWebhookDispatcher 启动 WEBHOOK_WORKERS 个投递者，失败按退避重试，用尽次数后进入死信
+func (s *Service) StartWebhookDispatcher(ctx context.Context) {
+	client := &http.Client{
+		Timeout: s.webhookTimeout(),
+		// 不跟随跳转，3xx 视为失败
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	for i := 0; i < s.auth.WebhookWorkers; i++ {
+		go s.webhookWorker(ctx, client)
+	}
+}
+
+func (s *Service) webhookWorker(ctx context.Context, client *http.Client) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		delivery, err := s.repo.ClaimWebhookDelivery(newLockToken(), s.webhookTimeout()+30*time.Second)
+		if err != nil {
+			log.Printf("claim webhook delivery failed: %v", err)
+		}
+		if delivery != nil {
+			s.deliverWebhook(ctx, client, delivery)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.webhookWake:
+		case <-time.After(webhookPollInterval):
+		}
+	}
+}
+
+func (s *Service) deliverWebhook(ctx context.Context, client *http.Client, d *model.WebhookDelivery) {
+	sub, err := s.repo.GetWebhookSubscription(d.SubscriptionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.finishWebhook(d, model.WebhookDead, 0, "subscription deleted")
+		return
+	}
+	if err != nil {
+		s.retryWebhook(d, 0, err.Error())
+		return
+	}
+	if !sub.Enabled {
+		s.finishWebhook(d, model.WebhookDead, 0, "subscription disabled")
+		return
+	}
+
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		s.finishWebhook(d, model.WebhookDead, 0, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AgriScan-Webhook/1.0")
+	req.Header.Set("X-Webhook-Id", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(sub.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 服务关闭，放回队列且不计次数
+			s.requeueWebhook(d, time.Now(), d.Attempts-1, 0, "")
+			return
+		}
+		s.retryWebhook(d, 0, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		s.finishWebhook(d, model.WebhookSucceeded, resp.StatusCode, "")
+		return
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyLimit))
+	s.retryWebhook(d, resp.StatusCode, strings.TrimSpace(fmt.Sprintf("%s %s", resp.Status, snippet)))
+}
+
+// SignWebhook 签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制，接收方用相同方式校验并检查时间戳防重放
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryWebhook 未用尽次数时按退避重新排队，否则进入死信
+func (s *Service) retryWebhook(d *model.WebhookDelivery, statusCode int, msg string) {
+	if d.Attempts >= d.MaxAttempts {
+		s.finishWebhook(d, model.WebhookDead, statusCode, msg)
+		return
+	}
+	delay := llm.Backoff(d.Attempts, webhookRetryBase, webhookRetryMaxDelay)
+	s.requeueWebhook(d, time.Now().Add(delay), d.Attempts, statusCode, msg)
+}
+
+func (s *Service) requeueWebhook(d *model.WebhookDelivery, nextAt time.Time, attempts, statusCode int, msg string) {
+	ok, err := s.repo.FinishWebhookDelivery(d.ID, d.LockToken, map[string]interface{}{
+		"status":           model.WebhookPending,
+		"next_attempt_at":  nextAt,
+		"attempts":         attempts,
+		"last_status_code": statusCode,
+		"last_error":       limitText(msg, 512),
+	})
+	if err != nil || !ok {
+		log.Printf("requeue webhook delivery %d failed: ok=%v err=%v", d.ID, ok, err)
+	}
+}
+
+func (s *Service) finishWebhook(d *model.WebhookDelivery, status string, statusCode int, msg string) {
+	updates := map[string]interface{}{
+		"status":           status,
+		"last_status_code": statusCode,
+		"last_error":       limitText(msg, 512),
+	}
+	if status == model.WebhookSucceeded {
+		now := time.Now()
+		updates["delivered_at"] = &now
+	}
+	ok, err := s.repo.FinishWebhookDelivery(d.ID, d.LockToken, updates)
+	if err != nil || !ok {
+		log.Printf("finish webhook delivery %d failed: ok=%v err=%v", d.ID, ok, err)
+		return
+	}
+	if status == model.WebhookDead {
+		log.Printf("webhook delivery %d (%s) dead after %d attempts: %s", d.ID, d.EventType, d.Attempts, msg)
+	}
+}
+
+// limitText 截断到不超过 n 字节，不截断多字节字符
+func limitText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ListWebhookDeliveries 投递记录，status=dead 为死信列表
+func (s *Service) ListWebhookDeliveries(f WebhookDeliveryFilter, limit, offset int) ([]model.WebhookDelivery, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	f.Status = strings.TrimSpace(f.Status)
+	f.EventType = strings.TrimSpace(f.EventType)
+	f.EventID = strings.TrimSpace(f.EventID)
+	return s.repo.ListWebhookDeliveries(f, limit, offset)
+}
+
+func (s *Service) GetWebhookDelivery(id uint) (*model.WebhookDelivery, error) {
+	return s.repo.GetWebhookDelivery(id)
+}
+
+// ReplayWebhookDelivery 重新投递死信或已成功的记录，事件 ID 与内容不变
+func (s *Service) ReplayWebhookDelivery(id uint) (*model.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhookDelivery(id); err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.ReplayWebhookDelivery(id, s.webhookMaxAttempts())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrWebhookNotReplayable
+	}
+	s.wakeWebhookWorker()
+	return s.repo.GetWebhookDelivery(id)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"agri-scan/internal/llm"
+	"agri-scan/internal/model"
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const testWebhookSecret = "whsec_test_secret_0123"
+
+func TestSignWebhook(t *testing.T) {
+	got := SignWebhook(testWebhookSecret, "1700000000", []byte(`{"id":"evt_1"}`))
+	if want := "73f168c8f95cae26bf3b3104a1307c3040d4d7a17c3c699c8af06025c9c6bd14"; got != want {
+		t.Errorf("SignWebhook = %s, want %s", got, want)
+	}
+	if SignWebhook(testWebhookSecret, "1700000001", []byte(`{"id":"evt_1"}`)) == got {
+		t.Error("timestamp must be part of the signature")
+	}
+}
+
+func TestLimitText(t *testing.T) {
+	// “病害”每字 3 字节，截断不能留下半个字符
+	cases := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc"},
+		{"病害", 6, "病害"},
+		{"病害", 5, "病"},
+		{"病害", 4, "病"},
+		{"病害", 3, "病"},
+		{"病害", 2, ""},
+		{"ab病害", 4, "ab"},
+		{"叶斑病 leaf spot", 10, "叶斑病 "},
+	}
+	for _, tc := range cases {
+		got := limitText(tc.in, tc.n)
+		if got != tc.want || !utf8.ValidString(got) || len(got) > tc.n {
+			t.Errorf("limitText(%q, %d) = %q, want %q", tc.in, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestSaveResultPublishesOnlyNewCurrentResults(t *testing.T) {
+	s := newTestService(t)
+	createTestSubscription(t, s, "https://erp.example.com/hooks", true)
+	user := createTestUser(t, s, 10)
+	img := createTestImage(t, s, user.ID, contentHash([]byte("webhook-publish")))
+	ctx := context.Background()
+	countDeliveries := func() int64 {
+		var n int64
+		if err := s.repo.DB().Model(&model.WebhookDelivery{}).Where("event_type = ?", model.WebhookResultCreated).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if _, err := s.SaveResult(ctx, img.ID, &llm.RecognitionResult{CropType: "wheat", Confidence: 0.9, Provider: "mock"}, "upload", 10); err != nil {
+		t.Fatal(err)
+	}
+	if n := countDeliveries(); n != 1 {
+		t.Fatalf("deliveries after recognize = %d, want 1", n)
+	}
+	// 未采用的版本与批量重新识别产生的版本不通知
+	if _, err := s.saveResult(ctx, img.ID, &llm.RecognitionResult{CropType: "rice", Confidence: 0.8, Provider: "mock"}, "backfill", 10, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	runID := uint(1)
+	if _, err := s.saveResult(ctx, img.ID, &llm.RecognitionResult{CropType: "rice", Confidence: 0.8, Provider: "mock"}, "backfill", 10, &runID, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := countDeliveries(); n != 1 {
+		t.Errorf("deliveries = %d, want still 1", n)
+	}
+}
+
+// claimTestDelivery 为订阅写入一条待投递记录并以投递者身份领取
+func claimTestDelivery(t *testing.T, s *Service, sub *model.WebhookSubscription, maxAttempts int) *model.WebhookDelivery {
+	t.Helper()
+	item := model.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        fmt.Sprintf("evt_%d", testSeq.Add(1)),
+		EventType:      model.WebhookResultCreated,
+		Payload:        `{"type":"result.created"}`,
+		Status:         model.WebhookPending,
+		MaxAttempts:    maxAttempts,
+		NextAttemptAt:  time.Now().Add(-time.Second),
+	}
+	if err := s.repo.CreateWebhookDeliveries([]model.WebhookDelivery{item}); err != nil {
+		t.Fatal(err)
+	}
+	return claimNextDelivery(t, s)
+}
+
+func claimNextDelivery(t *testing.T, s *Service) *model.WebhookDelivery {
+	t.Helper()
+	d, err := s.repo.ClaimWebhookDelivery(newLockToken(), time.Minute)
+	if err != nil || d == nil {
+		t.Fatalf("claim = %v, %v", d, err)
+	}
+	return d
+}
+
+func createTestSubscription(t *testing.T, s *Service, url string, enabled bool) *model.WebhookSubscription {
+	t.Helper()
+	sub := &model.WebhookSubscription{URL: url, Secret: testWebhookSecret, Events: model.WebhookResultCreated, Enabled: enabled}
+	if err := s.repo.CreateWebhookSubscription(sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func TestDeliverWebhookSignsRequest(t *testing.T) {
+	s := newTestService(t)
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	sub := createTestSubscription(t, s, srv.URL, true)
+	d := claimTestDelivery(t, s, sub, 3)
+
+	s.deliverWebhook(context.Background(), srv.Client(), d)
+
+	if got == nil {
+		t.Fatal("subscriber was not called")
+	}
+	if string(gotBody) != d.Payload {
+		t.Errorf("body = %s", gotBody)
+	}
+	if got.Header.Get("X-Webhook-Id") != d.EventID || got.Header.Get("X-Webhook-Event") != d.EventType {
+		t.Errorf("event headers = %v", got.Header)
+	}
+	sig := strings.TrimPrefix(got.Header.Get("X-Webhook-Signature"), "sha256=")
+	want := SignWebhook(testWebhookSecret, got.Header.Get("X-Webhook-Timestamp"), gotBody)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		t.Errorf("signature %s does not verify", got.Header.Get("X-Webhook-Signature"))
+	}
+
+	stored, err := s.repo.GetWebhookDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.WebhookSucceeded || stored.LastStatusCode != http.StatusNoContent || stored.DeliveredAt == nil || stored.LockToken != "" {
+		t.Errorf("delivery = %+v", stored)
+	}
+}
+
+func TestDeliverWebhookRetriesThenDeadLetters(t *testing.T) {
+	s := newTestService(t)
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "busy")
+	}))
+	defer srv.Close()
+	sub := createTestSubscription(t, s, srv.URL, true)
+	d := claimTestDelivery(t, s, sub, 2)
+
+	before := time.Now()
+	s.deliverWebhook(context.Background(), srv.Client(), d)
+	stored, err := s.repo.GetWebhookDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.WebhookPending || stored.Attempts != 1 || stored.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("after first failure = %+v", stored)
+	}
+	if !strings.Contains(stored.LastError, "503") || !strings.Contains(stored.LastError, "busy") {
+		t.Errorf("last error = %q", stored.LastError)
+	}
+	// 第一次失败退避 webhookRetryBase 的后一半区间
+	if delay := stored.NextAttemptAt.Sub(before); delay < webhookRetryBase/2 || delay > webhookRetryBase+time.Second {
+		t.Errorf("next attempt in %s, want %s-%s", delay, webhookRetryBase/2, webhookRetryBase)
+	}
+
+	if err := s.repo.DB().Model(stored).UpdateColumn("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	d = claimNextDelivery(t, s)
+	if d.Attempts != 2 {
+		t.Fatalf("second claim attempts = %d", d.Attempts)
+	}
+	s.deliverWebhook(context.Background(), srv.Client(), d)
+	stored, err = s.repo.GetWebhookDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.WebhookDead || stored.Attempts != 2 || stored.DeliveredAt != nil {
+		t.Errorf("after last attempt = %+v", stored)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("subscriber called %d times, want 2", calls.Load())
+	}
+	if next, err := s.repo.ClaimWebhookDelivery(newLockToken(), time.Minute); err != nil || next != nil {
+		t.Errorf("dead delivery claimed again: %+v, %v", next, err)
+	}
+}
+
+func TestDeliverWebhookInactiveSubscription(t *testing.T) {
+	s := newTestService(t)
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+
+	disabled := createTestSubscription(t, s, srv.URL, false)
+	d := claimTestDelivery(t, s, disabled, 3)
+	s.deliverWebhook(context.Background(), srv.Client(), d)
+	if stored, _ := s.repo.GetWebhookDelivery(d.ID); stored.Status != model.WebhookDead || stored.LastError != "subscription disabled" {
+		t.Errorf("disabled subscription delivery = %+v", stored)
+	}
+
+	deleted := createTestSubscription(t, s, srv.URL, true)
+	d = claimTestDelivery(t, s, deleted, 3)
+	if err := s.repo.DeleteWebhookSubscription(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.deliverWebhook(context.Background(), srv.Client(), d)
+	if stored, _ := s.repo.GetWebhookDelivery(d.ID); stored.Status != model.WebhookDead || stored.LastError != "subscription deleted" {
+		t.Errorf("deleted subscription delivery = %+v", stored)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("subscriber called %d times", calls.Load())
+	}
+}
+
+func TestDeliverWebhookShutdownRequeuesWithoutCountingAttempt(t *testing.T) {
+	s := newTestService(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	sub := createTestSubscription(t, s, srv.URL, true)
+	d := claimTestDelivery(t, s, sub, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.deliverWebhook(ctx, srv.Client(), d)
+
+	stored, err := s.repo.GetWebhookDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.WebhookPending || stored.Attempts != 0 || stored.LastError != "" {
+		t.Errorf("delivery after shutdown = %+v", stored)
+	}
+}